@@ -42,10 +42,14 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		collections.GET("/:address/:token_id/image", middleware.CacheApi(svcCtx.KvStore, 60), v1.GetItemImageHandler(svcCtx))
 		// NFT销售历史价格信息
 		collections.GET("/:address/history-sales", v1.HistorySalesHandler(svcCtx))
+		// NFT地板价K线
+		collections.GET("/:address/floor-history", v1.FloorHistoryHandler(svcCtx))
 		// 获取NFT Item的owner信息
 		collections.GET("/:address/:token_id/owner", v1.ItemOwnerHandler(svcCtx))
 		// 刷新NFT Item的metadata
 		collections.POST("/:address/:token_id/metadata", v1.ItemMetadataRefreshHandler(svcCtx))
+		// 查询NFT Item的metadata刷新状态
+		collections.GET("/:address/:token_id/metadata", v1.ItemMetadataRefreshStatusHandler(svcCtx))
 
 		// 获取NFT集合排名信息
 		collections.GET("/ranking", middleware.CacheApi(svcCtx.KvStore, 60), v1.TopRankingHandler(svcCtx))
@@ -3,12 +3,14 @@ package v1
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
@@ -206,6 +208,74 @@ func ItemTopTraitPriceHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+// FloorHistoryMaxCandles 单次查询返回的最大K线数量
+const FloorHistoryMaxCandles = 1000
+
+// FloorHistoryDefaultCandles 未指定from时返回的K线数量
+const FloorHistoryDefaultCandles = 200
+
+// FloorHistoryHandler NFT集合的地板价K线
+func FloorHistoryHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionAddr := c.Params.ByName("address")
+		if collectionAddr == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		interval := c.DefaultQuery("interval", "1h")
+		seconds, ok := ordermanager.CandlePeriodSeconds(interval)
+		if !ok {
+			xzap.WithContext(c).Error("interval parse error: ", zap.String("interval", interval))
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		to := time.Now().Unix()
+		if v := c.Query("to"); v != "" {
+			if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		from := to - seconds*(FloorHistoryDefaultCandles-1)
+		if v := c.Query("from"); v != "" {
+			if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		if from > to || (to-from)/seconds >= FloorHistoryMaxCandles {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetFloorHistory(c.Request.Context(), svcCtx, chain, collectionAddr, interval, from, to)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get floor history error"))
+			return
+		}
+
+		xhttp.OkJson(c, struct {
+			Result interface{} `json:"result"`
+		}{
+			Result: res,
+		})
+	}
+}
+
 // NFT销售历史价格信息
 func HistorySalesHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -412,6 +482,43 @@ func ItemMetadataRefreshHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+// ItemMetadataRefreshStatusHandler 查询NFT Item的metadata刷新状态
+func ItemMetadataRefreshStatusHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionAddr := c.Params.ByName("address")
+		if collectionAddr == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		tokenID := c.Params.ByName("token_id")
+		if tokenID == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetItemMetadataRefreshStatus(c.Request.Context(), svcCtx, chain, collectionAddr, tokenID)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr("get item metadata refresh status error"))
+			return
+		}
+
+		xhttp.OkJson(c, types.CommonResp{Result: res})
+	}
+}
+
 // 指定Collection详情
 func CollectionDetailHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -3,23 +3,25 @@ package config
 import (
 	"strings"
 
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
-	//"github.com/ProjectsTask/EasySwapBase/image"
 	logging "github.com/ProjectsTask/EasySwapBase/logger"
+	"github.com/ProjectsTask/EasySwapBase/media"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Api        `toml:"api" json:"api"`
-	ProjectCfg *ProjectCfg     `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
-	Log        logging.LogConf `toml:"log" json:"log"`
-	//ImageCfg       *image.Config     `toml:"image_cfg" mapstructure:"image_cfg" json:"image_cfg"`
-	DB             gdb.Config        `toml:"db" json:"db"`
-	Kv             *KvConf           `toml:"kv" json:"kv"`
-	Evm            *erc.NftErc       `toml:"evm" json:"evm"`
-	MetadataParse  *MetadataParse    `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
-	ChainSupported []*ChainSupported `toml:"chain_supported" mapstructure:"chain_supported" json:"chain_supported"`
+	Api            `toml:"api" json:"api"`
+	ProjectCfg     *ProjectCfg                     `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
+	Log            logging.LogConf                 `toml:"log" json:"log"`
+	ImageCfg       *media.Config                   `toml:"image_cfg" mapstructure:"image_cfg" json:"image_cfg"`
+	DB             gdb.Config                      `toml:"db" json:"db"`
+	Kv             *KvConf                         `toml:"kv" json:"kv"`
+	Evm            *erc.NftErc                     `toml:"evm" json:"evm"`
+	MetadataParse  *MetadataParse                  `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
+	Resolver       *nftchainservice.ResolverConfig `toml:"resolver" mapstructure:"resolver" json:"resolver"`
+	ChainSupported []*ChainSupported               `toml:"chain_supported" mapstructure:"chain_supported" json:"chain_supported"`
 }
 
 type ProjectCfg struct {
@@ -46,6 +46,40 @@ func (d *Dao) QueryHistorySalesPriceInfo(ctx context.Context, chain string, coll
 	return historySalesInfo, nil
 }
 
+// QueryCollectionFloorCandles 查询指定周期在[from, to]时间段内的地板价K线，按开始时间升序
+func (d *Dao) QueryCollectionFloorCandles(ctx context.Context, chain string, collectionAddr string, period string, from, to int64) ([]multi.CollectionFloorCandle, error) {
+	var candles []multi.CollectionFloorCandle
+	if err := d.DB.WithContext(ctx).
+		Table(multi.CollectionFloorCandleTableName(chain)).
+		Where("collection_address = ? and period = ? and open_time >= ? and open_time <= ?",
+			strings.ToLower(collectionAddr), period, from, to).
+		Order("open_time asc").
+		Find(&candles).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get collection floor candles")
+	}
+
+	return candles, nil
+}
+
+// QueryLastCollectionFloorCandle 查询指定时间之前的最后一根K线，用于填充查询范围开始处的空缺，不存在时返回nil
+func (d *Dao) QueryLastCollectionFloorCandle(ctx context.Context, chain string, collectionAddr string, period string, before int64) (*multi.CollectionFloorCandle, error) {
+	var candles []multi.CollectionFloorCandle
+	if err := d.DB.WithContext(ctx).
+		Table(multi.CollectionFloorCandleTableName(chain)).
+		Where("collection_address = ? and period = ? and open_time < ?",
+			strings.ToLower(collectionAddr), period, before).
+		Order("open_time desc").
+		Limit(1).
+		Find(&candles).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get last collection floor candle")
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	return &candles[0], nil
+}
+
 // QueryAllCollectionInfo 查询指定链上的所有NFT集合信息
 func (d *Dao) QueryAllCollectionInfo(ctx context.Context, chain string) ([]multi.Collection, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -181,13 +215,13 @@ func (d *Dao) QueryMultiChainUserCollectionInfos(ctx context.Context, chainID []
 			"gc.item_amount as item_amount, " +
 			"gc.symbol as symbol, " +
 			"gc.image_uri as image_uri, " +
-			"count(*) as item_count "
+			fmt.Sprintf("sum(%s) as item_count ", heldQuantityColumn(chainName, "gi", userAddrsParam))
 		// 从Collection表和Item表联表查询
 		sqlMid += fmt.Sprintf("from %s as gc ", multi.CollectionTableName(chainName))
 		sqlMid += fmt.Sprintf("join %s as gi ", multi.ItemTableName(chainName))
 		sqlMid += "on gc.address = gi.collection_address "
 		// 过滤指定用户持有的Item
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
+		sqlMid += fmt.Sprintf("where %s ", itemHeldByCondition(chainName, "gi", userAddrsParam))
 		sqlMid += "group by gc.address"
 		sqlMid += ")"
 
@@ -254,6 +288,7 @@ func (d *Dao) QueryMultiChainUserItemInfos(ctx context.Context, chain []string,
 			"gi.token_id as token_id, " +
 			"gi.name as name, " +
 			"gi.owner as owner, " +
+			heldQuantityColumn(chainName, "gi", userAddrsParam) + " as quantity, " +
 			"sub.last_event_time as owned_time "
 		sqlMid += fmt.Sprintf("from %s gi ", multi.ItemTableName(chainName))
 
@@ -265,8 +300,8 @@ func (d *Dao) QueryMultiChainUserItemInfos(ctx context.Context, chain []string,
 			multi.ItemTableName(chainName), multi.ActivityTableName(chainName))
 		sqlMid += "on sgi.collection_address = sga.collection_address " +
 			"and sgi.token_id = sga.token_id "
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ",
-			userAddrsParam, multi.Sale)
+		sqlMid += fmt.Sprintf("where %s and sga.activity_type = %d ",
+			itemHeldByCondition(chainName, "sgi", userAddrsParam), multi.Sale)
 
 		// 如果指定了合约地址,添加合约地址过滤条件
 		if len(contractAddrs) > 0 {
@@ -281,7 +316,7 @@ func (d *Dao) QueryMultiChainUserItemInfos(ctx context.Context, chain []string,
 			"and gi.token_id = sub.token_id "
 
 		// 过滤指定用户持有的Item
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
+		sqlMid += fmt.Sprintf("where %s ", itemHeldByCondition(chainName, "gi", userAddrsParam))
 		if len(contractAddrs) > 0 {
 			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", contractAddrs[0])
 			for i := 1; i < len(contractAddrs); i++ {
@@ -348,6 +383,7 @@ func (d *Dao) QueryMultiChainUserListingItemInfos(ctx context.Context, chain []s
 		// 查询Item基本信息和最后交易时间
 		sqlMid += "select gi.chain_id as chain_id, gi.collection_address as collection_address, " +
 			"gi.token_id as token_id, gi.name as name, gi.owner as owner, " +
+			heldQuantityColumn(chainName, "gi", userAddrsParam) + " as quantity, " +
 			"sub.last_event_time as owned_time "
 		sqlMid += fmt.Sprintf("from %s gi ", multi.ItemTableName(chainName))
 		sqlMid += "left join "
@@ -359,8 +395,8 @@ func (d *Dao) QueryMultiChainUserListingItemInfos(ctx context.Context, chain []s
 		sqlMid += "on sgi.collection_address = sga.collection_address " +
 			"and sgi.token_id = sga.token_id "
 		// 过滤条件:指定用户和Sale类型活动
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ",
-			userAddrsParam, multi.Sale)
+		sqlMid += fmt.Sprintf("where %s and sga.activity_type = %d ",
+			itemHeldByCondition(chainName, "sgi", userAddrsParam), multi.Sale)
 
 		// 添加合约地址过滤
 		if len(contractAddrs) > 0 {
@@ -375,7 +411,7 @@ func (d *Dao) QueryMultiChainUserListingItemInfos(ctx context.Context, chain []s
 			"and gi.token_id = sub.token_id "
 
 		// 主查询过滤条件
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
+		sqlMid += fmt.Sprintf("where %s ", itemHeldByCondition(chainName, "gi", userAddrsParam))
 		if len(contractAddrs) > 0 {
 			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", contractAddrs[0])
 			for i := 1; i < len(contractAddrs); i++ {
@@ -434,6 +470,16 @@ func (d *Dao) QueryCollectionsListed(ctx context.Context, chain string, collecti
 	return collectionsListed, nil
 }
 
+// QueryCollectionPrice 从缓存读取集合的地板价、最高出价和价差，缓存不存在时返回false
+func (d *Dao) QueryCollectionPrice(ctx context.Context, chain string, collectionAddr string) (*ordermanager.CollectionPrice, bool, error) {
+	price, ok, err := ordermanager.GetCollectionPrice(d.KvStore, chain, collectionAddr)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed on get collection price")
+	}
+
+	return price, ok, nil
+}
+
 // CacheCollectionsListed 缓存集合的上架数量
 func (d *Dao) CacheCollectionsListed(ctx context.Context, chain string, collectionAddr string, listedCount int) error {
 	err := d.KvStore.SetInt(ordermanager.GenCollectionListedKey(chain, collectionAddr), listedCount)
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+)
+
+// itemHeldByCondition item由指定用户持有的SQL条件
+// users为SQL中的地址列表或占位符，ERC-721比较item的owner，ERC-1155查询持有者表
+func itemHeldByCondition(chain, itemAlias, users string) string {
+	return fmt.Sprintf("(%[2]s.owner in (%[3]s) or exists (select 1 from %[1]s ih "+
+		"where ih.collection_address = %[2]s.collection_address and ih.token_id = %[2]s.token_id "+
+		"and ih.owner in (%[3]s)))",
+		multi.ItemHolderTableName(chain), itemAlias, users)
+}
+
+// heldQuantityColumn 指定用户持有item数量的SQL表达式，ERC-721 item没有持有者记录，数量为1
+func heldQuantityColumn(chain, itemAlias, users string) string {
+	return fmt.Sprintf("coalesce((select sum(ih.balance) from %[1]s ih "+
+		"where ih.collection_address = %[2]s.collection_address and ih.token_id = %[2]s.token_id "+
+		"and ih.owner in (%[3]s)), 1)",
+		multi.ItemHolderTableName(chain), itemAlias, users)
+}
+
+// QueryItemHolders 查询ERC-1155 item的持有者，按持有数量倒序
+func (d *Dao) QueryItemHolders(ctx context.Context, chain, collectionAddr, tokenID string) ([]multi.ItemHolder, error) {
+	var holders []multi.ItemHolder
+	if err := d.DB.WithContext(ctx).Table(multi.ItemHolderTableName(chain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenID).
+		Order("balance desc").
+		Find(&holders).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query item holders")
+	}
+	return holders, nil
+}
@@ -137,7 +137,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 				db.Where("co.token_id =?", filter.TokenID)
 			}
 			if filter.UserAddress != "" {
-				db.Where("ci.owner =?", filter.UserAddress)
+				db.Where(itemHeldByCondition(chain, "ci", "?"), filter.UserAddress, filter.UserAddress)
 			}
 
 			db.Group("co.token_id")
@@ -167,7 +167,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 				db.Where("co.token_id =?", filter.TokenID)
 			}
 			if filter.UserAddress != "" {
-				db.Where("ci.owner =?", filter.UserAddress)
+				db.Where(itemHeldByCondition(chain, "ci", "?"), filter.UserAddress, filter.UserAddress)
 			}
 
 			db.Group("co.token_id")
@@ -210,7 +210,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 			db.Where("co.token_id =?", filter.TokenID)
 		}
 		if filter.UserAddress != "" {
-			db.Where("ci.owner =?", filter.UserAddress)
+			db.Where(itemHeldByCondition(chain, "ci", "?"), filter.UserAddress, filter.UserAddress)
 		}
 
 		db.Group("co.token_id").Having(
@@ -259,7 +259,7 @@ func (d *Dao) QueryCollectionItemOrder(ctx context.Context, chain string, filter
 			db.Where(fmt.Sprintf("ci.token_id = '%s'", filter.TokenID))
 		}
 		if filter.UserAddress != "" {
-			db.Where(fmt.Sprintf("ci.owner = '%s'", filter.UserAddress))
+			db.Where(itemHeldByCondition(chain, "ci", fmt.Sprintf("'%s'", filter.UserAddress)))
 		}
 	}
 
@@ -1208,3 +1208,20 @@ func (d *Dao) QueryItemBids(ctx context.Context, chain string, collectionAddr, t
 
 	return itemBids, count, nil
 }
+
+// QueryItemMetadataRefresh 查询item最近一次metadata刷新的状态，未请求过刷新时返回nil
+func (d *Dao) QueryItemMetadataRefresh(ctx context.Context, chain string, collectionAddr, tokenID string) (*multi.ItemMetadataRefresh, error) {
+	var refreshes []multi.ItemMetadataRefresh
+	if err := d.DB.WithContext(ctx).
+		Table(multi.ItemMetadataRefreshTableName(chain)).
+		Where("collection_address = ? and token_id = ?", strings.ToLower(collectionAddr), tokenID).
+		Limit(1).
+		Find(&refreshes).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get item metadata refresh")
+	}
+	if len(refreshes) == 0 {
+		return nil, nil
+	}
+
+	return &refreshes[0], nil
+}
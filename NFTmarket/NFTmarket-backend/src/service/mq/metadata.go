@@ -2,28 +2,21 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/metadatarefresh"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
-
-	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+	"gorm.io/gorm"
 )
 
-const CacheRefreshSingleItemMetadataKey = "cache:%s:%s:item:refresh:metadata"
-
-func GetRefreshSingleItemMetadataKey(project, chain string) string {
-	return fmt.Sprintf(CacheRefreshSingleItemMetadataKey, strings.ToLower(project), strings.ToLower(chain))
-}
-
 const CacheRefreshPreventReentrancyKeyPrefix = "cache:es:item:refresh:prevent:reentrancy:%d:%s:%s"
 const PreventReentrancyPeriod = 10 //second
 
-func AddSingleItemToRefreshMetadataQueue(kvStore *xkv.Store, project, chainName string, chainID int64, collectionAddr, tokenID string) error {
+// AddSingleItemToRefreshMetadataQueue 将item标记为等待刷新并加入刷新队列，由同步服务的metadata刷新消费
+func AddSingleItemToRefreshMetadataQueue(kvStore *xkv.Store, db *gorm.DB, project, chainName string, chainID int64, collectionAddr, tokenID string) error {
 	isRefreshed, err := kvStore.Get(fmt.Sprintf(CacheRefreshPreventReentrancyKeyPrefix, chainID, collectionAddr, tokenID))
 	if err != nil {
 		return errors.Wrap(err, "failed on check reentrancy status")
@@ -34,20 +27,18 @@ func AddSingleItemToRefreshMetadataQueue(kvStore *xkv.Store, project, chainName
 		return nil
 	}
 
-	item := types.RefreshItem{
+	// 先标记再入队，避免刷新完成后状态被覆盖为pending
+	if err := metadatarefresh.MarkPending(context.Background(), db, chainName, collectionAddr, tokenID); err != nil {
+		return err
+	}
+
+	item := metadatarefresh.RefreshItem{
 		ChainID:        chainID,
 		CollectionAddr: collectionAddr,
 		TokenID:        tokenID,
 	}
-
-	rawInfo, err := json.Marshal(&item)
-	if err != nil {
-		return errors.Wrap(err, "failed on marshal item info")
-	}
-
-	_, err = kvStore.Sadd(GetRefreshSingleItemMetadataKey(project, chainName), string(rawInfo))
-	if err != nil {
-		return errors.Wrap(err, "failed on push item to refresh metadata queue")
+	if _, err := metadatarefresh.AddToQueue(context.Background(), kvStore, project, chainName, &item); err != nil {
+		return err
 	}
 
 	_ = kvStore.Setex(fmt.Sprintf(CacheRefreshPreventReentrancyKeyPrefix, chainID, collectionAddr, tokenID), "true", PreventReentrancyPeriod)
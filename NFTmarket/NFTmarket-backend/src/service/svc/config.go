@@ -2,7 +2,7 @@ package svc
 
 import (
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
-	//"github.com/ProjectsTask/EasySwapBase/image"
+	"github.com/ProjectsTask/EasySwapBase/media"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"gorm.io/gorm"
 
@@ -10,11 +10,11 @@ import (
 )
 
 type CtxConfig struct {
-	db *gorm.DB
-	//imageMgr image.ImageManager
-	dao     *dao.Dao
-	KvStore *xkv.Store
-	Evm     erc.Erc
+	db       *gorm.DB
+	imageMgr *media.Manager
+	dao      *dao.Dao
+	KvStore  *xkv.Store
+	Evm      erc.Erc
 }
 
 type CtxOption func(conf *CtxConfig)
@@ -25,10 +25,10 @@ func NewServerCtx(options ...CtxOption) *ServerCtx {
 		opt(c)
 	}
 	return &ServerCtx{
-		DB: c.db,
-		//ImageMgr: c.imageMgr,
-		KvStore: c.KvStore,
-		Dao:     c.dao,
+		DB:       c.db,
+		ImageMgr: c.imageMgr,
+		KvStore:  c.KvStore,
+		Dao:      c.dao,
 	}
 }
 
@@ -44,6 +44,12 @@ func WithDB(db *gorm.DB) CtxOption {
 	}
 }
 
+func WithImageMgr(imageMgr *media.Manager) CtxOption {
+	return func(conf *CtxConfig) {
+		conf.imageMgr = imageMgr
+	}
+}
+
 func WithDao(dao *dao.Dao) CtxOption {
 	return func(conf *CtxConfig) {
 		conf.dao = dao
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/media"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
@@ -18,9 +19,9 @@ import (
 )
 
 type ServerCtx struct {
-	C  *config.Config
-	DB *gorm.DB
-	//ImageMgr image.ImageManager
+	C        *config.Config
+	DB       *gorm.DB
+	ImageMgr *media.Manager // 未配置图片存储时为nil
 	Dao      *dao.Dao
 	KvStore  *xkv.Store
 	RankKey  string
@@ -29,10 +30,13 @@ type ServerCtx struct {
 
 func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 	var err error
-	//imageMgr, err = image.NewManager(c.ImageCfg)
-	//if err != nil {
-	//	return nil, errors.Wrap(err, "failed on create image manager")
-	//}
+	var imageMgr *media.Manager
+	if c.ImageCfg != nil && c.ImageCfg.Type != "" {
+		imageMgr, err = media.NewManager(c.ImageCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on create image manager")
+		}
+	}
 
 	// Log
 	_, err = xzap.SetUp(c.Log)
@@ -69,13 +73,18 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "failed on start onchain sync service")
 		}
+		if c.Resolver != nil {
+			if err := nodeSrvs[int64(supported.ChainID)].SetResolverConfig(c.Resolver); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	dao := dao.New(context.Background(), db, store)
 	serverCtx := NewServerCtx(
 		WithDB(db),
 		WithKv(store),
-		//WithImageMgr(imageMgr),
+		WithImageMgr(imageMgr),
 		WithDao(dao),
 	)
 	serverCtx.C = c
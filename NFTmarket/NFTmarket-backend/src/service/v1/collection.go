@@ -564,8 +564,86 @@ func GetHistorySalesPrice(ctx context.Context, svcCtx *svc.ServerCtx, chain, col
 	return res, nil
 }
 
+// GetFloorHistory 获取NFT集合的地板价K线，[from, to]按周期对齐，没有事件的周期用上一周期的收盘价填充
+func GetFloorHistory(ctx context.Context, svcCtx *svc.ServerCtx, chain, collectionAddr, interval string, from, to int64) ([]types.FloorCandle, error) {
+	seconds, ok := ordermanager.CandlePeriodSeconds(interval)
+	if !ok {
+		return nil, errors.Errorf("unsupported interval: %s", interval)
+	}
+	from -= from % seconds
+	to -= to % seconds
+
+	candles, err := svcCtx.Dao.QueryCollectionFloorCandles(ctx, chain, collectionAddr, interval, from, to)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get collection floor candles")
+	}
+	last, err := svcCtx.Dao.QueryLastCollectionFloorCandle(ctx, chain, collectionAddr, interval, from)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get last collection floor candle")
+	}
+
+	var prev *types.FloorCandle
+	if last != nil {
+		prev = &types.FloorCandle{Close: last.Close, ListedCount: last.ListedCount}
+	}
+	res := make([]types.FloorCandle, 0, (to-from)/seconds+1)
+	for openTime, i := from, 0; openTime <= to; openTime += seconds {
+		if i < len(candles) && candles[i].OpenTime == openTime {
+			c := candles[i]
+			i++
+			res = append(res, types.FloorCandle{
+				OpenTime:    c.OpenTime,
+				Open:        c.Open,
+				High:        c.High,
+				Low:         c.Low,
+				Close:       c.Close,
+				ListedCount: c.ListedCount,
+				Volume:      c.Volume,
+				Sales:       c.Sales,
+			})
+			prev = &res[len(res)-1]
+			continue
+		}
+		// 查询范围开始之前没有K线时不填充
+		if prev == nil {
+			continue
+		}
+		res = append(res, types.FloorCandle{
+			OpenTime:    openTime,
+			Open:        prev.Close,
+			High:        prev.Close,
+			Low:         prev.Close,
+			Close:       prev.Close,
+			ListedCount: prev.ListedCount,
+		})
+		prev = &res[len(res)-1]
+	}
+
+	return res, nil
+}
+
 // GetItemOwner 获取NFT Item的所有者信息
 func GetItemOwner(ctx context.Context, svcCtx *svc.ServerCtx, chainID int64, chain, collectionAddr, tokenID string) (*types.ItemOwner, error) {
+	// ERC-1155没有唯一的owner，返回索引的持有者列表
+	if svcCtx.NodeSrvs[chainID].TokenStandard(collectionAddr) == multi.TokenStandardERC1155 {
+		holders, err := svcCtx.Dao.QueryItemHolders(ctx, chain, collectionAddr, tokenID)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on query item holders", zap.Error(err))
+			return nil, errcode.ErrUnexpected
+		}
+		itemOwner := &types.ItemOwner{
+			CollectionAddress: collectionAddr,
+			TokenID:           tokenID,
+		}
+		for _, holder := range holders {
+			itemOwner.Holders = append(itemOwner.Holders, types.ItemHolding{
+				Owner:    holder.Owner,
+				Quantity: holder.Balance.IntPart(),
+			})
+		}
+		return itemOwner, nil
+	}
+
 	// 从链上获取NFT所有者地址
 	address, err := svcCtx.NodeSrvs[chainID].FetchNftOwner(collectionAddr, tokenID)
 	if err != nil {
@@ -726,10 +804,25 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 		xzap.WithContext(ctx).Error("failed on get floor price", zap.Error(err))
 	}
 
-	// 查询卖单价格
-	collectionSell, err := svcCtx.Dao.QueryCollectionSellPrice(ctx, chain, collectionAddr)
+	// 查询最高出价和价差，优先读取OrderManager维护的缓存
+	var sellPrice, bestItemBid, spread decimal.Decimal
+	price, ok, err := svcCtx.Dao.QueryCollectionPrice(ctx, chain, collectionAddr)
 	if err != nil {
-		xzap.WithContext(ctx).Error("failed on get floor price", zap.Error(err))
+		xzap.WithContext(ctx).Error("failed on get collection price", zap.Error(err))
+	}
+	if ok {
+		sellPrice, bestItemBid, spread = price.BestBid, price.BestItemBid, price.Spread
+	} else {
+		// 缓存不存在时查询卖单价格
+		collectionSell, err := svcCtx.Dao.QueryCollectionSellPrice(ctx, chain, collectionAddr)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get floor price", zap.Error(err))
+		} else {
+			sellPrice = collectionSell.SalePrice
+		}
+		if !floorPrice.IsZero() && !sellPrice.IsZero() {
+			spread = floorPrice.Sub(sellPrice)
+		}
 	}
 
 	// 如果地板价发生变化,更新价格事件
@@ -767,7 +860,9 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 		Address:     collection.Address,
 		ChainId:     collection.ChainId,
 		FloorPrice:  floorPrice,
-		SellPrice:   collectionSell.SalePrice.String(),
+		SellPrice:   sellPrice.String(),
+		BestItemBid: bestItemBid.String(),
+		Spread:      spread.String(),
 		VolumeTotal: allVol,
 		Volume24h:   volume24h,
 		Sold24h:     sold,
@@ -783,7 +878,7 @@ func GetCollectionDetail(ctx context.Context, svcCtx *svc.ServerCtx, chain strin
 
 // RefreshItemMetadata refresh item meta data.
 func RefreshItemMetadata(ctx context.Context, svcCtx *svc.ServerCtx, chainName string, chainId int64, collectionAddress, tokenId string) error {
-	if err := mq.AddSingleItemToRefreshMetadataQueue(svcCtx.KvStore, svcCtx.C.ProjectCfg.Name, chainName, chainId, collectionAddress, tokenId); err != nil {
+	if err := mq.AddSingleItemToRefreshMetadataQueue(svcCtx.KvStore, svcCtx.Dao.DB, svcCtx.C.ProjectCfg.Name, chainName, chainId, collectionAddress, tokenId); err != nil {
 		xzap.WithContext(ctx).Error("failed on add item to refresh queue", zap.Error(err), zap.String("collection address: ", collectionAddress), zap.String("item_id", tokenId))
 		return errcode.ErrUnexpected
 	}
@@ -792,17 +887,50 @@ func RefreshItemMetadata(ctx context.Context, svcCtx *svc.ServerCtx, chainName s
 
 }
 
+// metadata刷新状态的名称
+var metadataRefreshStatus = map[int]string{
+	multi.MetadataRefreshPending: "pending",
+	multi.MetadataRefreshDone:    "done",
+	multi.MetadataRefreshFailed:  "failed",
+}
+
+// GetItemMetadataRefreshStatus 获取NFT Item最近一次metadata刷新的状态
+func GetItemMetadataRefreshStatus(ctx context.Context, svcCtx *svc.ServerCtx, chain string, collectionAddress, tokenId string) (*types.ItemMetadataRefreshStatus, error) {
+	refresh, err := svcCtx.Dao.QueryItemMetadataRefresh(ctx, chain, collectionAddress, tokenId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get item metadata refresh")
+	}
+
+	status := types.ItemMetadataRefreshStatus{
+		CollectionAddress: collectionAddress,
+		TokenID:           tokenId,
+		Status:            "none",
+	}
+	if refresh != nil {
+		status.Status = metadataRefreshStatus[refresh.Status]
+		status.Reason = refresh.Reason
+		status.RequestTime = refresh.RequestTime
+		status.RefreshTime = refresh.RefreshTime
+	}
+
+	return &status, nil
+}
+
 // 获取NFT Item的图片信息
 func GetItemImage(ctx context.Context, svcCtx *svc.ServerCtx, chain string, collectionAddress, tokenId string) (*types.ItemImage, error) {
 	items, err := svcCtx.Dao.QueryCollectionItemsImage(ctx, chain, collectionAddress, []string{tokenId})
 	if err != nil || len(items) == 0 {
 		return nil, errors.Wrap(err, "failed on get item image")
 	}
+	// 已上传的图片返回最小尺寸的缩略图，未上传时返回原始地址
 	var imageUri string
 	if items[0].IsUploadedOss {
-		imageUri = items[0].OssUri // svcCtx.ImageMgr.GetSmallSizeImageUrl(items[0].OssUri)
+		imageUri = items[0].OssUri
+		if svcCtx.ImageMgr != nil {
+			imageUri = svcCtx.ImageMgr.GetSmallSizeImageUrl(imageUri)
+		}
 	} else {
-		imageUri = items[0].ImageUri // svcCtx.ImageMgr.GetSmallSizeImageUrl(items[0].ImageUri)
+		imageUri = items[0].ImageUri
 	}
 
 	return &types.ItemImage{
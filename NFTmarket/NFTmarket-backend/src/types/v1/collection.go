@@ -39,6 +39,18 @@ type HistorySalesPriceInfo struct {
 	TimeStamp int64           `json:"time_stamp"`
 }
 
+// FloorCandle 地板价K线，没有事件的周期沿用上一周期的收盘价和上架数量
+type FloorCandle struct {
+	OpenTime    int64           `json:"open_time"`
+	Open        decimal.Decimal `json:"open"`
+	High        decimal.Decimal `json:"high"`
+	Low         decimal.Decimal `json:"low"`
+	Close       decimal.Decimal `json:"close"`
+	ListedCount int64           `json:"listed_count"`
+	Volume      decimal.Decimal `json:"volume"`
+	Sales       int64           `json:"sales"`
+}
+
 type TopTraitFilterParams struct {
 	TokenIds []string `json:"token_ids"`
 	ChainID  int      `json:"chain_id"`
@@ -113,6 +125,8 @@ type CollectionDetail struct {
 	ChainId        int             `json:"chain_id"`
 	FloorPrice     decimal.Decimal `json:"floor_price"`
 	SellPrice      string          `json:"sell_price"`
+	BestItemBid    string          `json:"best_item_bid"`
+	Spread         string          `json:"spread"`
 	VolumeTotal    decimal.Decimal `json:"volume_total"`
 	Volume24h      decimal.Decimal `json:"volume_24h"`
 	Sold24h        int64           `json:"sold_24h"`
@@ -130,12 +144,6 @@ type CommonResp struct {
 	Result interface{} `json:"result"`
 }
 
-type RefreshItem struct {
-	ChainID        int64  `json:"chain_id"`
-	CollectionAddr string `json:"collection_addr"`
-	TokenID        string `json:"token_id"`
-}
-
 type CollectionListed struct {
 	CollectionAddr string `json:"collection_address"`
 	Count          int    `json:"count"`
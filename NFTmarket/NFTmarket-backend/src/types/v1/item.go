@@ -16,9 +16,26 @@ type ItemPriceInfo struct {
 }
 
 type ItemOwner struct {
+	CollectionAddress string        `json:"collection_address"`
+	TokenID           string        `json:"token_id"`
+	Owner             string        `json:"owner"`             // ERC-721的owner，ERC-1155为空
+	Holders           []ItemHolding `json:"holders,omitempty"` // ERC-1155的持有者
+}
+
+// ItemHolding ERC-1155 item的持有者和持有数量
+type ItemHolding struct {
+	Owner    string `json:"owner"`
+	Quantity int64  `json:"quantity"`
+}
+
+// ItemMetadataRefreshStatus item最近一次metadata刷新的状态
+type ItemMetadataRefreshStatus struct {
 	CollectionAddress string `json:"collection_address"`
 	TokenID           string `json:"token_id"`
-	Owner             string `json:"owner"`
+	Status            string `json:"status"` // none(未请求过刷新)、pending、done或failed
+	Reason            string `json:"reason"` // 失败原因
+	RequestTime       int64  `json:"request_time"`
+	RefreshTime       int64  `json:"refresh_time"`
 }
 
 type ItemImage struct {
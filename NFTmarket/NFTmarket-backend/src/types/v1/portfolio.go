@@ -83,6 +83,7 @@ type PortfolioItemInfo struct {
 	LastCostPrice float64         `json:"last_cost_price"`
 	OwnedTime     int64           `json:"owned_time"`
 	Owner         string          `json:"owner"`
+	Quantity      int64           `json:"quantity"` // 持有数量，ERC-721为1
 	Listing       bool            `json:"listing"`
 	MarketplaceID int             `json:"marketplace_id"`
 	Name          string          `json:"name"`
@@ -6,24 +6,50 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/pkg/errors"
 
 	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
 )
 
+// 订阅通道的缓冲大小
+const SubscribeBuffer = 128
+
+var ErrSubscribeNotSupported = errors.New("websocket url not configured")
+
 type Service struct {
 	client *ethclient.Client
+	rpc    xhttp.RPCClient // 批量请求使用的JSON-RPC客户端
+	wsUrl  string          // 订阅使用的websocket地址
+}
+
+// rpcHeader eth_getBlockByNumber返回的区块头字段
+type rpcHeader struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       string         `json:"hash"`
+	ParentHash string         `json:"parentHash"`
+	Time       hexutil.Uint64 `json:"timestamp"`
 }
 
 // 创建以太坊客户端
 func New(nodeUrl string) (*Service, error) {
+	return NewWithWs(nodeUrl, "")
+}
+
+// 创建支持websocket订阅的以太坊客户端，wsUrl为空时不支持订阅
+func NewWithWs(nodeUrl, wsUrl string) (*Service, error) {
 	client, err := ethclient.Dial(nodeUrl)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on create client")
 	}
 	return &Service{
 		client: client,
+		rpc:    xhttp.NewRPCClient(nodeUrl),
+		wsUrl:  wsUrl,
 	}, nil
 }
 
@@ -34,6 +60,21 @@ func (s *Service) Client() interface{} {
 
 // 查询事件
 func (s *Service) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
+	logs, err := s.client.FilterLogs(ctx, toEthQuery(q))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get events")
+	}
+	// 收集事件
+	var logEvents []interface{}
+	for _, log := range logs {
+		logEvents = append(logEvents, log)
+	}
+	// 返回
+	return logEvents, nil
+}
+
+// 转换为以太坊的查询条件
+func toEthQuery(q logTypes.FilterQuery) ethereum.FilterQuery {
 	// 收集合约地址
 	var addresses []common.Address
 	for _, addr := range q.Addresses {
@@ -48,24 +89,77 @@ func (s *Service) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]int
 		}
 		topicsHash = append(topicsHash, topicHash)
 	}
-	// 查询事件
-	queryParam := ethereum.FilterQuery{
+	return ethereum.FilterQuery{
 		FromBlock: q.FromBlock,
 		ToBlock:   q.ToBlock,
 		Addresses: addresses,
 		Topics:    topicsHash,
 	}
-	logs, err := s.client.FilterLogs(ctx, queryParam)
+}
+
+// 通过websocket订阅新区块头和日志，任一订阅断开时关闭连接并通过Err()返回错误
+func (s *Service) Subscribe(ctx context.Context, q logTypes.FilterQuery, heads chan<- *logTypes.BlockHeader, logs chan<- interface{}) (ethereum.Subscription, error) {
+	if s.wsUrl == "" {
+		return nil, ErrSubscribeNotSupported
+	}
+	client, err := ethclient.DialContext(ctx, s.wsUrl)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed on get events")
+		return nil, errors.Wrap(err, "failed on dial websocket")
 	}
-	// 收集事件
-	var logEvents []interface{}
-	for _, log := range logs {
-		logEvents = append(logEvents, log)
+	rawHeads := make(chan *types.Header, SubscribeBuffer)
+	headSub, err := client.SubscribeNewHead(ctx, rawHeads)
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "failed on subscribe new heads")
 	}
-	// 返回
-	return logEvents, nil
+	rawLogs := make(chan types.Log, SubscribeBuffer)
+	logSub, err := client.SubscribeFilterLogs(ctx, toEthQuery(q), rawLogs)
+	if err != nil {
+		headSub.Unsubscribe()
+		client.Close()
+		return nil, errors.Wrap(err, "failed on subscribe logs")
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer client.Close()
+		defer headSub.Unsubscribe()
+		defer logSub.Unsubscribe()
+		for {
+			select {
+			case <-quit:
+				return nil
+			case err := <-headSub.Err():
+				return errors.Wrap(subscriptionErr(err), "new heads subscription dropped")
+			case err := <-logSub.Err():
+				return errors.Wrap(subscriptionErr(err), "logs subscription dropped")
+			case header := <-rawHeads:
+				select {
+				case heads <- &logTypes.BlockHeader{
+					Number:     header.Number.Uint64(),
+					Hash:       header.Hash().String(),
+					ParentHash: header.ParentHash.String(),
+					Time:       header.Time,
+				}:
+				case <-quit:
+					return nil
+				}
+			case log := <-rawLogs:
+				select {
+				case logs <- log:
+				case <-quit:
+					return nil
+				}
+			}
+		}
+	}), nil
+}
+
+// 订阅被服务端关闭时Err()返回nil
+func subscriptionErr(err error) error {
+	if err == nil {
+		return errors.New("subscription closed")
+	}
+	return err
 }
 
 // 获取指定区块事件
@@ -78,6 +172,62 @@ func (s *Service) BlockTimeByNumber(ctx context.Context, blockNum *big.Int) (uin
 	return header.Time, nil
 }
 
+// 获取指定区块头
+func (s *Service) BlockHeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error) {
+	header, err := s.client.HeaderByNumber(ctx, blockNum)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+
+	return &logTypes.BlockHeader{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash().String(),
+		ParentHash: header.ParentHash.String(),
+		Time:       header.Time,
+	}, nil
+}
+
+// 批量获取区块头，返回顺序与blockNums一致，任一区块获取失败时返回错误
+func (s *Service) BlockHeadersByNumbers(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error) {
+	if len(blockNums) == 0 {
+		return nil, nil
+	}
+	requests := make(xhttp.RPCRequests, 0, len(blockNums))
+	for i, blockNum := range blockNums {
+		request := xhttp.NewRPCRequest("eth_getBlockByNumber", hexutil.EncodeUint64(blockNum), false)
+		request.ID = i
+		requests = append(requests, request)
+	}
+	responses, err := s.rpc.CallBatch(requests)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block headers")
+	}
+
+	byID := responses.AsMap()
+	headers := make([]*logTypes.BlockHeader, len(blockNums))
+	for i, blockNum := range blockNums {
+		response, ok := byID[i]
+		if !ok {
+			return nil, errors.Errorf("block header %d missing in batch response", blockNum)
+		}
+		var header *rpcHeader
+		if err := response.ReadToObject(&header); err != nil {
+			return nil, errors.Wrapf(err, "failed on decode block header %d", blockNum)
+		}
+		if header == nil || uint64(header.Number) != blockNum {
+			return nil, errors.Errorf("block header %d not found", blockNum)
+		}
+		headers[i] = &logTypes.BlockHeader{
+			Number:     uint64(header.Number),
+			Hash:       header.Hash,
+			ParentHash: header.ParentHash,
+			Time:       uint64(header.Time),
+		}
+	}
+
+	return headers, nil
+}
+
 func (s *Service) CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error) {
 	return s.CallContract(ctx, param.EVMParam, param.BlockNumber)
 }
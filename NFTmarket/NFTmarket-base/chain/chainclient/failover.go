@@ -0,0 +1,392 @@
+package chainclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/pkg/errors"
+
+	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/retry"
+)
+
+const (
+	FailoverRetryLimit = 3
+	FailoverCooldown   = 30 * time.Second // 连续失败的节点暂停使用的时间
+	// 连续失败达到该次数后节点进入冷却期
+	FailoverCooldownThreshold = 3
+	// 健康分和延迟的指数移动平均系数
+	healthAlpha = 0.3
+)
+
+var failoverRetryWait = []time.Duration{200 * time.Millisecond, 500 * time.Millisecond, time.Second}
+
+// 请求本身导致的错误，换节点重试也不会成功，不影响节点健康分
+var permanentErrors = []string{
+	"execution reverted",
+	"query returned more than",
+	"block range",
+	"response size",
+	"invalid argument",
+}
+
+// Endpoint 节点配置
+type Endpoint struct {
+	Url   string  `toml:"url" mapstructure:"url" json:"url"`
+	Rate  float64 `toml:"rate" mapstructure:"rate" json:"rate"`    // 每秒请求数上限，0表示不限制
+	Burst int     `toml:"burst" mapstructure:"burst" json:"burst"` // 突发请求数
+	// websocket地址，用于订阅新区块和日志，为空时该节点不支持订阅
+	WsUrl string `toml:"ws_url" mapstructure:"ws_url" json:"ws_url"`
+}
+
+// EndpointStats 节点的健康状态和请求统计
+type EndpointStats struct {
+	Endpoint          string        `json:"endpoint"`
+	Score             float64       `json:"score"`
+	Latency           time.Duration `json:"latency"`
+	Requests          uint64        `json:"requests"`
+	Errors            uint64        `json:"errors"`
+	ConsecutiveErrors int           `json:"consecutive_errors"`
+	LastError         string        `json:"last_error"`
+	CooldownUntil     time.Time     `json:"cooldown_until"`
+}
+
+// FailoverClient 多节点的ChainClient，按健康分选择节点，失败时切换节点重试，每个节点独立限流
+type FailoverClient struct {
+	chain      string
+	endpoints  []*endpoint
+	retryLimit uint
+	retryWait  []time.Duration
+}
+
+type endpoint struct {
+	index   int
+	name    string // 不含api key的节点名，用于日志和监控
+	client  ChainClient
+	limiter *tokenBucket
+
+	mu                sync.Mutex
+	score             float64
+	latency           time.Duration
+	requests          uint64
+	errors            uint64
+	consecutiveErrors int
+	lastError         string
+	cooldownUntil     time.Time
+}
+
+// NewFailover 创建多节点的ChainClient
+func NewFailover(chainID int, chain string, endpoints []Endpoint) (*FailoverClient, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoint configured")
+	}
+	clients := make([]ChainClient, 0, len(endpoints))
+	for _, e := range endpoints {
+		client, err := NewWithWs(chainID, e.Url, e.WsUrl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on create client for %s", endpointName(0, e.Url))
+		}
+		clients = append(clients, client)
+	}
+	return newFailover(chain, clients, endpoints), nil
+}
+
+func newFailover(chain string, clients []ChainClient, endpoints []Endpoint) *FailoverClient {
+	c := &FailoverClient{
+		chain:      chain,
+		retryLimit: FailoverRetryLimit,
+		retryWait:  failoverRetryWait,
+	}
+	if n := uint(len(clients)) + 1; n > c.retryLimit {
+		c.retryLimit = n
+	}
+	for i, client := range clients {
+		e := &endpoint{
+			index:   i,
+			name:    endpointName(i, endpoints[i].Url),
+			client:  client,
+			limiter: newTokenBucket(endpoints[i].Rate, endpoints[i].Burst),
+			score:   1,
+		}
+		endpointHealth.WithLabelValues(chain, e.name).Set(e.score)
+		c.endpoints = append(c.endpoints, e)
+	}
+	return c
+}
+
+// endpointName 节点url中可能包含api key，只保留序号和host
+func endpointName(index int, rawUrl string) string {
+	host := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return fmt.Sprintf("%d-%s", index, host)
+}
+
+func isPermanentError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range permanentErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// pick 选择本次请求的节点：优先未尝试过、不在冷却期、健康分高的节点，
+// 有可用令牌的节点优先，都没有令牌时等待最优节点的令牌
+func (c *FailoverClient) pick(ctx context.Context, tried map[*endpoint]bool) (*endpoint, error) {
+	now := time.Now()
+	type candidate struct {
+		e        *endpoint
+		tried    bool
+		cooldown bool
+		score    float64
+	}
+	candidates := make([]candidate, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		e.mu.Lock()
+		candidates = append(candidates, candidate{
+			e:        e,
+			tried:    tried[e],
+			cooldown: now.Before(e.cooldownUntil),
+			score:    e.score,
+		})
+		e.mu.Unlock()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.tried != b.tried {
+			return !a.tried
+		}
+		if a.cooldown != b.cooldown {
+			return !a.cooldown
+		}
+		return a.score > b.score
+	})
+
+	best := candidates[0]
+	for _, cand := range candidates {
+		if cand.tried != best.tried || cand.cooldown != best.cooldown {
+			break
+		}
+		if cand.e.limiter.allow(now) {
+			return cand.e, nil
+		}
+	}
+	if wait := best.e.limiter.reserve(now); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return best.e, nil
+}
+
+// record 记录请求结果，healthy为false时降低节点健康分
+func (e *endpoint) record(chain, method string, elapsed time.Duration, err error, healthy bool) {
+	requestDuration.WithLabelValues(chain, e.name, method).Observe(elapsed.Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(chain, e.name, method).Inc()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests++
+	if e.latency == 0 {
+		e.latency = elapsed
+	} else {
+		e.latency = time.Duration((1-healthAlpha)*float64(e.latency) + healthAlpha*float64(elapsed))
+	}
+	if healthy {
+		e.score = (1-healthAlpha)*e.score + healthAlpha
+		e.consecutiveErrors = 0
+	} else {
+		e.score = (1 - healthAlpha) * e.score
+		e.errors++
+		e.consecutiveErrors++
+		e.lastError = err.Error()
+		if e.consecutiveErrors >= FailoverCooldownThreshold {
+			e.cooldownUntil = time.Now().Add(FailoverCooldown)
+		}
+	}
+	endpointHealth.WithLabelValues(chain, e.name).Set(e.score)
+}
+
+// do 在选中的节点上执行请求，失败时按retry策略切换节点重试
+func (c *FailoverClient) do(ctx context.Context, method string, fn func(client ChainClient) error) error {
+	tried := make(map[*endpoint]bool)
+	var final error
+	err := retry.Retry(func(attempt uint) error {
+		if err := ctx.Err(); err != nil {
+			final = err
+			return nil
+		}
+		e, err := c.pick(ctx, tried)
+		if err != nil {
+			final = err
+			return nil
+		}
+		// 所有节点都尝试过后重新按健康分选择
+		tried[e] = true
+		if len(tried) == len(c.endpoints) {
+			tried = make(map[*endpoint]bool)
+		}
+
+		start := time.Now()
+		err = fn(e.client)
+		elapsed := time.Since(start)
+		if err != nil && isPermanentError(err) {
+			e.record(c.chain, method, elapsed, err, true)
+			final = err
+			return nil
+		}
+		e.record(c.chain, method, elapsed, err, err == nil)
+		if err != nil {
+			return errors.Wrapf(err, "endpoint %s", e.name)
+		}
+		return nil
+	}, retry.Limit(c.retryLimit), retry.Wait(c.retryWait...))
+	if final != nil {
+		return final
+	}
+	return err
+}
+
+// Stats 返回所有节点的健康状态和请求统计
+func (c *FailoverClient) Stats() []EndpointStats {
+	stats := make([]EndpointStats, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		e.mu.Lock()
+		stats = append(stats, EndpointStats{
+			Endpoint:          e.name,
+			Score:             e.score,
+			Latency:           e.latency,
+			Requests:          e.requests,
+			Errors:            e.errors,
+			ConsecutiveErrors: e.consecutiveErrors,
+			LastError:         e.lastError,
+			CooldownUntil:     e.cooldownUntil,
+		})
+		e.mu.Unlock()
+	}
+	return stats
+}
+
+func (c *FailoverClient) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
+	var logs []interface{}
+	err := c.do(ctx, "FilterLogs", func(client ChainClient) error {
+		var err error
+		logs, err = client.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+func (c *FailoverClient) BlockTimeByNumber(ctx context.Context, blockNum *big.Int) (uint64, error) {
+	var blockTime uint64
+	err := c.do(ctx, "BlockTimeByNumber", func(client ChainClient) error {
+		var err error
+		blockTime, err = client.BlockTimeByNumber(ctx, blockNum)
+		return err
+	})
+	return blockTime, err
+}
+
+func (c *FailoverClient) BlockHeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error) {
+	var header *logTypes.BlockHeader
+	err := c.do(ctx, "BlockHeaderByNumber", func(client ChainClient) error {
+		var err error
+		header, err = client.BlockHeaderByNumber(ctx, blockNum)
+		return err
+	})
+	return header, err
+}
+
+func (c *FailoverClient) BlockHeadersByNumbers(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error) {
+	var headers []*logTypes.BlockHeader
+	err := c.do(ctx, "BlockHeadersByNumbers", func(client ChainClient) error {
+		var err error
+		headers, err = client.BlockHeadersByNumbers(ctx, blockNums)
+		return err
+	})
+	return headers, err
+}
+
+// Subscribe 按健康分依次尝试在节点上建立订阅，订阅断开后由调用方重新订阅
+func (c *FailoverClient) Subscribe(ctx context.Context, q logTypes.FilterQuery, heads chan<- *logTypes.BlockHeader, logs chan<- interface{}) (ethereum.Subscription, error) {
+	endpoints := make([]*endpoint, len(c.endpoints))
+	copy(endpoints, c.endpoints)
+	scores := make(map[*endpoint]float64, len(endpoints))
+	for _, e := range endpoints {
+		e.mu.Lock()
+		scores[e] = e.score
+		e.mu.Unlock()
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return scores[endpoints[i]] > scores[endpoints[j]]
+	})
+
+	var lastErr error
+	for _, e := range endpoints {
+		sub, err := e.client.Subscribe(ctx, q, heads, logs)
+		if err == nil {
+			return sub, nil
+		}
+		lastErr = errors.Wrapf(err, "endpoint %s", e.name)
+	}
+	return nil, lastErr
+}
+
+// Client 返回第一个节点的底层客户端
+func (c *FailoverClient) Client() interface{} {
+	return c.endpoints[0].client.Client()
+}
+
+func (c *FailoverClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var data []byte
+	err := c.do(ctx, "CallContract", func(client ChainClient) error {
+		var err error
+		data, err = client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return data, err
+}
+
+func (c *FailoverClient) CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error) {
+	var result interface{}
+	err := c.do(ctx, "CallContractByChain", func(client ChainClient) error {
+		var err error
+		result, err = client.CallContractByChain(ctx, param)
+		return err
+	})
+	return result, err
+}
+
+func (c *FailoverClient) BlockNumber() (uint64, error) {
+	var blockNum uint64
+	err := c.do(context.Background(), "BlockNumber", func(client ChainClient) error {
+		var err error
+		blockNum, err = client.BlockNumber()
+		return err
+	})
+	return blockNum, err
+}
+
+func (c *FailoverClient) BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error) {
+	var block interface{}
+	err := c.do(ctx, "BlockWithTxs", func(client ChainClient) error {
+		var err error
+		block, err = client.BlockWithTxs(ctx, blockNumber)
+		return err
+	})
+	return block, err
+}
@@ -0,0 +1,105 @@
+package chainclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient 返回固定区块高度或错误的节点
+type fakeClient struct {
+	ChainClient
+	blockNum uint64
+	err      error
+	calls    int
+}
+
+func (f *fakeClient) BlockNumber() (uint64, error) {
+	f.calls++
+	return f.blockNum, f.err
+}
+
+func newTestFailover(clients ...*fakeClient) *FailoverClient {
+	var chainClients []ChainClient
+	var endpoints []Endpoint
+	for _, client := range clients {
+		chainClients = append(chainClients, client)
+		endpoints = append(endpoints, Endpoint{Url: "https://node.example.com/key"})
+	}
+	c := newFailover("test", chainClients, endpoints)
+	c.retryWait = nil
+	return c
+}
+
+func TestFailoverSwitchEndpoint(t *testing.T) {
+	bad := &fakeClient{err: errors.New("connection refused")}
+	good := &fakeClient{blockNum: 100}
+	c := newTestFailover(bad, good)
+
+	blockNum, err := c.BlockNumber()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), blockNum)
+	assert.Equal(t, 1, bad.calls)
+
+	stats := c.Stats()
+	assert.Equal(t, "0-node.example.com", stats[0].Endpoint)
+	assert.Equal(t, uint64(1), stats[0].Errors)
+	assert.Less(t, stats[0].Score, stats[1].Score)
+}
+
+func TestFailoverCooldown(t *testing.T) {
+	bad := &fakeClient{err: errors.New("connection refused")}
+	good := &fakeClient{blockNum: 100}
+	c := newTestFailover(bad, good)
+
+	for i := 0; i < FailoverCooldownThreshold; i++ {
+		c.endpoints[0].record("test", "BlockNumber", time.Millisecond, bad.err, false)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := c.BlockNumber()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, bad.calls)
+	assert.Equal(t, 3, good.calls)
+}
+
+func TestFailoverPermanentError(t *testing.T) {
+	first := &fakeClient{err: errors.New("execution reverted")}
+	second := &fakeClient{blockNum: 100}
+	c := newTestFailover(first, second)
+
+	_, err := c.BlockNumber()
+	assert.Error(t, err)
+	assert.Equal(t, 1, first.calls)
+	assert.Equal(t, 0, second.calls)
+	assert.Equal(t, uint64(0), c.Stats()[0].Errors)
+}
+
+func TestFailoverAllEndpointsFail(t *testing.T) {
+	a := &fakeClient{err: errors.New("timeout")}
+	b := &fakeClient{err: errors.New("timeout")}
+	c := newTestFailover(a, b)
+
+	_, err := c.BlockNumber()
+	assert.Error(t, err)
+	assert.Equal(t, int(c.retryLimit), a.calls+b.calls)
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 2)
+	b.last = now
+	assert.True(t, b.allow(now))
+	assert.True(t, b.allow(now))
+	assert.False(t, b.allow(now))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now))
+	// 经过200ms补充两个令牌，其中一个已被预留
+	assert.True(t, b.allow(now.Add(200*time.Millisecond)))
+	assert.False(t, b.allow(now.Add(200*time.Millisecond)))
+
+	var unlimited *tokenBucket
+	assert.True(t, unlimited.allow(now))
+	assert.Equal(t, time.Duration(0), unlimited.reserve(now))
+}
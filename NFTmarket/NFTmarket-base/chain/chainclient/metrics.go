@@ -0,0 +1,31 @@
+package chainclient
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "easyswap",
+		Subsystem: "chain_client",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of node requests by endpoint and method.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"chain", "endpoint", "method"})
+	requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyswap",
+		Subsystem: "chain_client",
+		Name:      "request_errors_total",
+		Help:      "Failed node requests by endpoint and method.",
+	}, []string{"chain", "endpoint", "method"})
+	endpointHealth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "chain_client",
+		Name:      "endpoint_health_score",
+		Help:      "Health score of node endpoints, between 0 and 1.",
+	}, []string{"chain", "endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, requestErrors, endpointHealth)
+}
@@ -15,17 +15,26 @@ import (
 type ChainClient interface {
 	FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error)
 	BlockTimeByNumber(context.Context, *big.Int) (uint64, error)
+	BlockHeaderByNumber(context.Context, *big.Int) (*logTypes.BlockHeader, error)
+	BlockHeadersByNumbers(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error)
 	Client() interface{}
 	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
 	CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error)
 	BlockNumber() (uint64, error)
 	BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error)
+	// Subscribe 订阅新区块头和符合条件的日志，连接断开时通过Subscription.Err()返回错误
+	Subscribe(ctx context.Context, q logTypes.FilterQuery, heads chan<- *logTypes.BlockHeader, logs chan<- interface{}) (ethereum.Subscription, error)
 }
 
 func New(chainID int, nodeUrl string) (ChainClient, error) {
+	return NewWithWs(chainID, nodeUrl, "")
+}
+
+// NewWithWs 创建支持websocket订阅的客户端，wsUrl为空时不支持订阅
+func NewWithWs(chainID int, nodeUrl, wsUrl string) (ChainClient, error) {
 	switch chainID {
 	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID:
-		return evmclient.New(nodeUrl)
+		return evmclient.NewWithWs(nodeUrl, wsUrl)
 	default:
 		return nil, errors.New("unsupported chain id")
 	}
@@ -0,0 +1,67 @@
+package nftchainservice
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DiskCache 按URI的sha256在本地目录缓存内容
+type DiskCache struct {
+	dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed on create resolver cache dir")
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	key := fmt.Sprintf("%x", sum)
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Get 返回缓存的内容，ttl为0时不过期
+func (c *DiskCache) Get(uri string, ttl time.Duration) ([]byte, bool) {
+	path := c.path(uri)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if ttl > 0 && time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put 写入缓存，先写临时文件再重命名，失败时忽略
+func (c *DiskCache) Put(uri string, data []byte) {
+	path := c.path(uri)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,121 @@
+package nftchainservice
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+// ERC721EnumerableInterfaceId ERC721Enumerable的ERC-165接口id
+var ERC721EnumerableInterfaceId = [4]byte{0x78, 0x0e, 0x9d, 0x63}
+
+// callNftContract 调用NFT合约的只读方法并解码返回值
+func (s *Service) callNftContract(collectionAddr, method string, args ...interface{}) ([]interface{}, error) {
+	return s.callContract(s.Abi, collectionAddr, method, args...)
+}
+
+// callContract 按指定的abi调用合约的只读方法并解码返回值
+func (s *Service) callContract(contractAbi *abi.ABI, collectionAddr, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on pack %s", method)
+	}
+	to := common.HexToAddress(collectionAddr)
+	respData, err := s.NodeClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on call %s", method)
+	}
+	res, err := contractAbi.Unpack(method, respData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on unpack %s", method)
+	}
+	if len(res) == 0 {
+		return nil, errors.Errorf("empty %s result", method)
+	}
+	return res, nil
+}
+
+// FetchCollectionName 获取合约的name和symbol，合约未实现时返回空字符串
+func (s *Service) FetchCollectionName(collectionAddr string) (string, string) {
+	var name, symbol string
+	if res, err := s.callNftContract(collectionAddr, "name"); err == nil {
+		name, _ = res[0].(string)
+	}
+	if res, err := s.callNftContract(collectionAddr, "symbol"); err == nil {
+		symbol, _ = res[0].(string)
+	}
+	return name, symbol
+}
+
+// SupportsEnumerable 合约是否实现了ERC721Enumerable，调用失败视为未实现
+func (s *Service) SupportsEnumerable(collectionAddr string) bool {
+	res, err := s.callNftContract(collectionAddr, "supportsInterface", ERC721EnumerableInterfaceId)
+	if err != nil {
+		return false
+	}
+	supported, _ := res[0].(bool)
+	return supported
+}
+
+// FetchTotalSupply 获取ERC721Enumerable合约的发行总量
+func (s *Service) FetchTotalSupply(collectionAddr string) (uint64, error) {
+	res, err := s.callNftContract(collectionAddr, "totalSupply")
+	if err != nil {
+		return 0, err
+	}
+	total, ok := res[0].(*big.Int)
+	if !ok || !total.IsUint64() {
+		return 0, errors.Errorf("invalid total supply %v", res[0])
+	}
+	return total.Uint64(), nil
+}
+
+// FetchTokenByIndex 获取ERC721Enumerable合约中第index个token的id
+func (s *Service) FetchTokenByIndex(collectionAddr string, index uint64) (string, error) {
+	res, err := s.callNftContract(collectionAddr, "tokenByIndex", new(big.Int).SetUint64(index))
+	if err != nil {
+		return "", err
+	}
+	tokenId, ok := res[0].(*big.Int)
+	if !ok {
+		return "", errors.Errorf("invalid token id %v", res[0])
+	}
+	return tokenId.String(), nil
+}
+
+// GetCollectionTransferLogs 获取单个合约在区间内的Transfer、TransferSingle和TransferBatch日志，按区块和日志顺序排列
+func (s *Service) GetCollectionTransferLogs(collectionAddr string, fromBlock, toBlock uint64) ([]*TransferLog, error) {
+	logs, err := s.NodeClient.FilterLogs(s.ctx, logTypes.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: []string{collectionAddr},
+		Topics:    [][]string{nftTransferTopics()},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on filter logs")
+	}
+
+	transferLogs := s.decodeTransferLogs(logs)
+	sort.SliceStable(transferLogs, func(i, j int) bool {
+		if transferLogs[i].BlockNumber != transferLogs[j].BlockNumber {
+			return transferLogs[i].BlockNumber < transferLogs[j].BlockNumber
+		}
+		return transferLogs[i].Index < transferLogs[j].Index
+	})
+	return transferLogs, nil
+}
+
+// LatestBlockNumber 获取节点的最新区块高度
+func (s *Service) LatestBlockNumber() (uint64, error) {
+	blockNum, err := s.NodeClient.BlockNumber()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get latest block number")
+	}
+	return blockNum, nil
+}
@@ -0,0 +1,173 @@
+package nftchainservice
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	evmTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// Erc1155ContractMetaData ERC-1155合约中用到的方法和事件
+var Erc1155ContractMetaData = &bind.MetaData{
+	ABI: `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"operator","type":"address"},{"indexed":true,"internalType":"address","name":"from","type":"address"},{"indexed":true,"internalType":"address","name":"to","type":"address"},{"indexed":false,"internalType":"uint256","name":"id","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"value","type":"uint256"}],"name":"TransferSingle","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"operator","type":"address"},{"indexed":true,"internalType":"address","name":"from","type":"address"},{"indexed":true,"internalType":"address","name":"to","type":"address"},{"indexed":false,"internalType":"uint256[]","name":"ids","type":"uint256[]"},{"indexed":false,"internalType":"uint256[]","name":"values","type":"uint256[]"}],"name":"TransferBatch","type":"event"},{"inputs":[{"internalType":"address","name":"account","type":"address"},{"internalType":"uint256","name":"id","type":"uint256"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"uint256","name":"id","type":"uint256"}],"name":"uri","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"bytes4","name":"interfaceId","type":"bytes4"}],"name":"supportsInterface","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"}]`,
+}
+
+var (
+	// ERC721InterfaceId ERC-721的ERC-165接口id
+	ERC721InterfaceId = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	// ERC1155InterfaceId ERC-1155的ERC-165接口id
+	ERC1155InterfaceId = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+var EVMTransferSingleTopic = common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+var EVMTransferBatchTopic = common.HexToHash("0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb")
+
+// TokenStandard 通过ERC-165判断合约的token标准，结果按合约地址缓存
+// 合约未实现ERC-165时按ERC-721处理，调用失败时不缓存结果
+func (s *Service) TokenStandard(collectionAddr string) int64 {
+	key := strings.ToLower(collectionAddr)
+	if standard, ok := s.standards.Load(key); ok {
+		return standard.(int64)
+	}
+	res, err := s.callNftContract(collectionAddr, "supportsInterface", ERC1155InterfaceId)
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on detect token standard, use erc721",
+			zap.String("collection_addr", collectionAddr), zap.Error(err))
+		return multi.TokenStandardERC721
+	}
+	standard := int64(multi.TokenStandardERC721)
+	if supported, _ := res[0].(bool); supported {
+		standard = multi.TokenStandardERC1155
+	}
+	s.standards.Store(key, standard)
+	return standard
+}
+
+// FetchNftBalance 获取owner持有的ERC-1155 token数量
+func (s *Service) FetchNftBalance(collectionAddr, tokenID, owner string) (*big.Int, error) {
+	tokenId, ok := new(big.Int).SetString(tokenID, 10)
+	if !ok {
+		return nil, errors.Errorf("invalid token id %s", tokenID)
+	}
+	res, err := s.callContract(s.Erc1155Abi, collectionAddr, "balanceOf", common.HexToAddress(owner), tokenId)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := res[0].(*big.Int)
+	if !ok {
+		return nil, errors.Errorf("invalid balance %v", res[0])
+	}
+	return balance, nil
+}
+
+// ERC1155TokenURI 将ERC-1155 uri中的{id}替换为64位小写十六进制的token id
+func ERC1155TokenURI(uri string, tokenId *big.Int) string {
+	return strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", tokenId))
+}
+
+// nftTransferTopics 过滤NFT转移日志的topic0
+func nftTransferTopics() []string {
+	return []string{EVMTransferTopic.String(), EVMTransferSingleTopic.String(), EVMTransferBatchTopic.String()}
+}
+
+// decodeTransferLogs 解析节点返回的日志，解析失败的日志记录后跳过
+func (s *Service) decodeTransferLogs(logs []interface{}) []*TransferLog {
+	var transferLogs []*TransferLog
+	for _, log := range logs {
+		evmLog, ok := log.(evmTypes.Log)
+		if !ok {
+			continue
+		}
+		decoded, err := s.decodeTransferLog(evmLog)
+		if err != nil {
+			xzap.WithContext(s.ctx).Warn("failed on decode transfer log",
+				zap.String("tx_hash", evmLog.TxHash.String()), zap.Uint("log_index", evmLog.Index), zap.Error(err))
+			continue
+		}
+		transferLogs = append(transferLogs, decoded...)
+	}
+	return transferLogs
+}
+
+// decodeTransferLog 解析ERC-721的Transfer和ERC-1155的TransferSingle、TransferBatch日志
+// TransferBatch中的每个token生成一条TransferLog，它们的Index相同；不是NFT转移的日志返回nil
+func (s *Service) decodeTransferLog(evmLog evmTypes.Log) ([]*TransferLog, error) {
+	if len(evmLog.Topics) == 0 {
+		return nil, nil
+	}
+	newLog := func(from, to common.Hash, tokenId, amount *big.Int, standard int64) *TransferLog {
+		return &TransferLog{
+			Address:         evmLog.Address.String(),
+			TransactionHash: evmLog.TxHash.String(),
+			BlockNumber:     evmLog.BlockNumber,
+			BlockHash:       evmLog.BlockHash.String(),
+			Data:            evmLog.Data,
+			Topics:          evmLog.Topics,
+			Topic0:          evmLog.Topics[0].Hex(),
+			From:            common.BytesToAddress(from.Bytes()).String(),
+			To:              common.BytesToAddress(to.Bytes()).String(),
+			TokenID:         tokenId.String(),
+			Amount:          amount,
+			TokenStandard:   standard,
+			TxIndex:         evmLog.TxIndex,
+			Index:           evmLog.Index,
+			Removed:         evmLog.Removed,
+		}
+	}
+
+	switch evmLog.Topics[0] {
+	case EVMTransferTopic:
+		// ERC20的Transfer没有indexed的tokenId
+		if len(evmLog.Topics) != 4 {
+			return nil, nil
+		}
+		tokenId := new(big.Int).SetBytes(evmLog.Topics[3].Bytes())
+		return []*TransferLog{newLog(evmLog.Topics[1], evmLog.Topics[2], tokenId, big.NewInt(1), multi.TokenStandardERC721)}, nil
+
+	case EVMTransferSingleTopic:
+		if len(evmLog.Topics) != 4 {
+			return nil, nil
+		}
+		var event struct {
+			Id    *big.Int
+			Value *big.Int
+		}
+		if err := s.Erc1155Abi.UnpackIntoInterface(&event, "TransferSingle", evmLog.Data); err != nil {
+			return nil, errors.Wrap(err, "failed on unpack TransferSingle")
+		}
+		transferLog := newLog(evmLog.Topics[2], evmLog.Topics[3], event.Id, event.Value, multi.TokenStandardERC1155)
+		transferLog.Operator = common.BytesToAddress(evmLog.Topics[1].Bytes()).String()
+		return []*TransferLog{transferLog}, nil
+
+	case EVMTransferBatchTopic:
+		if len(evmLog.Topics) != 4 {
+			return nil, nil
+		}
+		var event struct {
+			Ids    []*big.Int
+			Values []*big.Int
+		}
+		if err := s.Erc1155Abi.UnpackIntoInterface(&event, "TransferBatch", evmLog.Data); err != nil {
+			return nil, errors.Wrap(err, "failed on unpack TransferBatch")
+		}
+		if len(event.Ids) != len(event.Values) {
+			return nil, errors.Errorf("TransferBatch ids and values length mismatch: %d != %d", len(event.Ids), len(event.Values))
+		}
+		transferLogs := make([]*TransferLog, 0, len(event.Ids))
+		for i := range event.Ids {
+			transferLog := newLog(evmLog.Topics[2], evmLog.Topics[3], event.Ids[i], event.Values[i], multi.TokenStandardERC1155)
+			transferLog.Operator = common.BytesToAddress(evmLog.Topics[1].Bytes()).String()
+			transferLogs = append(transferLogs, transferLog)
+		}
+		return transferLogs, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package nftchainservice
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	evmTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestTransferTopics(t *testing.T) {
+	assert.Equal(t, crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")), EVMTransferTopic)
+	assert.Equal(t, crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)")), EVMTransferSingleTopic)
+	assert.Equal(t, crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])")), EVMTransferBatchTopic)
+}
+
+func TestERC1155TokenURI(t *testing.T) {
+	assert.Equal(t, "https://token-cdn-domain/000000000000000000000000000000000000000000000000000000000004cce0.json",
+		ERC1155TokenURI("https://token-cdn-domain/{id}.json", big.NewInt(314592)))
+	assert.Equal(t, "ipfs://"+testCid+"/1.json", ERC1155TokenURI("ipfs://"+testCid+"/1.json", big.NewInt(1)))
+}
+
+func TestDecodeTransferLog(t *testing.T) {
+	erc1155Abi, err := Erc1155ContractMetaData.GetAbi()
+	require.NoError(t, err)
+	s := &Service{Erc1155Abi: erc1155Abi}
+
+	operator := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	from := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	to := common.HexToAddress("0x0000000000000000000000000000000000000003")
+	topics := func(sig common.Hash, addrs ...common.Address) []common.Hash {
+		res := []common.Hash{sig}
+		for _, addr := range addrs {
+			res = append(res, common.BytesToHash(addr.Bytes()))
+		}
+		return res
+	}
+
+	// ERC-721 Transfer
+	logs, err := s.decodeTransferLog(evmTypes.Log{
+		Topics: append(topics(EVMTransferTopic, from, to), common.BigToHash(big.NewInt(7))),
+		Index:  1,
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "7", logs[0].TokenID)
+	assert.Equal(t, int64(1), logs[0].Amount.Int64())
+	assert.Equal(t, int64(multi.TokenStandardERC721), logs[0].TokenStandard)
+	assert.Equal(t, from.String(), logs[0].From)
+
+	// ERC20 Transfer没有indexed的tokenId
+	logs, err = s.decodeTransferLog(evmTypes.Log{Topics: topics(EVMTransferTopic, from, to)})
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+
+	// TransferSingle
+	data, err := abi.Arguments{erc1155Abi.Events["TransferSingle"].Inputs[3], erc1155Abi.Events["TransferSingle"].Inputs[4]}.
+		Pack(big.NewInt(5), big.NewInt(10))
+	require.NoError(t, err)
+	logs, err = s.decodeTransferLog(evmTypes.Log{Topics: topics(EVMTransferSingleTopic, operator, from, to), Data: data, Index: 2})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "5", logs[0].TokenID)
+	assert.Equal(t, int64(10), logs[0].Amount.Int64())
+	assert.Equal(t, int64(multi.TokenStandardERC1155), logs[0].TokenStandard)
+	assert.Equal(t, operator.String(), logs[0].Operator)
+	assert.Equal(t, from.String(), logs[0].From)
+	assert.Equal(t, to.String(), logs[0].To)
+
+	// TransferBatch拆分为多条，Index相同
+	data, err = abi.Arguments{erc1155Abi.Events["TransferBatch"].Inputs[3], erc1155Abi.Events["TransferBatch"].Inputs[4]}.
+		Pack([]*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(3), big.NewInt(4)})
+	require.NoError(t, err)
+	logs, err = s.decodeTransferLog(evmTypes.Log{Topics: topics(EVMTransferBatchTopic, operator, from, to), Data: data, Index: 3})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "1", logs[0].TokenID)
+	assert.Equal(t, int64(3), logs[0].Amount.Int64())
+	assert.Equal(t, "2", logs[1].TokenID)
+	assert.Equal(t, int64(4), logs[1].Amount.Int64())
+	assert.Equal(t, logs[0].Index, logs[1].Index)
+
+	// 数据无法解析时返回错误
+	_, err = s.decodeTransferLog(evmTypes.Log{Topics: topics(EVMTransferBatchTopic, operator, from, to), Data: []byte{1}})
+	assert.Error(t, err)
+}
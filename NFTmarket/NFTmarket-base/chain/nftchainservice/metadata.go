@@ -2,11 +2,8 @@ package nftchainservice
 
 import (
 	"bytes"
-	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"math/big"
 	"net/http"
 	"net/url"
@@ -21,22 +18,9 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 )
 
-const fetchIPFSTimeout = 30 * time.Second
-
-var (
-	hosts = []string{"https://ipfs.io/ipfs/", "https://cf-ipfs.com/ipfs/", "https://infura-ipfs.io/ipfs/", "https://cloudflare-ipfs.com/ipfs/"}
-)
-
-type nftInfoSimple struct {
-	Name         string `json:"name"`
-	Image        string `json:"image"`
-	Description  string `json:"description"`
-	ExternalLink string `json:"external_link"`
-	Attributes   interface{}
-}
-
 func (s *Service) fetchNftMetadata(collectionAddr string, tokenID string) ([]byte, string, error) {
 	beginTime := time.Now()
 
@@ -47,7 +31,11 @@ func (s *Service) fetchNftMetadata(collectionAddr string, tokenID string) ([]byt
 	}()
 
 	tokenId, _ := big.NewInt(0).SetString(tokenID, 10)
-	tokenURIReqData, err := s.Abi.Pack("tokenURI", tokenId)
+	contractAbi, method := s.Abi, "tokenURI"
+	if s.TokenStandard(collectionAddr) == multi.TokenStandardERC1155 {
+		contractAbi, method = s.Erc1155Abi, "uri"
+	}
+	tokenURIReqData, err := contractAbi.Pack(method, tokenId)
 	if err != nil {
 		return nil, "", errors.Wrap(err, fmt.Sprintf("failed on pack token uri %s", tokenID))
 	}
@@ -58,40 +46,49 @@ func (s *Service) fetchNftMetadata(collectionAddr string, tokenID string) ([]byt
 		return nil, "", errors.Wrap(err, "failed on request token uri")
 	}
 
-	res, err := s.Abi.Unpack("tokenURI", respData)
+	res, err := contractAbi.Unpack(method, respData)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "failed on unpack token uri")
 	}
 
 	tokenUri := res[0].(string)
-	var body []byte
-	if len(tokenUri) > 29 && tokenUri[0:29] == "data:application/json;base64," {
-		body, err = base64.StdEncoding.DecodeString(tokenUri[29:])
-		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on decode token uri: %s", tokenUri))
-		}
-	} else if len(tokenUri) > 5 && tokenUri[0:5] == "ipfs:" {
-		body, err = s.fetchIpfsData(tokenUri)
-		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
-		}
-	} else if len(tokenUri) > 5 && tokenUri[0:4] != "http" {
-		return nil, "", errors.New(fmt.Sprintf("invalid url %s", tokenUri))
+	if method == "uri" {
+		tokenUri = ERC1155TokenURI(tokenUri, tokenId)
 	}
-
-	if len(tokenUri) > 5 && tokenUri[0:4] == "http" {
-		body, err = s.fetchJsonData(tokenUri)
-		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch metadata. uri:%s", tokenUri))
-		}
+	body, err := s.Resolver.Resolve(s.ctx, tokenUri)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
 	}
-
-	if body != nil {
-		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
-		return body, tokenUri, nil
+	if len(body) == 0 {
+		return nil, "", errors.New("empty metadata")
 	}
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	return unwrapDataEnvelope(body), tokenUri, nil
+}
 
-	return nil, "", errors.New("empty metadata")
+// unwrapDataEnvelope 部分接口把metadata包在{"msg": ..., "data": {...}}中返回，
+// 外层没有name和image而data中有时返回data的内容
+func unwrapDataEnvelope(body []byte) []byte {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return body
+	}
+	if _, ok := envelope["name"]; ok {
+		return body
+	}
+	if _, ok := envelope["image"]; ok {
+		return body
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(envelope["data"], &data); err != nil {
+		return body
+	}
+	if _, ok := data["name"]; !ok {
+		if _, ok := data["image"]; !ok {
+			return body
+		}
+	}
+	return envelope["data"]
 }
 
 func (s *Service) FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error) {
@@ -124,88 +121,6 @@ func (s *Service) FetchNftOwner(collectionAddr string, tokenID string) (common.A
 	return address, nil
 }
 
-func (s *Service) fetchIpfsData(tokenUri string) ([]byte, error) {
-	finished := make(chan []byte)
-	ticker := time.NewTicker(fetchIPFSTimeout)
-	var cancelFns []context.CancelFunc
-	for i := range hosts {
-		host := hosts[i]
-		fullUrl := strings.Replace(tokenUri, "ipfs://", host, 1)
-		ctx, cancel := context.WithCancel(context.Background())
-		cancelFns = append(cancelFns, cancel)
-		go func() {
-			req, err := http.NewRequestWithContext(ctx, "GET", fullUrl, nil)
-			if err != nil {
-				xzap.WithContext(s.ctx).Error("failed on create fetch ipfs data req",
-					zap.String("token_uri", tokenUri), zap.Error(err))
-				return
-			}
-
-			resp, err := s.HttpClient.Do(req)
-			if err != nil {
-				xzap.WithContext(s.ctx).Error("failed on fetch metadata from ipfs",
-					zap.String("token_uri", tokenUri), zap.Error(err))
-				return
-			}
-
-			if resp.StatusCode == http.StatusOK {
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					xzap.WithContext(s.ctx).Error("failed on read ipfs req resp body",
-						zap.String("token_uri", tokenUri), zap.Error(err))
-					return
-				}
-
-				finished <- body
-			}
-		}()
-	}
-
-	select {
-	case data := <-finished:
-		for i := range cancelFns {
-			cancelFns[i]()
-		}
-
-		return data, nil
-	case <-ticker.C:
-		return nil, errors.New("request metadata timeout: " + tokenUri)
-	}
-}
-
-func (s *Service) fetchJsonData(tokenUri string) (body []byte, err error) {
-	resp, err := s.HttpClient.Get(tokenUri)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on get metadata from http")
-	}
-
-	if resp.StatusCode == http.StatusOK {
-		body, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on read resp body")
-		}
-
-		if strings.Contains(tokenUri, "squid-app-o5c27.ondigitalocean") {
-			tmpData := struct {
-				Msg  string        `json:"msg"`
-				Data nftInfoSimple `json:"data"`
-			}{}
-			if err := json.Unmarshal(body, &tmpData); err != nil {
-				return nil, errors.Wrap(err, "failed on unmarshal raw metadata")
-			}
-
-			if tmpData.Data.Name != "" {
-				body, err = json.Marshal(tmpData.Data)
-				if err != nil {
-					return nil, errors.Wrap(err, "failed on marshal raw metadata")
-				}
-			}
-		}
-	}
-
-	return body, err
-}
-
 func (s *Service) FetchOnChainMetadata(collectionAddr string, tokenID string) (*JsonMetadata, error) {
 	rawData, tokenUri, err := s.fetchNftMetadata(collectionAddr, tokenID)
 	if err != nil {
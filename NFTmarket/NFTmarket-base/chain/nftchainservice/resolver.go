@@ -0,0 +1,409 @@
+package nftchainservice
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+const (
+	DefaultMaxResponseSize  = 16 << 20 // 单次响应的最大字节数
+	DefaultGatewayTimeout   = 30       // 单个网关的请求超时(秒)
+	DefaultFailureThreshold = 3        // 网关连续失败多少次后暂停使用
+	DefaultGatewayCooldown  = 60       // 网关暂停使用的时长(秒)
+)
+
+var (
+	DefaultIpfsGateways    = []string{"https://ipfs.io/ipfs/", "https://dweb.link/ipfs/"}
+	DefaultArweaveGateways = []string{"https://arweave.net/"}
+)
+
+// ipfsCidPattern CIDv0(Qm开头的base58)或CIDv1(base32)
+var ipfsCidPattern = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{20,})$`)
+
+// GatewayConfig 网关地址和响应大小限制，MaxSize为0时使用所在scheme的限制
+type GatewayConfig struct {
+	URL     string `toml:"url" mapstructure:"url" json:"url"`
+	MaxSize int64  `toml:"max_size" mapstructure:"max_size" json:"max_size"`
+}
+
+// SchemeConfig 一种URI scheme的网关和响应大小限制
+type SchemeConfig struct {
+	Gateways []GatewayConfig `toml:"gateways" mapstructure:"gateways" json:"gateways"`
+	MaxSize  int64           `toml:"max_size" mapstructure:"max_size" json:"max_size"`
+}
+
+// ResolverConfig metadata URI的解析配置，未配置的项使用默认值
+type ResolverConfig struct {
+	Ipfs             SchemeConfig `toml:"ipfs" mapstructure:"ipfs" json:"ipfs"`
+	Arweave          SchemeConfig `toml:"arweave" mapstructure:"arweave" json:"arweave"`
+	Http             SchemeConfig `toml:"http" mapstructure:"http" json:"http"`
+	Data             SchemeConfig `toml:"data" mapstructure:"data" json:"data"`
+	Timeout          int64        `toml:"timeout" mapstructure:"timeout" json:"timeout"`                               // 单个网关的请求超时(秒)
+	FailureThreshold int          `toml:"failure_threshold" mapstructure:"failure_threshold" json:"failure_threshold"` // 连续失败多少次后暂停使用网关
+	Cooldown         int64        `toml:"cooldown" mapstructure:"cooldown" json:"cooldown"`                            // 网关暂停使用的时长(秒)
+	CacheDir         string       `toml:"cache_dir" mapstructure:"cache_dir" json:"cache_dir"`                         // 本地缓存目录，为空时不缓存
+	CacheTTL         int64        `toml:"cache_ttl" mapstructure:"cache_ttl" json:"cache_ttl"`                         // http(s)内容的缓存时长(秒)，0表示不缓存，ipfs和ar的内容不变一直缓存
+}
+
+// Resolver 获取一种scheme的URI指向的内容
+type Resolver interface {
+	Resolve(ctx context.Context, uri string) ([]byte, error)
+}
+
+// Registry 按URI scheme选择Resolver，并在本地缓存ipfs、ar和http(s)的内容
+type Registry struct {
+	resolvers map[string]Resolver
+	cache     *DiskCache
+	cacheTTL  time.Duration
+}
+
+// NewRegistry 注册ipfs、ar、data和http(s)的Resolver
+func NewRegistry(cfg *ResolverConfig, client *http.Client) (*Registry, error) {
+	if cfg == nil {
+		cfg = &ResolverConfig{}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if cfg.Timeout <= 0 {
+		timeout = DefaultGatewayTimeout * time.Second
+	}
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	cooldown := time.Duration(cfg.Cooldown) * time.Second
+	if cfg.Cooldown <= 0 {
+		cooldown = DefaultGatewayCooldown * time.Second
+	}
+	newGateways := func(scheme SchemeConfig, defaults []string) []*Gateway {
+		configs := scheme.Gateways
+		if len(configs) == 0 {
+			for _, u := range defaults {
+				configs = append(configs, GatewayConfig{URL: u})
+			}
+		}
+		var gateways []*Gateway
+		for _, c := range configs {
+			gateways = append(gateways, NewGateway(client, c.URL, maxSize(c.MaxSize, scheme.MaxSize), timeout, threshold, cooldown))
+		}
+		return gateways
+	}
+
+	httpMaxSize := maxSize(cfg.Http.MaxSize, 0)
+	httpResolver := &HttpResolver{
+		newGateway: func() *Gateway {
+			return NewGateway(client, "", httpMaxSize, timeout, threshold, cooldown)
+		},
+		gateways: make(map[string]*Gateway),
+	}
+	r := &Registry{resolvers: make(map[string]Resolver), cacheTTL: time.Duration(cfg.CacheTTL) * time.Second}
+	r.Register("ipfs", &IpfsResolver{gateways: newGateways(cfg.Ipfs, DefaultIpfsGateways)})
+	r.Register("ar", &ArweaveResolver{gateways: newGateways(cfg.Arweave, DefaultArweaveGateways)})
+	r.Register("data", &DataResolver{maxSize: maxSize(cfg.Data.MaxSize, 0)})
+	r.Register("http", httpResolver)
+	r.Register("https", httpResolver)
+	if cfg.CacheDir != "" {
+		cache, err := NewDiskCache(cfg.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		r.cache = cache
+	}
+	return r, nil
+}
+
+func maxSize(sizes ...int64) int64 {
+	for _, size := range sizes {
+		if size > 0 {
+			return size
+		}
+	}
+	return DefaultMaxResponseSize
+}
+
+// Register 注册或替换scheme的Resolver，scheme不区分大小写
+func (r *Registry) Register(scheme string, resolver Resolver) {
+	r.resolvers[strings.ToLower(scheme)] = resolver
+}
+
+// Resolve 获取URI指向的内容，data URI不缓存
+func (r *Registry) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	uri = strings.TrimSpace(uri)
+	scheme, _, ok := strings.Cut(uri, ":")
+	if !ok {
+		return nil, errors.Errorf("invalid uri: %s", uri)
+	}
+	scheme = strings.ToLower(scheme)
+	resolver, ok := r.resolvers[scheme]
+	if !ok {
+		return nil, errors.Errorf("unsupported uri scheme: %s", scheme)
+	}
+
+	ttl := r.ttl(scheme)
+	if r.cache != nil && ttl >= 0 {
+		if data, ok := r.cache.Get(uri, ttl); ok {
+			return data, nil
+		}
+	}
+	data, err := resolver.Resolve(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil && ttl >= 0 {
+		r.cache.Put(uri, data)
+	}
+	return data, nil
+}
+
+// ttl 返回scheme的缓存时长，0表示一直有效，小于0表示不缓存
+func (r *Registry) ttl(scheme string) time.Duration {
+	switch scheme {
+	case "ipfs", "ar":
+		return 0
+	case "http", "https":
+		if r.cacheTTL > 0 {
+			return r.cacheTTL
+		}
+	}
+	return -1
+}
+
+// Gateway 一个http网关，连续失败达到阈值后在冷却期内暂停使用
+type Gateway struct {
+	client    *http.Client
+	base      string
+	maxSize   int64
+	timeout   time.Duration
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+}
+
+func NewGateway(client *http.Client, base string, maxSize int64, timeout time.Duration, threshold int, cooldown time.Duration) *Gateway {
+	return &Gateway{
+		client:    client,
+		base:      base,
+		maxSize:   maxSize,
+		timeout:   timeout,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Healthy 网关是否可用
+func (g *Gateway) Healthy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !time.Now().Before(g.downUntil)
+}
+
+func (g *Gateway) report(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err == nil {
+		g.failures = 0
+		return
+	}
+	g.failures++
+	if g.failures >= g.threshold {
+		g.failures = 0
+		g.downUntil = time.Now().Add(g.cooldown)
+	}
+}
+
+// Get 请求网关地址加上path，响应超过大小限制时返回xhttp.ErrBodySizeLimit
+func (g *Gateway) Get(ctx context.Context, path string) ([]byte, error) {
+	data, err := g.get(ctx, g.base+path)
+	// 调用方取消的请求不计入网关的健康状态
+	if ctx.Err() == nil {
+		g.report(err)
+	}
+	return data, err
+}
+
+func (g *Gateway) get(ctx context.Context, rawurl string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create request")
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on get %s", rawurl)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed on get %s, status: %d", rawurl, resp.StatusCode)
+	}
+	if resp.ContentLength > g.maxSize {
+		return nil, errors.Wrapf(xhttp.ErrBodySizeLimit, "content length %d", resp.ContentLength)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, g.maxSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed on read %s", rawurl)
+	}
+	if int64(len(body)) > g.maxSize {
+		return nil, errors.Wrapf(xhttp.ErrBodySizeLimit, "more than %d bytes", g.maxSize)
+	}
+	return body, nil
+}
+
+// fetchFromGateways 依次尝试可用的网关，都不可用时尝试全部网关
+func fetchFromGateways(ctx context.Context, gateways []*Gateway, path string) ([]byte, error) {
+	var healthy, down []*Gateway
+	for _, g := range gateways {
+		if g.Healthy() {
+			healthy = append(healthy, g)
+		} else {
+			down = append(down, g)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = down
+	}
+	var lastErr error = errors.New("no gateway configured")
+	for _, g := range candidates {
+		data, err := g.Get(ctx, path)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// IpfsResolver 通过网关获取ipfs://的内容
+type IpfsResolver struct {
+	gateways []*Gateway
+}
+
+func (r *IpfsResolver) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	path, err := NormalizeIpfsPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	return fetchFromGateways(ctx, r.gateways, path)
+}
+
+// NormalizeIpfsPath 将ipfs://<cid>/<path>的各种写法统一为<cid>/<path>
+// 支持ipfs://ipfs/<cid>、ipfs:/<cid>和/ipfs/<cid>，base32的CIDv1转为小写
+func NormalizeIpfsPath(uri string) (string, error) {
+	path := uri
+	if len(path) >= 5 && strings.EqualFold(path[:5], "ipfs:") {
+		path = path[5:]
+	}
+	path = strings.TrimLeft(path, "/")
+	for strings.HasPrefix(path, "ipfs/") {
+		path = strings.TrimLeft(strings.TrimPrefix(path, "ipfs/"), "/")
+	}
+	cid, rest, _ := strings.Cut(path, "/")
+	if strings.HasPrefix(strings.ToLower(cid), "b") {
+		cid = strings.ToLower(cid)
+	}
+	if !ipfsCidPattern.MatchString(cid) {
+		return "", errors.Errorf("invalid ipfs cid in %s", uri)
+	}
+	if rest == "" {
+		return cid, nil
+	}
+	return cid + "/" + rest, nil
+}
+
+// ArweaveResolver 通过网关获取ar://<tx id>/<path>的内容
+type ArweaveResolver struct {
+	gateways []*Gateway
+}
+
+func (r *ArweaveResolver) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	path := strings.TrimLeft(uri[len("ar:"):], "/")
+	if path == "" {
+		return nil, errors.Errorf("invalid arweave uri: %s", uri)
+	}
+	return fetchFromGateways(ctx, r.gateways, path)
+}
+
+// HttpResolver 直接请求http(s)地址，每个host单独统计健康状态，暂停使用的host直接返回错误
+type HttpResolver struct {
+	newGateway func() *Gateway
+
+	mu       sync.Mutex
+	gateways map[string]*Gateway // host -> 网关
+}
+
+func (r *HttpResolver) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid url %s", uri)
+	}
+	gateway := r.gateway(strings.ToLower(u.Host))
+	if !gateway.Healthy() {
+		return nil, errors.Errorf("host %s is cooling down after repeated failures", u.Host)
+	}
+	return gateway.Get(ctx, uri)
+}
+
+func (r *HttpResolver) gateway(host string) *Gateway {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	gateway, ok := r.gateways[host]
+	if !ok {
+		gateway = r.newGateway()
+		r.gateways[host] = gateway
+	}
+	return gateway
+}
+
+// DataResolver 解析data:[<mediatype>][;base64],<data>
+type DataResolver struct {
+	maxSize int64
+}
+
+func (r *DataResolver) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	header, payload, ok := strings.Cut(uri[len("data:"):], ",")
+	if !ok {
+		return nil, errors.New("invalid data uri")
+	}
+	var data []byte
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			// 部分合约使用不带padding的base64
+			if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "=")); err != nil {
+				return nil, errors.Wrap(err, "failed on decode base64 data uri")
+			}
+		}
+		data = decoded
+	} else {
+		unescaped, err := url.PathUnescape(payload)
+		if err != nil {
+			// 未转义的json中可能含有%，按原文处理
+			unescaped = payload
+		}
+		data = []byte(unescaped)
+	}
+	if int64(len(data)) > r.maxSize {
+		return nil, errors.Wrapf(xhttp.ErrBodySizeLimit, "more than %d bytes", r.maxSize)
+	}
+	return data, nil
+}
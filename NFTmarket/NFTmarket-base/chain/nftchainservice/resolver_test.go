@@ -0,0 +1,156 @@
+package nftchainservice
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+const testCid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+func TestNormalizeIpfsPath(t *testing.T) {
+	for uri, want := range map[string]string{
+		"ipfs://" + testCid:                  testCid,
+		"ipfs://" + testCid + "/1.json":      testCid + "/1.json",
+		"ipfs://ipfs/" + testCid + "/1.json": testCid + "/1.json",
+		"ipfs:/" + testCid:                   testCid,
+		"IPFS://" + testCid:                  testCid,
+		"ipfs://BAFYBEIGDYRZT5SFP7UDM7HU76UH7Y26NF3EFUYLQABF3OCLGTQY55FBZDI/2": "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/2",
+	} {
+		got, err := NormalizeIpfsPath(uri)
+		assert.NoError(t, err, uri)
+		assert.Equal(t, want, got, uri)
+	}
+	_, err := NormalizeIpfsPath("ipfs://not-a-cid/1.json")
+	assert.Error(t, err)
+}
+
+func TestRegistryIpfsGatewayFallback(t *testing.T) {
+	var badCalls, goodCalls atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badCalls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodCalls.Add(1)
+		assert.Equal(t, "/ipfs/"+testCid+"/1.json", r.URL.Path)
+		w.Write([]byte(`{"name":"one"}`))
+	}))
+	defer good.Close()
+
+	r, err := NewRegistry(&ResolverConfig{
+		Ipfs: SchemeConfig{Gateways: []GatewayConfig{
+			{URL: bad.URL + "/ipfs/"},
+			{URL: good.URL + "/ipfs/"},
+		}},
+		FailureThreshold: 2,
+	}, nil)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		data, err := r.Resolve(context.Background(), "ipfs://ipfs/"+testCid+"/1.json")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"name":"one"}`, string(data))
+	}
+	// 连续失败两次后暂停使用
+	assert.Equal(t, int32(2), badCalls.Load())
+	assert.Equal(t, int32(3), goodCalls.Load())
+}
+
+func TestHttpResolverSkipsUnhealthyHost(t *testing.T) {
+	var badCalls atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badCalls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"one"}`))
+	}))
+	defer good.Close()
+
+	r, err := NewRegistry(&ResolverConfig{FailureThreshold: 2}, nil)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := r.Resolve(context.Background(), bad.URL+"/1.json")
+		assert.Error(t, err)
+	}
+	// 连续失败两次后暂停请求该host，其他host不受影响
+	assert.Equal(t, int32(2), badCalls.Load())
+	data, err := r.Resolve(context.Background(), good.URL+"/1.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"one"}`, string(data))
+}
+
+func TestRegistrySizeLimitAndCache(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("a", 100)))
+			return
+		}
+		w.Write([]byte(`{"name":"tx"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := &ResolverConfig{
+		Arweave:  SchemeConfig{Gateways: []GatewayConfig{{URL: server.URL + "/"}}},
+		Http:     SchemeConfig{MaxSize: 50},
+		CacheDir: dir,
+	}
+	r, err := NewRegistry(cfg, nil)
+	assert.NoError(t, err)
+
+	_, err = r.Resolve(context.Background(), server.URL+"/large")
+	assert.ErrorIs(t, err, xhttp.ErrBodySizeLimit)
+
+	// ar的内容不变，缓存后不再请求网关
+	for i := 0; i < 2; i++ {
+		data, err := r.Resolve(context.Background(), "ar://tx-id")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"name":"tx"}`, string(data))
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	// 新的Registry使用同一个缓存目录
+	r, err = NewRegistry(cfg, nil)
+	assert.NoError(t, err)
+	_, err = r.Resolve(context.Background(), "ar://tx-id")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRegistryDataURI(t *testing.T) {
+	r, err := NewRegistry(nil, nil)
+	assert.NoError(t, err)
+
+	raw := `{"name":"on chain"}`
+	data, err := r.Resolve(context.Background(), "data:application/json;base64,"+base64.StdEncoding.EncodeToString([]byte(raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, raw, string(data))
+
+	data, err = r.Resolve(context.Background(), "data:application/json;utf8,"+raw)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, string(data))
+
+	_, err = r.Resolve(context.Background(), "ftp://example.com/1.json")
+	assert.Error(t, err)
+}
+
+func TestUnwrapDataEnvelope(t *testing.T) {
+	assert.Equal(t, `{"name":"a"}`, string(unwrapDataEnvelope([]byte(`{"msg":"ok","data":{"name":"a"}}`))))
+	assert.Equal(t, `{"name":"a","data":{"name":"b"}}`, string(unwrapDataEnvelope([]byte(`{"name":"a","data":{"name":"b"}}`))))
+	assert.Equal(t, `{"data":[1]}`, string(unwrapDataEnvelope([]byte(`{"data":[1]}`))))
+}
@@ -2,6 +2,7 @@ package nftchainservice
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -25,7 +26,9 @@ type Service struct {
 	ctx context.Context
 
 	Abi            *abi.ABI
+	Erc1155Abi     *abi.ABI
 	HttpClient     *xhttp.Client
+	Resolver       *Registry // 按scheme获取tokenURI指向的内容
 	NodeClient     chainclient.ChainClient
 	ChainName      string
 	NodeName       string
@@ -34,30 +37,49 @@ type Service struct {
 	AttributesTags []string
 	TraitNameTags  []string
 	TraitValueTags []string
+
+	standards sync.Map // 合约地址 -> token标准
 }
 
 func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags, imageTags, attributesTags,
 	traitNameTags, traitValueTags []string) (*Service, error) {
+	nodeClient, err := chainclient.New(chainID, endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create node client")
+	}
+	return NewWithClient(ctx, nodeClient, chainName, nameTags, imageTags, attributesTags, traitNameTags, traitValueTags)
+}
+
+// NewWithClient 使用已创建的ChainClient，多个服务可以共用同一个多节点客户端
+func NewWithClient(ctx context.Context, nodeClient chainclient.ChainClient, chainName string, nameTags, imageTags,
+	attributesTags, traitNameTags, traitValueTags []string) (*Service, error) {
 	conf := xhttp.GetDefaultConfig()
 	conf.ForceAttemptHTTP2 = false
 	conf.HTTPTimeout = time.Duration(defaultTimeout) * time.Second
 	conf.DialTimeout = time.Duration(defaultTimeout-5) * time.Second
 	conf.DialKeepAlive = time.Duration(defaultTimeout+10) * time.Second
 
-	nodeClient, err := chainclient.New(chainID, endpoint)
+	abi, err := NftContractMetaData.GetAbi()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed on create node client")
+		return nil, errors.Wrap(err, "failed on get contract abi")
+	}
+	erc1155Abi, err := Erc1155ContractMetaData.GetAbi()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get erc1155 contract abi")
 	}
 
-	abi, err := NftContractMetaData.GetAbi()
+	httpClient := xhttp.NewClient(conf)
+	resolver, err := NewRegistry(nil, httpClient.Client)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed on get contract abi")
+		return nil, errors.Wrap(err, "failed on create uri resolver")
 	}
 
 	return &Service{
 		ctx:            ctx,
 		Abi:            abi,
-		HttpClient:     xhttp.NewClient(conf),
+		Erc1155Abi:     erc1155Abi,
+		HttpClient:     httpClient,
+		Resolver:       resolver,
 		NodeClient:     nodeClient,
 		ChainName:      chainName,
 		NameTags:       nameTags,
@@ -67,3 +89,13 @@ func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags,
 		TraitValueTags: traitValueTags,
 	}, nil
 }
+
+// SetResolverConfig 使用配置的网关、大小限制和缓存替换默认的URI解析
+func (s *Service) SetResolverConfig(cfg *ResolverConfig) error {
+	resolver, err := NewRegistry(cfg, s.HttpClient.Client)
+	if err != nil {
+		return errors.Wrap(err, "failed on create uri resolver")
+	}
+	s.Resolver = resolver
+	return nil
+}
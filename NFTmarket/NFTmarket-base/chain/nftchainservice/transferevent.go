@@ -6,7 +6,6 @@ import (
 	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
-	evmTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/pkg/errors"
 
 	"github.com/ProjectsTask/EasySwapBase/chain"
@@ -36,6 +35,9 @@ type TransferLog struct {
 	From            string        `json:"topic1"`
 	To              string        `json:"topic2"`
 	TokenID         string        `json:"topic3"`
+	Operator        string        `json:"operator"`      // ERC-1155转移的发起者
+	Amount          *big.Int      `json:"amount"`        // 转移数量，ERC-721为1
+	TokenStandard   int64         `json:"tokenStandard"` // 1:ERC-721,2:ERC-1155
 	TxIndex         uint          `json:"transactionIndex"`
 	Index           uint          `json:"logIndex"`
 	Removed         bool          `json:"removed"`
@@ -54,10 +56,10 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		startBlockTime = blockTimestamp
 	}
 
-	var transferTopic string
+	var transferTopics []string
 	switch s.ChainName {
 	case chain.Eth, chain.Optimism, chain.Sepolia:
-		transferTopic = EVMTransferTopic.String()
+		transferTopics = nftTransferTopics()
 	default:
 		return nil, errors.Wrap(err, "unsupported chain")
 	}
@@ -66,7 +68,7 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		FromBlock: new(big.Int).SetUint64(fromBlock),
 		ToBlock:   new(big.Int).SetUint64(toBlock),
 		Topics: [][]string{
-			{transferTopic},
+			transferTopics,
 		},
 	}
 
@@ -76,45 +78,18 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		return nil, errors.Wrap(err, "failed on filter logs")
 	}
 
-	var transferLogs []*TransferLog
-	for _, log := range logs {
-		var evmLog evmTypes.Log
-		var ok bool
-		evmLog, ok = log.(evmTypes.Log)
-		if ok {
-			var topics [4]string
-			for i := range evmLog.Topics {
-				topics[i] = evmLog.Topics[i].Hex()
-			}
-			if topics[3] == "" {
-				continue
-			}
-
-			tokenId := new(big.Int).SetBytes(evmLog.Topics[3][:])
-			transferLog := &TransferLog{
-				Address:         evmLog.Address.String(),
-				TransactionHash: evmLog.TxHash.String(),
-				BlockNumber:     evmLog.BlockNumber,
-				BlockTime:       startBlockTime + (evmLog.BlockNumber-fromBlock)*uint64(BlockTimeGap[s.ChainName]),
-				BlockHash:       evmLog.BlockHash.String(),
-				Data:            evmLog.Data,
-				Topics:          evmLog.Topics,
-				Topic0:          topics[0],
-				From:            common.HexToAddress(topics[1]).String(),
-				To:              common.HexToAddress(topics[2]).String(),
-				TokenID:         tokenId.String(),
-				TxIndex:         evmLog.TxIndex,
-				Index:           evmLog.Index,
-				Removed:         evmLog.Removed,
-			}
-			transferLogs = append(transferLogs, transferLog)
-			continue
-		}
+	transferLogs := s.decodeTransferLogs(logs)
+	for _, transferLog := range transferLogs {
+		transferLog.BlockTime = startBlockTime + (transferLog.BlockNumber-fromBlock)*uint64(BlockTimeGap[s.ChainName])
 	}
 
-	// Sort transferLogs by block number
-	sort.Slice(transferLogs, func(i, j int) bool {
-		return transferLogs[i].BlockNumber < transferLogs[j].BlockNumber
+	// Sort transferLogs by block number and log index
+	// TransferBatch拆分出的日志Index相同，保持原有顺序
+	sort.SliceStable(transferLogs, func(i, j int) bool {
+		if transferLogs[i].BlockNumber != transferLogs[j].BlockNumber {
+			return transferLogs[i].BlockNumber < transferLogs[j].BlockNumber
+		}
+		return transferLogs[i].Index < transferLogs[j].Index
 	})
 
 	return transferLogs, nil
@@ -0,0 +1,9 @@
+package types
+
+// BlockHeader 区块头中与索引相关的字段
+type BlockHeader struct {
+	Number     uint64 // 区块高度
+	Hash       string // 区块hash
+	ParentHash string // 父区块hash
+	Time       uint64 // 区块时间
+}
@@ -0,0 +1,55 @@
+package eventsink
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Version 事件结构的版本号，字段发生不兼容变更时递增
+const Version = 1
+
+type EventType string
+
+const (
+	OrderCreated     EventType = "OrderCreated"
+	OrderCancelled   EventType = "OrderCancelled"
+	OrderFilled      EventType = "OrderFilled"
+	OwnershipChanged EventType = "OwnershipChanged"
+)
+
+// Event 归一化后的市场事件，携带所在区块、交易和日志的位置
+type Event struct {
+	Version         int       `json:"version"`
+	Type            EventType `json:"type"`
+	ChainId         int64     `json:"chain_id"`
+	Chain           string    `json:"chain"`
+	ContractAddress string    `json:"contract_address"` // 产生事件的合约地址
+	BlockNumber     uint64    `json:"block_number"`
+	BlockTime       int64     `json:"block_time"`
+	TxHash          string    `json:"tx_hash"`
+	LogIndex        uint      `json:"log_index"`
+
+	OrderId           string          `json:"order_id,omitempty"`
+	OrderType         int64           `json:"order_type,omitempty"` // 1:listing 2:collection bid 3:item bid
+	CollectionAddress string          `json:"collection_address"`
+	TokenId           string          `json:"token_id,omitempty"`
+	Maker             string          `json:"maker,omitempty"`
+	Taker             string          `json:"taker,omitempty"`
+	From              string          `json:"from,omitempty"`
+	To                string          `json:"to,omitempty"`
+	Price             decimal.Decimal `json:"price"`
+	Quantity          int64           `json:"quantity,omitempty"`
+	ExpireTime        int64           `json:"expire_time,omitempty"`
+}
+
+// Key 事件的唯一标识，消费者可以据此去重
+func (e *Event) Key() string {
+	return fmt.Sprintf("%s:%s:%d:%s:%s", e.Chain, e.TxHash, e.LogIndex, e.Type, e.OrderId)
+}
+
+// Message 从事件流中读取的消息
+type Message struct {
+	ID    string // 消息在事件流中的位置
+	Event *Event
+}
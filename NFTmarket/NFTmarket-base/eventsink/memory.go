@@ -0,0 +1,134 @@
+package eventsink
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryBus 进程内的事件总线，用于测试和单进程部署，重启后数据丢失
+type MemoryBus struct {
+	mu            sync.Mutex
+	streams       map[string]*memoryStream
+	retryInterval time.Duration
+}
+
+type memoryStream struct {
+	messages []*Message
+	groups   map[string]*memoryGroup
+	notify   chan struct{} // 有新消息时关闭并替换
+}
+
+type memoryGroup struct {
+	next  int   // 下一条未投递消息的下标
+	retry []int // 处理失败等待重新投递的消息下标
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		streams:       make(map[string]*memoryStream),
+		retryInterval: time.Second,
+	}
+}
+
+func (b *MemoryBus) stream(chain string) *memoryStream {
+	stream, ok := b.streams[chain]
+	if !ok {
+		stream = &memoryStream{
+			groups: make(map[string]*memoryGroup),
+			notify: make(chan struct{}),
+		}
+		b.streams[chain] = stream
+	}
+	return stream
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, events ...*Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	notified := make(map[*memoryStream]bool)
+	for _, event := range events {
+		stream := b.stream(event.Chain)
+		stream.messages = append(stream.messages, &Message{
+			ID:    strconv.Itoa(len(stream.messages)+1) + "-0",
+			Event: event,
+		})
+		if !notified[stream] {
+			close(stream.notify)
+			stream.notify = make(chan struct{})
+			notified[stream] = true
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Consume(ctx context.Context, chain, group, consumer string, handler Handler) error {
+	for {
+		b.mu.Lock()
+		stream := b.stream(chain)
+		g, ok := stream.groups[group]
+		if !ok {
+			g = &memoryGroup{}
+			stream.groups[group] = g
+		}
+		// 优先重新投递处理失败的消息
+		index, retried := -1, false
+		if len(g.retry) > 0 {
+			index, retried = g.retry[0], true
+			g.retry = g.retry[1:]
+		} else if g.next < len(stream.messages) {
+			index = g.next
+			g.next++
+		}
+		var msg *Message
+		if index >= 0 {
+			msg = stream.messages[index]
+		}
+		notify := stream.notify
+		b.mu.Unlock()
+
+		if msg == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-notify:
+			}
+			continue
+		}
+		if retried {
+			select {
+			case <-ctx.Done():
+				b.requeue(chain, group, index)
+				return nil
+			case <-time.After(b.retryInterval):
+			}
+		}
+		if err := handler(ctx, msg); err != nil {
+			b.requeue(chain, group, index)
+		}
+	}
+}
+
+// requeue 将消息放回消费组的重试队列
+func (b *MemoryBus) requeue(chain, group string, index int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g := b.stream(chain).groups[group]
+	g.retry = append([]int{index}, g.retry...)
+}
+
+func (b *MemoryBus) Replay(ctx context.Context, chain, group string, fromBlock uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream(chain)
+	next := len(stream.messages)
+	for i, msg := range stream.messages {
+		if msg.Event.BlockNumber >= fromBlock {
+			next = i
+			break
+		}
+	}
+	stream.groups[group] = &memoryGroup{next: next}
+	return nil
+}
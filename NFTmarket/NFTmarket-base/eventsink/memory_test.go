@@ -0,0 +1,104 @@
+package eventsink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect 消费指定链的事件，收到n条消息后返回
+func collect(t *testing.T, bus *MemoryBus, chain, group string, n int, handler Handler) []*Message {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var msgs []*Message
+	done := make(chan struct{})
+	go func() {
+		_ = bus.Consume(ctx, chain, group, "c1", func(ctx context.Context, msg *Message) error {
+			if handler != nil {
+				if err := handler(ctx, msg); err != nil {
+					return err
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			msgs = append(msgs, msg)
+			if len(msgs) == n {
+				close(done)
+			}
+			return nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("timeout waiting for %d messages", n)
+	}
+	cancel()
+	mu.Lock()
+	defer mu.Unlock()
+	return msgs
+}
+
+func TestMemoryBusConsume(t *testing.T) {
+	bus := NewMemoryBus()
+	ctx := context.Background()
+	assert.NoError(t, bus.Publish(ctx,
+		&Event{Type: OrderCreated, Chain: "eth", BlockNumber: 1, OrderId: "0x1"},
+		&Event{Type: OrderCreated, Chain: "sepolia", BlockNumber: 1, OrderId: "0x2"},
+		&Event{Type: OrderCancelled, Chain: "eth", BlockNumber: 2, OrderId: "0x1"},
+	))
+
+	msgs := collect(t, bus, "eth", "g1", 2, nil)
+	assert.Equal(t, OrderCreated, msgs[0].Event.Type)
+	assert.Equal(t, OrderCancelled, msgs[1].Event.Type)
+
+	// 不同消费组独立消费
+	msgs = collect(t, bus, "eth", "g2", 2, nil)
+	assert.Equal(t, "0x1", msgs[0].Event.OrderId)
+}
+
+func TestMemoryBusRedeliver(t *testing.T) {
+	bus := NewMemoryBus()
+	bus.retryInterval = time.Millisecond
+	ctx := context.Background()
+	assert.NoError(t, bus.Publish(ctx,
+		&Event{Type: OrderCreated, Chain: "eth", BlockNumber: 1, OrderId: "0x1"},
+		&Event{Type: OrderFilled, Chain: "eth", BlockNumber: 2, OrderId: "0x1"},
+	))
+
+	failed := false
+	msgs := collect(t, bus, "eth", "g1", 2, func(ctx context.Context, msg *Message) error {
+		if msg.Event.Type == OrderCreated && !failed {
+			failed = true
+			return errors.New("temporary error")
+		}
+		return nil
+	})
+	assert.True(t, failed)
+	assert.Equal(t, OrderCreated, msgs[0].Event.Type)
+	assert.Equal(t, OrderFilled, msgs[1].Event.Type)
+}
+
+func TestMemoryBusReplay(t *testing.T) {
+	bus := NewMemoryBus()
+	ctx := context.Background()
+	for block := uint64(1); block <= 5; block++ {
+		assert.NoError(t, bus.Publish(ctx, &Event{Type: OwnershipChanged, Chain: "eth", BlockNumber: block}))
+	}
+	collect(t, bus, "eth", "g1", 5, nil)
+
+	assert.NoError(t, bus.Replay(ctx, "eth", "g1", 4))
+	msgs := collect(t, bus, "eth", "g1", 2, nil)
+	assert.Equal(t, uint64(4), msgs[0].Event.BlockNumber)
+	assert.Equal(t, uint64(5), msgs[1].Event.BlockNumber)
+}
+
+func TestNextStreamID(t *testing.T) {
+	assert.Equal(t, "1700000000000-1", nextStreamID("1700000000000-0"))
+	assert.Equal(t, "bad", nextStreamID("bad"))
+}
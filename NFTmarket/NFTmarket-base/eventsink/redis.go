@@ -0,0 +1,266 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	red "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	RedisReadCount    = 100
+	RedisPollInterval = time.Second
+	// 其它消费者持有超过该时间仍未确认的消息会被认领，用于接管已退出的消费者
+	RedisClaimIdle     = time.Minute
+	RedisRetryInterval = time.Second
+	redisEventField    = "event"
+	redisReplayPage    = 500
+)
+
+// RedisBus 基于Redis Streams的事件总线，每条链一个stream
+type RedisBus struct {
+	redis  *redis.Redis
+	maxLen int64 // stream保留的最大消息数(近似)，0表示不限制
+}
+
+func NewRedisBus(r *redis.Redis, maxLen int64) *RedisBus {
+	return &RedisBus{redis: r, maxLen: maxLen}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		for _, event := range events {
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return errors.Wrap(err, "failed on marshal event")
+			}
+			p.XAdd(ctx, &red.XAddArgs{
+				Stream: StreamKey(event.Chain),
+				MaxLen: b.maxLen,
+				Approx: b.maxLen > 0,
+				Values: map[string]interface{}{redisEventField: string(payload)},
+			})
+		}
+		return nil
+	})
+}
+
+func (b *RedisBus) Consume(ctx context.Context, chain, group, consumer string, handler Handler) error {
+	stream := StreamKey(chain)
+	if err := b.createGroup(ctx, stream, group, "0"); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		// 先处理本消费者未确认的消息，再认领超时的消息，最后读取新消息
+		msgs, err := b.readGroup(ctx, stream, group, consumer, "0")
+		if err == nil && len(msgs) == 0 {
+			var claimed int
+			if claimed, err = b.claimIdle(ctx, stream, group, consumer); err == nil && claimed > 0 {
+				continue
+			}
+		}
+		if err == nil && len(msgs) == 0 {
+			msgs, err = b.readGroup(ctx, stream, group, consumer, ">")
+		}
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on read event stream",
+				zap.String("stream", stream), zap.String("group", group), zap.Error(err))
+			sleep(ctx, RedisRetryInterval)
+			continue
+		}
+		if len(msgs) == 0 {
+			sleep(ctx, RedisPollInterval)
+			continue
+		}
+
+		for _, msg := range msgs {
+			if msg.Event != nil {
+				if err := handler(ctx, msg); err != nil {
+					// 保留在待确认列表中，下一轮重新投递
+					xzap.WithContext(ctx).Error("failed on handle event",
+						zap.String("stream", stream), zap.String("id", msg.ID), zap.Error(err))
+					sleep(ctx, RedisRetryInterval)
+					break
+				}
+			}
+			if err := b.ack(ctx, stream, group, msg.ID); err != nil {
+				xzap.WithContext(ctx).Error("failed on ack event",
+					zap.String("stream", stream), zap.String("id", msg.ID), zap.Error(err))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (b *RedisBus) Replay(ctx context.Context, chain, group string, fromBlock uint64) error {
+	stream := StreamKey(chain)
+	// 按页扫描，找到第一条区块号不小于fromBlock的消息，将消费组位置设置为它之前的消息
+	start, id := "-", "$"
+	prev := "0"
+scan:
+	for {
+		var cmd *red.XMessageSliceCmd
+		if err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+			cmd = p.XRangeN(ctx, stream, start, "+", redisReplayPage)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "failed on range event stream")
+		}
+		page := cmd.Val()
+		for _, xmsg := range page {
+			event, err := decodeEvent(xmsg)
+			if err == nil && event.BlockNumber >= fromBlock {
+				id = prev
+				break scan
+			}
+			prev = xmsg.ID
+		}
+		if len(page) < redisReplayPage {
+			break
+		}
+		start = nextStreamID(page[len(page)-1].ID)
+	}
+
+	if err := b.createGroup(ctx, stream, group, id); err != nil {
+		return err
+	}
+	if err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XGroupSetID(ctx, stream, group, id)
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed on set consumer group position")
+	}
+	return nil
+}
+
+// createGroup 创建消费组，已存在时忽略
+func (b *RedisBus) createGroup(ctx context.Context, stream, group, start string) error {
+	err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XGroupCreateMkStream(ctx, stream, group, start)
+		return nil
+	})
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "failed on create consumer group")
+	}
+	return nil
+}
+
+func (b *RedisBus) readGroup(ctx context.Context, stream, group, consumer, id string) ([]*Message, error) {
+	var cmd *red.XStreamSliceCmd
+	err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XReadGroup(ctx, &red.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{stream, id},
+			Count:    RedisReadCount,
+			Block:    -1,
+		})
+		return nil
+	})
+	if err != nil && err != red.Nil {
+		return nil, err
+	}
+	var msgs []*Message
+	for _, xstream := range cmd.Val() {
+		for _, xmsg := range xstream.Messages {
+			event, err := decodeEvent(xmsg)
+			if err != nil {
+				// 已被裁剪或无法解析的消息直接确认
+				xzap.WithContext(ctx).Error("failed on decode event",
+					zap.String("stream", stream), zap.String("id", xmsg.ID), zap.Error(err))
+			}
+			msgs = append(msgs, &Message{ID: xmsg.ID, Event: event})
+		}
+	}
+	return msgs, nil
+}
+
+// claimIdle 认领其它消费者超时未确认的消息
+func (b *RedisBus) claimIdle(ctx context.Context, stream, group, consumer string) (int, error) {
+	var pendingCmd *red.XPendingExtCmd
+	if err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		pendingCmd = p.XPendingExt(ctx, &red.XPendingExtArgs{
+			Stream: stream,
+			Group:  group,
+			Start:  "-",
+			End:    "+",
+			Count:  RedisReadCount,
+		})
+		return nil
+	}); err != nil && err != red.Nil {
+		return 0, err
+	}
+	var ids []string
+	for _, pending := range pendingCmd.Val() {
+		if pending.Consumer != consumer && pending.Idle >= RedisClaimIdle {
+			ids = append(ids, pending.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XClaimJustID(ctx, &red.XClaimArgs{
+			Stream:   stream,
+			Group:    group,
+			Consumer: consumer,
+			MinIdle:  RedisClaimIdle,
+			Messages: ids,
+		})
+		return nil
+	}); err != nil && err != red.Nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func (b *RedisBus) ack(ctx context.Context, stream, group, id string) error {
+	return b.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XAck(ctx, stream, group, id)
+		return nil
+	})
+}
+
+func decodeEvent(xmsg red.XMessage) (*Event, error) {
+	payload, ok := xmsg.Values[redisEventField].(string)
+	if !ok {
+		return nil, errors.New("event field not found")
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return nil, errors.Wrap(err, "failed on unmarshal event")
+	}
+	return &event, nil
+}
+
+// nextStreamID 返回紧随id之后的消息id，用于分页扫描
+func nextStreamID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return id
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,34 @@
+package eventsink
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sink 发布市场事件
+type Sink interface {
+	// Publish 按顺序发布事件，events可以属于不同的链
+	Publish(ctx context.Context, events ...*Event) error
+}
+
+// Handler 处理单条消息，返回错误时消息不会被确认，稍后重新投递
+type Handler func(ctx context.Context, msg *Message) error
+
+// Source 以消费组的方式读取市场事件，同一消费组内的消费者共同消费，每条消息至少投递一次
+type Source interface {
+	// Consume 持续读取指定链的事件直到ctx结束，handler成功返回后确认消息
+	Consume(ctx context.Context, chain, group, consumer string, handler Handler) error
+	// Replay 将消费组的读取位置重置到第一条区块号不小于fromBlock的消息
+	Replay(ctx context.Context, chain, group string, fromBlock uint64) error
+}
+
+// Bus 同时支持发布和消费的事件总线
+type Bus interface {
+	Sink
+	Source
+}
+
+// StreamKey 每条链一个事件流
+func StreamKey(chain string) string {
+	return fmt.Sprintf("cache:es:events:%s", chain)
+}
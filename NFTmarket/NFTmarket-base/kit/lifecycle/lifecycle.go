@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/threading"
+)
+
+// State 后台协程的运行状态
+type State string
+
+const (
+	Running State = "running"
+	Stopped State = "stopped"
+)
+
+// Group 一组后台协程，记录每个协程的运行状态，停止时等待全部退出
+type Group struct {
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+	states map[string]State
+}
+
+func NewGroup() *Group {
+	return &Group{states: make(map[string]State)}
+}
+
+// Go 启动名为name的协程，panic时恢复并记录为已停止
+func (g *Group) Go(name string, fn func()) {
+	g.wg.Add(1)
+	g.setState(name, Running)
+	threading.GoSafe(func() {
+		defer g.wg.Done()
+		defer g.setState(name, Stopped)
+		fn()
+	})
+}
+
+func (g *Group) setState(name string, state State) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.states[name] = state
+}
+
+// Status 返回每个协程的运行状态
+func (g *Group) Status() map[string]State {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	status := make(map[string]State, len(g.states))
+	for name, state := range g.states {
+		status[name] = state
+	}
+	return status
+}
+
+// Running 返回仍在运行的协程名称
+func (g *Group) Running() []string {
+	var names []string
+	for name, state := range g.Status() {
+		if state == Running {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Wait 等待所有协程退出，ctx结束时返回仍在运行的协程
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "still running: %s", strings.Join(g.Running(), ","))
+	}
+}
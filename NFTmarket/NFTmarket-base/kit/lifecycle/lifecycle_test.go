@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup(t *testing.T) {
+	g := NewGroup()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	g.Go("loop", func() {
+		<-ctx.Done()
+	})
+	g.Go("panic", func() {
+		panic("boom")
+	})
+	release := make(chan struct{})
+	g.Go("slow", func() {
+		<-release
+	})
+
+	assert.Eventually(t, func() bool {
+		return g.Status()["panic"] == Stopped
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"loop", "slow"}, g.Running())
+
+	// 超时时返回仍在运行的协程
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	err := g.Wait(waitCtx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "slow")
+	}
+
+	close(release)
+	assert.NoError(t, g.Wait(context.Background()))
+	assert.Equal(t, map[string]State{"loop": Stopped, "panic": Stopped, "slow": Stopped}, g.Status())
+}
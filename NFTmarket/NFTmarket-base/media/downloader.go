@@ -0,0 +1,57 @@
+package media
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+var ErrTooLarge = errors.New("media file too large")
+
+// Downloader 下载媒体文件的原始内容，超过maxSize时返回ErrTooLarge
+type Downloader interface {
+	Download(ctx context.Context, uri string, maxSize int64) ([]byte, error)
+}
+
+// HTTPDownloader 通过metadata的URI解析获取媒体文件，支持http(s)、ipfs、ar和data URI，
+// ipfs和ar在多个网关间切换并跳过暂停使用的网关
+type HTTPDownloader struct {
+	Resolver nftchainservice.Resolver
+}
+
+// NewHTTPDownloader 创建下载器，ipfsGateway为空时使用默认的ipfs网关，各scheme的响应大小限制为maxSize
+func NewHTTPDownloader(ipfsGateway string, maxSize int64, timeout int64) (*HTTPDownloader, error) {
+	scheme := nftchainservice.SchemeConfig{MaxSize: maxSize}
+	ipfs := scheme
+	if ipfsGateway != "" {
+		ipfs.Gateways = []nftchainservice.GatewayConfig{{URL: ipfsGateway}}
+	}
+	registry, err := nftchainservice.NewRegistry(&nftchainservice.ResolverConfig{
+		Ipfs:    ipfs,
+		Arweave: scheme,
+		Http:    scheme,
+		Data:    scheme,
+		Timeout: timeout,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPDownloader{Resolver: registry}, nil
+}
+
+func (d *HTTPDownloader) Download(ctx context.Context, uri string, maxSize int64) ([]byte, error) {
+	data, err := d.Resolver.Resolve(ctx, uri)
+	if errors.Is(err, xhttp.ErrBodySizeLimit) {
+		return nil, ErrTooLarge
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on download media")
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
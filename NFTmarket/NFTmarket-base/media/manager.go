@@ -0,0 +1,328 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxSize         = 32 << 20 // 原始文件的最大字节数
+	DefaultMaxPixels       = 64 << 20 // 解码图片的最大像素数，防止解压炸弹
+	DefaultDownloadTimeout = 60       // 下载超时(秒)
+	JpegQuality            = 85
+)
+
+// DefaultThumbnailSizes 缩略图的宽度，按从小到大排列
+var DefaultThumbnailSizes = []int{128, 512}
+
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+// Kind 媒体文件的类别
+type Kind int
+
+const (
+	KindImage Kind = 1
+	KindVideo Kind = 2
+)
+
+// Config 媒体存储配置，Type为空时不启用
+type Config struct {
+	Type            string `toml:"type" mapstructure:"type" json:"type"`                                     // 存储后端，目前支持local
+	LocalDir        string `toml:"local_dir" mapstructure:"local_dir" json:"local_dir"`                      // local后端的存储目录
+	BaseURL         string `toml:"base_url" mapstructure:"base_url" json:"base_url"`                         // 存储目录对外访问的地址
+	IpfsGateway     string `toml:"ipfs_gateway" mapstructure:"ipfs_gateway" json:"ipfs_gateway"`             // ipfs网关前缀，为空时使用默认网关
+	MaxSize         int64  `toml:"max_size" mapstructure:"max_size" json:"max_size"`                         // 原始文件的最大字节数，0时使用默认值
+	DownloadTimeout int64  `toml:"download_timeout" mapstructure:"download_timeout" json:"download_timeout"` // 下载超时(秒)，0时使用默认值
+	ThumbnailSizes  []int  `toml:"thumbnail_sizes" mapstructure:"thumbnail_sizes" json:"thumbnail_sizes"`    // 缩略图宽度，为空时使用默认值
+}
+
+// Asset 处理后的媒体文件，URI和缩略图地址都由内容hash确定
+type Asset struct {
+	Hash        string
+	ContentType string
+	Kind        Kind
+	URI         string
+	Thumbnails  map[int]string // 缩略图宽度 -> 地址，只有图片有缩略图
+}
+
+// Manager 下载媒体文件，校验类型后按内容hash保存原文件，并为图片生成缩略图
+type Manager struct {
+	store      Store
+	downloader Downloader
+	maxSize    int64
+	maxPixels  int
+	sizes      []int
+}
+
+// NewManager 根据配置创建媒体管理器
+func NewManager(cfg *Config) (*Manager, error) {
+	if cfg == nil || cfg.Type == "" {
+		return nil, errors.New("media store is not configured")
+	}
+	var store Store
+	switch cfg.Type {
+	case "local":
+		localStore, err := NewLocalStore(cfg.LocalDir, cfg.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		store = localStore
+	default:
+		return nil, errors.Errorf("unsupported media store type: %s", cfg.Type)
+	}
+	timeout := cfg.DownloadTimeout
+	if timeout <= 0 {
+		timeout = DefaultDownloadTimeout
+	}
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	downloader, err := NewHTTPDownloader(cfg.IpfsGateway, maxSize, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return New(store, downloader, maxSize, cfg.ThumbnailSizes), nil
+}
+
+// New 创建媒体管理器，maxSize为0或sizes为空时使用默认值
+func New(store Store, downloader Downloader, maxSize int64, sizes []int) *Manager {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if len(sizes) == 0 {
+		sizes = DefaultThumbnailSizes
+	}
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+	return &Manager{
+		store:      store,
+		downloader: downloader,
+		maxSize:    maxSize,
+		maxPixels:  DefaultMaxPixels,
+		sizes:      sizes,
+	}
+}
+
+// Process 下载uri指向的文件并保存，相同内容只保存一次
+func (m *Manager) Process(ctx context.Context, uri string) (*Asset, error) {
+	data, err := m.downloader.Download(ctx, uri, m.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return m.Save(ctx, data)
+}
+
+// Save 校验并保存文件内容
+func (m *Manager) Save(ctx context.Context, data []byte) (*Asset, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty media file")
+	}
+	if int64(len(data)) > m.maxSize {
+		return nil, ErrTooLarge
+	}
+	contentType := DetectContentType(data)
+	var kind Kind
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		kind = KindImage
+	case strings.HasPrefix(contentType, "video/"):
+		kind = KindVideo
+	default:
+		return nil, errors.Wrap(ErrUnsupportedType, contentType)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	asset := &Asset{Hash: hash, ContentType: contentType, Kind: kind}
+
+	// 解码失败的栅格图片视为损坏的文件
+	var img image.Image
+	if kind == KindImage && isRaster(contentType) {
+		decoded, err := m.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		img = decoded
+	}
+
+	key := originalKey(hash)
+	if err := m.put(ctx, key, contentType, data); err != nil {
+		return nil, err
+	}
+	asset.URI = m.store.URL(key)
+	if kind != KindImage {
+		return asset, nil
+	}
+
+	asset.Thumbnails = make(map[int]string, len(m.sizes))
+	for _, size := range m.sizes {
+		thumbKey := thumbnailKey(hash, size)
+		thumb, thumbType, err := thumbnail(img, data, contentType, size)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.put(ctx, thumbKey, thumbType, thumb); err != nil {
+			return nil, err
+		}
+		asset.Thumbnails[size] = m.store.URL(thumbKey)
+	}
+	return asset, nil
+}
+
+// put 保存文件，内容由key确定，已存在时跳过
+func (m *Manager) put(ctx context.Context, key, contentType string, data []byte) error {
+	exists, err := m.store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return m.store.Put(ctx, key, contentType, data)
+}
+
+func (m *Manager) decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on decode image config")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > m.maxPixels {
+		return nil, errors.Errorf("invalid image size %dx%d", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on decode image")
+	}
+	return img, nil
+}
+
+// ThumbnailURL 返回由本管理器保存的图片的缩略图地址，其它地址原样返回
+func (m *Manager) ThumbnailURL(uri string, size int) string {
+	prefix := m.store.URL("")
+	if !strings.HasPrefix(uri, prefix) {
+		return uri
+	}
+	key := strings.TrimPrefix(uri, prefix)
+	hash := key[strings.LastIndex(key, "/")+1:]
+	if key != originalKey(hash) {
+		return uri
+	}
+	return m.store.URL(thumbnailKey(hash, size))
+}
+
+// GetSmallSizeImageUrl 返回最小尺寸的缩略图地址
+func (m *Manager) GetSmallSizeImageUrl(uri string) string {
+	return m.ThumbnailURL(uri, m.sizes[0])
+}
+
+// originalKey 原文件按hash的前两位分目录保存
+func originalKey(hash string) string {
+	if len(hash) < 2 {
+		return hash
+	}
+	return hash[:2] + "/" + hash
+}
+
+func thumbnailKey(hash string, size int) string {
+	return fmt.Sprintf("%s_%d", originalKey(hash), size)
+}
+
+// DetectContentType 识别文件类型，在http.DetectContentType的基础上识别svg
+func DetectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "text/xml") || strings.HasPrefix(contentType, "text/plain") {
+		head := data
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+	return contentType
+}
+
+// isRaster 是否为可以解码并缩放的图片
+func isRaster(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// thumbnail 将图片缩放到指定宽度，不能缩放或原图更小时使用原文件
+func thumbnail(img image.Image, data []byte, contentType string, width int) ([]byte, string, error) {
+	if img == nil || img.Bounds().Dx() <= width {
+		return data, contentType, nil
+	}
+	resized := resize(img, width)
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: JpegQuality}); err != nil {
+			return nil, "", errors.Wrap(err, "failed on encode jpeg thumbnail")
+		}
+		return buf.Bytes(), contentType, nil
+	}
+	if err := png.Encode(&buf, resized); err != nil {
+		return nil, "", errors.Wrap(err, "failed on encode png thumbnail")
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// resize 按宽度等比缩小，每个目标像素取对应源区域的平均值
+func resize(src image.Image, width int) *image.NRGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	height := srcH * width / srcW
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcH/height
+		y1 := bounds.Min.Y + (y+1)*srcH/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcW/width
+			x1 := bounds.Min.X + (x+1)*srcW/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDownloader map[string][]byte
+
+func (d fakeDownloader) Download(ctx context.Context, uri string, maxSize int64) ([]byte, error) {
+	data, ok := d[uri]
+	if !ok {
+		return nil, errors.Errorf("not found: %s", uri)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+func testPng(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func newTestManager(t *testing.T, files fakeDownloader) (*Manager, string) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "https://media.example.com/")
+	assert.NoError(t, err)
+	return New(store, files, 1<<20, []int{512, 128}), dir
+}
+
+func TestProcessImage(t *testing.T) {
+	original := testPng(t, 600, 300)
+	m, dir := newTestManager(t, fakeDownloader{
+		"ipfs://a.png": original,
+		"ipfs://b.png": original,
+	})
+	ctx := context.Background()
+
+	asset, err := m.Process(ctx, "ipfs://a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, KindImage, asset.Kind)
+	assert.Equal(t, "image/png", asset.ContentType)
+	assert.Equal(t, "https://media.example.com/"+asset.Hash[:2]+"/"+asset.Hash, asset.URI)
+
+	// 缩略图按宽度等比缩小
+	for size, height := range map[int]int{128: 64, 512: 256} {
+		assert.Equal(t, m.ThumbnailURL(asset.URI, size), asset.Thumbnails[size])
+		raw, err := os.ReadFile(filepath.Join(dir, asset.Hash[:2], fmt.Sprintf("%s_%d", asset.Hash, size)))
+		assert.NoError(t, err)
+		cfg, err := png.DecodeConfig(bytes.NewReader(raw))
+		assert.NoError(t, err)
+		assert.Equal(t, size, cfg.Width)
+		assert.Equal(t, height, cfg.Height)
+	}
+	assert.Equal(t, asset.Thumbnails[128], m.GetSmallSizeImageUrl(asset.URI))
+
+	// 相同内容的地址相同
+	again, err := m.Process(ctx, "ipfs://b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, asset.URI, again.URI)
+
+	// 不是本管理器保存的地址原样返回
+	assert.Equal(t, "ipfs://a.png", m.GetSmallSizeImageUrl("ipfs://a.png"))
+}
+
+func TestProcessSmallImageAndVideo(t *testing.T) {
+	small := testPng(t, 100, 50)
+	video := append([]byte{0, 0, 0, 0x18}, []byte("ftypmp42\x00\x00\x00\x00mp42isom")...)
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"></svg>`)
+	m, _ := newTestManager(t, fakeDownloader{
+		"small": small,
+		"video": video,
+		"svg":   svg,
+		"text":  []byte("hello"),
+		"bad":   append([]byte("\x89PNG\r\n\x1a\n"), 0, 0, 0),
+		"large": make([]byte, 2<<20),
+	})
+	ctx := context.Background()
+
+	// 原图比缩略图小时使用原图
+	asset, err := m.Process(ctx, "small")
+	assert.NoError(t, err)
+	assert.Len(t, asset.Thumbnails, 2)
+
+	asset, err = m.Process(ctx, "video")
+	assert.NoError(t, err)
+	assert.Equal(t, KindVideo, asset.Kind)
+	assert.Equal(t, "video/mp4", asset.ContentType)
+	assert.Empty(t, asset.Thumbnails)
+
+	asset, err = m.Process(ctx, "svg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", asset.ContentType)
+
+	_, err = m.Process(ctx, "text")
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	_, err = m.Process(ctx, "bad")
+	assert.Error(t, err)
+	_, err = m.Process(ctx, "large")
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestHTTPDownloader(t *testing.T) {
+	var requested []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		_, _ = w.Write([]byte("ipfs"))
+	}))
+	defer gateway.Close()
+	d, err := NewHTTPDownloader(gateway.URL+"/ipfs/", 10, 5)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	data, err := d.Download(ctx, "ipfs://ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.png", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ipfs"), data)
+	assert.Equal(t, []string{"/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.png"}, requested)
+
+	data, err = d.Download(ctx, "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("png")), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("png"), data)
+
+	data, err = d.Download(ctx, "data:image/svg+xml,%3Csvg%3E", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("<svg>"), data)
+
+	_, err = d.Download(ctx, "data:text/plain;base64,"+base64.StdEncoding.EncodeToString(make([]byte, 100)), 10)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = d.Download(ctx, "ipfs://ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.png", 2)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
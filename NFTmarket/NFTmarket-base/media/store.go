@@ -0,0 +1,79 @@
+package media
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Store 按key保存媒体文件的存储后端，key由内容hash生成，相同的key内容相同
+type Store interface {
+	// Put 保存文件，key已存在时覆盖
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Exists 文件是否已保存
+	Exists(ctx context.Context, key string) (bool, error)
+	// URL 返回文件的访问地址
+	URL(key string) string
+}
+
+// LocalStore 本地文件系统存储，用于测试和单机部署，由baseURL对应的静态文件服务对外提供访问
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	if root == "" {
+		return nil, errors.New("empty local media dir")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed on create local media dir")
+	}
+	return &LocalStore{root: root, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put 先写入临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed on create media dir")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed on create temp media file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed on write media file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed on close media file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "failed on rename media file")
+	}
+	return nil
+}
+
+func (s *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, errors.Wrap(err, "failed on stat media file")
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,123 @@
+package media
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+const (
+	UploadPollInterval = 10 // 没有待处理的图片时的轮询间隔(秒)
+	UploadBatchSize    = 20 // 每轮最多处理的item数量
+)
+
+// Uploader 处理ob_item_external中未上传的图片，保存后写回存储地址和视频类型
+// metadata刷新更换图片时会重置上传状态，item会被重新处理
+type Uploader struct {
+	ctx     context.Context
+	db      *gorm.DB
+	manager *Manager
+	chain   string
+	loops   *lifecycle.Group
+}
+
+func NewUploader(ctx context.Context, db *gorm.DB, manager *Manager, chain string) *Uploader {
+	return &Uploader{
+		ctx:     ctx,
+		db:      db,
+		manager: manager,
+		chain:   chain,
+		loops:   lifecycle.NewGroup(),
+	}
+}
+
+func (u *Uploader) Start() {
+	u.loops.Go("upload", u.uploadLoop)
+}
+
+// Wait 等待后台协程退出，ctx结束时返回仍在运行的协程
+func (u *Uploader) Wait(ctx context.Context) error {
+	return u.loops.Wait(ctx)
+}
+
+// Status 返回后台协程的运行状态
+func (u *Uploader) Status() map[string]lifecycle.State {
+	return u.loops.Status()
+}
+
+func (u *Uploader) uploadLoop() {
+	for {
+		n, err := u.UploadBatch()
+		if err != nil {
+			xzap.WithContext(u.ctx).Error("failed on upload item images",
+				zap.String("chain", u.chain), zap.Error(err))
+		}
+		// 还有待处理的图片时立即处理下一批
+		if err == nil && n == UploadBatchSize {
+			continue
+		}
+		select {
+		case <-u.ctx.Done():
+			return
+		case <-time.After(UploadPollInterval * time.Second):
+		}
+	}
+}
+
+// UploadBatch 处理一批未上传的图片，返回处理的数量
+func (u *Uploader) UploadBatch() (int, error) {
+	var externals []multi.ItemExternal
+	if err := u.db.WithContext(u.ctx).Table(multi.ItemExternalTableName(u.chain)).
+		Where("is_uploaded_oss = ? and upload_status = ? and image_uri != ''", false, multi.OK).
+		Order("id").Limit(UploadBatchSize).Find(&externals).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get item externals")
+	}
+	for i := range externals {
+		if u.ctx.Err() != nil {
+			return i, nil
+		}
+		if err := u.upload(&externals[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(externals), nil
+}
+
+// upload 保存单个item的图片，下载或校验失败时标记为获取图片失败
+func (u *Uploader) upload(external *multi.ItemExternal) error {
+	updates := map[string]interface{}{"update_time": time.Now().UnixMilli()}
+	asset, err := u.manager.Process(u.ctx, external.ImageUri)
+	if err != nil {
+		if u.ctx.Err() != nil {
+			return nil
+		}
+		xzap.WithContext(u.ctx).Warn("failed on process item image",
+			zap.String("collection_address", external.CollectionAddress), zap.String("token_id", external.TokenId),
+			zap.String("image_uri", external.ImageUri), zap.Error(err))
+		updates["upload_status"] = multi.FetchImageFailed
+	} else {
+		updates["is_uploaded_oss"] = true
+		updates["oss_uri"] = asset.URI
+		if asset.Kind == KindVideo {
+			updates["is_video_uploaded"] = true
+			updates["video_type"] = asset.ContentType
+			updates["video_uri"] = external.ImageUri
+			updates["video_oss_uri"] = asset.URI
+		}
+	}
+
+	// 只更新处理期间图片地址没有变化的记录
+	if err := u.db.WithContext(u.ctx).Table(multi.ItemExternalTableName(u.chain)).
+		Where("id = ? and image_uri = ?", external.ID, external.ImageUri).
+		Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update item external")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package metadatarefresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const CacheRefreshSingleItemMetadataKey = "cache:%s:%s:item:refresh:metadata"
+
+// GetRefreshSingleItemMetadataKey 每个项目、每条链一个刷新队列(Redis set)
+func GetRefreshSingleItemMetadataKey(project, chain string) string {
+	return fmt.Sprintf(CacheRefreshSingleItemMetadataKey, strings.ToLower(project), strings.ToLower(chain))
+}
+
+// RefreshItem 刷新队列中的item
+type RefreshItem struct {
+	ChainID        int64  `json:"chain_id"`
+	CollectionAddr string `json:"collection_addr"`
+	TokenID        string `json:"token_id"`
+}
+
+// AddToQueue 将item加入刷新队列，返回是否为新加入
+func AddToQueue(ctx context.Context, kv *xkv.Store, project, chain string, item *RefreshItem) (bool, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return false, errors.Wrap(err, "failed on marshal item info")
+	}
+	n, err := kv.SaddCtx(ctx, GetRefreshSingleItemMetadataKey(project, chain), string(raw))
+	if err != nil {
+		return false, errors.Wrap(err, "failed on push item to refresh metadata queue")
+	}
+	return n > 0, nil
+}
+
+// popFromQueue 从刷新队列中随机取出一个item，队列为空时返回nil
+// 取出后未记录刷新结果的item状态仍为等待刷新，重启时由requeuePending重新入队
+func popFromQueue(ctx context.Context, kv *xkv.Store, project, chain string) (*RefreshItem, error) {
+	raw, err := kv.SpopCtx(ctx, GetRefreshSingleItemMetadataKey(project, chain))
+	if err == redis.Nil || (err == nil && raw == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pop item from refresh metadata queue")
+	}
+	var item RefreshItem
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		return nil, errors.Wrapf(err, "failed on unmarshal refresh item: %s", raw)
+	}
+	return &item, nil
+}
@@ -0,0 +1,320 @@
+package metadatarefresh
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	PollInterval     = 5   // 队列为空时的轮询间隔(秒)
+	BatchSize        = 20  // 每轮最多刷新的item数量
+	RequeueBatchSize = 500 // 启动时每批重新入队的等待刷新item数量
+	MaxReasonLength  = 512
+)
+
+// Fetcher 获取链上metadata和owner，由nftchainservice.Service实现
+type Fetcher interface {
+	FetchOnChainMetadata(collectionAddr string, tokenID string) (*nftchainservice.JsonMetadata, error)
+	FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error)
+	TokenStandard(collectionAddr string) int64
+}
+
+// Service 消费后端写入的刷新队列，从链上重新获取item的metadata并写入item、trait和external表
+type Service struct {
+	ctx     context.Context
+	db      *gorm.DB
+	kv      *xkv.Store
+	fetcher Fetcher
+	chain   string
+	chainId int64
+	project string
+	loops   *lifecycle.Group
+}
+
+func New(ctx context.Context, db *gorm.DB, kv *xkv.Store, fetcher Fetcher, chain string, chainId int64, project string) *Service {
+	return &Service{
+		ctx:     ctx,
+		db:      db,
+		kv:      kv,
+		fetcher: fetcher,
+		chain:   chain,
+		chainId: chainId,
+		project: project,
+		loops:   lifecycle.NewGroup(),
+	}
+}
+
+func (s *Service) Start() {
+	s.loops.Go("refresh", s.refreshLoop)
+}
+
+// Wait 等待后台协程退出，ctx结束时返回仍在运行的协程
+func (s *Service) Wait(ctx context.Context) error {
+	return s.loops.Wait(ctx)
+}
+
+// Status 返回后台协程的运行状态
+func (s *Service) Status() map[string]lifecycle.State {
+	return s.loops.Status()
+}
+
+func (s *Service) refreshLoop() {
+	if err := s.requeuePending(); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on requeue pending item metadata refresh",
+			zap.String("chain", s.chain), zap.Error(err))
+	}
+	for {
+		n, err := s.refreshBatch()
+		if err != nil {
+			xzap.WithContext(s.ctx).Error("failed on refresh item metadata",
+				zap.String("chain", s.chain), zap.Error(err))
+		}
+		// 队列中还有item时立即处理下一批
+		if err == nil && n == BatchSize {
+			continue
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(PollInterval * time.Second):
+		}
+	}
+}
+
+// requeuePending 将刷新状态仍为等待刷新的item重新加入队列
+// item从队列取出后、记录刷新结果前进程退出时，请求已不在队列中，启动时补回避免丢失；队列中已有的item不会重复加入
+func (s *Service) requeuePending() error {
+	var rows []multi.ItemMetadataRefresh
+	requeued := 0
+	err := s.db.WithContext(s.ctx).Table(multi.ItemMetadataRefreshTableName(s.chain)).
+		Where("status = ?", multi.MetadataRefreshPending).
+		FindInBatches(&rows, RequeueBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				added, err := AddToQueue(s.ctx, s.kv, s.project, s.chain, &RefreshItem{
+					ChainID:        s.chainId,
+					CollectionAddr: row.CollectionAddress,
+					TokenID:        row.TokenId,
+				})
+				if err != nil {
+					return err
+				}
+				if added {
+					requeued++
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on requeue pending items")
+	}
+	if requeued > 0 {
+		xzap.WithContext(s.ctx).Info("requeue pending item metadata refresh",
+			zap.String("chain", s.chain), zap.Int("count", requeued))
+	}
+	return nil
+}
+
+// refreshBatch 从队列中取出最多BatchSize个item刷新，返回取出的数量
+func (s *Service) refreshBatch() (int, error) {
+	for i := 0; i < BatchSize; i++ {
+		if s.ctx.Err() != nil {
+			return i, nil
+		}
+		item, err := popFromQueue(s.ctx, s.kv, s.project, s.chain)
+		if err != nil {
+			return i, err
+		}
+		if item == nil {
+			return i, nil
+		}
+		if item.ChainID != s.chainId {
+			xzap.WithContext(s.ctx).Warn("refresh item from another chain, skip it",
+				zap.String("chain", s.chain), zap.Int64("chain_id", item.ChainID))
+			continue
+		}
+		s.Refresh(item.CollectionAddr, item.TokenID)
+	}
+	return BatchSize, nil
+}
+
+// Refresh 从链上获取item的metadata并写入数据库，结果记录在刷新状态表中
+func (s *Service) Refresh(collectionAddr, tokenId string) {
+	collectionAddr = strings.ToLower(collectionAddr)
+	err := s.refresh(collectionAddr, tokenId)
+	if err == nil {
+		return
+	}
+	xzap.WithContext(s.ctx).Error("failed on refresh item metadata",
+		zap.String("collection_address", collectionAddr), zap.String("token_id", tokenId), zap.Error(err))
+	if err := s.recordStatus(s.db.WithContext(s.ctx), collectionAddr, tokenId, multi.MetadataRefreshFailed, err.Error()); err != nil {
+		xzap.WithContext(s.ctx).Error("failed on record item metadata refresh status",
+			zap.String("collection_address", collectionAddr), zap.String("token_id", tokenId), zap.Error(err))
+	}
+}
+
+func (s *Service) refresh(collectionAddr, tokenId string) error {
+	metadata, err := s.fetcher.FetchOnChainMetadata(collectionAddr, tokenId)
+	if err != nil {
+		return errors.Wrap(err, "failed on fetch on chain metadata")
+	}
+
+	// item不存在时从链上获取owner后创建
+	var count int64
+	if err := s.db.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+		Count(&count).Error; err != nil {
+		return errors.Wrap(err, "failed on get item")
+	}
+	// ERC-1155的持有者和发行量由转移事件维护
+	var owner string
+	supply := int64(1)
+	if count == 0 && s.fetcher.TokenStandard(collectionAddr) == multi.TokenStandardERC1155 {
+		supply = 0
+	} else if count == 0 {
+		address, err := s.fetcher.FetchNftOwner(collectionAddr, tokenId)
+		if err != nil {
+			return errors.Wrap(err, "failed on fetch nft owner")
+		}
+		owner = strings.ToLower(address.String())
+	}
+
+	// metadata中没有名称时保留原有名称
+	updates := []string{"update_time"}
+	if metadata.Name != "" {
+		updates = append(updates, "name")
+	}
+
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.AssignmentColumns(updates),
+		}).Create(&multi.Item{
+			ChainId:           int(s.chainId),
+			CollectionAddress: collectionAddr,
+			TokenId:           tokenId,
+			Name:              metadata.Name,
+			Owner:             owner,
+			Creator:           owner,
+			Supply:            supply,
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on upsert item")
+		}
+
+		if err := tx.Table(multi.ItemTraitTableName(s.chain)).
+			Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+			Delete(&multi.ItemTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete item traits")
+		}
+		if traits := itemTraits(collectionAddr, tokenId, metadata); len(traits) > 0 {
+			if err := tx.Table(multi.ItemTraitTableName(s.chain)).Create(&traits).Error; err != nil {
+				return errors.Wrap(err, "failed on create item traits")
+			}
+		}
+
+		if err := s.upsertExternal(tx, collectionAddr, tokenId, metadata.Image); err != nil {
+			return err
+		}
+		return s.recordStatus(tx, collectionAddr, tokenId, multi.MetadataRefreshDone, "")
+	})
+}
+
+// upsertExternal 更新item图片地址，图片变化时需要重新上传oss
+func (s *Service) upsertExternal(tx *gorm.DB, collectionAddr, tokenId, image string) error {
+	var externals []multi.ItemExternal
+	if err := tx.Table(multi.ItemExternalTableName(s.chain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+		Limit(1).Find(&externals).Error; err != nil {
+		return errors.Wrap(err, "failed on get item external")
+	}
+	if len(externals) == 0 {
+		if err := tx.Table(multi.ItemExternalTableName(s.chain)).Create(&multi.ItemExternal{
+			CollectionAddress: collectionAddr,
+			TokenId:           tokenId,
+			ImageUri:          image,
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on create item external")
+		}
+		return nil
+	}
+	if externals[0].ImageUri == image {
+		return nil
+	}
+	if err := tx.Table(multi.ItemExternalTableName(s.chain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+		Updates(map[string]interface{}{
+			"image_uri":       image,
+			"is_uploaded_oss": false,
+			"upload_status":   multi.OK,
+			"oss_uri":         "",
+			"update_time":     time.Now().UnixMilli(),
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on update item external")
+	}
+	return nil
+}
+
+// recordStatus 记录item最近一次刷新的结果
+func (s *Service) recordStatus(tx *gorm.DB, collectionAddr, tokenId string, status int, reason string) error {
+	if len(reason) > MaxReasonLength {
+		reason = reason[:MaxReasonLength]
+	}
+	if err := tx.Table(multi.ItemMetadataRefreshTableName(s.chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "reason", "refresh_time", "update_time"}),
+	}).Create(&multi.ItemMetadataRefresh{
+		CollectionAddress: collectionAddr,
+		TokenId:           tokenId,
+		Status:            status,
+		Reason:            reason,
+		RefreshTime:       time.Now().Unix(),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on record item metadata refresh status")
+	}
+	return nil
+}
+
+// itemTraits 将metadata中的属性转换为item trait，忽略属性名或属性值为空的项
+func itemTraits(collectionAddr, tokenId string, metadata *nftchainservice.JsonMetadata) []multi.ItemTrait {
+	var traits []multi.ItemTrait
+	for _, attr := range metadata.Attributes {
+		if attr == nil || attr.TraitType == "" || attr.Value == "" {
+			continue
+		}
+		traits = append(traits, multi.ItemTrait{
+			CollectionAddress: collectionAddr,
+			TokenId:           tokenId,
+			Trait:             attr.TraitType,
+			TraitValue:        attr.Value,
+		})
+	}
+	return traits
+}
+
+// MarkPending 将item标记为等待刷新，由加入刷新队列的一方调用
+func MarkPending(ctx context.Context, db *gorm.DB, chain, collectionAddr, tokenId string) error {
+	if err := db.WithContext(ctx).Table(multi.ItemMetadataRefreshTableName(chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "reason", "request_time", "update_time"}),
+	}).Create(&multi.ItemMetadataRefresh{
+		CollectionAddress: strings.ToLower(collectionAddr),
+		TokenId:           tokenId,
+		Status:            multi.MetadataRefreshPending,
+		RequestTime:       time.Now().Unix(),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on mark item metadata refresh pending")
+	}
+	return nil
+}
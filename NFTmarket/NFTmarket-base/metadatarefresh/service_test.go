@@ -0,0 +1,58 @@
+package metadatarefresh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+func TestQueue(t *testing.T) {
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore([]cache.NodeConf{{
+		RedisConf: redis.RedisConf{Host: mr.Addr(), Type: "node"},
+		Weight:    100,
+	}})
+	ctx := context.Background()
+	item := &RefreshItem{ChainID: 11155111, CollectionAddr: "0xabc", TokenID: "1"}
+
+	added, err := AddToQueue(ctx, kv, "OrderBookDex", "sepolia", item)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	// 队列中已有的item不重复加入
+	added, err = AddToQueue(ctx, kv, "OrderBookDex", "sepolia", item)
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.True(t, mr.Exists("cache:orderbookdex:sepolia:item:refresh:metadata"))
+
+	popped, err := popFromQueue(ctx, kv, "OrderBookDex", "sepolia")
+	assert.NoError(t, err)
+	assert.Equal(t, item, popped)
+	popped, err = popFromQueue(ctx, kv, "OrderBookDex", "sepolia")
+	assert.NoError(t, err)
+	assert.Nil(t, popped)
+}
+
+func TestItemTraits(t *testing.T) {
+	metadata := &nftchainservice.JsonMetadata{
+		Attributes: []*nftchainservice.OpenseaMetadataProps{
+			{TraitType: "Background", Value: "Blue"},
+			{TraitType: "", Value: "Red"},
+			nil,
+			{TraitType: "Eyes", Value: ""},
+			{TraitType: "Level", Value: "3"},
+		},
+	}
+	traits := itemTraits("0xabc", "1", metadata)
+	assert.Len(t, traits, 2)
+	assert.Equal(t, "Background", traits[0].Trait)
+	assert.Equal(t, "Blue", traits[0].TraitValue)
+	assert.Equal(t, "Level", traits[1].Trait)
+	assert.Equal(t, "0xabc", traits[1].CollectionAddress)
+}
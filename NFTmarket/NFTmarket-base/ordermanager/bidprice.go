@@ -0,0 +1,121 @@
+package ordermanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+// CollectionPrice collection的最优价格快照，由OrderManager在价格变化时写入Redis
+type CollectionPrice struct {
+	CollectionAddress string          `json:"collection_address"`
+	FloorPrice        decimal.Decimal `json:"floor_price"`
+	BestBid           decimal.Decimal `json:"best_bid"`      // 最高集合出价
+	BestItemBid       decimal.Decimal `json:"best_item_bid"` // 所有item中的最高出价
+	Spread            decimal.Decimal `json:"spread"`        // 地板价与最高集合出价之差，任一方为空时为0
+	EventTime         int64           `json:"event_time"`
+}
+
+func GenCollectionPriceKey(chain, address string) string {
+	return fmt.Sprintf("cache:es:%s:collection:price:%s", strings.ToLower(chain), strings.ToLower(address))
+}
+
+// equal 比较价格是否相同，忽略事件时间
+func (p *CollectionPrice) equal(other *CollectionPrice) bool {
+	return p.FloorPrice.Equal(other.FloorPrice) &&
+		p.BestBid.Equal(other.BestBid) &&
+		p.BestItemBid.Equal(other.BestItemBid)
+}
+
+// currentPrice 根据订单簿计算当前的最优价格快照
+func (info *collectionTradeInfo) currentPrice(address string) CollectionPrice {
+	price := CollectionPrice{
+		CollectionAddress: strings.ToLower(address),
+		FloorPrice:        info.floorPrice,
+		BestBid:           info.bids.BestPrice(),
+		BestItemBid:       info.itemBids.BestPrice(),
+		EventTime:         time.Now().Unix(),
+	}
+	if !price.FloorPrice.IsZero() && !price.BestBid.IsZero() {
+		price.Spread = price.FloorPrice.Sub(price.BestBid)
+	}
+	return price
+}
+
+// checkAndUpdateBidPrice 检查集合的最高集合出价、最高item出价和价差，
+// 任一价格变化时写入Redis并记录到历史表，均成功后才更新内存中的快照
+func (om *OrderManager) checkAndUpdateBidPrice(address string) error {
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(address)]
+	if !ok {
+		return nil
+	}
+
+	price := tradeInfo.currentPrice(address)
+	if price.equal(&tradeInfo.price) {
+		return nil
+	}
+
+	if err := om.cacheCollectionPrice(&price); err != nil {
+		return err
+	}
+	if err := om.persistCollectionBidPrice(&price); err != nil {
+		return err
+	}
+	tradeInfo.price = price
+
+	xzap.WithContext(om.Ctx).Info("update collection bid price",
+		zap.String("collection_addr", address),
+		zap.String("best_bid", price.BestBid.String()),
+		zap.String("best_item_bid", price.BestItemBid.String()),
+		zap.String("spread", price.Spread.String()))
+	return nil
+}
+
+// cacheCollectionPrice 将最优价格快照写入Redis
+func (om *OrderManager) cacheCollectionPrice(price *CollectionPrice) error {
+	if err := om.Xkv.Write(GenCollectionPriceKey(om.chain, price.CollectionAddress), price); err != nil {
+		return errors.Wrap(err, "failed on write collection price")
+	}
+	return nil
+}
+
+// persistCollectionBidPrice 记录最高出价和价差的变化，同一秒内的多次变化只保留最后一次
+func (om *OrderManager) persistCollectionBidPrice(price *CollectionPrice) error {
+	record := multi.CollectionBidPrice{
+		CollectionAddress: price.CollectionAddress,
+		BestBid:           price.BestBid,
+		BestItemBid:       price.BestItemBid,
+		Spread:            price.Spread,
+		EventTime:         price.EventTime,
+	}
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionBidPriceTableName(om.project, om.chain)).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"best_bid", "best_item_bid", "spread", "update_time"}),
+		}).Create(&record).Error; err != nil {
+		return errors.Wrap(err, "failed on insert collection bid price")
+	}
+	return nil
+}
+
+// GetCollectionPrice 从Redis读取collection的最优价格快照，快照不存在时返回false
+func GetCollectionPrice(kv *xkv.Store, chain, address string) (*CollectionPrice, bool, error) {
+	var price CollectionPrice
+	ok, err := kv.Read(GenCollectionPriceKey(chain, address), &price)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed on read collection price")
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return &price, true, nil
+}
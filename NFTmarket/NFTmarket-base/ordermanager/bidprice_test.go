@@ -0,0 +1,60 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestCollectionCurrentPrice(t *testing.T) {
+	info := newCollectionTradeInfo(decimal.Zero)
+	info.book(multi.ItemBidOrder).Add("1", decimal.NewFromFloat(0.7), "a", "1")
+	info.book(multi.ItemBidOrder).Add("2", decimal.NewFromFloat(0.9), "b", "2")
+
+	// 没有地板价或集合出价时价差为0
+	price := info.currentPrice("0xABC")
+	assert.Equal(t, "0xabc", price.CollectionAddress)
+	assert.True(t, price.BestBid.IsZero())
+	assert.Equal(t, decimal.NewFromFloat(0.9), price.BestItemBid)
+	assert.True(t, price.Spread.IsZero())
+
+	info.floorPrice = decimal.NewFromFloat(1.2)
+	info.book(multi.CollectionBidOrder).Add("3", decimal.NewFromFloat(0.8), "c", "0")
+	info.book(multi.CollectionBidOrder).Add("4", decimal.NewFromFloat(1.0), "d", "0")
+	price = info.currentPrice("0xabc")
+	assert.Equal(t, decimal.NewFromFloat(1.0), price.BestBid)
+	assert.True(t, price.Spread.Equal(decimal.NewFromFloat(0.2)))
+
+	// 事件时间不影响价格比较
+	next := info.currentPrice("0xabc")
+	next.EventTime++
+	assert.True(t, price.equal(&next))
+	info.itemBids.Remove("2")
+	next = info.currentPrice("0xabc")
+	assert.False(t, price.equal(&next))
+}
+
+func TestCacheCollectionPrice(t *testing.T) {
+	mr := miniredis.RunT(t)
+	om := newTestSnapshotManager(mr)
+
+	_, ok, err := GetCollectionPrice(om.Xkv, "sepolia", "0xabc")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, om.cacheCollectionPrice(&CollectionPrice{
+		CollectionAddress: "0xabc",
+		FloorPrice:        decimal.NewFromFloat(1.2),
+		BestBid:           decimal.NewFromFloat(1.0),
+		Spread:            decimal.NewFromFloat(0.2),
+	}))
+	price, ok, err := GetCollectionPrice(om.Xkv, "Sepolia", "0xABC")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, price.BestBid.Equal(decimal.NewFromFloat(1.0)))
+	assert.True(t, price.Spread.Equal(decimal.NewFromFloat(0.2)))
+}
@@ -0,0 +1,175 @@
+package ordermanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+// CandlePeriod 地板价K线的周期
+type CandlePeriod struct {
+	Name    string
+	Seconds int64
+}
+
+var CandlePeriods = []CandlePeriod{
+	{Name: "5m", Seconds: 5 * 60},
+	{Name: "1h", Seconds: 60 * 60},
+	{Name: "1d", Seconds: 24 * 60 * 60},
+}
+
+// CandlePeriodSeconds 返回K线周期的秒数，不支持的周期返回false
+func CandlePeriodSeconds(name string) (int64, bool) {
+	for _, period := range CandlePeriods {
+		if period.Name == name {
+			return period.Seconds, true
+		}
+	}
+	return 0, false
+}
+
+type candleKey struct {
+	address  string
+	period   string
+	openTime int64
+}
+
+// candle 上次写入数据库之后的K线增量，写入时与数据库中的同一根K线合并
+type candle struct {
+	open, high, low, close decimal.Decimal
+	listedCount            int64
+	volume                 decimal.Decimal
+	sales                  int64
+	position               int64 // 计入增量的最后一个交易事件的队列位置
+}
+
+// observe 记录一次地板价，地板价为0时表示没有挂单，不计入开高低收
+func (c *candle) observe(floorPrice decimal.Decimal) {
+	if floorPrice.IsZero() {
+		return
+	}
+	if c.open.IsZero() {
+		c.open = floorPrice
+	}
+	if c.high.IsZero() || floorPrice.GreaterThan(c.high) {
+		c.high = floorPrice
+	}
+	if c.low.IsZero() || floorPrice.LessThan(c.low) {
+		c.low = floorPrice
+	}
+	c.close = floorPrice
+}
+
+// candleTime 事件计入K线的时间，回滚补偿等没有区块时间的事件按处理时间统计
+func candleTime(event *TradeEvent) int64 {
+	if event.BlockTime > 0 {
+		return event.BlockTime
+	}
+	return time.Now().Unix()
+}
+
+// observeCandle 在交易事件处理完成后记录collection的地板价、上架数量和成交额，position为事件在队列中的位置，
+// 已写入数据库的K线不再计入位置不晚于写入位置的重放事件。K线增量只在floorPriceProcess协程中访问
+func (om *OrderManager) observeCandle(address string, tradeInfo *collectionTradeInfo, volume decimal.Decimal, now, position int64) {
+	address = strings.ToLower(address)
+	for _, period := range CandlePeriods {
+		key := candleKey{address: address, period: period.Name, openTime: now - now%period.Seconds}
+		if position <= om.flushedCandles[key] {
+			continue
+		}
+		c, ok := om.candles[key]
+		if !ok {
+			c = &candle{}
+			om.candles[key] = c
+		}
+		c.observe(tradeInfo.floorPrice)
+		c.listedCount = int64(tradeInfo.listings.Tokens())
+		if volume.IsPositive() {
+			c.volume = c.volume.Add(volume)
+			c.sales++
+		}
+		c.position = position
+	}
+}
+
+// flushCandles 将K线增量合并写入数据库，在保存快照之前调用。每根K线记录已合并的最后一个事件的队列位置，
+// 写入后、保存快照前退出时，重启后重放的事件由loadFlushedCandles跳过，不会重复统计
+func (om *OrderManager) flushCandles() error {
+	keys := make([]candleKey, 0, len(om.candles))
+	for key := range om.candles {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].address != keys[j].address {
+			return keys[i].address < keys[j].address
+		}
+		if keys[i].period != keys[j].period {
+			return keys[i].period < keys[j].period
+		}
+		return keys[i].openTime < keys[j].openTime
+	})
+
+	now := time.Now().UnixMilli()
+	for i := 0; i < len(keys); i += MaxBatchReqNum {
+		end := i + MaxBatchReqNum
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*13)
+		for _, key := range keys[i:end] {
+			c := om.candles[key]
+			valueStrings = append(valueStrings, "(?,?,?,?,?,?,?,?,?,?,?,?,?)")
+			valueArgs = append(valueArgs, key.address, key.period, key.openTime, c.open, c.high, c.low, c.close,
+				c.listedCount, c.volume, c.sales, c.position, now, now)
+		}
+
+		// 开盘价保留最早的非零值，最高最低价忽略0，成交额和成交数量累加
+		stmt := fmt.Sprintf(`INSERT INTO %s (collection_address,period,open_time,open,high,low,close,listed_count,volume,sales,stream_position,create_time,update_time) VALUES %s
+		ON DUPLICATE KEY UPDATE open=IF(open=0,VALUES(open),open),
+		high=IF(VALUES(high)>high,VALUES(high),high),
+		low=IF(VALUES(low)>0 AND (low=0 OR VALUES(low)<low),VALUES(low),low),
+		close=IF(VALUES(close)>0,VALUES(close),close),
+		listed_count=VALUES(listed_count),volume=volume+VALUES(volume),sales=sales+VALUES(sales),
+		stream_position=VALUES(stream_position),update_time=VALUES(update_time)`,
+			gdb.GetMultiProjectCollectionFloorCandleTableName(om.project, om.chain), strings.Join(valueStrings, ","))
+		if err := om.DB.WithContext(om.Ctx).Exec(stmt, valueArgs...).Error; err != nil {
+			return errors.Wrap(err, "failed on persist collection floor candles")
+		}
+
+		for _, key := range keys[i:end] {
+			delete(om.candles, key)
+		}
+	}
+	return nil
+}
+
+// loadFlushedCandles 加载快照之后写入数据库的K线及其已合并的队列位置，重放快照之后的事件时跳过已写入的部分。
+// 只加载位置不晚于已消费位置的K线，事件队列被清空重新计数后旧的记录不会影响新的事件
+func (om *OrderManager) loadFlushedCandles(after, consumed int64) error {
+	var candles []multi.CollectionFloorCandle
+	if err := om.DB.WithContext(om.Ctx).
+		Table(gdb.GetMultiProjectCollectionFloorCandleTableName(om.project, om.chain)).
+		Select("collection_address, period, open_time, stream_position").
+		Where("stream_position > ? and stream_position <= ?", after, consumed).
+		Find(&candles).Error; err != nil {
+		return errors.Wrap(err, "failed on get flushed collection floor candles")
+	}
+	om.flushedCandles = make(map[candleKey]int64, len(candles))
+	for _, c := range candles {
+		key := candleKey{address: strings.ToLower(c.CollectionAddress), period: c.Period, openTime: c.OpenTime}
+		om.flushedCandles[key] = c.StreamPosition
+	}
+	return nil
+}
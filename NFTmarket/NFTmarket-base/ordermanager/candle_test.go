@@ -0,0 +1,99 @@
+package ordermanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestCandleObserve(t *testing.T) {
+	var c candle
+	// 没有挂单时不计入开高低收
+	c.observe(decimal.Zero)
+	assert.True(t, c.open.IsZero())
+
+	for _, price := range []float64{1.0, 1.5, 0.8, 1.2} {
+		c.observe(decimal.NewFromFloat(price))
+	}
+	c.observe(decimal.Zero)
+	assert.Equal(t, decimal.NewFromFloat(1.0), c.open)
+	assert.Equal(t, decimal.NewFromFloat(1.5), c.high)
+	assert.Equal(t, decimal.NewFromFloat(0.8), c.low)
+	assert.Equal(t, decimal.NewFromFloat(1.2), c.close)
+}
+
+func TestObserveCandle(t *testing.T) {
+	om := &OrderManager{candles: make(map[candleKey]*candle)}
+	info := newCollectionTradeInfo(decimal.NewFromFloat(1.0))
+	info.book(multi.ListingOrder).Add("1", decimal.NewFromFloat(1.0), "a", "1")
+	info.book(multi.ListingOrder).Add("2", decimal.NewFromFloat(1.1), "a", "1")
+	info.book(multi.ListingOrder).Add("3", decimal.NewFromFloat(1.3), "b", "2")
+
+	now := int64(24*60*60 + 61*60) // 第二天01:01
+	om.observeCandle("0xABC", info, decimal.Zero, now, 1)
+	om.observeCandle("0xabc", info, decimal.NewFromFloat(2.0), now+10, 2)
+	assert.Len(t, om.candles, len(CandlePeriods))
+
+	for _, period := range CandlePeriods {
+		key := candleKey{address: "0xabc", period: period.Name, openTime: now - now%period.Seconds}
+		c, ok := om.candles[key]
+		if assert.True(t, ok, period.Name) {
+			// 同一token的多个挂单只计一次
+			assert.Equal(t, int64(2), c.listedCount)
+			assert.Equal(t, decimal.NewFromFloat(2.0), c.volume)
+			assert.Equal(t, int64(1), c.sales)
+			assert.Equal(t, decimal.NewFromFloat(1.0), c.close)
+			assert.Equal(t, int64(2), c.position)
+		}
+	}
+}
+
+func TestObserveCandleSkipsFlushed(t *testing.T) {
+	now := int64(24*60*60 + 61*60)
+	hour := candleKey{address: "0xabc", period: "1h", openTime: now - now%3600}
+	// 小时K线已写入位置2之前的事件，重放时只计入位置3
+	om := &OrderManager{
+		candles:        make(map[candleKey]*candle),
+		flushedCandles: map[candleKey]int64{hour: 2},
+	}
+	info := newCollectionTradeInfo(decimal.NewFromFloat(1.0))
+	info.book(multi.ListingOrder).Add("1", decimal.NewFromFloat(1.0), "a", "1")
+	for position := int64(1); position <= 3; position++ {
+		om.observeCandle("0xabc", info, decimal.NewFromFloat(2.0), now, position)
+	}
+
+	assert.Equal(t, int64(1), om.candles[hour].sales)
+	assert.Equal(t, decimal.NewFromFloat(2.0), om.candles[hour].volume)
+	day := candleKey{address: "0xabc", period: "1d", openTime: now - now%(24*3600)}
+	assert.Equal(t, int64(3), om.candles[day].sales)
+	assert.Equal(t, int64(3), om.candles[day].position)
+}
+
+func TestOrderBookTokens(t *testing.T) {
+	book := NewOrderBook(SideListing)
+	book.Add("1", decimal.NewFromInt(1), "a", "1")
+	book.Add("2", decimal.NewFromInt(2), "a", "1")
+	book.Add("3", decimal.NewFromInt(3), "b", "2")
+	assert.Equal(t, 2, book.Tokens())
+
+	book.Remove("1")
+	assert.Equal(t, 2, book.Tokens())
+	book.Remove("2")
+	assert.Equal(t, 1, book.Tokens())
+	// 重复删除不影响计数
+	book.Remove("2")
+	assert.Equal(t, 1, book.Tokens())
+}
+
+func TestCandleTime(t *testing.T) {
+	// 按区块时间统计，延迟处理的事件计入所在区块的K线
+	assert.Equal(t, int64(1700000000), candleTime(&TradeEvent{BlockTime: 1700000000}))
+
+	before := time.Now().Unix()
+	got := candleTime(&TradeEvent{})
+	assert.True(t, got >= before && got <= time.Now().Unix())
+}
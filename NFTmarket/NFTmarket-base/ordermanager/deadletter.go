@@ -0,0 +1,244 @@
+package ordermanager
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/retry"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	// 死信队列，field为死信id，value为序列化的DeadLetter
+	CacheDeadLetterPre = "cache:es:dlq:%s"
+	// 重放的死信的累计尝试次数，重放后再次失败时累加
+	CacheDeadLetterAttemptsPre = "cache:es:dlq:%s:attempts"
+
+	DeadLetterRetryLimit = 3 // 每次处理事件的最大尝试次数
+)
+
+// DeadLetterRetryWait 处理失败后的等待时间
+var DeadLetterRetryWait = []time.Duration{100 * time.Millisecond, 500 * time.Millisecond}
+
+// 死信事件的来源队列
+const (
+	SourceListing    = "listing"     // 新订单 ListingInfo
+	SourceTradeEvent = "trade_event" // 交易事件 TradeEvent
+)
+
+func genDeadLetterKey(chain string) string {
+	return fmt.Sprintf(CacheDeadLetterPre, chain)
+}
+
+func genDeadLetterAttemptsKey(chain string) string {
+	return fmt.Sprintf(CacheDeadLetterAttemptsPre, chain)
+}
+
+// DeadLetter 处理失败的事件
+type DeadLetter struct {
+	ID         string `json:"id"`
+	Source     string `json:"source"`
+	Payload    string `json:"payload"`
+	Error      string `json:"error"`
+	Attempts   uint   `json:"attempts"`
+	Position   int64  `json:"position"` // 事件在来源队列中的消费位置
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// deadLetterID 根据来源和事件内容生成id，同一事件重放后再次失败时id不变
+func deadLetterID(source, payload string) string {
+	sum := sha1.Sum([]byte(source + ":" + payload))
+	return hex.EncodeToString(sum[:8])
+}
+
+// permanentError 重试无法恢复的错误，例如无法解析的事件，直接移入死信队列
+type permanentError struct {
+	error
+}
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// process 处理事件，失败时按重试策略有限次重试，仍然失败的事件移入死信队列
+func (om *OrderManager) process(source string, entry *streamEntry, handle func(payload string) error) {
+	var lastErr error
+	var attempts uint
+	_ = retry.Retry(func(attempt uint) error {
+		attempts = attempt + 1
+		lastErr = handle(entry.Payload)
+		var perr permanentError
+		if errors.As(lastErr, &perr) {
+			lastErr = perr.error
+			return nil
+		}
+		return lastErr
+	}, retry.Limit(DeadLetterRetryLimit), retry.Wait(DeadLetterRetryWait...))
+	if lastErr == nil {
+		return
+	}
+
+	xzap.WithContext(om.Ctx).Error("[Order Manage] move event to dead letter queue",
+		zap.String("chain", om.chain), zap.String("source", source),
+		zap.Int64("position", entry.Position), zap.Uint("attempts", attempts),
+		zap.String("payload", entry.Payload), zap.Error(lastErr))
+	if err := addDeadLetter(om.Ctx, om.Xkv.Redis, om.chain, source, entry, lastErr, attempts); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on add dead letter",
+			zap.String("chain", om.chain), zap.String("payload", entry.Payload), zap.Error(err))
+	}
+}
+
+// addDeadLetter 将事件写入死信队列，已存在或重放过的同一事件累加尝试次数
+func addDeadLetter(ctx context.Context, rds *redis.Redis, chain, source string, entry *streamEntry, cause error, attempts uint) error {
+	now := time.Now().Unix()
+	letter := DeadLetter{
+		ID:         deadLetterID(source, entry.Payload),
+		Source:     source,
+		Payload:    entry.Payload,
+		Error:      cause.Error(),
+		Attempts:   attempts,
+		Position:   entry.Position,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	if existing, ok, err := getDeadLetter(ctx, rds, chain, letter.ID); err != nil {
+		return err
+	} else if ok {
+		letter.Attempts += existing.Attempts
+		letter.CreateTime = existing.CreateTime
+	}
+	prior, err := rds.HgetCtx(ctx, genDeadLetterAttemptsKey(chain), letter.ID)
+	if err != nil && err != redis.Nil {
+		return errors.Wrap(err, "failed on get dead letter attempts")
+	}
+	if n, err := strconv.ParseUint(prior, 10, 64); err == nil {
+		letter.Attempts += uint(n)
+	}
+
+	raw, err := json.Marshal(letter)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal dead letter")
+	}
+	if err := rds.HsetCtx(ctx, genDeadLetterKey(chain), letter.ID, string(raw)); err != nil {
+		return errors.Wrap(err, "failed on set dead letter")
+	}
+	if _, err := rds.HdelCtx(ctx, genDeadLetterAttemptsKey(chain), letter.ID); err != nil {
+		return errors.Wrap(err, "failed on delete dead letter attempts")
+	}
+	return nil
+}
+
+func getDeadLetter(ctx context.Context, rds *redis.Redis, chain, id string) (*DeadLetter, bool, error) {
+	raw, err := rds.HgetCtx(ctx, genDeadLetterKey(chain), id)
+	if err == redis.Nil || (err == nil && raw == "") {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed on get dead letter")
+	}
+	var letter DeadLetter
+	if err := json.Unmarshal([]byte(raw), &letter); err != nil {
+		return nil, false, errors.Wrap(err, "failed on unmarshal dead letter")
+	}
+	return &letter, true, nil
+}
+
+// ListDeadLetters 按进入死信队列的时间返回所有死信
+func ListDeadLetters(ctx context.Context, kv *xkv.Store, chain string) ([]*DeadLetter, error) {
+	values, err := kv.Redis.HgetallCtx(ctx, genDeadLetterKey(chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get dead letters")
+	}
+	letters := make([]*DeadLetter, 0, len(values))
+	for _, raw := range values {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(raw), &letter); err != nil {
+			return nil, errors.Wrap(err, "failed on unmarshal dead letter")
+		}
+		letters = append(letters, &letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].CreateTime != letters[j].CreateTime {
+			return letters[i].CreateTime < letters[j].CreateTime
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+// GetDeadLetter 返回指定id的死信，不存在时返回false
+func GetDeadLetter(ctx context.Context, kv *xkv.Store, chain, id string) (*DeadLetter, bool, error) {
+	return getDeadLetter(ctx, kv.Redis, chain, strings.ToLower(id))
+}
+
+// ReplayDeadLetter 将死信重新放回来源队列的末尾，由同步服务重新处理，再次失败时累加尝试次数
+func ReplayDeadLetter(ctx context.Context, kv *xkv.Store, chain, id string) error {
+	letter, ok, err := GetDeadLetter(ctx, kv, chain, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("dead letter %s not found", id)
+	}
+
+	var key string
+	switch letter.Source {
+	case SourceListing:
+		key = GenOrdersCacheKey(chain)
+	case SourceTradeEvent:
+		key = genTradeEventsCacheKey(chain)
+	default:
+		return errors.Errorf("unknown dead letter source: %s", letter.Source)
+	}
+
+	if err := kv.Redis.HsetCtx(ctx, genDeadLetterAttemptsKey(chain), letter.ID, strconv.FormatUint(uint64(letter.Attempts), 10)); err != nil {
+		return errors.Wrap(err, "failed on set dead letter attempts")
+	}
+	if _, err := kv.Redis.RpushCtx(ctx, key, letter.Payload); err != nil {
+		return errors.Wrap(err, "failed on push dead letter to queue")
+	}
+	if _, err := kv.Redis.HdelCtx(ctx, genDeadLetterKey(chain), letter.ID); err != nil {
+		return errors.Wrap(err, "failed on delete dead letter")
+	}
+	return nil
+}
+
+// PurgeDeadLetters 删除指定id的死信，ids为空时删除所有死信，返回删除的数量
+func PurgeDeadLetters(ctx context.Context, kv *xkv.Store, chain string, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		letters, err := ListDeadLetters(ctx, kv, chain)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := kv.Redis.DelCtx(ctx, genDeadLetterKey(chain), genDeadLetterAttemptsKey(chain)); err != nil {
+			return 0, errors.Wrap(err, "failed on delete dead letters")
+		}
+		return len(letters), nil
+	}
+
+	var purged int
+	for _, id := range ids {
+		ok, err := kv.Redis.HdelCtx(ctx, genDeadLetterKey(chain), strings.ToLower(id))
+		if err != nil {
+			return purged, errors.Wrap(err, "failed on delete dead letter")
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,80 @@
+package ordermanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	om := newTestSnapshotManager(mr)
+	wait := DeadLetterRetryWait
+	DeadLetterRetryWait = []time.Duration{time.Millisecond}
+	defer func() { DeadLetterRetryWait = wait }()
+
+	// 临时错误重试成功后不进入死信队列
+	var calls int
+	om.process(SourceTradeEvent, &streamEntry{Position: 1, Payload: "ok"}, func(payload string) error {
+		calls++
+		if calls < DeadLetterRetryLimit {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	assert.Equal(t, DeadLetterRetryLimit, calls)
+
+	// 无法恢复的错误不重试
+	calls = 0
+	om.process(SourceListing, &streamEntry{Position: 2, Payload: "bad"}, func(payload string) error {
+		calls++
+		return permanent(errors.New("invalid json"))
+	})
+	assert.Equal(t, 1, calls)
+
+	// 重试次数用完后进入死信队列
+	failing := func(payload string) error {
+		return errors.New("db down")
+	}
+	om.process(SourceTradeEvent, &streamEntry{Position: 3, Payload: `{"order_id":"1"}`}, failing)
+
+	letters, err := ListDeadLetters(om.Ctx, om.Xkv, om.chain)
+	assert.NoError(t, err)
+	assert.Len(t, letters, 2)
+	letter, ok, err := GetDeadLetter(om.Ctx, om.Xkv, om.chain, deadLetterID(SourceTradeEvent, `{"order_id":"1"}`))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint(DeadLetterRetryLimit), letter.Attempts)
+	assert.Equal(t, "db down", letter.Error)
+	assert.Equal(t, int64(3), letter.Position)
+
+	// 重放后放回来源队列，再次失败时累加尝试次数
+	assert.NoError(t, ReplayDeadLetter(om.Ctx, om.Xkv, om.chain, letter.ID))
+	_, ok, err = GetDeadLetter(om.Ctx, om.Xkv, om.chain, letter.ID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	stream := newEventStream(om.Xkv.Redis, genTradeEventsCacheKey(om.chain))
+	entry, err := stream.pop(om.Ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"order_id":"1"}`, entry.Payload)
+	om.process(SourceTradeEvent, entry, failing)
+	letter, ok, err = GetDeadLetter(om.Ctx, om.Xkv, om.chain, letter.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint(2*DeadLetterRetryLimit), letter.Attempts)
+
+	assert.Error(t, ReplayDeadLetter(om.Ctx, om.Xkv, om.chain, "missing"))
+
+	purged, err := PurgeDeadLetters(om.Ctx, om.Xkv, om.chain, letter.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	purged, err = PurgeDeadLetters(om.Ctx, om.Xkv, om.chain)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	letters, err = ListDeadLetters(om.Ctx, om.Xkv, om.chain)
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
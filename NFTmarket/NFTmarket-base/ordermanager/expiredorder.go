@@ -1,10 +1,14 @@
 package ordermanager
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"github.com/zeromicro/go-zero/core/threading"
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
@@ -13,235 +17,231 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 )
 
-// orderExpiryProcess 函数负责处理订单过期的逻辑,主要包含以下功能:
-// 1. 使用defer recover防止panic导致主协程退出
-// 2. 启动时从数据库加载所有活跃订单到时间轮队列
-// 3. 每秒检查一次时间轮,处理到期的订单
-func (om *OrderManager) orderExpiryProcess() {
-	// 1. 使用 defer recover 来捕获可能的 panic,防止主协程死掉
-	defer func() {
-		if r := recover(); r != nil {
-			xzap.WithContext(om.Ctx).Error("[Order Manage] dq process recovered: " + fmt.Sprintf("%v", r))
-		}
-	}()
+const (
+	// 待过期订单的有序集合，score为过期时间；花括号使两个key在集群模式下位于同一个slot
+	CacheExpiryQueuePre = "cache:es:expiry:{%s}"
+	// 已认领待处理的订单，score为租约到期时间，租约到期未完成的订单会被重新认领
+	CacheExpiryProcessingPre = "cache:es:expiry:{%s}:processing"
 
-	// 2. 启动时从数据库加载所有活跃订单到时间轮队列中
-	if err := om.loadOrdersToQueue(); err != nil {
-		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
-		return
-	}
+	ExpiryLease      = 60  // in seconds
+	ExpiryClaimBatch = 500 // 每次认领的订单数量
+	ExpiryWorkers    = 8   // 处理过期订单的协程数量
+)
 
-	// 3. 每秒检查一次时间轮
-	for {
-		<-time.After(time.Second * 1)
+// claimExpiryScript 原子地认领到期的订单：先认领租约已到期的订单，再从待过期集合中认领到期的订单，
+// 认领的订单移入处理集合并设置新的租约到期时间，多个实例同时认领时每个订单只会被一个实例获得
+// KEYS[1] 待过期集合 KEYS[2] 处理集合 ARGV[1] 当前时间 ARGV[2] 租约到期时间 ARGV[3] 认领数量
+const claimExpiryScript = `local claimed = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(claimed) do
+    redis.call('ZADD', KEYS[2], ARGV[2], member)
+end
+local limit = tonumber(ARGV[3]) - #claimed
+if limit > 0 then
+    local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, limit)
+    for _, member in ipairs(due) do
+        redis.call('ZREM', KEYS[1], member)
+        redis.call('ZADD', KEYS[2], ARGV[2], member)
+        table.insert(claimed, member)
+    end
+end
+return claimed`
+
+func genExpiryQueueKey(chain string) string {
+	return fmt.Sprintf(CacheExpiryQueuePre, chain)
+}
 
-		// 如果当前索引超过时间轮大小,则取模重置
-		if om.CurrentIndex >= WheelSize {
-			om.CurrentIndex = om.CurrentIndex % WheelSize
-		}
+func genExpiryProcessingKey(chain string) string {
+	return fmt.Sprintf(CacheExpiryProcessingPre, chain)
+}
 
-		// 获取当前时间槽的任务链表头
-		taskLinkHead := om.TimeWheel[om.CurrentIndex].NotifyActivities
-		headIndex := om.CurrentIndex
-		om.CurrentIndex++
-
-		// prev指向前一个节点,p指向当前节点
-		prev := taskLinkHead
-		p := taskLinkHead
-
-		// 遍历当前时间槽的所有任务
-		for p != nil {
-			// 如果任务的循环计数为0,说明到期需要处理
-			if p.CycleCount == 0 {
-				// 异步更新订单状态,避免阻塞主循环
-				go func(chain string, orderId string, collectionAddr string) {
-					if err := om.updateOrderState(orderId, collectionAddr); err != nil {
-						xzap.WithContext(om.Ctx).Error("failed on update order status", zap.Error(err), zap.String("chain", chain), zap.String("order_id", orderId))
-					}
-				}(p.ChainSuffix, p.orderID, p.CollectionAddr)
-
-				// 从链表中删除该节点
-				if prev == p { // 如果是头节点
-					om.TimeWheel[headIndex].NotifyActivities = p.Next
-					prev = p.Next
-					p = p.Next
-				} else { // 如果不是头节点
-					prev.Next = p.Next
-					p = p.Next
+// expiryTask 待过期的订单，序列化后作为有序集合的成员
+type expiryTask struct {
+	OrderId        string `json:"order_id"`
+	CollectionAddr string `json:"collection_addr"`
+	ExpireTime     int64  `json:"expire_time"`
+
+	member string
+}
+
+// orderExpiryProcess 函数负责处理订单过期的逻辑,主要包含以下功能:
+// 1. 过期队列保存在Redis中，由ListenNewListingLoop在启动时从快照或数据库恢复
+// 2. 每秒认领所有到期的订单，交给固定数量的工作协程处理，停机期间到期的订单在启动后全部补齐
+// 3. 订单状态按条件更新，多个实例或租约重入时同一订单只会过期一次
+func (om *OrderManager) orderExpiryProcess() {
+	// 1. 启动固定数量的工作协程，退出时等待已分发的订单处理完成
+	tasks := make(chan *expiryTask, ExpiryWorkers)
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	defer close(tasks)
+	for i := 0; i < ExpiryWorkers; i++ {
+		workers.Add(1)
+		threading.GoSafe(func() {
+			defer workers.Done()
+			for task := range tasks {
+				if err := om.expireOrder(task); err != nil {
+					// 保留在处理集合中，租约到期后重新认领
+					xzap.WithContext(om.Ctx).Error("failed on update order status", zap.Error(err),
+						zap.String("chain", om.chain), zap.String("order_id", task.OrderId))
 				}
-			} else {
-				// 如果任务未到期,循环计数减1
-				p.CycleCount--
-				prev = p
-				p = p.Next
 			}
+		})
+	}
+
+	// 2. 每秒认领到期的订单，ticker不受处理耗时影响
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-om.quit.Done():
+			return
+		case <-ticker.C:
 		}
+		om.dispatchDueOrders(tasks)
 	}
 }
 
-// loadOrdersToQueue 函数负责在系统启动时加载所有活跃订单并处理它们的过期状态
-// 主要功能包括:
-// 1. 从数据库分批加载所有活跃订单
-// 2. 检查每个订单是否已过期:
-//   - 已过期的订单:更新状态为过期并触发地板价更新事件
-//   - 未过期的订单:添加到延迟队列等待过期检查
-func (om *OrderManager) loadOrdersToQueue() error {
-	// 分批加载所有活跃订单
-	var totalOrders []*multi.Order
-	var id int64
+// dispatchDueOrders 认领所有到期的订单并分发给工作协程，记录本轮最大的过期延迟
+func (om *OrderManager) dispatchDueOrders(tasks chan<- *expiryTask) {
+	var lag int64
 	for {
-		var orders []*multi.Order
-		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-			Select("id, order_id, collection_address, price, expire_time").
-			Where("order_status = ? and id > ?", multi.OrderStatusActive, id).
-			Order("id asc").Limit(1000).
-			Scan(&orders).Error; err != nil {
-			return errors.Wrap(err, "failed on get collection orders")
+		now := time.Now().Unix()
+		claimed, err := om.claimDueOrders(now)
+		if err != nil {
+			xzap.WithContext(om.Ctx).Error("[Order Manage] failed on claim expired orders", zap.Error(err))
+			return
 		}
-		totalOrders = append(totalOrders, orders...)
-		if len(orders) < 1000 {
+		for _, task := range claimed {
+			if now-task.ExpireTime > lag {
+				lag = now - task.ExpireTime
+			}
+			select {
+			case tasks <- task:
+			case <-om.quit.Done():
+				return
+			}
+		}
+		if len(claimed) < ExpiryClaimBatch {
 			break
 		}
-
-		id = orders[len(orders)-1].ID
-	}
-
-	if len(totalOrders) == 0 {
-		return nil
 	}
+	expiryLag.WithLabelValues(om.chain).Set(float64(lag))
+}
 
-	// 分别记录已过期和未过期的订单
-	var expiredOrderIDs []int64
-	var expiredOrders []*multi.Order
-	for _, order := range totalOrders {
-		if order.ExpireTime < time.Now().Unix() {
-			// 已过期
-			expiredOrderIDs = append(expiredOrderIDs, order.ID)
-			expiredOrders = append(expiredOrders, order)
-		} else {
-			// 未过期,添加到延迟队列
-			delaySeconds := order.ExpireTime - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, order.OrderID, order.CollectionAddress); err != nil {
-				xzap.WithContext(om.Ctx).Error("[Order Manage] failed on add order to delay queue",
-					zap.Error(err))
-			}
-		}
+// claimDueOrders 认领过期时间不晚于now的订单
+func (om *OrderManager) claimDueOrders(now int64) ([]*expiryTask, error) {
+	resp, err := om.Xkv.Redis.EvalCtx(om.Ctx, claimExpiryScript,
+		[]string{genExpiryQueueKey(om.chain), genExpiryProcessingKey(om.chain)},
+		now, now+ExpiryLease, ExpiryClaimBatch)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "eval claim script err")
 	}
+	members, _ := resp.([]interface{})
 
-	// 批量更新已过期订单的状态
-	for i := 0; i < len(expiredOrderIDs); i += 100 {
-		end := i + MaxBatchReqNum
-		if i+MaxBatchReqNum >= len(expiredOrderIDs) {
-			end = len(expiredOrderIDs)
+	var tasks []*expiryTask
+	for _, m := range members {
+		member, ok := m.(string)
+		if !ok {
+			continue
 		}
-
-		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-			Where("id in (?)", expiredOrderIDs[i:end]).Update("order_status", multi.OrderStatusExpired).Error; err != nil {
-			return errors.Wrap(err, "failed on update expired orders status")
+		var task expiryTask
+		if err := json.Unmarshal([]byte(member), &task); err != nil {
+			// 无法解析的成员直接移除
+			xzap.WithContext(om.Ctx).Error("[Order Manage] invalid expiry task", zap.String("member", member), zap.Error(err))
+			om.completeExpiry(member)
+			continue
 		}
+		task.member = member
+		tasks = append(tasks, &task)
 	}
-
-	// 为每个过期订单触发地板价更新事件
-	for _, order := range expiredOrders {
-		if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-			EventType:      Expired,
-			CollectionAddr: order.CollectionAddress,
-			OrderId:        order.OrderID,
-		}); err != nil {
-			return errors.Wrap(err, "failed on add update floor price event")
-		}
-	}
-
-	return nil
+	return tasks, nil
 }
 
-// addToOrderExpiryCheckQueue 函数用于将订单添加到过期检查队列中
-// 主要功能:
-// 1. 根据延迟时间计算订单在时间轮上的位置
-// 2. 将订单添加到时间轮对应位置的链表中
-// 参数说明:
-// - delaySeconds: 延迟秒数,即订单过期前的剩余时间
-// - chainSuffix: 链标识
-// - orderId: 订单ID
-// - collectionAddr: NFT集合地址
-func (om *OrderManager) addToOrderExpiryCheckQueue(delaySeconds int64, chainSuffix string, orderId string, collectionAddr string) error {
-	// 加锁保护并发安全
-	om.Mux.Lock()
-	defer om.Mux.Unlock()
-
-	// 计算订单最终的时间轮位置
-	// 从当前索引开始计数
-	calculateValue := om.CurrentIndex + delaySeconds
-
-	// 计算需要循环的圈数
-	// 如果需要循环,则圈数减1(因为从0开始计数)
-	cycle := calculateValue / WheelSize
-	if cycle > 0 {
-		cycle--
-	}
-
-	// 计算订单在时间轮上的实际位置
-	index := calculateValue % WheelSize
-
-	// 创建订单对象
-	orderActivity := &Order{
-		orderID:        orderId,
+// scheduleExpiry 将订单加入过期队列，重复加入同一订单不会产生多个任务
+func (om *OrderManager) scheduleExpiry(orderId, collectionAddr string, expireTime int64) error {
+	member, err := json.Marshal(expiryTask{
+		OrderId:        orderId,
 		CollectionAddr: collectionAddr,
-		ChainSuffix:    chainSuffix,
-		CycleCount:     cycle,
-		WheelPosition:  index,
+		ExpireTime:     expireTime,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal expiry task")
 	}
-
-	// 如果该位置为空,直接放入
-	if om.TimeWheel[index].NotifyActivities == nil {
-		om.TimeWheel[index].NotifyActivities = orderActivity
-	} else {
-		// 否则插入到链表头部
-		// 因为不需要排序,所以直接插入到头部即可
-		head := om.TimeWheel[index].NotifyActivities
-		orderActivity.Next = head
-		om.TimeWheel[index].NotifyActivities = orderActivity
+	if _, err := om.Xkv.Redis.ZaddCtx(om.Ctx, genExpiryQueueKey(om.chain), expireTime, string(member)); err != nil {
+		return errors.Wrap(err, "failed on add order to expiry queue")
 	}
 	return nil
 }
 
-// GetWheelTaskQuantity :check tasks number in the time wheel at the moment
-func (om *OrderManager) GetWheelTaskQuantity(index int64) int64 {
-	orders := om.TimeWheel[index].NotifyActivities
-	if orders == nil {
-		return 0
-	}
-	var orderNum int64
-	for p := orders; p != nil; p = p.Next {
-		orderNum++
+// completeExpiry 订单处理完成后从处理集合中移除
+func (om *OrderManager) completeExpiry(member string) {
+	if _, err := om.Xkv.Redis.ZremCtx(om.Ctx, genExpiryProcessingKey(om.chain), member); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on complete expiry task", zap.Error(err))
 	}
-	return orderNum
 }
 
-// updateOrderState : handler function by sql transaction
-func (om *OrderManager) updateOrderState(orderId string, collectionAddr string) error {
-	// update orders status to expired
-	if err := om.updateOrdersStatus(orderId, multi.OrderStatusExpired); err != nil {
-		return errors.Wrap(err, "failed on update activities status")
+// expireOrder 将仍处于有效状态且已到期的订单置为过期，只有实际更新了订单时才触发地板价更新事件
+func (om *OrderManager) expireOrder(task *expiryTask) error {
+	result := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Where("order_id = ? and order_status = ? and expire_time <= ?",
+			task.OrderId, multi.OrderStatusActive, time.Now().Unix()).
+		Update("order_status", multi.OrderStatusExpired)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "failed on update expired orders status")
 	}
 
-	// update floor price
-	if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-		EventType:      Expired,
-		OrderId:        orderId,
-		CollectionAddr: collectionAddr,
-	}); err != nil {
-		return errors.Wrap(err, "failed on add update floor price event")
+	if result.RowsAffected > 0 {
+		expiredOrders.WithLabelValues(om.chain).Inc()
+		// update floor price
+		if err := om.addUpdateFloorPriceEvent(&TradeEvent{
+			EventType:      Expired,
+			OrderId:        task.OrderId,
+			CollectionAddr: task.CollectionAddr,
+		}); err != nil {
+			return errors.Wrap(err, "failed on add update floor price event")
+		}
 	}
 
+	om.completeExpiry(task.member)
 	return nil
 }
 
-// 更新订单状态
-func (om *OrderManager) updateOrdersStatus(orderID string, orderStatus int) error {
-	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-		Where("order_id = ?", orderID).Update("order_status", orderStatus).Error; err != nil {
-		return errors.Wrap(err, "failed on update expired orders status")
+// loadOrdersToQueue 函数负责在没有过期调度快照时从数据库分批加载所有活跃订单到过期队列，
+// 用于首次启动或Redis数据丢失时的恢复，已在队列中的订单不会重复入队
+func (om *OrderManager) loadOrdersToQueue() error {
+	var id int64
+	for {
+		var orders []*multi.Order
+		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+			Select("id, order_id, collection_address, expire_time").
+			Where("order_status = ? and id > ?", multi.OrderStatusActive, id).
+			Order("id asc").Limit(1000).
+			Scan(&orders).Error; err != nil {
+			return errors.Wrap(err, "failed on get collection orders")
+		}
+
+		var pairs []redis.Pair
+		for _, order := range orders {
+			member, err := json.Marshal(expiryTask{
+				OrderId:        order.OrderID,
+				CollectionAddr: order.CollectionAddress,
+				ExpireTime:     order.ExpireTime,
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed on marshal expiry task")
+			}
+			pairs = append(pairs, redis.Pair{Key: string(member), Score: order.ExpireTime})
+		}
+		if len(pairs) > 0 {
+			if _, err := om.Xkv.Redis.ZaddsCtx(om.Ctx, genExpiryQueueKey(om.chain), pairs...); err != nil {
+				return errors.Wrap(err, "failed on add orders to expiry queue")
+			}
+		}
+
+		if len(orders) < 1000 {
+			break
+		}
+		id = orders[len(orders)-1].ID
 	}
+
 	return nil
 }
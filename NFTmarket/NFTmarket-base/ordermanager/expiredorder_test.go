@@ -0,0 +1,65 @@
+package ordermanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+func newTestExpiryManager(mr *miniredis.Miniredis) *OrderManager {
+	return &OrderManager{
+		chain: "sepolia",
+		Ctx:   context.Background(),
+		Xkv:   &xkv.Store{Redis: redis.New(mr.Addr())},
+	}
+}
+
+func TestClaimDueOrders(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newTestExpiryManager(mr)
+	b := newTestExpiryManager(mr)
+
+	assert.NoError(t, a.scheduleExpiry("1", "0xa", 100))
+	assert.NoError(t, a.scheduleExpiry("2", "0xa", 200))
+	assert.NoError(t, a.scheduleExpiry("3", "0xb", 1000))
+	// 重复入队不会产生多个任务
+	assert.NoError(t, b.scheduleExpiry("1", "0xa", 100))
+
+	// 停机后补齐所有已到期的订单，同一订单只会被一个实例认领
+	claimedA, err := a.claimDueOrders(250)
+	assert.NoError(t, err)
+	claimedB, err := b.claimDueOrders(250)
+	assert.NoError(t, err)
+	assert.Len(t, claimedA, 2)
+	assert.Len(t, claimedB, 0)
+	assert.Equal(t, "1", claimedA[0].OrderId)
+	assert.Equal(t, int64(100), claimedA[0].ExpireTime)
+
+	// 完成的订单不会再被认领
+	a.completeExpiry(claimedA[0].member)
+
+	// 租约到期前不会被重新认领
+	claimedB, err = b.claimDueOrders(250 + ExpiryLease - 1)
+	assert.NoError(t, err)
+	assert.Len(t, claimedB, 0)
+
+	// 租约到期后未完成的订单被其它实例认领
+	claimedB, err = b.claimDueOrders(250 + ExpiryLease)
+	assert.NoError(t, err)
+	assert.Len(t, claimedB, 1)
+	assert.Equal(t, "2", claimedB[0].OrderId)
+
+	// 租约到期的订单和新到期的订单一起认领
+	claimedA, err = a.claimDueOrders(1000)
+	assert.NoError(t, err)
+	var ids []string
+	for _, task := range claimedA {
+		ids = append(ids, task.OrderId)
+	}
+	assert.ElementsMatch(t, []string{"2", "3"}, ids)
+}
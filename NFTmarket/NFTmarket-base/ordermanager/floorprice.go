@@ -8,7 +8,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/stores/redis"
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
@@ -29,18 +28,58 @@ const (
 	Expired          EventType = 9
 	ImportCollection EventType = 10
 	UpdateCollection EventType = 11
+	Filled           EventType = 12 // 订单完全成交，从订单簿中删除
 )
 
 const (
 	MaxBatchReqNum = 100
-	maxQueueLength = 100
 )
 
 const CacheTradeEventsQueuePre = "cache:es:trade:events:%s"
 
+// collectionTradeInfo collection的全量订单簿和最优价
 type collectionTradeInfo struct {
 	floorPrice decimal.Decimal
-	orders     *PriorityQueueMap // 优先级队列
+	price      CollectionPrice // 最近一次发布的最优价格快照
+	listings   *OrderBook      // 有效挂单
+	bids       *OrderBook      // 有效集合出价
+	itemBids   *OrderBook      // 有效item出价
+}
+
+func newCollectionTradeInfo(floorPrice decimal.Decimal) *collectionTradeInfo {
+	return &collectionTradeInfo{
+		floorPrice: floorPrice,
+		listings:   NewOrderBook(SideListing),
+		bids:       NewOrderBook(SideCollectionBid),
+		itemBids:   NewOrderBook(SideItemBid),
+	}
+}
+
+// book 返回订单类型对应的订单簿，offer不进入订单簿
+func (info *collectionTradeInfo) book(orderType int64) *OrderBook {
+	switch orderType {
+	case multi.CollectionBidOrder:
+		return info.bids
+	case multi.ItemBidOrder:
+		return info.itemBids
+	case multi.OfferOrder:
+		return nil
+	default:
+		// 兼容未携带订单类型的旧事件
+		return info.listings
+	}
+}
+
+// sideBook 返回指定方向的订单簿
+func (info *collectionTradeInfo) sideBook(side Side) *OrderBook {
+	switch side {
+	case SideCollectionBid:
+		return info.bids
+	case SideItemBid:
+		return info.itemBids
+	default:
+		return info.listings
+	}
 }
 
 type TradeEvent struct {
@@ -49,194 +88,249 @@ type TradeEvent struct {
 	TokenID        string          `json:"token_id"`
 	OrderId        string          `json:"order_id"`
 	OrderHash      string          `json:"order_hash"`
+	OrderType      int64           `json:"order_type"`
 	Price          decimal.Decimal `json:"price"`
 	From           string          `json:"from"`
 	To             string          `json:"to"`
 	TxHash         string          `json:"txHash"`
+	BlockTime      int64           `json:"block_time"` // 事件所在区块的时间，K线按区块时间统计
 }
 
-// 处理floorprice更新
+// floorPriceProcess 处理floorprice更新
+// 1. 启动时加载快照并重放快照之后消费的事件，没有快照时从数据库全量加载，队列中未处理的事件不会被丢弃
+// 2. 持续消费交易事件，更新订单簿、地板价和最高出价
+// 3. 定期保存快照，记录快照对应的消费位置
 func (om *OrderManager) floorPriceProcess() {
-	// 清空缓存中的剩余事件
-	key := genTradeEventsCacheKey(om.chain)
-	if err := om.Xkv.Redis.Ltrim(key, 1, 0); err != nil { // clear all value
-		xzap.WithContext(om.Ctx).Error("failed on flush remaining trade events", zap.Error(err))
-	}
+	stream := newEventStream(om.Xkv.Redis, genTradeEventsCacheKey(om.chain))
 
-	// 从数据库加载订单并更新地板价
-	if err := om.loadCollectionTradeInfo(); err != nil {
-		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
-		return
+	// 从快照或数据库恢复订单簿，失败时重试
+	var position int64
+	for {
+		var err error
+		position, err = om.restoreTradeInfo(stream)
+		if err == nil {
+			break
+		}
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on restore trade info", zap.Error(err))
+		select {
+		case <-om.quit.Done():
+			return
+		case <-time.After(time.Second * 10):
+		}
+	}
+	if err := om.saveFloorSnapshot(stream, position); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save floor snapshot", zap.Error(err))
 	}
 
 	// 持续监听并处理交易事件
+	ticker := time.NewTicker(SnapshotInterval * time.Second)
+	defer ticker.Stop()
+	saved := position
 	for {
-		// 从缓存中获取交易事件
-		result, err := om.Xkv.Lpop(key)
-		if err != nil || result == "" {
-			if err != nil && err != redis.Nil {
-				xzap.WithContext(om.Ctx).Warn("failed on get trade events from cache", zap.Error(err), zap.String("result", result))
+		select {
+		case <-om.quit.Done():
+			// 退出前写入K线和最后的快照，重启后无需重放
+			if position != saved {
+				if err := om.saveFloorSnapshot(stream, position); err != nil {
+					xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save floor snapshot", zap.Error(err))
+				}
 			}
-			time.Sleep(1 * time.Second)
-			continue
+			xzap.WithContext(om.Ctx).Info("[Order Manage] floor price loop exit", zap.String("chain", om.chain))
+			return
+		case <-ticker.C:
+			if position != saved {
+				if err := om.saveFloorSnapshot(stream, position); err != nil {
+					xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save floor snapshot", zap.Error(err))
+				} else {
+					saved = position
+				}
+			}
+		default:
 		}
 
-		xzap.WithContext(om.Ctx).Info("get trade events from cache", zap.String("event content", result))
-		// 解析事件内容
-		var event TradeEvent
-		if err := json.Unmarshal([]byte(result), &event); err != nil {
-			xzap.WithContext(om.Ctx).Warn("failed on unmarshal trade event info", zap.Error(err))
+		// 从缓存中获取交易事件
+		entry, err := stream.pop(om.Ctx)
+		if err != nil || entry == nil {
+			if err != nil {
+				xzap.WithContext(om.Ctx).Warn("failed on get trade events from cache", zap.Error(err))
+			}
+			select {
+			case <-om.quit.Done():
+			case <-time.After(time.Second):
+			}
 			continue
 		}
 
-		// 检查collection是否被跟踪
-		tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
-		if !ok && event.EventType != ImportCollection { //
-			xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", event.CollectionAddr))
-			continue
-		}
+		om.process(SourceTradeEvent, entry, om.tradeEventHandler(entry.Position))
+		position = entry.Position
+	}
+}
 
-		// 通知collection状态更新
-		if event.CollectionAddr != "" {
-			om.collectionListedCh <- event.CollectionAddr
+// restoreTradeInfo 加载快照并重放快照之后消费的交易事件，返回恢复后的消费位置。
+// 没有快照时从数据库全量加载，加载前已消费的事件均已反映在数据库中
+func (om *OrderManager) restoreTradeInfo(stream *eventStream) (int64, error) {
+	var data floorSnapshot
+	snap, ok, err := om.loadSnapshot(SnapshotFloor, &data)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		position, err := stream.position(om.Ctx)
+		if err != nil {
+			return 0, err
+		}
+		if err := om.loadCollectionTradeInfo(); err != nil {
+			return 0, err
 		}
+		om.listed.markAll()
+		xzap.WithContext(om.Ctx).Info("[Order Manage] load trade info from database",
+			zap.String("chain", om.chain), zap.Int64("position", position))
+		return position, nil
+	}
 
-		// 根据不同事件类型处理
-		switch event.EventType {
-		case Listing: // 上架事件
-			// 只有当价格低于队列最高价或队列为空时才添加订单
-			_, price := tradeInfo.orders.GetMax()
-			if price.GreaterThan(event.Price) || tradeInfo.orders.Len() == 0 {
-				tradeInfo.orders.Add(event.OrderId, event.Price, event.From, event.TokenID)
-			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	entries, err := stream.replay(om.Ctx, snap.Position)
+	if err != nil {
+		return 0, err
+	}
+	consumed, err := stream.position(om.Ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := om.loadFlushedCandles(snap.Position, consumed); err != nil {
+		return 0, err
+	}
 
-		case Cancel, Expired: // 取消或过期事件
-			// 从队列中删除订单
-			tradeInfo.orders.Remove(event.OrderId)
-			if tradeInfo.orders.Len() == 0 {
-				// 队列为空时重新加载订单
-				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
-			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr),
-					zap.Error(err))
-			}
+	om.Mux.Lock()
+	om.restoreFloorSnapshot(&data)
+	om.Mux.Unlock()
+	position := snap.Position
+	for _, entry := range entries {
+		om.process(SourceTradeEvent, entry, om.tradeEventHandler(entry.Position))
+		position = entry.Position
+	}
+	// 之后消费的事件位置都在已写入的位置之后
+	om.flushedCandles = nil
+	xzap.WithContext(om.Ctx).Info("[Order Manage] restore trade info from snapshot",
+		zap.String("chain", om.chain), zap.Int64("snapshot_position", snap.Position),
+		zap.Int("replayed", len(entries)))
+	return position, nil
+}
 
-		case Buy, Transfer: // 购买或转移事件
-			// 如果是购买事件,从队列中删除订单
-			if event.EventType == Buy {
-				tradeInfo.orders.Remove(event.OrderId)
-			}
+// tradeEventHandler 返回处理队列中position位置的交易事件的函数
+func (om *OrderManager) tradeEventHandler(position int64) func(payload string) error {
+	return func(payload string) error {
+		return om.applyTradeEvent(payload, position)
+	}
+}
 
-			// 检查队列是否为空,为空则重新加载订单
-			if tradeInfo.orders.Len() == 0 {
-				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
-			} else {
-				// 移除卖家的所有订单
-				tradeInfo.orders.RemoveMakerOrders(event.From, event.TokenID)
-				// 获取买家的有效订单
-				orders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, event.To)
-				if err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on get users valid orders",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr),
-						zap.String("from", event.From), zap.String("to", event.To),
-						zap.Error(err))
-					continue
-				}
+// applyTradeEvent 解析并处理交易事件
+func (om *OrderManager) applyTradeEvent(payload string, position int64) error {
+	xzap.WithContext(om.Ctx).Info("get trade events from cache", zap.String("event content", payload))
+	// 解析事件内容
+	var event TradeEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return permanent(errors.Wrap(err, "failed on unmarshal trade event info"))
+	}
 
-				// 添加买家的有效订单到队列
-				for _, order := range orders {
-					if !order.IsOpenseaBanned {
-						_, maxPrice := tradeInfo.orders.GetMax()
-						if maxPrice.GreaterThan(order.Price) {
-							tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
-						}
-					}
-				}
+	om.Mux.Lock()
+	defer om.Mux.Unlock()
+	return om.handleTradeEvent(&event, position)
+}
 
-				// 如果队列为空,重新加载订单
-				if tradeInfo.orders.Len() == 0 {
-					if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-						xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-							zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-							zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-						continue
-					}
-				}
-			}
+// handleTradeEvent 根据交易事件更新订单簿、地板价和最高出价，重复处理同一事件的结果不变
+func (om *OrderManager) handleTradeEvent(event *TradeEvent, position int64) error {
+	// 检查collection是否被跟踪，collection导入后可以从死信队列重放
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
+	if !ok && event.EventType != ImportCollection {
+		return permanent(errors.Errorf("untracked collection %s", event.CollectionAddr))
+	}
 
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	// 通知collection状态更新
+	if event.CollectionAddr != "" {
+		om.listed.mark(event.CollectionAddr)
+	}
 
-		case ImportCollection: // 导入新的Collection事件
-			// 检查Collection是否已存在
-			if _, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]; ok {
-				xzap.WithContext(om.Ctx).Warn("import collection repeated",
-					zap.String("collection_addr", event.CollectionAddr))
-				continue
-			}
+	// 根据不同事件类型处理
+	switch event.EventType {
+	case Listing: // 上架或出价事件
+		if book := tradeInfo.book(event.OrderType); book != nil {
+			book.Add(event.OrderId, event.Price, event.From, event.TokenID)
+		}
 
-			// 初始化新的Collection信息
-			om.collectionOrders[strings.ToLower(event.CollectionAddr)] = &collectionTradeInfo{
-				floorPrice: decimal.Zero,
-				orders:     NewPriorityQueueMap(maxQueueLength),
-			}
+	case Cancel, Expired, Filled: // 取消、过期或完全成交事件
+		// 从订单簿中删除订单
+		tradeInfo.listings.Remove(event.OrderId)
+		tradeInfo.bids.Remove(event.OrderId)
+		tradeInfo.itemBids.Remove(event.OrderId)
 
-		case UpdateCollection: // 更新Collection事件
-			// 检查地板价是否变化
-			_, floorPrice := tradeInfo.orders.GetMin()
-			if floorPrice.Equal(event.Price) {
-				continue
+	case Buy, Transfer: // 购买或转移事件
+		// 如果是购买事件,从订单簿中删除订单
+		if event.EventType == Buy {
+			tradeInfo.listings.Remove(event.OrderId)
+		}
+		// 移除卖家的所有挂单
+		tradeInfo.listings.RemoveMakerOrders(event.From, event.TokenID)
+		// 获取买家的有效挂单
+		orders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, event.To)
+		if err != nil {
+			return errors.Wrap(err, "failed on get users valid orders")
+		}
+		// 添加买家的有效挂单到订单簿
+		for _, order := range orders {
+			if !order.IsOpenseaBanned {
+				tradeInfo.listings.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
 			}
+		}
 
-			// 重新加载订单并更新地板价
-			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-				continue
-			}
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	case ImportCollection: // 导入新的Collection事件
+		// 检查Collection是否已存在
+		if ok {
+			xzap.WithContext(om.Ctx).Warn("import collection repeated",
+				zap.String("collection_addr", event.CollectionAddr))
+			return nil
+		}
 
-		default:
-			xzap.WithContext(om.Ctx).Error("unsupported event type", zap.String("event content", result))
+		// 初始化新的Collection信息
+		om.collectionOrders[strings.ToLower(event.CollectionAddr)] = newCollectionTradeInfo(decimal.Zero)
+		return nil
+
+	case UpdateCollection: // 更新Collection事件
+		// 检查地板价是否变化
+		if tradeInfo.listings.BestPrice().Equal(event.Price) {
+			return nil
+		}
+
+		// 重新加载订单并更新地板价
+		if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on reload collection orders")
 		}
+
+	default:
+		return permanent(errors.Errorf("unsupported event type %d", event.EventType))
 	}
+
+	// 更新地板价、最高出价和价差
+	if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+		return errors.Wrap(err, "failed on update collection floor price")
+	}
+	if err := om.checkAndUpdateBidPrice(event.CollectionAddr); err != nil {
+		return err
+	}
+
+	// 记录地板价K线，购买事件计入成交额
+	var volume decimal.Decimal
+	if event.EventType == Buy {
+		volume = event.Price
+	}
+	om.observeCandle(event.CollectionAddr, tradeInfo, volume, candleTime(event), position)
+	return nil
 }
 
 // loadCollectionTradeInfo 函数主要负责初始化和加载集合(Collection)的交易信息,主要包含以下步骤:
 func (om *OrderManager) loadCollectionTradeInfo() error {
+	om.Mux.Lock()
+	defer om.Mux.Unlock()
+
 	// 1. 从数据库加载所有集合信息
 	var collections []*multi.Collection
 	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionTableName(om.project, om.chain)).
@@ -244,63 +338,80 @@ func (om *OrderManager) loadCollectionTradeInfo() error {
 		return errors.Wrap(err, "failed on get collection floor price")
 	}
 	for _, collection := range collections {
-		// 为每个集合初始化交易信息,包含地板价和订单优先队列
-		om.collectionOrders[strings.ToLower(collection.Address)] = &collectionTradeInfo{
-			floorPrice: collection.FloorPrice,
-			orders:     NewPriorityQueueMap(maxQueueLength), // 优先级队列,限制最大长度
-		}
+		// 为每个集合初始化交易信息,包含地板价和全量订单簿
+		om.collectionOrders[strings.ToLower(collection.Address)] = newCollectionTradeInfo(collection.FloorPrice)
 	}
-	// 2. 分批加载每个集合的前100个有效订单
-	var totalOrders []*multi.Order
-	var id int64
-	for {
-		var orders []*multi.Order
-		// 查询条件:
-		// - 订单类型为Listing
-		// - 订单状态为Active
-		// - maker必须是token的owner
-		// - 非OpenSea禁止的item
-		if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
-			Select("co.id as id ,co.order_id as order_id, co.collection_address as collection_address, co.price as price,co.maker as maker,co.token_id as token_id").
-			Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
-			Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1) and co.id > ?", multi.ListingType, multi.OrderStatusActive, id).
-			Order("co.id asc").Limit(1000).
-			Scan(&orders).Error; err != nil {
-			return errors.Wrap(err, "failed on get collection orders")
-		}
-		totalOrders = append(totalOrders, orders...)
-		if len(orders) < 1000 {
-			break
-		}
 
-		id = orders[len(orders)-1].ID
+	// 2. 分批加载所有有效挂单、集合出价和item出价
+	var orders []*multi.Order
+	for _, orderType := range []int64{multi.ListingOrder, multi.CollectionBidOrder, multi.ItemBidOrder} {
+		typeOrders, err := om.getValidOrders("", orderType)
+		if err != nil {
+			return err
+		}
+		orders = append(orders, typeOrders...)
 	}
 
-	// 3. 将订单添加到对应集合的优先队列中
-	for _, order := range totalOrders {
-		ordersQueue, ok := om.collectionOrders[strings.ToLower(order.CollectionAddress)]
+	// 3. 将订单添加到对应集合的订单簿中
+	for _, order := range orders {
+		tradeInfo, ok := om.collectionOrders[strings.ToLower(order.CollectionAddress)]
 		if !ok {
 			xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", order.CollectionAddress))
 			continue
 		}
-		ordersQueue.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+		tradeInfo.book(order.OrderType).Add(order.OrderID, order.Price, order.Maker, order.TokenId)
 	}
 
-	// 4. 检查并更新每个集合的地板价
+	// 4. 检查并更新每个集合的地板价，发布最优价格快照
 	for addr, tradeInfo := range om.collectionOrders {
-		_, floorPrice := tradeInfo.orders.GetMin()
+		floorPrice := tradeInfo.listings.BestPrice()
 		if !floorPrice.Equal(tradeInfo.floorPrice) {
-			om.collectionOrders[strings.ToLower(addr)].floorPrice = floorPrice
+			tradeInfo.floorPrice = floorPrice
 			if err := om.updateFloorPrice(addr, floorPrice); err != nil {
 				xzap.WithContext(om.Ctx).Warn("failed on update collection floor price",
 					zap.String("collection_addr", addr), zap.Error(err))
 			}
 		}
+		tradeInfo.price = tradeInfo.currentPrice(addr)
+		if err := om.cacheCollectionPrice(&tradeInfo.price); err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on cache collection price",
+				zap.String("collection_addr", addr), zap.Error(err))
+		}
 	}
 
 	return nil
 }
 
+// getValidOrders 分批查询指定类型的全部有效订单，address为空时查询所有collection
+// 挂单要求maker是token的owner且不是OpenSea禁止的item
+func (om *OrderManager) getValidOrders(address string, orderType int64) ([]*multi.Order, error) {
+	var totalOrders []*multi.Order
+	var id int64
+	for {
+		var orders []*multi.Order
+		db := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
+			Select("co.id as id, co.order_id as order_id, co.collection_address as collection_address, co.price as price, co.maker as maker, co.token_id as token_id, co.order_type as order_type").
+			Where("co.order_type = ? and co.order_status = ? and co.id > ?", orderType, multi.OrderStatusActive, id)
+		if orderType == multi.ListingOrder {
+			db = db.Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
+				Where("co.maker = ci.owner and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)")
+		}
+		if address != "" {
+			db = db.Where("co.collection_address = ?", address)
+		}
+		if err := db.Order("co.id asc").Limit(1000).Scan(&orders).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on get collection orders")
+		}
+		totalOrders = append(totalOrders, orders...)
+		if len(orders) < 1000 {
+			break
+		}
+
+		id = orders[len(orders)-1].ID
+	}
+	return totalOrders, nil
+}
+
 func (om *OrderManager) updateFloorPrice(collectionAddr string, price decimal.Decimal) error {
 	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionTableName(om.project, om.chain)).
 		Where("address=?", collectionAddr).Update("floor_price", price).Error; err != nil {
@@ -325,19 +436,19 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 	}
 
 	// 2. 获取集合当前最低价格
-	_, newFloorPrice := tradeInfo.orders.GetMin()
+	newFloorPrice := tradeInfo.listings.BestPrice()
 
 	// 3. 如果最低价格发生变化,则更新地板价
 	if !newFloorPrice.Equal(tradeInfo.floorPrice) {
-		// 更新内存缓存中的地板价
-		tradeInfo.floorPrice = newFloorPrice
-		om.collectionOrders[strings.ToLower(address)] = tradeInfo
-
 		// 更新数据库中的地板价
 		if err := om.updateFloorPrice(address, newFloorPrice); err != nil {
 			return errors.Wrap(err, "failed on update collection floor price")
 		}
 
+		// 数据库更新成功后更新内存缓存中的地板价，失败时重试会再次更新
+		tradeInfo.floorPrice = newFloorPrice
+		floorPriceUpdates.WithLabelValues(om.chain).Inc()
+
 		// 记录地板价更新日志
 		xzap.WithContext(om.Ctx).Info("update collection floor price",
 			zap.String("collection_addr", address), zap.String("floor_price", newFloorPrice.String()))
@@ -345,39 +456,7 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 	return nil
 }
 
-// getLowestPrice100Orders 函数用于获取指定NFT集合中价格最低的100个订单
-// 主要功能包括:
-// 1. 从数据库中查询指定集合的订单信息
-// 2. 过滤条件:
-//   - 订单类型为listing
-//   - 订单状态为active
-//   - maker必须是token的owner
-//   - 非OpenSea禁止的item
-//
-// 3. 按价格升序排序并限制返回100条记录
-// 参数说明:
-// - address: NFT集合地址
-// 返回值:
-// - []*multi.Order: 订单列表
-// - error: 错误信息
-func (om *OrderManager) getLowestPrice100Orders(address string) ([]*multi.Order, error) {
-	var orders []*multi.Order
-	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
-		Select("co.id,co.order_id as order_id, co.collection_address, co.price, co.maker,co.token_id").
-		Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
-		Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
-		Where("co.collection_address = ?", address).Order("co.price asc").Limit(100).
-		Scan(&orders).Error; err != nil {
-		return nil, errors.Wrap(err, "failed on get collection lowest price orders")
-	}
-	return orders, nil
-}
-
-// reloadCollectionOrders 函数用于重新加载指定NFT集合的订单信息
-// 主要功能包括:
-// 1. 检查集合是否被跟踪
-// 2. 获取该集合价格最低的100个订单
-// 3. 重新构建优先级队列并更新内存中的订单信息
+// reloadCollectionOrders 函数用于从数据库重建指定NFT集合的挂单、集合出价和item出价订单簿
 // 参数说明:
 // - address: NFT集合地址
 // 返回值:
@@ -390,23 +469,58 @@ func (om *OrderManager) reloadCollectionOrders(address string) error {
 		return errors.New("untracked collection")
 	}
 
-	// 2. 获取该集合价格最低的100个订单
-	orders, err := om.getLowestPrice100Orders(address)
+	// 2. 获取该集合的全部有效挂单、集合出价和item出价
+	listings, err := om.getValidOrders(address, multi.ListingOrder)
+	if err != nil {
+		return errors.Wrap(err, "failed on get collection listings")
+	}
+	bids, err := om.getValidOrders(address, multi.CollectionBidOrder)
+	if err != nil {
+		return errors.Wrap(err, "failed on get collection bids")
+	}
+	itemBids, err := om.getValidOrders(address, multi.ItemBidOrder)
 	if err != nil {
-		return errors.Wrap(err, "failed on get 100 orders at the lowest price")
+		return errors.Wrap(err, "failed on get collection item bids")
 	}
 
-	// 3. 重新构建优先级队列
-	tradeInfo.orders = NewPriorityQueueMap(maxQueueLength)
-	// 将订单添加到优先级队列中
-	for _, order := range orders {
-		tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+	// 3. 重新构建订单簿
+	tradeInfo.listings = NewOrderBook(SideListing)
+	for _, order := range listings {
+		tradeInfo.listings.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+	}
+	tradeInfo.bids = NewOrderBook(SideCollectionBid)
+	for _, order := range bids {
+		tradeInfo.bids.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+	}
+	tradeInfo.itemBids = NewOrderBook(SideItemBid)
+	for _, order := range itemBids {
+		tradeInfo.itemBids.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
 	}
-	// 更新内存中的订单信息
-	om.collectionOrders[strings.ToLower(address)] = tradeInfo
 	return nil
 }
 
+// Depth 返回collection指定方向订单簿的前levels个价格档位，collection未被跟踪时返回false
+func (om *OrderManager) Depth(address string, side Side, levels int) ([]DepthLevel, bool) {
+	om.Mux.RLock()
+	defer om.Mux.RUnlock()
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(address)]
+	if !ok {
+		return nil, false
+	}
+	return tradeInfo.sideBook(side).Depth(levels), true
+}
+
+// BestOrders 返回collection指定方向订单簿中最优的n个订单，collection未被跟踪时返回false
+func (om *OrderManager) BestOrders(address string, side Side, n int) ([]BookEntry, bool) {
+	om.Mux.RLock()
+	defer om.Mux.RUnlock()
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(address)]
+	if !ok {
+		return nil, false
+	}
+	return tradeInfo.sideBook(side).BestN(n), true
+}
+
 type ValidOrder struct {
 	multi.Order
 	IsOpenseaBanned bool `json:"is_opensea_banned"`
@@ -3,6 +3,7 @@ package ordermanager
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,25 +23,73 @@ func GenCollectionListedKey(chain, address string) string {
 	return fmt.Sprintf("cache:es:%s:collection:listed:%s", strings.ToLower(chain), strings.ToLower(address))
 }
 
+// listedSet 待重新统计上架数量的collection，随订单管理器快照一起保存
+type listedSet struct {
+	mu          sync.Mutex
+	seq         int64
+	all         int64            // 需要统计所有collection时为标记序号，否则为0
+	collections map[string]int64 // collection地址到标记序号
+	wake        chan struct{}
+}
+
+func newListedSet() *listedSet {
+	return &listedSet{
+		collections: make(map[string]int64),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// mark 标记collection需要重新统计
+func (l *listedSet) mark(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	l.collections[strings.ToLower(addr)] = l.seq
+}
+
+// markAll 标记所有collection需要重新统计，并立即唤醒统计协程
+func (l *listedSet) markAll() {
+	l.mu.Lock()
+	l.seq++
+	l.all = l.seq
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pending 返回待统计的collection及其标记序号，不清空记录
+func (l *listedSet) pending() (int64, map[string]int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	collections := make(map[string]int64, len(l.collections))
+	for addr, seq := range l.collections {
+		collections[addr] = seq
+	}
+	return l.all, collections
+}
+
+// done 清除统计完成的记录，统计期间重新标记的collection保留到下一轮
+func (l *listedSet) done(all int64, collections map[string]int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if all != 0 && l.all == all {
+		l.all = 0
+	}
+	for addr, seq := range collections {
+		if l.collections[addr] == seq {
+			delete(l.collections, addr)
+		}
+	}
+}
+
 // listCountProcess 函数负责处理和维护NFT集合的上架数量统计
 // 主要功能包括:
-// 1. 启动时统计所有集合的上架数量
+// 1. 没有快照时统计所有集合的上架数量，由floorPriceProcess标记
 // 2. 定时(每分钟)更新有变动的集合的上架数量
-// 3. 实时接收集合状态变更通知并记录需要更新的集合
+// 3. 统计失败的集合保留在待统计记录中，下一轮重试
 func (om *OrderManager) listCountProcess() {
-	// 启动时重新统计所有的collection list数量
-	collectionsListed, err := om.countCollectionListed([]string{})
-	if err != nil {
-		xzap.WithContext(om.Ctx).Error("failed on count collection listed",
-			zap.Error(err))
-	}
-	// 将统计结果缓存到Redis
-	if err := om.cacheCollectionListCount(collectionsListed); err != nil {
-		xzap.WithContext(om.Ctx).Error("failed on cache collection listed count",
-			zap.Error(err))
-	}
-	// 用于记录需要更新的集合地址
-	collections := make(map[string]bool)
 	// 创建定时器,每分钟执行一次更新
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
@@ -48,37 +97,48 @@ func (om *OrderManager) listCountProcess() {
 	for {
 		select {
 		case <-ticker.C: // 定时器触发
-			// 将map中记录的集合地址转换为切片
-			var cs []string
-			for c := range collections {
-				cs = append(cs, c)
-			}
-			// 如果有需要更新的集合
-			if len(cs) > 0 {
-				// 重新统计这些集合的上架数量
-				collectionsListed, err := om.countCollectionListed(cs)
-				if err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on count collection listed",
-						zap.Error(err))
-				}
-
-				// 更新缓存
-				if err := om.cacheCollectionListCount(collectionsListed); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on cache collection listed count",
-						zap.Error(err))
-				}
-				// 清空记录
-				collections = make(map[string]bool)
+		case <-om.listed.wake: // 需要统计所有集合
+		case <-om.quit.Done(): // 退出前统计最后一次
+			if err := om.flushCollectionListed(); err != nil {
+				xzap.WithContext(om.Ctx).Error("failed on flush collection listed count",
+					zap.Error(err))
 			}
-		case addr := <-om.collectionListedCh: // 接收到集合状态变更通知
-			// 记录需要更新的集合地址
-			collections[strings.ToLower(addr)] = true
-		case <-om.Ctx.Done(): // 上下文取消时退出
-			xzap.WithContext(om.Ctx).Info("collection list count process exit",
-				zap.Error(err))
+			xzap.WithContext(om.Ctx).Info("collection list count process exit")
 			return
 		}
+
+		if err := om.flushCollectionListed(); err != nil {
+			xzap.WithContext(om.Ctx).Error("failed on flush collection listed count",
+				zap.Error(err))
+		}
+	}
+}
+
+// flushCollectionListed 重新统计被标记的集合的上架数量并更新缓存
+func (om *OrderManager) flushCollectionListed() error {
+	all, collections := om.listed.pending()
+	if all == 0 && len(collections) == 0 {
+		return nil
 	}
+
+	// 标记了所有集合时统计全部，否则只统计被标记的集合
+	var cs []string
+	if all == 0 {
+		for c := range collections {
+			cs = append(cs, c)
+		}
+	}
+	collectionsListed, err := om.countCollectionListed(cs)
+	if err != nil {
+		return errors.Wrap(err, "failed on count collection listed")
+	}
+
+	// 更新缓存
+	if err := om.cacheCollectionListCount(collectionsListed); err != nil {
+		return errors.Wrap(err, "failed on cache collection listed count")
+	}
+	om.listed.done(all, collections)
+	return nil
 }
 
 // countCollectionListed 函数用于统计NFT集合的上架数量
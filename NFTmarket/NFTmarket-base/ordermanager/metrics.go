@@ -0,0 +1,111 @@
+package ordermanager
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	QueueMetricsInterval = 15 // in seconds
+
+	QueueOrders           = "orders"
+	QueueTradeEvents      = "trade_events"
+	QueueExpiry           = "expiry"
+	QueueExpiryProcessing = "expiry_processing"
+	QueueDeadLetters      = "dead_letters"
+)
+
+var (
+	expiryLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "order_expiry",
+		Name:      "lag_seconds",
+		Help:      "Largest delay between expire time and claim time of orders claimed in the last tick.",
+	}, []string{"chain"})
+	expiredOrders = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyswap",
+		Subsystem: "order_expiry",
+		Name:      "expired_total",
+		Help:      "Orders marked as expired by the expiry scheduler.",
+	}, []string{"chain"})
+	queueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "order_manager",
+		Name:      "queue_length",
+		Help:      "Pending entries in the order manager Redis queues.",
+	}, []string{"chain", "queue"})
+	floorPriceUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyswap",
+		Subsystem: "order_manager",
+		Name:      "floor_price_updates_total",
+		Help:      "Collection floor price changes written to the database.",
+	}, []string{"chain"})
+)
+
+func init() {
+	prometheus.MustRegister(expiryLag, expiredOrders, queueLength, floorPriceUpdates)
+}
+
+// QueueStats 返回各Redis队列中待处理的数量
+// orders、trade_events为待消费的事件，expiry为等待过期的订单，expiry_processing为已认领未处理完的订单
+func (om *OrderManager) QueueStats() (map[string]int64, error) {
+	rds := om.Xkv.Redis
+	stats := make(map[string]int64)
+
+	orders, err := rds.LlenCtx(om.Ctx, GenOrdersCacheKey(om.chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get orders queue length")
+	}
+	stats[QueueOrders] = int64(orders)
+
+	tradeEvents, err := rds.LlenCtx(om.Ctx, genTradeEventsCacheKey(om.chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get trade events queue length")
+	}
+	stats[QueueTradeEvents] = int64(tradeEvents)
+
+	expiry, err := rds.ZcardCtx(om.Ctx, genExpiryQueueKey(om.chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get expiry queue size")
+	}
+	stats[QueueExpiry] = int64(expiry)
+
+	expiryProcessing, err := rds.ZcardCtx(om.Ctx, genExpiryProcessingKey(om.chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get expiry processing size")
+	}
+	stats[QueueExpiryProcessing] = int64(expiryProcessing)
+
+	deadLetters, err := rds.HlenCtx(om.Ctx, genDeadLetterKey(om.chain))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get dead letter count")
+	}
+	stats[QueueDeadLetters] = int64(deadLetters)
+	return stats, nil
+}
+
+// queueMetricsProcess 定期上报各队列长度
+func (om *OrderManager) queueMetricsProcess() {
+	ticker := time.NewTicker(QueueMetricsInterval * time.Second)
+	defer ticker.Stop()
+	for {
+		stats, err := om.QueueStats()
+		if err != nil {
+			xzap.WithContext(om.Ctx).Warn("[Order Manage] failed on get queue stats", zap.Error(err))
+		}
+		for queue, length := range stats {
+			queueLength.WithLabelValues(om.chain, queue).Set(float64(length))
+		}
+
+		select {
+		case <-om.quit.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueStats(t *testing.T) {
+	mr := miniredis.RunT(t)
+	om := newTestExpiryManager(mr)
+
+	_, err := mr.Push(GenOrdersCacheKey(om.chain), "a", "b")
+	assert.NoError(t, err)
+	_, err = mr.Push(genTradeEventsCacheKey(om.chain), "c")
+	assert.NoError(t, err)
+	assert.NoError(t, om.scheduleExpiry("1", "0xa", 100))
+	assert.NoError(t, om.scheduleExpiry("2", "0xa", 200))
+	assert.NoError(t, om.scheduleExpiry("3", "0xb", 1000))
+	_, err = om.claimDueOrders(150)
+	assert.NoError(t, err)
+	mr.HSet(genDeadLetterKey(om.chain), "x", "{}")
+
+	stats, err := om.QueueStats()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		QueueOrders:           2,
+		QueueTradeEvents:      1,
+		QueueExpiry:           2,
+		QueueExpiryProcessing: 1,
+		QueueDeadLetters:      1,
+	}, stats)
+}
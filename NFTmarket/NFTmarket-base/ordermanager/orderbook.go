@@ -0,0 +1,245 @@
+package ordermanager
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Side 订单簿方向
+type Side int
+
+const (
+	SideListing       Side = iota + 1 // 挂单，价格升序，最优价为地板价
+	SideCollectionBid                 // 集合出价，价格降序，最优价为最高出价
+	SideItemBid                       // item出价，价格降序，最优价为所有item中的最高出价
+)
+
+// BookEntry 订单簿中的订单
+type BookEntry struct {
+	OrderID string          `json:"order_id"`
+	Price   decimal.Decimal `json:"price"`
+	Maker   string          `json:"maker"`
+	TokenID string          `json:"token_id"`
+}
+
+// DepthLevel 订单簿的一个价格档位
+type DepthLevel struct {
+	Price  decimal.Decimal `json:"price"`
+	Orders int             `json:"orders"`
+}
+
+type bookNode struct {
+	entry    *BookEntry
+	priority uint32
+	left     *bookNode
+	right    *bookNode
+}
+
+// OrderBook 单个collection单个方向的全量订单簿，以treap按价格和订单id排序，
+// 插入和删除的期望复杂度为O(log n)，最优N档按序遍历获取
+type OrderBook struct {
+	side   Side
+	root   *bookNode
+	orders map[string]*BookEntry
+	// maker和tokenID到订单id的索引，用于item转移后移除旧owner的挂单
+	makerOrders map[string]map[string]struct{}
+	// tokenID的订单数量，用于统计上架的item数量
+	tokenOrders map[string]int
+}
+
+func NewOrderBook(side Side) *OrderBook {
+	return &OrderBook{
+		side:        side,
+		orders:      make(map[string]*BookEntry),
+		makerOrders: make(map[string]map[string]struct{}),
+		tokenOrders: make(map[string]int),
+	}
+}
+
+func makerKey(maker, tokenID string) string {
+	return strings.ToLower(maker) + ":" + strings.ToLower(tokenID)
+}
+
+// less 按最优价排序，价格相同时按订单id排序
+func (b *OrderBook) less(x, y *BookEntry) bool {
+	if c := x.Price.Cmp(y.Price); c != 0 {
+		if b.side != SideListing {
+			return c > 0
+		}
+		return c < 0
+	}
+	return x.OrderID < y.OrderID
+}
+
+func (b *OrderBook) Len() int {
+	return len(b.orders)
+}
+
+// Tokens 返回有订单的item数量
+func (b *OrderBook) Tokens() int {
+	return len(b.tokenOrders)
+}
+
+// Add 添加订单，订单已存在时按新价格更新
+func (b *OrderBook) Add(orderID string, price decimal.Decimal, maker, tokenID string) {
+	b.Remove(orderID)
+	entry := &BookEntry{
+		OrderID: orderID,
+		Price:   price,
+		Maker:   strings.ToLower(maker),
+		TokenID: strings.ToLower(tokenID),
+	}
+	left, right := b.split(b.root, entry)
+	b.root = merge(merge(left, &bookNode{entry: entry, priority: rand.Uint32()}), right)
+
+	b.orders[orderID] = entry
+	key := makerKey(maker, tokenID)
+	if b.makerOrders[key] == nil {
+		b.makerOrders[key] = make(map[string]struct{})
+	}
+	b.makerOrders[key][orderID] = struct{}{}
+	b.tokenOrders[entry.TokenID]++
+}
+
+// Remove 删除订单，订单不存在时返回false
+func (b *OrderBook) Remove(orderID string) bool {
+	entry, ok := b.orders[orderID]
+	if !ok {
+		return false
+	}
+	b.root = b.remove(b.root, entry)
+	delete(b.orders, orderID)
+	key := makerKey(entry.Maker, entry.TokenID)
+	delete(b.makerOrders[key], orderID)
+	if len(b.makerOrders[key]) == 0 {
+		delete(b.makerOrders, key)
+	}
+	if b.tokenOrders[entry.TokenID]--; b.tokenOrders[entry.TokenID] <= 0 {
+		delete(b.tokenOrders, entry.TokenID)
+	}
+	return true
+}
+
+// RemoveMakerOrders 删除maker在指定item上的所有订单
+func (b *OrderBook) RemoveMakerOrders(maker, tokenID string) {
+	for orderID := range b.makerOrders[makerKey(maker, tokenID)] {
+		b.Remove(orderID)
+	}
+}
+
+// Best 返回最优价的订单，订单簿为空时返回false
+func (b *OrderBook) Best() (BookEntry, bool) {
+	node := b.root
+	if node == nil {
+		return BookEntry{}, false
+	}
+	for node.left != nil {
+		node = node.left
+	}
+	return *node.entry, true
+}
+
+// BestPrice 返回最优价，订单簿为空时返回0
+func (b *OrderBook) BestPrice() decimal.Decimal {
+	entry, ok := b.Best()
+	if !ok {
+		return decimal.Zero
+	}
+	return entry.Price
+}
+
+// BestN 按最优价顺序返回前n个订单
+func (b *OrderBook) BestN(n int) []BookEntry {
+	var entries []BookEntry
+	b.walk(func(entry *BookEntry) bool {
+		if len(entries) >= n {
+			return false
+		}
+		entries = append(entries, *entry)
+		return true
+	})
+	return entries
+}
+
+// Depth 按最优价顺序返回前levels个价格档位的订单数量
+func (b *OrderBook) Depth(levels int) []DepthLevel {
+	var depth []DepthLevel
+	b.walk(func(entry *BookEntry) bool {
+		if n := len(depth); n > 0 && depth[n-1].Price.Equal(entry.Price) {
+			depth[n-1].Orders++
+			return true
+		}
+		if len(depth) >= levels {
+			return false
+		}
+		depth = append(depth, DepthLevel{Price: entry.Price, Orders: 1})
+		return true
+	})
+	return depth
+}
+
+// walk 按序遍历订单，fn返回false时停止
+func (b *OrderBook) walk(fn func(entry *BookEntry) bool) {
+	var stack []*bookNode
+	node := b.root
+	for node != nil || len(stack) > 0 {
+		for node != nil {
+			stack = append(stack, node)
+			node = node.left
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(node.entry) {
+			return
+		}
+		node = node.right
+	}
+}
+
+// split 将子树拆分为小于entry和不小于entry的两部分
+func (b *OrderBook) split(node *bookNode, entry *BookEntry) (*bookNode, *bookNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if b.less(node.entry, entry) {
+		left, right := b.split(node.right, entry)
+		node.right = left
+		return node, right
+	}
+	left, right := b.split(node.left, entry)
+	node.left = right
+	return left, node
+}
+
+func (b *OrderBook) remove(node *bookNode, entry *BookEntry) *bookNode {
+	if node == nil {
+		return nil
+	}
+	if node.entry == entry {
+		return merge(node.left, node.right)
+	}
+	if b.less(entry, node.entry) {
+		node.left = b.remove(node.left, entry)
+	} else {
+		node.right = b.remove(node.right, entry)
+	}
+	return node
+}
+
+// merge 合并两棵子树，left中的订单均排在right之前
+func merge(left, right *bookNode) *bookNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		left.right = merge(left.right, right)
+		return left
+	}
+	right.left = merge(left, right.left)
+	return right
+}
@@ -0,0 +1,98 @@
+package ordermanager
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBookListing(t *testing.T) {
+	book := NewOrderBook(SideListing)
+	book.Add("101", decimal.NewFromFloat(1.2), "a", "1")
+	book.Add("102", decimal.NewFromFloat(1.3), "b", "2")
+	book.Add("99", decimal.NewFromFloat(1.1), "c", "3")
+	book.Add("98", decimal.NewFromFloat(1.1), "d", "4")
+	book.Add("100", decimal.NewFromFloat(1.1), "e", "5")
+	book.Add("103", decimal.NewFromFloat(1.4), "f", "6")
+	book.Add("104", decimal.NewFromFloat(1.5), "g", "7")
+
+	// 同价格按订单id排序
+	best, ok := book.Best()
+	assert.True(t, ok)
+	assert.Equal(t, "100", best.OrderID)
+	assert.Equal(t, decimal.NewFromFloat(1.1), best.Price)
+
+	var ids []string
+	for _, entry := range book.BestN(4) {
+		ids = append(ids, entry.OrderID)
+	}
+	assert.Equal(t, []string{"100", "98", "99", "101"}, ids)
+
+	assert.Equal(t, []DepthLevel{
+		{Price: decimal.NewFromFloat(1.1), Orders: 3},
+		{Price: decimal.NewFromFloat(1.2), Orders: 1},
+	}, book.Depth(2))
+
+	assert.True(t, book.Remove("100"))
+	assert.False(t, book.Remove("100"))
+	book.RemoveMakerOrders("D", "4")
+	book.RemoveMakerOrders("c", "3")
+	assert.Equal(t, decimal.NewFromFloat(1.2), book.BestPrice())
+	assert.Equal(t, 4, book.Len())
+
+	// 重复添加按新价格更新
+	book.Add("104", decimal.NewFromFloat(0.5), "g", "7")
+	assert.Equal(t, decimal.NewFromFloat(0.5), book.BestPrice())
+	assert.Equal(t, 4, book.Len())
+}
+
+func TestOrderBookCollectionBid(t *testing.T) {
+	book := NewOrderBook(SideCollectionBid)
+	assert.True(t, book.BestPrice().IsZero())
+
+	book.Add("1", decimal.NewFromFloat(0.8), "a", "0")
+	book.Add("2", decimal.NewFromFloat(1.0), "b", "0")
+	book.Add("3", decimal.NewFromFloat(0.9), "c", "0")
+	assert.Equal(t, decimal.NewFromFloat(1.0), book.BestPrice())
+
+	book.Remove("2")
+	assert.Equal(t, decimal.NewFromFloat(0.9), book.BestPrice())
+}
+
+func TestOrderBookRandom(t *testing.T) {
+	book := NewOrderBook(SideListing)
+	prices := make(map[string]int64)
+	for i := 0; i < 5000; i++ {
+		id := fmt.Sprintf("%d", rand.Intn(1000))
+		if rand.Intn(3) == 0 {
+			book.Remove(id)
+			delete(prices, id)
+			continue
+		}
+		price := rand.Int63n(100)
+		book.Add(id, decimal.NewFromInt(price), "m", id)
+		prices[id] = price
+	}
+
+	var expected []string
+	for id := range prices {
+		expected = append(expected, id)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if prices[expected[i]] != prices[expected[j]] {
+			return prices[expected[i]] < prices[expected[j]]
+		}
+		return expected[i] < expected[j]
+	})
+
+	var got []string
+	for _, entry := range book.BestN(len(expected)) {
+		got = append(got, entry.OrderID)
+	}
+	assert.Equal(t, len(expected), book.Len())
+	assert.Equal(t, expected, got)
+}
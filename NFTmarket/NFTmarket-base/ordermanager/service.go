@@ -9,19 +9,17 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/stores/redis"
-	"github.com/zeromicro/go-zero/core/threading"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 )
 
 const (
-	// WheelSize : length of time wheel, 1s for a unit, 1h for a cycle
-	WheelSize           = 3600
 	List                = 3
 	CacheOrdersQueuePre = "cache:es:orders:%s"
 )
@@ -30,71 +28,73 @@ func GenOrdersCacheKey(chain string) string {
 	return fmt.Sprintf(CacheOrdersQueuePre, chain)
 }
 
-// Activity ：collection order-activity
-type Order struct {
-	// order Id
-	orderID        string
-	CollectionAddr string
-	// chain suffix name: ethw/bsc
-	ChainSuffix string
-	// expireIn - createIn (unit: s)
-	CycleCount int64
-	// position of the task on the time wheel
-	WheelPosition int64
-
-	Next *Order
-}
-
-type wheel struct {
-	// linked list
-	NotifyActivities *Order
-}
-
 type OrderManager struct {
 	chain string
 
-	// cycle time wheel
-	TimeWheel [WheelSize]wheel
-	// current time wheel index
-	CurrentIndex int64
-
 	collectionOrders map[string]*collectionTradeInfo
+	candles          map[candleKey]*candle // 未写入数据库的地板价K线增量
+	flushedCandles   map[candleKey]int64   // 快照之后已写入数据库的K线及其队列位置，只在恢复时使用
+
+	listed  *listedSet
+	project string
+	leader  *xkv.Leader // leader选举，为nil时未启用；写入快照和K线前检查租约
 
-	collectionListedCh chan string
-	project            string
+	quit   context.Context // 后台协程的退出信号，父上下文结束或调用Stop时触发
+	cancel context.CancelFunc
+	loops  *lifecycle.Group
 
 	Xkv *xkv.Store
 	DB  *gorm.DB
-	Ctx context.Context
+	Ctx context.Context // 数据库和Redis请求的上下文，不随退出信号取消，保证退出前写入最后的快照
 	Mux *sync.RWMutex
 }
 
 // NewDelayQueue : create func instance entrance
 func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, chain string, project string) *OrderManager {
+	quit, cancel := context.WithCancel(ctx)
 	return &OrderManager{
-		chain:              chain,
-		Xkv:                xkv,
-		DB:                 db,
-		Ctx:                ctx,
-		Mux:                new(sync.RWMutex),
-		collectionOrders:   make(map[string]*collectionTradeInfo),
-		collectionListedCh: make(chan string, 1000),
-		project:            project,
+		chain:            chain,
+		Xkv:              xkv,
+		DB:               db,
+		Ctx:              context.WithoutCancel(ctx),
+		quit:             quit,
+		cancel:           cancel,
+		loops:            lifecycle.NewGroup(),
+		Mux:              new(sync.RWMutex),
+		collectionOrders: make(map[string]*collectionTradeInfo),
+		candles:          make(map[candleKey]*candle),
+		listed:           newListedSet(),
+		project:          project,
 	}
 }
 
+// SetLeader 设置leader选举，失去租约后不再写入快照和K线，需要在Start之前调用
+func (om *OrderManager) SetLeader(leader *xkv.Leader) {
+	om.leader = leader
+}
+
 func (om *OrderManager) Start() {
 	// 处理新订单
-	threading.GoSafe(om.ListenNewListingLoop)
+	om.loops.Go("listing", om.ListenNewListingLoop)
 	// 处理订单过期状态
-	threading.GoSafe(om.orderExpiryProcess)
+	om.loops.Go("expiry", om.orderExpiryProcess)
 	// 处理floorprice更新
-	threading.GoSafe(om.floorPriceProcess)
+	om.loops.Go("floor_price", om.floorPriceProcess)
 	// 处理listCount更新
-	threading.GoSafe(om.listCountProcess)
+	om.loops.Go("list_count", om.listCountProcess)
+	// 上报队列长度
+	om.loops.Go("queue_metrics", om.queueMetricsProcess)
+}
+
+// Stop 通知后台协程退出，等待正在处理的事件完成并写入最后的快照，ctx结束时返回仍在运行的协程
+func (om *OrderManager) Stop(ctx context.Context) error {
+	om.cancel()
+	return om.loops.Wait(ctx)
 }
 
-func (om *OrderManager) Stop() {
+// Status 返回每个后台协程的运行状态
+func (om *OrderManager) Status() map[string]lifecycle.State {
+	return om.loops.Status()
 }
 
 type ListingInfo struct {
@@ -104,76 +104,143 @@ type ListingInfo struct {
 	TokenID        string          `json:"token_id"`
 	Price          decimal.Decimal `json:"price"`
 	Maker          string          `json:"maker"`
+	OrderType      int64           `json:"order_type"`
+	EventTime      int64           `json:"event_time"` // 挂单所在区块的时间
 }
 
 // 处理新订单
+// 启动时加载过期调度快照并重放快照之后消费的订单，没有快照时从数据库加载所有有效订单到过期队列
 func (om *OrderManager) ListenNewListingLoop() {
-	key := GenOrdersCacheKey(om.chain)
+	stream := newEventStream(om.Xkv.Redis, GenOrdersCacheKey(om.chain))
+
+	// 恢复过期调度，失败时重试
+	var position int64
 	for {
-		// 获取订单
-		result, err := om.Xkv.Lpop(key)
-		if err != nil || result == "" {
-			if err != nil && err != redis.Nil {
-				xzap.WithContext(context.Background()).Warn("failed on get order from cache", zap.Error(err), zap.String("result", result))
-			}
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		xzap.WithContext(om.Ctx).Info("get listing from cache", zap.String("result", result))
-		// 序列化订单信息
-		var listing ListingInfo
-		if err := json.Unmarshal([]byte(result), &listing); err != nil {
-			xzap.WithContext(om.Ctx).Warn("failed on Unmarshal order info", zap.Error(err))
-			continue
+		var err error
+		position, err = om.restoreExpirySchedule(stream)
+		if err == nil {
+			break
 		}
-		// 校验订单
-		if listing.OrderId == "" {
-			xzap.WithContext(om.Ctx).Error("invalid null order id")
-			continue
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on restore expiry schedule", zap.Error(err))
+		select {
+		case <-om.quit.Done():
+			return
+		case <-time.After(time.Second * 10):
 		}
-		if listing.ExpireIn < time.Now().Unix() {
-			// 订单已经过期
-			xzap.WithContext(om.Ctx).Info("expired activity order", zap.String("order_id", listing.OrderId))
-			// 更新订单状态
-			if err := om.updateOrdersStatus(listing.OrderId, multi.OrderStatusExpired); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update activity status", zap.String("order_id", listing.OrderId), zap.Error(err))
+	}
+	if err := om.saveExpirySnapshot(stream, position); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save expiry snapshot", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(SnapshotInterval * time.Second)
+	defer ticker.Stop()
+	saved := position
+	for {
+		select {
+		case <-om.quit.Done():
+			// 退出前记录最后处理的订单位置
+			if position != saved {
+				if err := om.saveExpirySnapshot(stream, position); err != nil {
+					xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save expiry snapshot", zap.Error(err))
+				}
 			}
-			// 添加更新floorprice事件
-			if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-				EventType:      Expired,
-				CollectionAddr: listing.CollectionAddr,
-				TokenID:        listing.TokenID,
-				OrderId:        listing.OrderId,
-				From:           listing.Maker,
-			}); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on add update floor price event", zap.String("order_id", listing.OrderId), zap.Error(err))
+			xzap.WithContext(om.Ctx).Info("[Order Manage] listing loop exit", zap.String("chain", om.chain))
+			return
+		case <-ticker.C:
+			if position != saved {
+				if err := om.saveExpirySnapshot(stream, position); err != nil {
+					xzap.WithContext(om.Ctx).Error("[Order Manage] failed on save expiry snapshot", zap.Error(err))
+				} else {
+					saved = position
+				}
 			}
-			continue
-		} else {
-			// 订单未过期，添加更新floorprice事件
-			if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-				EventType:      Listing,
-				CollectionAddr: listing.CollectionAddr,
-				TokenID:        listing.TokenID,
-				OrderId:        listing.OrderId,
-				Price:          listing.Price,
-				From:           listing.Maker,
-			}); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on push order to update price queue", zap.Error(err), zap.String("order_id", listing.OrderId),
-					zap.String("order_id", listing.OrderId),
-					zap.String("price", listing.Price.String()),
-					zap.String("chain", om.chain))
+		default:
+		}
+
+		// 获取订单
+		entry, err := stream.pop(om.Ctx)
+		if err != nil || entry == nil {
+			if err != nil {
+				xzap.WithContext(om.Ctx).Warn("failed on get order from cache", zap.Error(err))
 			}
-			// 添加到订单过期检查队列
-			delaySeconds := listing.ExpireIn - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, listing.OrderId, listing.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on push order to expired check queue", zap.Error(err), zap.String("order_id", listing.OrderId),
-					zap.String("chain", om.chain))
+			select {
+			case <-om.quit.Done():
+			case <-time.After(time.Second):
 			}
+			continue
 		}
+		om.process(SourceListing, entry, om.handleListing)
+		position = entry.Position
 	}
 }
 
+// restoreExpirySchedule 重放过期调度快照之后消费的订单，返回恢复后的消费位置。
+// 没有快照时从数据库加载所有有效订单，加载前已消费的订单均已在数据库中
+func (om *OrderManager) restoreExpirySchedule(stream *eventStream) (int64, error) {
+	snap, ok, err := om.loadSnapshot(SnapshotExpiry, nil)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		position, err := stream.position(om.Ctx)
+		if err != nil {
+			return 0, err
+		}
+		if err := om.loadOrdersToQueue(); err != nil {
+			return 0, err
+		}
+		return position, nil
+	}
+
+	entries, err := stream.replay(om.Ctx, snap.Position)
+	if err != nil {
+		return 0, err
+	}
+	position := snap.Position
+	for _, entry := range entries {
+		om.process(SourceListing, entry, om.handleListing)
+		position = entry.Position
+	}
+	return position, nil
+}
+
+// handleListing 将新订单加入过期队列，未过期的订单同时添加更新floorprice事件，重复处理同一订单的结果不变
+func (om *OrderManager) handleListing(payload string) error {
+	xzap.WithContext(om.Ctx).Info("get listing from cache", zap.String("result", payload))
+	// 序列化订单信息
+	var listing ListingInfo
+	if err := json.Unmarshal([]byte(payload), &listing); err != nil {
+		return permanent(errors.Wrap(err, "failed on unmarshal order info"))
+	}
+	// 校验订单
+	if listing.OrderId == "" {
+		return permanent(errors.New("invalid null order id"))
+	}
+	if listing.ExpireIn < time.Now().Unix() {
+		// 订单已经过期，由过期队列在下一轮更新状态
+		xzap.WithContext(om.Ctx).Info("expired activity order", zap.String("order_id", listing.OrderId))
+	} else {
+		// 订单未过期，添加更新floorprice事件
+		if err := om.addUpdateFloorPriceEvent(&TradeEvent{
+			EventType:      Listing,
+			CollectionAddr: listing.CollectionAddr,
+			TokenID:        listing.TokenID,
+			OrderId:        listing.OrderId,
+			Price:          listing.Price,
+			From:           listing.Maker,
+			OrderType:      listing.OrderType,
+			BlockTime:      listing.EventTime,
+		}); err != nil {
+			return errors.Wrap(err, "failed on push order to update price queue")
+		}
+	}
+	// 添加到订单过期队列
+	if err := om.scheduleExpiry(listing.OrderId, listing.CollectionAddr, listing.ExpireIn); err != nil {
+		return errors.Wrap(err, "failed on push order to expired check queue")
+	}
+	return nil
+}
+
 // 添加订单
 func (om *OrderManager) AddToOrderManagerQueue(order *multi.Order) error {
 	if order.TokenId == "" {
@@ -186,6 +253,8 @@ func (om *OrderManager) AddToOrderManagerQueue(order *multi.Order) error {
 		TokenID:        order.TokenId,
 		Price:          order.Price,
 		Maker:          order.Maker,
+		OrderType:      order.OrderType,
+		EventTime:      order.EventTime,
 	})
 	if err != nil {
 		return errors.Wrap(err, "failed on marshal listing info")
@@ -197,3 +266,27 @@ func (om *OrderManager) AddToOrderManagerQueue(order *multi.Order) error {
 
 	return nil
 }
+
+// InactivateMakerListings 将maker在指定item上的有效挂单置为失效，用于item转移后旧owner的挂单无法成交的场景
+// tx为空时使用默认数据库连接，返回失效的订单id
+func (om *OrderManager) InactivateMakerListings(tx *gorm.DB, collectionAddr, tokenID, maker string) ([]string, error) {
+	if tx == nil {
+		tx = om.DB.WithContext(om.Ctx)
+	}
+	var orderIds []string
+	if err := tx.Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Where("collection_address = ? and token_id = ? and maker = ? and order_type = ? and order_status = ?",
+			collectionAddr, tokenID, maker, multi.ListingOrder, multi.OrderStatusActive).
+		Pluck("order_id", &orderIds).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get maker listings")
+	}
+	if len(orderIds) == 0 {
+		return nil, nil
+	}
+	if err := tx.Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Where("order_id in ?", orderIds).
+		Update("order_status", multi.OrderStatusInactive).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on inactivate maker listings")
+	}
+	return orderIds, nil
+}
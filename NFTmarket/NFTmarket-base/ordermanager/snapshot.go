@@ -0,0 +1,180 @@
+package ordermanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	CacheSnapshotPre = "cache:es:snapshot:%s:%s"
+	SnapshotInterval = 60 // in seconds
+
+	SnapshotFloor  = "floor"  // 订单簿、最优价格和待统计上架数量的collection，对应交易事件队列的位置
+	SnapshotExpiry = "expiry" // 过期调度，对应新订单队列的位置
+)
+
+func genSnapshotKey(chain, name string) string {
+	return fmt.Sprintf(CacheSnapshotPre, strings.ToLower(chain), name)
+}
+
+// snapshot 订单管理器的状态快照，Position为快照对应的事件队列消费位置
+type snapshot struct {
+	Position   int64           `json:"position"`
+	CreateTime int64           `json:"create_time"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+// collectionSnapshot 单个collection的订单簿和最优价格
+type collectionSnapshot struct {
+	Address    string          `json:"address"`
+	FloorPrice decimal.Decimal `json:"floor_price"`
+	Price      CollectionPrice `json:"price"`
+	Listings   []BookEntry     `json:"listings"`
+	Bids       []BookEntry     `json:"bids"`
+	ItemBids   []BookEntry     `json:"item_bids"`
+}
+
+// floorSnapshot floorPriceProcess的状态，待统计上架数量的collection由交易事件标记，一起保存
+type floorSnapshot struct {
+	Collections []*collectionSnapshot `json:"collections"`
+	ListedAll   bool                  `json:"listed_all"`
+	Listed      []string              `json:"listed"`
+}
+
+// saveSnapshot 保存快照，data为nil时只记录消费位置
+func (om *OrderManager) saveSnapshot(name string, position int64, data interface{}) error {
+	if err := om.leader.Check(om.Ctx); err != nil {
+		return errors.Wrap(err, "refuse to save snapshot")
+	}
+	snap := snapshot{
+		Position:   position,
+		CreateTime: time.Now().Unix(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return errors.Wrap(err, "failed on marshal snapshot data")
+		}
+		snap.Data = raw
+	}
+	if err := om.Xkv.Write(genSnapshotKey(om.chain, name), &snap); err != nil {
+		return errors.Wrap(err, "failed on write snapshot")
+	}
+	return nil
+}
+
+// loadSnapshot 读取快照并将数据反序列化到data，快照不存在时返回false
+func (om *OrderManager) loadSnapshot(name string, data interface{}) (*snapshot, bool, error) {
+	var snap snapshot
+	ok, err := om.Xkv.Read(genSnapshotKey(om.chain, name), &snap)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed on read snapshot")
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if data != nil && len(snap.Data) > 0 {
+		if err := json.Unmarshal(snap.Data, data); err != nil {
+			return nil, false, errors.Wrap(err, "failed on unmarshal snapshot data")
+		}
+	}
+	return &snap, true, nil
+}
+
+// takeFloorSnapshot 复制当前的订单簿状态，调用方需持有om.Mux
+func (om *OrderManager) takeFloorSnapshot() *floorSnapshot {
+	data := &floorSnapshot{}
+	for addr, tradeInfo := range om.collectionOrders {
+		data.Collections = append(data.Collections, &collectionSnapshot{
+			Address:    addr,
+			FloorPrice: tradeInfo.floorPrice,
+			Price:      tradeInfo.price,
+			Listings:   tradeInfo.listings.BestN(tradeInfo.listings.Len()),
+			Bids:       tradeInfo.bids.BestN(tradeInfo.bids.Len()),
+			ItemBids:   tradeInfo.itemBids.BestN(tradeInfo.itemBids.Len()),
+		})
+	}
+	sort.Slice(data.Collections, func(i, j int) bool {
+		return data.Collections[i].Address < data.Collections[j].Address
+	})
+
+	all, collections := om.listed.pending()
+	data.ListedAll = all != 0
+	for addr := range collections {
+		data.Listed = append(data.Listed, addr)
+	}
+	sort.Strings(data.Listed)
+	return data
+}
+
+// restoreFloorSnapshot 从快照恢复订单簿状态，调用方需持有om.Mux
+func (om *OrderManager) restoreFloorSnapshot(data *floorSnapshot) {
+	om.collectionOrders = make(map[string]*collectionTradeInfo, len(data.Collections))
+	for _, c := range data.Collections {
+		tradeInfo := newCollectionTradeInfo(c.FloorPrice)
+		tradeInfo.price = c.Price
+		for _, books := range []struct {
+			book    *OrderBook
+			entries []BookEntry
+		}{
+			{tradeInfo.listings, c.Listings},
+			{tradeInfo.bids, c.Bids},
+			{tradeInfo.itemBids, c.ItemBids},
+		} {
+			for _, entry := range books.entries {
+				books.book.Add(entry.OrderID, entry.Price, entry.Maker, entry.TokenID)
+			}
+		}
+		om.collectionOrders[strings.ToLower(c.Address)] = tradeInfo
+	}
+
+	if data.ListedAll {
+		om.listed.markAll()
+	}
+	for _, addr := range data.Listed {
+		om.listed.mark(addr)
+	}
+}
+
+// saveFloorSnapshot 写入地板价K线后保存订单簿快照，并删除快照之前的消费日志
+func (om *OrderManager) saveFloorSnapshot(stream *eventStream, position int64) error {
+	if err := om.leader.Check(om.Ctx); err != nil {
+		return errors.Wrap(err, "refuse to flush collection floor candles")
+	}
+	if err := om.flushCandles(); err != nil {
+		return err
+	}
+
+	om.Mux.RLock()
+	data := om.takeFloorSnapshot()
+	om.Mux.RUnlock()
+
+	if err := om.saveSnapshot(SnapshotFloor, position, data); err != nil {
+		return err
+	}
+	if err := stream.trim(om.Ctx, position); err != nil {
+		return err
+	}
+	xzap.WithContext(om.Ctx).Info("[Order Manage] save floor snapshot",
+		zap.String("chain", om.chain), zap.Int64("position", position),
+		zap.Int("collections", len(data.Collections)))
+	return nil
+}
+
+// saveExpirySnapshot 记录过期调度对应的新订单队列位置并删除之前的消费日志，
+// 过期调度本身保存在Redis有序集合中
+func (om *OrderManager) saveExpirySnapshot(stream *eventStream, position int64) error {
+	if err := om.saveSnapshot(SnapshotExpiry, position, nil); err != nil {
+		return err
+	}
+	return stream.trim(om.Ctx, position)
+}
@@ -0,0 +1,139 @@
+package ordermanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+func newTestSnapshotManager(mr *miniredis.Miniredis) *OrderManager {
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	quit, cancel := context.WithCancel(ctx)
+	return &OrderManager{
+		chain:            "sepolia",
+		Ctx:              ctx,
+		quit:             quit,
+		cancel:           cancel,
+		loops:            lifecycle.NewGroup(),
+		Mux:              new(sync.RWMutex),
+		collectionOrders: make(map[string]*collectionTradeInfo),
+		candles:          make(map[candleKey]*candle),
+		listed:           newListedSet(),
+		Xkv: xkv.NewStore([]cache.NodeConf{{
+			RedisConf: redis.RedisConf{Host: mr.Addr(), Type: "node"},
+			Weight:    100,
+		}}),
+	}
+}
+
+func TestFloorSnapshot(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newTestSnapshotManager(mr)
+
+	info := newCollectionTradeInfo(decimal.NewFromFloat(1.1))
+	info.book(multi.ListingOrder).Add("1", decimal.NewFromFloat(1.1), "a", "1")
+	info.book(multi.ListingOrder).Add("2", decimal.NewFromFloat(1.5), "b", "2")
+	info.book(multi.CollectionBidOrder).Add("3", decimal.NewFromFloat(0.9), "c", "0")
+	info.book(multi.ItemBidOrder).Add("4", decimal.NewFromFloat(0.8), "d", "1")
+	info.price = info.currentPrice("0xabc")
+	a.collectionOrders["0xabc"] = info
+	a.collectionOrders["0xdef"] = newCollectionTradeInfo(decimal.Zero)
+	a.listed.mark("0xABC")
+
+	stream := newEventStream(a.Xkv.Redis, genTradeEventsCacheKey(a.chain))
+	assert.NoError(t, a.saveFloorSnapshot(stream, 42))
+
+	b := newTestSnapshotManager(mr)
+	var data floorSnapshot
+	snap, ok, err := b.loadSnapshot(SnapshotFloor, &data)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), snap.Position)
+	b.restoreFloorSnapshot(&data)
+
+	assert.Len(t, b.collectionOrders, 2)
+	restored := b.collectionOrders["0xabc"]
+	assert.True(t, restored.floorPrice.Equal(decimal.NewFromFloat(1.1)))
+	assert.Equal(t, 2, restored.listings.Len())
+	assert.Equal(t, info.listings.BestN(2), restored.listings.BestN(2))
+	assert.True(t, restored.bids.BestPrice().Equal(decimal.NewFromFloat(0.9)))
+	assert.True(t, restored.itemBids.BestPrice().Equal(decimal.NewFromFloat(0.8)))
+	assert.True(t, restored.price.equal(&info.price))
+
+	// 待统计上架数量的collection随快照恢复
+	all, collections := b.listed.pending()
+	assert.Equal(t, int64(0), all)
+	assert.Contains(t, collections, "0xabc")
+
+	// 恢复后item转移仍能按maker移除挂单
+	restored.listings.RemoveMakerOrders("a", "1")
+	assert.True(t, restored.listings.BestPrice().Equal(decimal.NewFromFloat(1.5)))
+}
+
+func TestListedSet(t *testing.T) {
+	l := newListedSet()
+	l.mark("0xA")
+	l.mark("0xb")
+	all, collections := l.pending()
+	assert.Equal(t, int64(0), all)
+	assert.Len(t, collections, 2)
+
+	// 统计期间重新标记的collection保留到下一轮
+	l.mark("0xa")
+	l.done(all, collections)
+	_, collections = l.pending()
+	assert.Equal(t, []string{"0xa"}, keys(collections))
+
+	l.markAll()
+	all, collections = l.pending()
+	assert.NotEqual(t, int64(0), all)
+	select {
+	case <-l.wake:
+	default:
+		t.Error("expected wake up after mark all")
+	}
+	l.done(all, collections)
+	all, collections = l.pending()
+	assert.Equal(t, int64(0), all)
+	assert.Len(t, collections, 0)
+}
+
+func keys(m map[string]int64) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func TestOrderManagerStop(t *testing.T) {
+	mr := miniredis.RunT(t)
+	om := newTestSnapshotManager(mr)
+	assert.NoError(t, om.saveSnapshot(SnapshotFloor, 0, &floorSnapshot{}))
+
+	om.loops.Go("floor_price", om.floorPriceProcess)
+	om.loops.Go("list_count", om.listCountProcess)
+	assert.Equal(t, lifecycle.Running, om.Status()["floor_price"])
+	assert.Equal(t, lifecycle.Running, om.Status()["list_count"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assert.NoError(t, om.Stop(ctx))
+	assert.Equal(t, map[string]lifecycle.State{
+		"floor_price": lifecycle.Stopped,
+		"list_count":  lifecycle.Stopped,
+	}, om.Status())
+}
@@ -0,0 +1,108 @@
+package ordermanager
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// popStreamScript 从队列头部取出一个事件，分配递增的消费位置并记录到日志有序集合，
+// 进程在处理事件前退出时，重启后可以从日志中重放
+// KEYS[1] 事件队列 KEYS[2] 消费位置 KEYS[3] 消费日志
+const popStreamScript = `local payload = redis.call('LPOP', KEYS[1])
+if not payload then
+    return false
+end
+local position = redis.call('INCR', KEYS[2])
+redis.call('ZADD', KEYS[3], position, position .. ':' .. payload)
+return {position, payload}`
+
+// streamEntry 从队列中消费的事件
+type streamEntry struct {
+	Position int64
+	Payload  string
+}
+
+// eventStream 基于Redis列表的事件队列，每个消费的事件带有递增的位置，
+// 快照记录其对应的位置，重启后只重放快照之后消费的事件
+type eventStream struct {
+	rds         *redis.Redis
+	key         string
+	positionKey string
+	journalKey  string
+}
+
+func newEventStream(rds *redis.Redis, key string) *eventStream {
+	return &eventStream{
+		rds:         rds,
+		key:         key,
+		positionKey: key + ":position",
+		journalKey:  key + ":journal",
+	}
+}
+
+// pop 消费队列头部的事件，队列为空时返回nil
+func (s *eventStream) pop(ctx context.Context) (*streamEntry, error) {
+	resp, err := s.rds.EvalCtx(ctx, popStreamScript, []string{s.key, s.positionKey, s.journalKey})
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "eval pop stream script err")
+	}
+
+	values, ok := resp.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, errors.New("invalid pop stream result")
+	}
+	position, _ := values[0].(int64)
+	payload, _ := values[1].(string)
+	return &streamEntry{Position: position, Payload: payload}, nil
+}
+
+// position 返回最后一个被消费事件的位置
+func (s *eventStream) position(ctx context.Context) (int64, error) {
+	value, err := s.rds.GetCtx(ctx, s.positionKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get stream position")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	position, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid stream position")
+	}
+	return position, nil
+}
+
+// replay 按位置顺序返回位置大于after的已消费事件
+func (s *eventStream) replay(ctx context.Context, after int64) ([]*streamEntry, error) {
+	pairs, err := s.rds.ZrangebyscoreWithScoresCtx(ctx, s.journalKey, after+1, math.MaxInt64)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get stream journal")
+	}
+
+	entries := make([]*streamEntry, 0, len(pairs))
+	for _, pair := range pairs {
+		// 成员格式为 位置:事件内容
+		index := strings.IndexByte(pair.Key, ':')
+		if index < 0 {
+			continue
+		}
+		entries = append(entries, &streamEntry{Position: pair.Score, Payload: pair.Key[index+1:]})
+	}
+	return entries, nil
+}
+
+// trim 删除位置不大于upto的消费日志，在快照保存后调用
+func (s *eventStream) trim(ctx context.Context, upto int64) error {
+	if _, err := s.rds.ZremrangebyscoreCtx(ctx, s.journalKey, 0, upto); err != nil {
+		return errors.Wrap(err, "failed on trim stream journal")
+	}
+	return nil
+}
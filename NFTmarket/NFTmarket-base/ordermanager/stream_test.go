@@ -0,0 +1,58 @@
+package ordermanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func TestEventStream(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rds := redis.New(mr.Addr())
+	ctx := context.Background()
+	stream := newEventStream(rds, "cache:es:trade:events:sepolia")
+
+	entry, err := stream.pop(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+	position, err := stream.position(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), position)
+
+	_, err = rds.Rpush(stream.key, `{"order_id":"1"}`, `{"order_id":"2"}`, `{"order_id":"3"}`)
+	assert.NoError(t, err)
+
+	for i := int64(1); i <= 2; i++ {
+		entry, err = stream.pop(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, i, entry.Position)
+	}
+	assert.Equal(t, `{"order_id":"2"}`, entry.Payload)
+
+	// 已消费的事件保留在日志中，未消费的事件保留在队列中
+	entries, err := stream.replay(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = stream.replay(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*streamEntry{{Position: 2, Payload: `{"order_id":"2"}`}}, entries)
+	length, err := rds.Llen(stream.key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, length)
+
+	// 保存快照后删除之前的日志
+	assert.NoError(t, stream.trim(ctx, 2))
+	entries, err = stream.replay(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+
+	entry, err = stream.pop(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), entry.Position)
+	position, err = stream.position(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), position)
+}
@@ -0,0 +1,21 @@
+package multi
+
+import "fmt"
+
+// BatchMatchError matchOrders中单笔撮合失败的记录
+type BatchMatchError struct {
+	Id          int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	TxHash      string `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	LogIndex    int64  `gorm:"column:log_index;NOT NULL" json:"log_index"`                                              // 日志在区块中的序号
+	BlockNumber int64  `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	MatchOffset int64  `gorm:"column:match_offset;NOT NULL" json:"match_offset"`                                        // 失败的撮合在批量参数中的下标
+	RevertData  string `gorm:"column:revert_data" json:"revert_data"`                                                   // 原始revert数据(hex)
+	Reason      string `gorm:"column:reason" json:"reason"`                                                             // 解析后的失败原因
+	EventTime   int64  `gorm:"column:event_time;default:0" json:"event_time"`                                           // 链上事件发生的时间
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func BatchMatchErrorTableName(chainName string) string {
+	return fmt.Sprintf("ob_batch_match_error_%s", chainName)
+}
@@ -29,12 +29,18 @@ const (
 	AlreadySyncHistorySale = 1
 )
 
+// (1:ERC-721,2:ERC-1155)
+const (
+	TokenStandardERC721  = 1
+	TokenStandardERC1155 = 2
+)
+
 type Collection struct {
 	Id               int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`             // 主键
 	Symbol           string          `gorm:"column:symbol;NOT NULL" json:"symbol"`                       // 项目标识
 	ChainId          int             `gorm:"column:chain_id;default:1;NOT NULL" json:"chain_id"`         // 链类型(1:以太坊)
 	Auth             int             `gorm:"column:auth;default:0;NOT NULL" json:"auth"`                 // 认证(0:默认未认证1:认证通过2:认证不通过)
-	TokenStandard    int64           `gorm:"column:token_standard;NOT NULL" json:"token_standard"`       // 合约实现标准
+	TokenStandard    int64           `gorm:"column:token_standard;NOT NULL" json:"token_standard"`       // 合约实现标准(1:ERC-721,2:ERC-1155)
 	Name             string          `gorm:"column:name;NOT NULL" json:"name"`                           // 项目名称
 	Creator          string          `gorm:"column:creator;NOT NULL" json:"creator"`                     // 创建者
 	Address          string          `gorm:"column:address;NOT NULL" json:"address"`                     // 链上合约地址
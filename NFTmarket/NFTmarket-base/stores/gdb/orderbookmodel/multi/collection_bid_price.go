@@ -0,0 +1,23 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CollectionBidPrice collection最高出价和价差的变化记录
+type CollectionBidPrice struct {
+	Id                int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	CollectionAddress string          `gorm:"column:collection_address;NOT NULL" json:"collection_address"`                            // 链上合约地址
+	BestBid           decimal.Decimal `gorm:"column:best_bid;type:decimal(30,18);comment:最高集合出价" json:"best_bid"`                      // 最高集合出价
+	BestItemBid       decimal.Decimal `gorm:"column:best_item_bid;type:decimal(30,18);comment:最高item出价" json:"best_item_bid"`          // 最高item出价
+	Spread            decimal.Decimal `gorm:"column:spread;type:decimal(30,18);comment:地板价与最高集合出价之差" json:"spread"`                    // 价差
+	EventTime         int64           `gorm:"column:event_time" json:"event_time"`                                                     // 事件时间
+	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func CollectionBidPriceTableName(chainName string) string {
+	return fmt.Sprintf("ob_collection_bid_price_%s", chainName)
+}
@@ -0,0 +1,29 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CollectionFloorCandle collection地板价K线，地板价为0(没有挂单)的时刻不计入开高低收
+type CollectionFloorCandle struct {
+	Id                int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	CollectionAddress string          `gorm:"column:collection_address;NOT NULL" json:"collection_address"`                            // 链上合约地址
+	Period            string          `gorm:"column:period;NOT NULL;comment:K线周期 5m/1h/1d" json:"period"`                              // K线周期
+	OpenTime          int64           `gorm:"column:open_time;NOT NULL;comment:周期开始时间" json:"open_time"`                               // 周期开始时间
+	Open              decimal.Decimal `gorm:"column:open;type:decimal(30,18)" json:"open"`                                             // 开盘地板价
+	High              decimal.Decimal `gorm:"column:high;type:decimal(30,18)" json:"high"`                                             // 最高地板价
+	Low               decimal.Decimal `gorm:"column:low;type:decimal(30,18)" json:"low"`                                               // 最低地板价
+	Close             decimal.Decimal `gorm:"column:close;type:decimal(30,18)" json:"close"`                                           // 收盘地板价
+	ListedCount       int64           `gorm:"column:listed_count;comment:周期结束时的上架数量" json:"listed_count"`                              // 上架数量
+	Volume            decimal.Decimal `gorm:"column:volume;type:decimal(30,18);comment:周期内成交额" json:"volume"`                          // 成交额
+	Sales             int64           `gorm:"column:sales;comment:周期内成交数量" json:"sales"`                                               // 成交数量
+	StreamPosition    int64           `gorm:"column:stream_position;default:0;NOT NULL" json:"stream_position"`                        // 已合并的最后一个交易事件的队列位置
+	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func CollectionFloorCandleTableName(chainName string) string {
+	return fmt.Sprintf("ob_collection_floor_candle_%s", chainName)
+}
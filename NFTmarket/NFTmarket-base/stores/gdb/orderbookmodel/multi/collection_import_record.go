@@ -4,12 +4,28 @@ import (
 	"fmt"
 )
 
+const (
+	ImportStageQueued     = 0 // 加入任务
+	ImportStageCollection = 1 // collection导入完成
+	ImportStageDone       = 2 // item导入完成
+)
+
+const (
+	ImportTokenSourceEnumerable = 1 // 通过ERC721Enumerable枚举token
+	ImportTokenSourceTransfer   = 2 // 通过回放Transfer日志枚举token
+)
+
 // CollectionImportRecord 导入结果表信息
 type CollectionImportRecord struct {
 	Id                int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:id"` // id
-	CollectionAddress string `json:"address" gorm:"column:address;type:varchar(42);index:index_collection_address;not null;default:'';comment:链上合约地址"`
-	Msg               string `json:"msg" gorm:"msg;type:varchar(16000);default:'';not null;comment:错误的提示信息"`
+	CollectionAddress string `json:"address" gorm:"column:collection_address;type:varchar(42);index:index_collection_address;not null;default:'';comment:链上合约地址"`
+	Msg               string `json:"msg" gorm:"column:msg;type:varchar(1600);default:'';not null;comment:错误的提示信息"`
 	FinishedStage     int32  `json:"finished_stage" gorm:"column:finished_stage;type:tinyint(1);not null;default:0;comment:已完成的阶段。0表示加入任务，1表示导入collection完成，2全部完成(指item导入完成，photo不好记录不影响此处的阶段)"`
+	TokenSource       int32  `json:"token_source" gorm:"column:token_source;type:tinyint(1);not null;default:0;comment:token枚举方式(1:ERC721Enumerable 2:Transfer日志)"`
+	TotalCount        int64  `json:"total_count" gorm:"column:total_count;type:bigint(20);not null;default:0;comment:待导入的数量，Enumerable为token数量，Transfer为区块数量"`
+	ImportedCount     int64  `json:"imported_count" gorm:"column:imported_count;type:bigint(20);not null;default:0;comment:已导入的item数量"`
+	NextCursor        int64  `json:"next_cursor" gorm:"column:next_cursor;type:bigint(20);not null;default:0;comment:下一次导入的位置，Enumerable为token序号，Transfer为区块高度"`
+	ToBlock           int64  `json:"to_block" gorm:"column:to_block;type:bigint(20);not null;default:0;comment:Transfer日志回放的截止区块"`
 	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
 	UpdateTime        int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
 }
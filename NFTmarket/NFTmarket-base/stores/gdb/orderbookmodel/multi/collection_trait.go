@@ -0,0 +1,18 @@
+package multi
+
+import "fmt"
+
+// CollectionTrait collection中每个属性值的item数量
+type CollectionTrait struct {
+	Id                int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"` // 主键
+	CollectionAddress string `gorm:"column:collection_address;NOT NULL" json:"collection_address"`
+	Trait             string `gorm:"column:trait;NOT NULL" json:"trait"`                                                      // 属性名称
+	TraitValue        string `gorm:"column:trait_value;NOT NULL" json:"trait_value"`                                          // 属性值
+	Count             int64  `gorm:"column:count;default:0;NOT NULL" json:"count"`                                            // 拥有该属性值的item数量
+	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func CollectionTraitTableName(chainName string) string {
+	return fmt.Sprintf("ob_collection_trait_%s", chainName)
+}
@@ -0,0 +1,18 @@
+package multi
+
+import "fmt"
+
+// IndexedBlock 已索引区块的hash记录，用于检测链重组
+type IndexedBlock struct {
+	Id              int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	ContractAddress string `gorm:"column:contract_address;NOT NULL" json:"contract_address"`                                // 订单簿合约地址
+	BlockNumber     int64  `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	BlockHash       string `gorm:"column:block_hash;NOT NULL" json:"block_hash"`                                            // 区块hash
+	ParentHash      string `gorm:"column:parent_hash;NOT NULL" json:"parent_hash"`                                          // 父区块hash
+	CreateTime      int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime      int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IndexedBlockTableName(chainName string) string {
+	return fmt.Sprintf("ob_indexed_block_%s", chainName)
+}
@@ -0,0 +1,40 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// (1:创建订单,2:更新订单,3:更新item owner,4:更新ERC-1155持有数量,5:创建item,6:更新ERC-1155发行量)
+const (
+	JournalOrderCreated  = 1
+	JournalOrderUpdated  = 2
+	JournalItemOwner     = 3
+	JournalHolderBalance = 4
+	JournalItemCreated   = 5
+	JournalItemSupply    = 6
+)
+
+// IndexerJournal 索引器的回滚日志，记录每次变更前的数据，链重组时按倒序恢复
+type IndexerJournal struct {
+	Id                    int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	ContractAddress       string          `gorm:"column:contract_address;NOT NULL" json:"contract_address"`                                // 订单簿合约地址或索引器的key
+	BlockNumber           int64           `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	TxHash                string          `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	JournalType           int             `gorm:"column:journal_type;NOT NULL" json:"journal_type"`                                        // 变更类型
+	OrderID               string          `gorm:"column:order_id" json:"order_id"`                                                         // 订单id
+	CollectionAddress     string          `gorm:"column:collection_address" json:"collection_address"`                                     // 合约地址
+	TokenId               string          `gorm:"column:token_id" json:"token_id"`                                                         // token_id
+	PrevOrderStatus       int             `gorm:"column:prev_order_status" json:"prev_order_status"`                                       // 变更前的订单状态
+	PrevQuantityRemaining int64           `gorm:"column:prev_quantity_remaining" json:"prev_quantity_remaining"`                           // 变更前的剩余数量
+	PrevTaker             string          `gorm:"column:prev_taker" json:"prev_taker"`                                                     // 变更前的taker
+	PrevOwner             string          `gorm:"column:prev_owner" json:"prev_owner"`                                                     // 变更前的owner，ERC-1155为持有者
+	PrevBalance           decimal.Decimal `gorm:"column:prev_balance" json:"prev_balance"`                                                 // 变更前的ERC-1155持有数量或发行量
+	CreateTime            int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime            int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IndexerJournalTableName(chainName string) string {
+	return fmt.Sprintf("ob_indexer_journal_%s", chainName)
+}
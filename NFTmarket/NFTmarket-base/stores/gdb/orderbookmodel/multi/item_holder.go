@@ -0,0 +1,22 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ItemHolder ERC-1155 item的持有者和持有数量，ERC-721 item的owner记录在item表中
+type ItemHolder struct {
+	Id                int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	CollectionAddress string          `gorm:"column:collection_address;NOT NULL" json:"collection_address"`                            // 合约地址
+	TokenId           string          `gorm:"column:token_id;NOT NULL" json:"token_id"`                                                // token_id
+	Owner             string          `gorm:"column:owner;NOT NULL" json:"owner"`                                                      // 持有者
+	Balance           decimal.Decimal `gorm:"column:balance;NOT NULL" json:"balance"`                                                  // 持有数量
+	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ItemHolderTableName(chainName string) string {
+	return fmt.Sprintf("ob_item_holder_%s", chainName)
+}
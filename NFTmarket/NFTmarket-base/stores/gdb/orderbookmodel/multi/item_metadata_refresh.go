@@ -0,0 +1,27 @@
+package multi
+
+import "fmt"
+
+// metadata刷新状态
+const (
+	MetadataRefreshPending = 0 // 已加入刷新队列
+	MetadataRefreshDone    = 1 // 刷新成功
+	MetadataRefreshFailed  = 2 // 刷新失败，原因见reason
+)
+
+// ItemMetadataRefresh item的metadata刷新状态，每个item只保留最近一次刷新的结果
+type ItemMetadataRefresh struct {
+	Id                int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	CollectionAddress string `gorm:"column:collection_address;NOT NULL" json:"collection_address"`                            // 合约地址
+	TokenId           string `gorm:"column:token_id;NOT NULL" json:"token_id"`                                                // token_id
+	Status            int    `gorm:"column:status;default:0;NOT NULL" json:"status"`                                          // 刷新状态
+	Reason            string `gorm:"column:reason" json:"reason"`                                                             // 失败原因
+	RequestTime       int64  `gorm:"column:request_time;default:0" json:"request_time"`                                       // 最近一次加入刷新队列的时间
+	RefreshTime       int64  `gorm:"column:refresh_time;default:0" json:"refresh_time"`                                       // 最近一次刷新完成的时间
+	CreateTime        int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ItemMetadataRefreshTableName(chainName string) string {
+	return fmt.Sprintf("ob_item_metadata_refresh_%s", chainName)
+}
@@ -0,0 +1,21 @@
+package multi
+
+import "fmt"
+
+// OrderEdit 订单编辑记录，editOrders会取消旧订单并创建新订单，这里记录新旧订单的关联
+type OrderEdit struct {
+	Id          int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	OldOrderID  string `gorm:"column:old_order_id;NOT NULL" json:"old_order_id"`                                        // 旧订单hash
+	NewOrderID  string `gorm:"column:new_order_id;NOT NULL" json:"new_order_id"`                                        // 新订单hash
+	Maker       string `gorm:"column:maker;NOT NULL" json:"maker"`                                                      // 订单创建者
+	BlockNumber int64  `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	TxHash      string `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	LogIndex    int64  `gorm:"column:log_index;NOT NULL" json:"log_index"`                                              // 日志在区块中的序号
+	EventTime   int64  `gorm:"column:event_time;default:0" json:"event_time"`                                           // 链上事件发生的时间
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OrderEditTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_edit_%s", chainName)
+}
@@ -0,0 +1,30 @@
+package multi
+
+import "fmt"
+
+// 订单被合约跳过的原因
+const (
+	SkipReasonInvalidMake      = "invalid_make"       // 新订单参数无效，订单未创建
+	SkipReasonOrderFilled      = "order_filled"       // 订单已完成
+	SkipReasonOrderCancelled   = "order_cancelled"    // 订单已取消
+	SkipReasonInvalidEditOrder = "invalid_edit_order" // 编辑时新订单无效(salt、过期时间或已成交)
+	SkipReasonRejected         = "rejected"           // 非订单创建者操作或编辑修改了价格和数量以外的字段
+)
+
+// OrderSkip 合约LogSkipOrder事件记录
+type OrderSkip struct {
+	Id          int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	OrderID     string `gorm:"column:order_id;NOT NULL" json:"order_id"`                                                // 订单hash
+	Salt        int64  `gorm:"column:salt;NOT NULL" json:"salt"`                                                        // 事件中的salt
+	Reason      string `gorm:"column:reason;NOT NULL" json:"reason"`                                                    // 跳过原因
+	BlockNumber int64  `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	TxHash      string `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	LogIndex    int64  `gorm:"column:log_index;NOT NULL" json:"log_index"`                                              // 日志在区块中的序号
+	EventTime   int64  `gorm:"column:event_time;default:0" json:"event_time"`                                           // 链上事件发生的时间
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OrderSkipTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_skip_%s", chainName)
+}
@@ -0,0 +1,23 @@
+package multi
+
+import "fmt"
+
+// (1:新订单,2:交易事件,3:市场事件)
+const (
+	OutboxOrder       = 1
+	OutboxTradeEvent  = 2
+	OutboxMarketEvent = 3
+)
+
+// Outbox 事务发件箱，与数据库变更在同一事务中写入，再由后台任务投递到redis
+type Outbox struct {
+	Id          int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	MessageType int    `gorm:"column:message_type;NOT NULL" json:"message_type"`                                        // 消息类型
+	Payload     string `gorm:"column:payload;NOT NULL" json:"payload"`                                                  // 消息内容(json)
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OutboxTableName(chainName string) string {
+	return fmt.Sprintf("ob_outbox_%s", chainName)
+}
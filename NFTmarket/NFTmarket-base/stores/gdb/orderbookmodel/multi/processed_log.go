@@ -0,0 +1,18 @@
+package multi
+
+import "fmt"
+
+// ProcessedLog 已处理的合约日志，以(tx_hash, log_index)唯一标识，保证重放时不会重复处理
+type ProcessedLog struct {
+	Id              int64  `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	ContractAddress string `gorm:"column:contract_address;NOT NULL" json:"contract_address"`                                // 日志所属的合约地址
+	TxHash          string `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	LogIndex        int64  `gorm:"column:log_index;NOT NULL" json:"log_index"`                                              // 日志在区块中的序号
+	BlockNumber     int64  `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	CreateTime      int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime      int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ProcessedLogTableName(chainName string) string {
+	return fmt.Sprintf("ob_processed_log_%s", chainName)
+}
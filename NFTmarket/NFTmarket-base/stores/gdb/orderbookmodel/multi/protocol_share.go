@@ -0,0 +1,23 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ProtocolShare 协议手续费比例变更记录，按区块顺序构成时间序列
+type ProtocolShare struct {
+	Id            int64           `gorm:"column:id;AUTO_INCREMENT;primary_key" json:"id"`                                          // 主键
+	ProtocolShare decimal.Decimal `gorm:"column:protocol_share;NOT NULL" json:"protocol_share"`                                    // 新的手续费比例(基数10000)
+	BlockNumber   int64           `gorm:"column:block_number;NOT NULL" json:"block_number"`                                        // 区块号
+	TxHash        string          `gorm:"column:tx_hash;NOT NULL" json:"tx_hash"`                                                  // 交易hash
+	LogIndex      int64           `gorm:"column:log_index;NOT NULL" json:"log_index"`                                              // 日志在区块中的序号
+	EventTime     int64           `gorm:"column:event_time;default:0" json:"event_time"`                                           // 链上事件发生的时间
+	CreateTime    int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime    int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ProtocolShareTableName(chainName string) string {
+	return fmt.Sprintf("ob_protocol_share_%s", chainName)
+}
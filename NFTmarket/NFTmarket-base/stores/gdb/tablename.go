@@ -45,6 +45,22 @@ func GetMultiProjectCollectionFloorPriceTableName(project string, chain string)
 	}
 }
 
+func GetMultiProjectCollectionBidPriceTableName(project string, chain string) string {
+	if project == OrderBookDexProject {
+		return multi.CollectionBidPriceTableName(chain)
+	} else {
+		return ""
+	}
+}
+
+func GetMultiProjectCollectionFloorCandleTableName(project string, chain string) string {
+	if project == OrderBookDexProject {
+		return multi.CollectionFloorCandleTableName(chain)
+	} else {
+		return ""
+	}
+}
+
 func GetMultiProjectItemExternalTableName(project string, chain string) string {
 	if project == OrderBookDexProject {
 		return multi.ItemExternalTableName(chain)
@@ -68,3 +84,11 @@ func GetMultiProjectCollectionTradeTableName(project string, chain string) strin
 		return ""
 	}
 }
+
+func GetMultiProjectItemHolderTableName(project string, chain string) string {
+	if project == OrderBookDexProject {
+		return multi.ItemHolderTableName(chain)
+	} else {
+		return ""
+	}
+}
@@ -0,0 +1,194 @@
+package xkv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// 租约key，value为"<id>:<token>"
+	CacheLeaderPre = "cache:es:leader:%s"
+	// 递增的fencing token计数器，不随租约过期
+	CacheLeaderTokenPre = "cache:es:leader:%s:token"
+
+	// acquireLeaderScript 租约不存在时获取租约并分配新的fencing token，返回token，租约已被占用时返回0
+	acquireLeaderScript = `if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+    local token = redis.call('INCR', KEYS[2]);
+    redis.call('SET', KEYS[1], ARGV[1] .. ':' .. token, 'PX', ARGV[2]);
+    return token;
+end
+return 0;`
+	// renewLeaderScript 租约仍属于自己时续期
+	renewLeaderScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2]);
+end
+return 0;`
+	// resignLeaderScript 租约仍属于自己时释放
+	resignLeaderScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1]);
+end
+return 0;`
+)
+
+// ErrLeaseLost 租约已过期或被其它实例获取
+var ErrLeaseLost = errors.New("leader lease lost")
+
+// Leader 基于Redis租约的leader选举，每次当选分配一个递增的fencing token，
+// 写入方用token拒绝已失去租约的旧leader的写入
+type Leader struct {
+	store    *Store
+	key      string
+	tokenKey string
+	id       string
+	ttl      time.Duration
+
+	token  atomic.Int64 // 最近一次当选的token，失去租约后保留，用于拒绝旧leader的写入
+	leader atomic.Bool
+}
+
+// NewLeader 新建leader选举，name区分不同的选举，id为当前实例的唯一标识
+func NewLeader(store *Store, name, id string, ttl time.Duration) *Leader {
+	return &Leader{
+		store:    store,
+		key:      fmt.Sprintf(CacheLeaderPre, name),
+		tokenKey: fmt.Sprintf(CacheLeaderTokenPre, name),
+		id:       id,
+		ttl:      ttl,
+	}
+}
+
+// ID 返回当前实例的标识
+func (l *Leader) ID() string {
+	return l.id
+}
+
+// Token 返回最近一次当选的fencing token，未启用选举(nil)或从未当选时返回0
+func (l *Leader) Token() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.token.Load()
+}
+
+// IsLeader 返回当前是否持有租约，未启用选举(nil)时返回true
+func (l *Leader) IsLeader() bool {
+	if l == nil {
+		return true
+	}
+	return l.leader.Load()
+}
+
+// Check 写入前确认仍持有租约且没有token更大的leader当选，未启用选举(nil)时不做检查
+// 用于Redis快照、消息投递等不经过同步进度fencing的写入，租约过期但本地尚未发现时也能拒绝
+func (l *Leader) Check(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if !l.leader.Load() {
+		return ErrLeaseLost
+	}
+	value, err := l.store.Redis.GetCtx(ctx, l.tokenKey)
+	if err != nil {
+		return errors.Wrap(err, "failed on get leader token")
+	}
+	current, _ := strconv.ParseInt(value, 10, 64)
+	if own := l.token.Load(); current > own {
+		l.leader.Store(false)
+		return errors.Wrapf(ErrLeaseLost, "current token: %d, own token: %d", current, own)
+	}
+	return nil
+}
+
+func (l *Leader) value() string {
+	return l.id + ":" + strconv.FormatInt(l.token.Load(), 10)
+}
+
+// TryAcquire 尝试获取租约，成功时返回新的fencing token
+func (l *Leader) TryAcquire(ctx context.Context) (int64, bool, error) {
+	resp, err := l.store.Redis.EvalCtx(ctx, acquireLeaderScript, []string{l.key, l.tokenKey},
+		l.id, strconv.FormatInt(l.ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on acquire leader lease")
+	}
+	token, ok := resp.(int64)
+	if !ok || token == 0 {
+		return 0, false, nil
+	}
+	l.token.Store(token)
+	l.leader.Store(true)
+	return token, true, nil
+}
+
+// Campaign 每隔interval尝试获取租约，直到当选或ctx结束
+func (l *Leader) Campaign(ctx context.Context, interval time.Duration) (int64, error) {
+	for {
+		// Redis不可用时继续重试，恢复后仍可当选
+		if token, ok, _ := l.TryAcquire(ctx); ok {
+			return token, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Renew 续期租约，租约已不属于自己时返回false
+func (l *Leader) Renew(ctx context.Context) (bool, error) {
+	resp, err := l.store.Redis.EvalCtx(ctx, renewLeaderScript, []string{l.key},
+		l.value(), strconv.FormatInt(l.ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, errors.Wrap(err, "failed on renew leader lease")
+	}
+	renewed, _ := resp.(int64)
+	if renewed == 0 {
+		l.leader.Store(false)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Keep 每隔ttl/3续期租约，直到ctx结束或失去租约
+// Redis不可用时按本地时间判断，租约可能已过期时即认为失去租约，返回ErrLeaseLost
+func (l *Leader) Keep(ctx context.Context) error {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	expireAt := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		renewed, err := l.Renew(ctx)
+		if err == nil && !renewed {
+			return ErrLeaseLost
+		}
+		if err == nil {
+			expireAt = start.Add(l.ttl)
+			continue
+		}
+		if !time.Now().Add(l.ttl / 3).Before(expireAt) {
+			l.leader.Store(false)
+			return errors.Wrap(ErrLeaseLost, err.Error())
+		}
+	}
+}
+
+// Resign 释放租约，其它实例可以立即当选
+func (l *Leader) Resign(ctx context.Context) error {
+	l.leader.Store(false)
+	if _, err := l.store.Redis.EvalCtx(ctx, resignLeaderScript, []string{l.key}, l.value()); err != nil {
+		return errors.Wrap(err, "failed on resign leader lease")
+	}
+	return nil
+}
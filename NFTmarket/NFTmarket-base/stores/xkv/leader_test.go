@@ -0,0 +1,113 @@
+package xkv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func newTestStore(mr *miniredis.Miniredis) *Store {
+	return NewStore([]cache.NodeConf{{
+		RedisConf: redis.RedisConf{Host: mr.Addr(), Type: "node"},
+		Weight:    100,
+	}})
+}
+
+func TestLeaderElection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestStore(mr)
+	ctx := context.Background()
+
+	var nilLeader *Leader
+	assert.Equal(t, int64(0), nilLeader.Token())
+	assert.True(t, nilLeader.IsLeader())
+	assert.NoError(t, nilLeader.Check(ctx))
+
+	a := NewLeader(store, "sync", "a", 3*time.Second)
+	b := NewLeader(store, "sync", "b", 3*time.Second)
+
+	token, ok, err := a.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), token)
+	assert.True(t, a.IsLeader())
+	assert.NoError(t, a.Check(ctx))
+
+	// 租约被占用时不能当选
+	_, ok, err = b.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, b.IsLeader())
+
+	renewed, err := a.Renew(ctx)
+	assert.NoError(t, err)
+	assert.True(t, renewed)
+
+	// 租约过期后其它实例当选，token递增，旧leader续期失败但保留旧token
+	mr.FastForward(4 * time.Second)
+	token, ok, err = b.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), token)
+	assert.NoError(t, b.Check(ctx))
+
+	// 旧leader续期之前写入检查即发现已有更新的leader
+	assert.True(t, a.IsLeader())
+	assert.True(t, errors.Is(a.Check(ctx), ErrLeaseLost))
+	assert.False(t, a.IsLeader())
+
+	renewed, err = a.Renew(ctx)
+	assert.NoError(t, err)
+	assert.False(t, renewed)
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, int64(1), a.Token())
+
+	// 旧leader释放租约不影响新leader
+	assert.NoError(t, a.Resign(ctx))
+	renewed, err = b.Renew(ctx)
+	assert.NoError(t, err)
+	assert.True(t, renewed)
+
+	assert.NoError(t, b.Resign(ctx))
+	token, ok, err = a.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), token)
+}
+
+func TestLeaderKeep(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestStore(mr)
+	ctx := context.Background()
+
+	a := NewLeader(store, "sync", "a", 150*time.Millisecond)
+	token, err := a.Campaign(ctx, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), token)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Keep(ctx)
+	}()
+
+	// 续期期间租约一直有效
+	time.Sleep(300 * time.Millisecond)
+	assert.True(t, a.IsLeader())
+	assert.True(t, mr.Exists(a.key))
+
+	// 租约被其它实例获取后Keep返回ErrLeaseLost
+	assert.NoError(t, mr.Set(a.key, "b:2"))
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, ErrLeaseLost))
+	case <-time.After(time.Second):
+		t.Fatal("keep did not return after lease lost")
+	}
+	assert.False(t, a.IsLeader())
+}
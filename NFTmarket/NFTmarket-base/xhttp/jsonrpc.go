@@ -22,6 +22,8 @@ type RPCClient interface {
 	CallRaw(request *RPCRequest) (*RPCResponse, error)
 	// CallFor 进行 JSON-RPC 调用并将响应结果反序列化到所给类型对象中
 	CallFor(out interface{}, method string, params ...interface{}) error
+	// CallBatch 在一次 HTTP 请求中进行多个 JSON-RPC 调用，响应顺序不保证与请求一致
+	CallBatch(requests RPCRequests) (RPCResponses, error)
 }
 
 // RPCOption JSON-RPC 客户端可选配置
@@ -148,6 +150,48 @@ func (c *rpcClient) CallFor(out interface{}, method string, params ...interface{
 	return rpcResp.ReadToObject(out)
 }
 
+// CallBatch 在一次 HTTP 请求中进行多个 JSON-RPC 调用，响应顺序不保证与请求一致
+func (c *rpcClient) CallBatch(requests RPCRequests) (RPCResponses, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("empty batch request")
+	}
+	for _, req := range requests {
+		if req.JSONRPC == "" {
+			req.JSONRPC = jsonrpcVersion
+		}
+	}
+
+	httpReq, err := c.newRequest(requests)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "call batch of %d requests on %s err",
+			len(requests), c.endpoint)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "call batch of %d requests on %s err",
+			len(requests), httpReq.URL.String())
+	}
+	defer httpResp.Body.Close()
+
+	d := json.NewDecoder(httpResp.Body)
+	d.DisallowUnknownFields()
+	d.UseNumber()
+
+	var rpcResps RPCResponses
+	err = d.Decode(&rpcResps)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "call batch on %s status code: %d, decode body err",
+			httpReq.URL.String(), httpResp.StatusCode)
+	}
+	if len(rpcResps) == 0 {
+		return nil, errors.Errorf("call batch on %s status code: %d, rpc response missing err.",
+			httpReq.URL.String(), httpResp.StatusCode)
+	}
+
+	return rpcResps, nil
+}
+
 // RPCRequest 通用 JSON-RPC 请求体
 type RPCRequest struct {
 	JSONRPC string      `json:"jsonrpc"`
@@ -156,6 +200,9 @@ type RPCRequest struct {
 	Params  interface{} `json:"params,omitempty"`
 }
 
+// RPCRequests 批量 JSON-RPC 请求体，每个请求需要设置不同的 ID
+type RPCRequests []*RPCRequest
+
 // NewRPCRequest 新建通用 JSON-RPC 请求体
 func NewRPCRequest(method string, params ...interface{}) *RPCRequest {
 	req := &RPCRequest{
@@ -215,6 +262,19 @@ type RPCResponse struct {
 	Error   interface{} `json:"error,omitempty"`
 }
 
+// RPCResponses 批量 JSON-RPC 响应体
+type RPCResponses []*RPCResponse
+
+// AsMap 按请求 ID 索引响应
+func (resps RPCResponses) AsMap() map[int]*RPCResponse {
+	m := make(map[int]*RPCResponse, len(resps))
+	for _, resp := range resps {
+		m[resp.ID] = resp
+	}
+
+	return m
+}
+
 // GetInt64 获取响应结果的 int64 类型值
 func (resp *RPCResponse) GetInt64() (int64, error) {
 	if resp.Error != nil {
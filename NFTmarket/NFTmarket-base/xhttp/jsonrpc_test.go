@@ -2,6 +2,8 @@ package xhttp
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -95,3 +97,32 @@ func TestRpcClient_CallFor(t *testing.T) {
 		t.Logf("%+v", result)
 	}
 }
+
+func TestRpcClient_CallBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []*RPCRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		// 倒序返回，调用方需按 ID 匹配
+		var resps []*RPCResponse
+		for i := len(reqs) - 1; i >= 0; i-- {
+			resps = append(resps, &RPCResponse{JSONRPC: reqs[i].JSONRPC, ID: reqs[i].ID, Result: reqs[i].Method})
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(resps))
+	}))
+	defer server.Close()
+
+	c := NewRPCClient(server.URL)
+	reqs := RPCRequests{NewRPCRequest("a"), NewRPCRequest("b")}
+	reqs[0].ID, reqs[1].ID = 0, 1
+	resps, err := c.CallBatch(reqs)
+	assert.NoError(t, err)
+	assert.Len(t, resps, 2)
+
+	byID := resps.AsMap()
+	method, err := byID[1].GetString()
+	assert.NoError(t, err)
+	assert.Equal(t, "b", method)
+
+	_, err = c.CallBatch(nil)
+	assert.Error(t, err)
+}
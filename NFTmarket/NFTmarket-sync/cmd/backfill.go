@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/orderbookindexer"
+)
+
+var backfillOpts orderbookindexer.BackfillOptions
+var backfillTail bool
+var backfillChain, backfillDex string
+
+var BackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "backfill easy swap order info in parallel.",
+	Long:  "backfill easy swap order info in parallel, then continue with live sync.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+		if err != nil {
+			return err
+		}
+		if _, err := xzap.SetUp(*cfg.Log); err != nil { // 初始化日志模块
+			return err
+		}
+
+		s, err := service.New(ctx, cfg) // 初始化服务
+		if err != nil {
+			return err
+		}
+
+		// 信号通知chan
+		onSignal := make(chan os.Signal, 1)
+		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-onSignal
+			xzap.WithContext(ctx).Info("Exit by signal", zap.String("signal", sig.String()))
+			cancel()
+		}()
+
+		// 退出时停止同步并释放回补时获取的leader租约
+		defer func() {
+			stopCtx, stopCancel := context.WithTimeout(context.Background(), cfg.GetShutdownTimeout())
+			defer stopCancel()
+			if err := s.Stop(stopCtx); err != nil {
+				xzap.WithContext(ctx).Error("Failed to stop sync server gracefully", zap.Error(err))
+			}
+		}()
+
+		if err := s.Backfill(backfillChain, backfillDex, backfillOpts); err != nil { // 回补历史区块
+			xzap.WithContext(ctx).Error("Failed to backfill", zap.Error(err))
+			return err
+		}
+		if !backfillTail {
+			return nil
+		}
+
+		// 从回补结束的区块继续实时同步
+		if err := s.Start(); err != nil {
+			xzap.WithContext(ctx).Error("Failed to start sync server", zap.Error(err))
+			return err
+		}
+		select {
+		case <-ctx.Done():
+		case err := <-s.Exit(): // 失去leader等错误
+			xzap.WithContext(ctx).Error("Exit by error", zap.Error(err))
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := BackfillCmd.Flags()
+	flags.Uint64Var(&backfillOpts.From, "from", 0, "first block to backfill (default is the last indexed block)")
+	flags.Uint64Var(&backfillOpts.To, "to", 0, "last block to backfill (default is the latest safe block)")
+	flags.IntVar(&backfillOpts.Workers, "workers", orderbookindexer.BackfillWorkers, "number of parallel log fetchers")
+	flags.Uint64Var(&backfillOpts.Window, "window", orderbookindexer.BackfillWindow, "initial number of blocks per fetch")
+	flags.BoolVar(&backfillTail, "tail", true, "continue with live sync after backfill")
+	flags.StringVar(&backfillChain, "chain", "", "chain name of the deployment to backfill (required with multiple deployments)")
+	flags.StringVar(&backfillDex, "dex", "", "dex address of the deployment to backfill (required with multiple deployments on one chain)")
+	// 将回补命令添加到主命令中
+	rootCmd.AddCommand(BackfillCmd)
+}
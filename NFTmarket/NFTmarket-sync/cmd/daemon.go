@@ -7,7 +7,6 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
@@ -23,66 +22,74 @@ var DaemonCmd = &cobra.Command{
 	Short: "sync easy swap order info.",
 	Long:  "sync easy swap order info.",
 	Run: func(cmd *cobra.Command, args []string) {
-		wg := &sync.WaitGroup{}
-		wg.Add(1)
 		ctx := context.Background()
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
-		// rpc退出信号通知chan
-		onSyncExit := make(chan error, 1)
 
-		go func() {
-			defer wg.Done()
+		cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+		if err != nil {
+			xzap.WithContext(ctx).Error("Failed to unmarshal config", zap.Error(err))
+			return
+		}
 
-			cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
-			if err != nil {
-				xzap.WithContext(ctx).Error("Failed to unmarshal config", zap.Error(err))
-				onSyncExit <- err
-				return
-			}
+		_, err = xzap.SetUp(*cfg.Log) // 初始化日志模块
+		if err != nil {
+			xzap.WithContext(ctx).Error("Failed to set up logger", zap.Error(err))
+			return
+		}
 
-			_, err = xzap.SetUp(*cfg.Log) // 初始化日志模块
-			if err != nil {
-				xzap.WithContext(ctx).Error("Failed to set up logger", zap.Error(err))
-				onSyncExit <- err
-				return
-			}
+		xzap.WithContext(ctx).Info("sync server start", zap.Any("config", cfg))
 
-			xzap.WithContext(ctx).Info("sync server start", zap.Any("config", cfg))
+		s, err := service.New(ctx, cfg) // 初始化服务
+		if err != nil {
+			xzap.WithContext(ctx).Error("Failed to create sync server", zap.Error(err))
+			return
+		}
 
-			s, err := service.New(ctx, cfg) // 初始化服务
-			if err != nil {
-				xzap.WithContext(ctx).Error("Failed to create sync server", zap.Error(err))
-				onSyncExit <- err
-				return
-			}
+		if err := s.Start(); err != nil { // 启动服务
+			xzap.WithContext(ctx).Error("Failed to start sync server", zap.Error(err))
+			return
+		}
 
-			if err := s.Start(); err != nil { // 启动服务
-				xzap.WithContext(ctx).Error("Failed to start sync server", zap.Error(err))
-				onSyncExit <- err
-				return
-			}
+		if cfg.Monitor.PprofEnable { // 开启pprof，用于性能监控
+			go http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", cfg.Monitor.PprofPort), nil)
+		}
 
-			if cfg.Monitor.PprofEnable { // 开启pprof，用于性能监控
-				http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", cfg.Monitor.PprofPort), nil)
+		var healthServer *http.Server
+		if cfg.Monitor.HealthPort > 0 { // 开启健康检查和Prometheus指标
+			healthServer = &http.Server{
+				Addr:    fmt.Sprintf("0.0.0.0:%d", cfg.Monitor.HealthPort),
+				Handler: s.HealthHandler(),
 			}
-		}()
+			go func() {
+				if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					xzap.WithContext(ctx).Error("Failed to serve health check", zap.Error(err))
+				}
+			}()
+		}
+
 		// 信号通知chan
 		onSignal := make(chan os.Signal, 1)
 		// 优雅退出
 		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
 		select {
 		case sig := <-onSignal:
-			switch sig {
-			case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM:
-				cancel()
-				xzap.WithContext(ctx).Info("Exit by signal", zap.String("signal", sig.String()))
-			}
-		case err := <-onSyncExit:
-			cancel()
+			xzap.WithContext(ctx).Info("Exit by signal", zap.String("signal", sig.String()))
+		case err := <-s.Exit(): // 失去leader等错误
 			xzap.WithContext(ctx).Error("Exit by error", zap.Error(err))
 		}
-		wg.Wait()
+
+		// 等待正在处理的事件完成和最后的快照写入，超时后直接退出
+		stopCtx, stopCancel := context.WithTimeout(ctx, cfg.GetShutdownTimeout())
+		defer stopCancel()
+		if healthServer != nil {
+			_ = healthServer.Shutdown(stopCtx)
+		}
+		if err := s.Stop(stopCtx); err != nil {
+			xzap.WithContext(ctx).Error("Failed to stop sync server gracefully", zap.Error(err))
+			return
+		}
+		xzap.WithContext(ctx).Info("sync server stopped", zap.Any("loops", s.LoopStatus()))
 	},
 }
 
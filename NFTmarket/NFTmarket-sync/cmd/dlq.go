@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+var (
+	dlqChain string
+	dlqAll   bool
+)
+
+var DlqCmd = &cobra.Command{
+	Use:   "dlq",
+	Short: "manage order manager dead letters.",
+	Long:  "list, inspect, replay or purge listing and trade events that the order manager failed to process.",
+}
+
+var dlqListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list dead letters.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kv, err := newDlqStore()
+		if err != nil {
+			return err
+		}
+		letters, err := ordermanager.ListDeadLetters(context.Background(), kv, dlqChain)
+		if err != nil {
+			return err
+		}
+		for _, letter := range letters {
+			fmt.Printf("%s\t%s\t%s\tattempts=%d\t%s\n", letter.ID, letter.Source,
+				time.Unix(letter.UpdateTime, 0).Format(time.RFC3339), letter.Attempts, letter.Error)
+		}
+		return nil
+	},
+}
+
+var dlqInspectCmd = &cobra.Command{
+	Use:   "inspect <id>",
+	Short: "print a dead letter with its payload.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kv, err := newDlqStore()
+		if err != nil {
+			return err
+		}
+		letter, ok, err := ordermanager.GetDeadLetter(context.Background(), kv, dlqChain, args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("dead letter %s not found", args[0])
+		}
+		out, err := json.MarshalIndent(letter, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var dlqReplayCmd = &cobra.Command{
+	Use:   "replay [id...]",
+	Short: "push dead letters back to their source queue.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ids, kv, err := dlqTargets(args)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := ordermanager.ReplayDeadLetter(context.Background(), kv, dlqChain, id); err != nil {
+				return err
+			}
+			fmt.Println("replayed", id)
+		}
+		return nil
+	},
+}
+
+var dlqPurgeCmd = &cobra.Command{
+	Use:   "purge [id...]",
+	Short: "delete dead letters.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !dlqAll {
+			return errors.New("specify dead letter ids or --all")
+		}
+		kv, err := newDlqStore()
+		if err != nil {
+			return err
+		}
+		purged, err := ordermanager.PurgeDeadLetters(context.Background(), kv, dlqChain, args...)
+		if err != nil {
+			return err
+		}
+		fmt.Println("purged", purged)
+		return nil
+	},
+}
+
+// newDlqStore 根据配置文件连接Redis
+func newDlqStore() (*xkv.Store, error) {
+	cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+	if err != nil {
+		return nil, err
+	}
+	return service.NewKvStore(cfg), nil
+}
+
+// dlqTargets 返回命令指定的死信id，--all时返回所有死信id
+func dlqTargets(args []string) ([]string, *xkv.Store, error) {
+	if len(args) == 0 && !dlqAll {
+		return nil, nil, errors.New("specify dead letter ids or --all")
+	}
+	kv, err := newDlqStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) > 0 {
+		return args, kv, nil
+	}
+	letters, err := ordermanager.ListDeadLetters(context.Background(), kv, dlqChain)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ids []string
+	for _, letter := range letters {
+		ids = append(ids, letter.ID)
+	}
+	return ids, kv, nil
+}
+
+func init() {
+	flags := DlqCmd.PersistentFlags()
+	flags.StringVar(&dlqChain, "chain", "", "chain name of the order manager")
+	_ = DlqCmd.MarkPersistentFlagRequired("chain")
+	dlqReplayCmd.Flags().BoolVar(&dlqAll, "all", false, "replay all dead letters")
+	dlqPurgeCmd.Flags().BoolVar(&dlqAll, "all", false, "purge all dead letters")
+
+	DlqCmd.AddCommand(dlqListCmd, dlqInspectCmd, dlqReplayCmd, dlqPurgeCmd)
+	// 将死信命令添加到主命令中
+	rootCmd.AddCommand(DlqCmd)
+}
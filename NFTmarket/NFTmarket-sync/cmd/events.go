@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+var (
+	eventsChain     string
+	eventsGroup     string
+	eventsConsumer  string
+	eventsFromBlock uint64
+)
+
+var EventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "tail easy swap market events.",
+	Long:  "tail easy swap market events from the event stream with a consumer group, optionally replaying from a block.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+		if err != nil {
+			return err
+		}
+		if _, err := xzap.SetUp(*cfg.Log); err != nil { // 初始化日志模块
+			return err
+		}
+		if cfg.EventSink.Type != "redis" {
+			return errors.Errorf("events command requires redis event sink, got: %q", cfg.EventSink.Type)
+		}
+		bus, err := service.NewEventSink(cfg.EventSink, service.NewKvStore(cfg))
+		if err != nil {
+			return err
+		}
+
+		// 信号通知chan
+		onSignal := make(chan os.Signal, 1)
+		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-onSignal
+			cancel()
+		}()
+
+		if cmd.Flags().Changed("from-block") { // 重置消费组位置
+			if err := bus.Replay(ctx, eventsChain, eventsGroup, eventsFromBlock); err != nil {
+				return err
+			}
+		}
+		return bus.Consume(ctx, eventsChain, eventsGroup, eventsConsumer, func(ctx context.Context, msg *eventsink.Message) error {
+			payload, err := json.Marshal(msg.Event)
+			if err != nil {
+				return err
+			}
+			fmt.Println(msg.ID, string(payload))
+			return nil
+		})
+	},
+}
+
+func init() {
+	flags := EventsCmd.Flags()
+	flags.StringVar(&eventsChain, "chain", "", "chain name of the event stream")
+	flags.StringVar(&eventsGroup, "group", "cli", "consumer group name")
+	flags.StringVar(&eventsConsumer, "consumer", "cli", "consumer name within the group")
+	flags.Uint64Var(&eventsFromBlock, "from-block", 0, "replay the group from the first event at or after this block")
+	_ = EventsCmd.MarkFlagRequired("chain")
+	// 将事件命令添加到主命令中
+	rootCmd.AddCommand(EventsCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service"
+	"github.com/ProjectsTask/EasySwapSync/service/collectionimporter"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+var importOpts collectionimporter.Options
+var importChain string
+
+var ImportCmd = &cobra.Command{
+	Use:   "import <collection address>",
+	Short: "import a collection and its items.",
+	Long:  "import a collection and its items, an interrupted import resumes from the last finished batch.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+		if err != nil {
+			return err
+		}
+		if _, err := xzap.SetUp(*cfg.Log); err != nil { // 初始化日志模块
+			return err
+		}
+
+		s, err := service.New(ctx, cfg) // 初始化服务
+		if err != nil {
+			return err
+		}
+
+		// 信号通知chan，中断后再次执行从上次的进度继续
+		onSignal := make(chan os.Signal, 1)
+		signal.Notify(onSignal, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-onSignal
+			xzap.WithContext(ctx).Info("Exit by signal", zap.String("signal", sig.String()))
+			cancel()
+		}()
+
+		if err := s.ImportCollection(importChain, args[0], importOpts); err != nil {
+			xzap.WithContext(ctx).Error("Failed to import collection", zap.String("address", args[0]), zap.Error(err))
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := ImportCmd.Flags()
+	flags.StringVar(&importChain, "chain", "", "chain name of the collection (required with multiple chains)")
+	flags.Uint64Var(&importOpts.FromBlock, "from-block", 0, "first block to replay transfer logs from when the collection is not enumerable")
+	flags.IntVar(&importOpts.Concurrency, "concurrency", collectionimporter.DefaultConcurrency, "number of parallel owner and metadata fetches")
+	flags.Uint64Var(&importOpts.BatchSize, "batch", collectionimporter.DefaultBatchSize, "number of tokens per enumerable batch")
+	flags.Uint64Var(&importOpts.BlockWindow, "window", collectionimporter.DefaultBlockWindow, "number of blocks per transfer log fetch")
+	// 将导入命令添加到主命令中
+	rootCmd.AddCommand(ImportCmd)
+}
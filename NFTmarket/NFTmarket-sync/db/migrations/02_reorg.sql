@@ -0,0 +1,38 @@
+create table ob_indexed_block_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    block_number bigint      not null comment '区块号',
+    block_hash   varchar(66) not null comment '区块hash',
+    parent_hash  varchar(66) not null comment '父区块hash',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间',
+    constraint index_block_number
+        unique (block_number)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_indexer_journal_sepolia
+(
+    id                      bigint auto_increment comment '主键'
+        primary key,
+    block_number            bigint                 not null comment '区块号',
+    tx_hash                 varchar(66)            not null comment '交易事务hash',
+    journal_type            tinyint                not null comment '(1:创建订单,2:更新订单,3:更新item owner)',
+    order_id                varchar(66)            null comment '订单hash',
+    collection_address      varchar(42)            null,
+    token_id                varchar(128)           null,
+    prev_order_status       tinyint     default 0  not null comment '变更前的订单状态',
+    prev_quantity_remaining bigint      default 0  not null comment '变更前的剩余数量',
+    prev_taker              varchar(42) default '' not null comment '变更前的taker',
+    prev_owner              varchar(42) default '' not null comment '变更前的owner',
+    create_time             bigint                 null comment '创建时间',
+    update_time             bigint                 null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_block_number
+    on ob_indexer_journal_sepolia (block_number);
+
+create index index_block_number
+    on ob_activity_sepolia (block_number);
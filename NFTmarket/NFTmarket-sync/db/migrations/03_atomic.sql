@@ -0,0 +1,27 @@
+create table ob_processed_log_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    log_index    bigint      not null comment '日志在区块中的序号',
+    block_number bigint      not null comment '区块号',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间',
+    constraint index_tx_hash_log_index
+        unique (tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_block_number
+    on ob_processed_log_sepolia (block_number);
+
+create table ob_outbox_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    message_type tinyint  not null comment '(1:新订单,2:交易事件)',
+    payload      text     not null comment '消息内容(json)',
+    create_time  bigint   null comment '创建时间',
+    update_time  bigint   null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
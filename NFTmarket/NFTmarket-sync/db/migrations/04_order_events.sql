@@ -0,0 +1,84 @@
+create table ob_order_edit_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    old_order_id varchar(66) not null comment '旧订单hash',
+    new_order_id varchar(66) not null comment '新订单hash',
+    maker        varchar(42) not null comment '订单创建者',
+    block_number bigint      not null comment '区块号',
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    event_time   bigint      default 0 null comment '链上事件发生的时间',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_old_order_id
+    on ob_order_edit_sepolia (old_order_id);
+
+create index index_new_order_id
+    on ob_order_edit_sepolia (new_order_id);
+
+create index index_block_number
+    on ob_order_edit_sepolia (block_number);
+
+create table ob_order_skip_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    order_id     varchar(66) not null comment '订单hash',
+    salt         bigint      not null comment '事件中的salt',
+    reason       varchar(32) not null comment '跳过原因',
+    block_number bigint      not null comment '区块号',
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    log_index    bigint      not null comment '日志在区块中的序号',
+    event_time   bigint      default 0 null comment '链上事件发生的时间',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_order_id
+    on ob_order_skip_sepolia (order_id);
+
+create index index_block_number
+    on ob_order_skip_sepolia (block_number);
+
+create table ob_batch_match_error_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    log_index    bigint      not null comment '日志在区块中的序号',
+    block_number bigint      not null comment '区块号',
+    match_offset bigint      not null comment '失败的撮合在批量参数中的下标',
+    revert_data  text        null comment '原始revert数据(hex)',
+    reason       varchar(512) null comment '解析后的失败原因',
+    event_time   bigint      default 0 null comment '链上事件发生的时间',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_tx_hash
+    on ob_batch_match_error_sepolia (tx_hash);
+
+create index index_block_number
+    on ob_batch_match_error_sepolia (block_number);
+
+create table ob_protocol_share_sepolia
+(
+    id             bigint auto_increment comment '主键'
+        primary key,
+    protocol_share decimal(30) not null comment '手续费比例(基数10000)',
+    block_number   bigint      not null comment '区块号',
+    tx_hash        varchar(66) not null comment '交易事务hash',
+    log_index      bigint      not null comment '日志在区块中的序号',
+    event_time     bigint      default 0 null comment '链上事件发生的时间',
+    create_time    bigint      null comment '创建时间',
+    update_time    bigint      null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_block_number
+    on ob_protocol_share_sepolia (block_number, log_index);
@@ -0,0 +1,20 @@
+alter table ob_indexed_status
+    add column contract_address varchar(42) default '' not null comment '同步的合约地址，为空表示按链同步' after index_type;
+
+alter table ob_indexed_block_sepolia
+    add column contract_address varchar(42) default '' not null comment '订单簿合约地址' after id,
+    drop index index_block_number,
+    add constraint index_contract_block_number
+        unique (contract_address, block_number);
+
+alter table ob_indexer_journal_sepolia
+    add column contract_address varchar(42) default '' not null comment '订单簿合约地址' after id;
+
+create index index_contract_block_number
+    on ob_indexer_journal_sepolia (contract_address, block_number);
+
+alter table ob_processed_log_sepolia
+    add column contract_address varchar(42) default '' not null comment '日志所属的合约地址' after id;
+
+create index index_contract_block_number
+    on ob_processed_log_sepolia (contract_address, block_number);
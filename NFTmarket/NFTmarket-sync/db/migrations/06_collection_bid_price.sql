@@ -0,0 +1,18 @@
+create table ob_collection_bid_price_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)     not null comment '链上合约地址',
+    best_bid           decimal(30)     null comment '最高集合出价',
+    best_item_bid      decimal(30)     null comment '最高item出价',
+    spread             decimal(30)     null comment '地板价与最高集合出价之差',
+    event_time         bigint          null comment '事件时间',
+    create_time        bigint          null comment '创建时间',
+    update_time        bigint          null comment '更新时间',
+    constraint index_collection_event_time
+        unique (collection_address, event_time)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_event_time
+    on ob_collection_bid_price_sepolia (event_time);
@@ -0,0 +1,23 @@
+create table ob_collection_floor_candle_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)     not null comment '链上合约地址',
+    period             varchar(8)      not null comment 'K线周期 5m/1h/1d',
+    open_time          bigint          not null comment '周期开始时间',
+    open               decimal(30)     null comment '开盘地板价',
+    high               decimal(30)     null comment '最高地板价',
+    low                decimal(30)     null comment '最低地板价',
+    close              decimal(30)     null comment '收盘地板价',
+    listed_count       bigint          null comment '周期结束时的上架数量',
+    volume             decimal(30)     null comment '周期内成交额',
+    sales              bigint          null comment '周期内成交数量',
+    create_time        bigint          null comment '创建时间',
+    update_time        bigint          null comment '更新时间',
+    constraint index_collection_period_open_time
+        unique (collection_address, period, open_time)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_period_open_time
+    on ob_collection_floor_candle_sepolia (period, open_time);
@@ -0,0 +1,2 @@
+alter table ob_indexed_status
+    add column leader_token bigint default 0 not null comment '最后写入进度的leader的fencing token' after contract_address;
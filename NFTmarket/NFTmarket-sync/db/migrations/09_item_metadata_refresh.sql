@@ -0,0 +1,19 @@
+create table ob_item_metadata_refresh_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)       not null comment '合约地址',
+    token_id           varchar(128)      not null comment 'token_id',
+    status             tinyint default 0 not null comment '刷新状态 0:pending 1:done 2:failed',
+    reason             varchar(512)      null comment '失败原因',
+    request_time       bigint  default 0 null comment '最近一次加入刷新队列的时间',
+    refresh_time       bigint  default 0 null comment '最近一次刷新完成的时间',
+    create_time        bigint            null comment '创建时间',
+    update_time        bigint            null comment '更新时间',
+    constraint index_collection_token
+        unique (collection_address, token_id)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_status
+    on ob_item_metadata_refresh_sepolia (status);
@@ -0,0 +1,25 @@
+alter table ob_collection_import_record_sepolia
+    add column token_source   tinyint(1) default 0 not null comment 'token枚举方式 1:ERC721Enumerable 2:Transfer日志' after finished_stage,
+    add column total_count    bigint     default 0 not null comment '待导入的数量，Enumerable为token数量，Transfer为区块数量' after token_source,
+    add column imported_count bigint     default 0 not null comment '已导入的item数量' after total_count,
+    add column next_cursor    bigint     default 0 not null comment '下一次导入的位置，Enumerable为token序号，Transfer为区块高度' after imported_count,
+    add column to_block       bigint     default 0 not null comment 'Transfer日志回放的截止区块' after next_cursor;
+
+create index index_collection_address
+    on ob_collection_import_record_sepolia (collection_address);
+
+create table ob_collection_trait_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    collection_address varchar(42)      not null comment '合约地址',
+    trait              varchar(128)     not null comment '属性名称',
+    trait_value        varchar(512)     not null comment '属性值',
+    count              bigint default 0 not null comment '拥有该属性值的item数量',
+    create_time        bigint           null comment '创建时间',
+    update_time        bigint           null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_collection_trait_value
+    on ob_collection_trait_sepolia (collection_address, trait, trait_value);
@@ -0,0 +1,2 @@
+create index index_upload_status
+    on ob_item_external_sepolia (is_uploaded_oss, upload_status);
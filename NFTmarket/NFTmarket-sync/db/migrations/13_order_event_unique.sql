@@ -0,0 +1,43 @@
+alter table ob_order_edit_sepolia
+    add column log_index bigint default 0 not null comment '日志在区块中的序号' after tx_hash;
+
+-- 删除重放写入的重复记录，保留最早的一条
+delete a
+from ob_order_edit_sepolia a
+         join ob_order_edit_sepolia b
+              on a.tx_hash = b.tx_hash and a.old_order_id = b.old_order_id and a.new_order_id = b.new_order_id and a.id > b.id;
+
+-- 历史记录没有日志序号，使用负的主键保证唯一，不会与新写入的记录冲突
+update ob_order_edit_sepolia
+set log_index = -id;
+
+delete a
+from ob_order_skip_sepolia a
+         join ob_order_skip_sepolia b
+              on a.tx_hash = b.tx_hash and a.log_index = b.log_index and a.id > b.id;
+
+delete a
+from ob_batch_match_error_sepolia a
+         join ob_batch_match_error_sepolia b
+              on a.tx_hash = b.tx_hash and a.log_index = b.log_index and a.id > b.id;
+
+delete a
+from ob_protocol_share_sepolia a
+         join ob_protocol_share_sepolia b
+              on a.tx_hash = b.tx_hash and a.log_index = b.log_index and a.id > b.id;
+
+alter table ob_order_edit_sepolia
+    add constraint index_tx_hash_log_index
+        unique (tx_hash, log_index);
+
+alter table ob_order_skip_sepolia
+    add constraint index_tx_hash_log_index
+        unique (tx_hash, log_index);
+
+alter table ob_batch_match_error_sepolia
+    add constraint index_tx_hash_log_index
+        unique (tx_hash, log_index);
+
+alter table ob_protocol_share_sepolia
+    add constraint index_tx_hash_log_index
+        unique (tx_hash, log_index);
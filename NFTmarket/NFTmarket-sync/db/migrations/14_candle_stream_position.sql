@@ -0,0 +1,5 @@
+alter table ob_collection_floor_candle_sepolia
+    add column stream_position bigint default 0 not null comment '已合并的最后一个交易事件的队列位置' after sales;
+
+create index index_stream_position
+    on ob_collection_floor_candle_sepolia (stream_position);
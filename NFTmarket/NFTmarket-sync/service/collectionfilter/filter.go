@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
 
 	"gorm.io/gorm"
@@ -63,11 +64,15 @@ func (f *Filter) PreloadCollections() error {
 	var addresses []string
 	var err error
 
-	// Query the addresses directly from the database
+	// Query the addresses directly from the database,
+	// including collections being imported so that their transfers are synced during the import
+	importing := f.db.Table(multi.CollectionImportRecordTableName(f.chain)).
+		Select("collection_address").
+		Where("finished_stage = ?", multi.ImportStageCollection)
 	err = f.db.WithContext(f.ctx).
 		Table(gdb.GetMultiProjectCollectionTableName(f.project, f.chain)).
 		Select("address").
-		Where("floor_price_status = ?", comm.CollectionFloorPriceImported).
+		Where("floor_price_status = ? or address in (?)", comm.CollectionFloorPriceImported, importing).
 		Scan(&addresses).Error
 
 	if err != nil {
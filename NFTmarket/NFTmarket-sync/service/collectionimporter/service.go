@@ -0,0 +1,770 @@
+package collectionimporter
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+const (
+	DefaultConcurrency = 8    // 默认并发获取owner和metadata的数量
+	DefaultBatchSize   = 100  // Enumerable每批导入的token数量
+	DefaultBlockWindow = 2000 // Transfer日志每次查询的区块数量
+	MaxMsgLength       = 1600
+	ZeroAddress        = "0x0000000000000000000000000000000000000000"
+)
+
+// NodeService 导入所需的链上查询，由nftchainservice.Service实现
+type NodeService interface {
+	FetchCollectionName(collectionAddr string) (string, string)
+	SupportsEnumerable(collectionAddr string) bool
+	FetchTotalSupply(collectionAddr string) (uint64, error)
+	FetchTokenByIndex(collectionAddr string, index uint64) (string, error)
+	FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error)
+	TokenStandard(collectionAddr string) int64
+	FetchNftBalance(collectionAddr, tokenID, owner string) (*big.Int, error)
+	GetCollectionTransferLogs(collectionAddr string, fromBlock, toBlock uint64) ([]*nftchainservice.TransferLog, error)
+	LatestBlockNumber() (uint64, error)
+}
+
+// Refresher 刷新单个item的metadata，由metadatarefresh.Service实现
+type Refresher interface {
+	Refresh(collectionAddr, tokenId string)
+}
+
+// Options 导入参数
+type Options struct {
+	FromBlock   uint64 // Transfer日志回放的起始区块，一般为合约部署区块
+	Concurrency int    // 并发获取owner和metadata的数量
+	BatchSize   uint64 // Enumerable每批导入的token数量
+	BlockWindow uint64 // Transfer日志每次查询的区块数量
+}
+
+func (o *Options) setDefaults() {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.BlockWindow == 0 {
+		o.BlockWindow = DefaultBlockWindow
+	}
+}
+
+// Service 导入collection: 写入collection和item，获取metadata并统计属性数量，完成后通知订单管理器和过滤器
+// 导入进度记录在ob_collection_import_record表中，中断后再次导入同一地址时从上次的位置继续
+type Service struct {
+	ctx              context.Context
+	db               *gorm.DB
+	kv               *xkv.Store
+	nodeSrv          NodeService
+	refresher        Refresher
+	collectionFilter *collectionfilter.Filter // 为nil时由sync服务定时从数据库加载
+	chainId          int64
+	chain            string
+	project          string
+}
+
+func New(ctx context.Context, db *gorm.DB, kv *xkv.Store, nodeSrv NodeService, refresher Refresher, collectionFilter *collectionfilter.Filter, chainId int64, chain string, project string) *Service {
+	return &Service{
+		ctx:              ctx,
+		db:               db,
+		kv:               kv,
+		nodeSrv:          nodeSrv,
+		refresher:        refresher,
+		collectionFilter: collectionFilter,
+		chainId:          chainId,
+		chain:            chain,
+		project:          project,
+	}
+}
+
+// Import 导入collection，失败时错误信息写入导入记录
+func (s *Service) Import(collectionAddr string, opts Options) error {
+	if !common.IsHexAddress(collectionAddr) {
+		return errors.Errorf("invalid collection address: %s", collectionAddr)
+	}
+	collectionAddr = strings.ToLower(collectionAddr)
+	opts.setDefaults()
+
+	record, err := s.loadRecord(collectionAddr)
+	if err != nil {
+		return err
+	}
+	if err := s.importCollection(record, opts); err != nil {
+		msg := err.Error()
+		if len(msg) > MaxMsgLength {
+			msg = msg[:MaxMsgLength]
+		}
+		if err := s.updateRecord(record.Id, map[string]interface{}{"msg": msg}); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on record import error",
+				zap.String("collection_address", collectionAddr), zap.Error(err))
+		}
+		return err
+	}
+	return nil
+}
+
+// loadRecord 获取未完成的导入记录，不存在时新建
+func (s *Service) loadRecord(collectionAddr string) (*multi.CollectionImportRecord, error) {
+	var records []multi.CollectionImportRecord
+	if err := s.db.WithContext(s.ctx).Table(multi.CollectionImportRecordTableName(s.chain)).
+		Where("collection_address = ? and finished_stage < ?", collectionAddr, multi.ImportStageDone).
+		Order("id desc").Limit(1).Find(&records).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get import record")
+	}
+	if len(records) > 0 {
+		xzap.WithContext(s.ctx).Info("resume collection import",
+			zap.String("collection_address", collectionAddr), zap.Int64("record_id", records[0].Id),
+			zap.Int32("finished_stage", records[0].FinishedStage), zap.Int64("next_cursor", records[0].NextCursor))
+		return &records[0], nil
+	}
+	record := &multi.CollectionImportRecord{CollectionAddress: collectionAddr}
+	if err := s.db.WithContext(s.ctx).Table(multi.CollectionImportRecordTableName(s.chain)).
+		Create(record).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on create import record")
+	}
+	return record, nil
+}
+
+func (s *Service) updateRecord(id int64, updates map[string]interface{}) error {
+	updates["update_time"] = time.Now().UnixMilli()
+	if err := s.db.WithContext(s.ctx).Table(multi.CollectionImportRecordTableName(s.chain)).
+		Where("id = ?", id).Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update import record")
+	}
+	return nil
+}
+
+func (s *Service) importCollection(record *multi.CollectionImportRecord, opts Options) error {
+	if record.FinishedStage == multi.ImportStageQueued {
+		if err := s.importCollectionInfo(record, opts); err != nil {
+			return err
+		}
+	}
+
+	// 导入开始时即加入过滤器，导入期间的Transfer由Transfer同步处理，完成前再回放到同步进度
+	if s.collectionFilter != nil {
+		s.collectionFilter.Add(record.CollectionAddress)
+	}
+
+	tokenStandard, err := s.collectionTokenStandard(record.CollectionAddress)
+	if err != nil {
+		return err
+	}
+	for {
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+		var done bool
+		var err error
+		if record.TokenSource == multi.ImportTokenSourceEnumerable {
+			done, err = s.importEnumerableBatch(record, opts)
+		} else if tokenStandard == multi.TokenStandardERC1155 {
+			done, err = s.importErc1155TransferBatch(record, opts)
+		} else {
+			done, err = s.importTransferBatch(record, opts)
+		}
+		if err != nil {
+			return err
+		}
+		if done && record.TokenSource == multi.ImportTokenSourceTransfer {
+			if done, err = s.catchUp(record); err != nil {
+				return err
+			}
+		}
+		if err := s.updateRecord(record.Id, map[string]interface{}{
+			"next_cursor":    record.NextCursor,
+			"imported_count": record.ImportedCount,
+			"to_block":       record.ToBlock,
+			"total_count":    record.TotalCount,
+		}); err != nil {
+			return err
+		}
+		xzap.WithContext(s.ctx).Info("collection import progress",
+			zap.String("collection_address", record.CollectionAddress), zap.Int64("next_cursor", record.NextCursor),
+			zap.Int64("total_count", record.TotalCount), zap.Int64("imported_count", record.ImportedCount))
+		if done {
+			break
+		}
+	}
+
+	return s.finish(record, tokenStandard)
+}
+
+// catchUp 回放到截止区块后，Transfer同步可能已处理到更新的区块，
+// 而加入过滤器之前的区块中该collection的Transfer被跳过，需要把截止区块延长到同步进度，返回是否已追上
+func (s *Service) catchUp(record *multi.CollectionImportRecord) (bool, error) {
+	var statuses []base.IndexedStatus
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, base.TypeNftTransferIndex).
+		Limit(1).Find(&statuses).Error; err != nil {
+		return false, errors.Wrap(err, "failed on get transfer index status")
+	}
+	// 同步进度为下一个待同步的区块
+	if len(statuses) == 0 || statuses[0].LastIndexedBlock-1 <= record.ToBlock {
+		return true, nil
+	}
+	toBlock := statuses[0].LastIndexedBlock - 1
+	xzap.WithContext(s.ctx).Info("collection import catch up with transfer sync",
+		zap.String("collection_address", record.CollectionAddress),
+		zap.Int64("from_block", record.ToBlock+1), zap.Int64("to_block", toBlock))
+	record.TotalCount += toBlock - record.ToBlock
+	record.ToBlock = toBlock
+	return false, nil
+}
+
+// collectionTokenStandard 查询已写入的collection的token标准
+func (s *Service) collectionTokenStandard(collectionAddr string) (int64, error) {
+	var standards []int64
+	if err := s.db.WithContext(s.ctx).Table(gdb.GetMultiProjectCollectionTableName(s.project, s.chain)).
+		Where("address = ?", collectionAddr).
+		Limit(1).Pluck("token_standard", &standards).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get collection token standard")
+	}
+	if len(standards) == 0 || standards[0] == 0 {
+		return multi.TokenStandardERC721, nil
+	}
+	return standards[0], nil
+}
+
+// importCollectionInfo 写入collection并确定token的枚举方式
+func (s *Service) importCollectionInfo(record *multi.CollectionImportRecord, opts Options) error {
+	collectionAddr := record.CollectionAddress
+	name, symbol := s.nodeSrv.FetchCollectionName(collectionAddr)
+	tokenStandard := s.nodeSrv.TokenStandard(collectionAddr)
+
+	// ERC-1155没有Enumerable扩展，持有者只能通过转移日志获得
+	if tokenStandard == multi.TokenStandardERC721 && s.nodeSrv.SupportsEnumerable(collectionAddr) {
+		total, err := s.nodeSrv.FetchTotalSupply(collectionAddr)
+		if err != nil {
+			return errors.Wrap(err, "failed on fetch total supply")
+		}
+		record.TokenSource = multi.ImportTokenSourceEnumerable
+		record.TotalCount = int64(total)
+		record.NextCursor = 0
+	} else {
+		// 不支持Enumerable时回放到当前最新区块的Transfer日志
+		toBlock, err := s.nodeSrv.LatestBlockNumber()
+		if err != nil {
+			return err
+		}
+		if opts.FromBlock > toBlock {
+			return errors.Errorf("from block %d is greater than latest block %d", opts.FromBlock, toBlock)
+		}
+		record.TokenSource = multi.ImportTokenSourceTransfer
+		record.ToBlock = int64(toBlock)
+		record.TotalCount = int64(toBlock - opts.FromBlock + 1)
+		record.NextCursor = int64(opts.FromBlock)
+	}
+
+	// collection表没有is_need_refresh字段，需要指定写入的字段
+	if err := s.db.WithContext(s.ctx).Table(gdb.GetMultiProjectCollectionTableName(s.project, s.chain)).
+		Select("symbol", "chain_id", "token_standard", "name", "creator", "address", "floor_price_status", "create_time", "update_time").
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"symbol", "name", "update_time"}),
+		}).Create(&multi.Collection{
+		Symbol:           symbol,
+		ChainId:          int(s.chainId),
+		TokenStandard:    tokenStandard,
+		Name:             name,
+		Address:          collectionAddr,
+		FloorPriceStatus: comm.CollectionFloorPriceNotImport,
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on upsert collection")
+	}
+
+	record.FinishedStage = multi.ImportStageCollection
+	return s.updateRecord(record.Id, map[string]interface{}{
+		"finished_stage": record.FinishedStage,
+		"token_source":   record.TokenSource,
+		"total_count":    record.TotalCount,
+		"next_cursor":    record.NextCursor,
+		"to_block":       record.ToBlock,
+		"msg":            "",
+	})
+}
+
+// importEnumerableBatch 按序号导入一批token，返回是否已全部导入
+func (s *Service) importEnumerableBatch(record *multi.CollectionImportRecord, opts Options) (bool, error) {
+	from := uint64(record.NextCursor)
+	to := from + opts.BatchSize
+	if to > uint64(record.TotalCount) {
+		to = uint64(record.TotalCount)
+	}
+	if from >= to {
+		return true, nil
+	}
+
+	owners := make([]string, to-from)
+	tokenIds := make([]string, to-from)
+	if err := forEach(int(to-from), opts.Concurrency, func(i int) error {
+		tokenId, err := s.nodeSrv.FetchTokenByIndex(record.CollectionAddress, from+uint64(i))
+		if err != nil {
+			return errors.Wrapf(err, "failed on fetch token by index %d", from+uint64(i))
+		}
+		owner, err := s.nodeSrv.FetchNftOwner(record.CollectionAddress, tokenId)
+		if err != nil {
+			return errors.Wrapf(err, "failed on fetch owner of token %s", tokenId)
+		}
+		tokenIds[i] = tokenId
+		owners[i] = strings.ToLower(owner.String())
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	items := make(map[string]string, len(tokenIds))
+	for i, tokenId := range tokenIds {
+		items[tokenId] = owners[i]
+	}
+	// 枚举时无法得知mint的接收者，creator留空
+	if err := s.importItems(record, items, nil, opts); err != nil {
+		return false, err
+	}
+	record.NextCursor = int64(to)
+	record.ImportedCount += int64(len(items))
+	return to >= uint64(record.TotalCount), nil
+}
+
+// importTransferBatch 回放一个区块窗口内的Transfer日志，返回是否已回放到截止区块
+func (s *Service) importTransferBatch(record *multi.CollectionImportRecord, opts Options) (bool, error) {
+	from := uint64(record.NextCursor)
+	toBlock := uint64(record.ToBlock)
+	if from > toBlock {
+		return true, nil
+	}
+	to := from + opts.BlockWindow - 1
+	if to > toBlock {
+		to = toBlock
+	}
+
+	logs, err := s.nodeSrv.GetCollectionTransferLogs(record.CollectionAddress, from, to)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed on get transfer logs, from: %d, to: %d", from, to)
+	}
+	owners := latestOwners(logs)
+	creators := mintRecipients(logs)
+
+	items := make(map[string]string, len(owners))
+	var burned []string
+	for tokenId, owner := range owners {
+		if owner == ZeroAddress {
+			burned = append(burned, tokenId)
+			continue
+		}
+		items[tokenId] = owner
+	}
+	if len(burned) > 0 {
+		if err := s.deleteItems(record.CollectionAddress, burned); err != nil {
+			return false, err
+		}
+	}
+	if err := s.importItems(record, items, creators, opts); err != nil {
+		return false, err
+	}
+	record.NextCursor = int64(to + 1)
+	record.ImportedCount += int64(len(items))
+	return to >= toBlock, nil
+}
+
+// importErc1155TransferBatch 回放一个区块窗口内的ERC-1155转移日志，从链上获取涉及的持有者的当前持有数量
+func (s *Service) importErc1155TransferBatch(record *multi.CollectionImportRecord, opts Options) (bool, error) {
+	from := uint64(record.NextCursor)
+	toBlock := uint64(record.ToBlock)
+	if from > toBlock {
+		return true, nil
+	}
+	to := from + opts.BlockWindow - 1
+	if to > toBlock {
+		to = toBlock
+	}
+
+	logs, err := s.nodeSrv.GetCollectionTransferLogs(record.CollectionAddress, from, to)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed on get transfer logs, from: %d, to: %d", from, to)
+	}
+	holders, creators := touchedHolders(logs)
+
+	balances := make([]*big.Int, len(holders))
+	if err := forEach(len(holders), opts.Concurrency, func(i int) error {
+		balance, err := s.nodeSrv.FetchNftBalance(record.CollectionAddress, holders[i].tokenId, holders[i].owner)
+		if err != nil {
+			return errors.Wrapf(err, "failed on fetch balance of token %s, owner %s", holders[i].tokenId, holders[i].owner)
+		}
+		balances[i] = balance
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		for i, holder := range holders {
+			if err := comm.SetHolderBalance(tx, s.chain, record.CollectionAddress, holder.tokenId, holder.owner,
+				decimal.NewFromBigInt(balances[i], 0)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	// 持有者和发行量在导入完成时统计，这里只创建item
+	items := make(map[string]string, len(creators))
+	for tokenId, creator := range creators {
+		items[tokenId] = creator
+	}
+	for _, holder := range holders {
+		if _, ok := items[holder.tokenId]; !ok {
+			items[holder.tokenId] = ""
+		}
+	}
+	if err := s.importErc1155Items(record.CollectionAddress, items, opts); err != nil {
+		return false, err
+	}
+	record.NextCursor = int64(to + 1)
+	record.ImportedCount += int64(len(items))
+	return to >= toBlock, nil
+}
+
+type tokenHolder struct {
+	tokenId string
+	owner   string
+}
+
+// touchedHolders 返回日志中涉及的(token, 持有者)和mint时的创建者，不包含零地址
+func touchedHolders(logs []*nftchainservice.TransferLog) ([]tokenHolder, map[string]string) {
+	var holders []tokenHolder
+	seen := make(map[tokenHolder]struct{})
+	creators := make(map[string]string)
+	for _, log := range logs {
+		if log.From == ZeroAddress {
+			if _, ok := creators[log.TokenID]; !ok {
+				creators[log.TokenID] = strings.ToLower(log.Operator)
+			}
+		}
+		for _, owner := range []string{log.From, log.To} {
+			if owner == ZeroAddress {
+				continue
+			}
+			holder := tokenHolder{tokenId: log.TokenID, owner: strings.ToLower(owner)}
+			if _, ok := seen[holder]; ok {
+				continue
+			}
+			seen[holder] = struct{}{}
+			holders = append(holders, holder)
+		}
+	}
+	return holders, creators
+}
+
+// importErc1155Items 创建ERC-1155的item，已存在时保留原有数据，再并发获取metadata
+func (s *Service) importErc1155Items(collectionAddr string, creators map[string]string, opts Options) error {
+	if len(creators) == 0 {
+		return nil
+	}
+	items := make([]multi.Item, 0, len(creators))
+	tokenIds := make([]string, 0, len(creators))
+	for tokenId, creator := range creators {
+		items = append(items, multi.Item{
+			ChainId:           int(s.chainId),
+			CollectionAddress: collectionAddr,
+			TokenId:           tokenId,
+			Creator:           creator,
+		})
+		tokenIds = append(tokenIds, tokenId)
+	}
+	if err := s.db.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"update_time"}),
+	}).Create(&items).Error; err != nil {
+		return errors.Wrap(err, "failed on upsert items")
+	}
+
+	return forEach(len(tokenIds), opts.Concurrency, func(i int) error {
+		s.refresher.Refresh(collectionAddr, tokenIds[i])
+		return nil
+	})
+}
+
+// latestOwners 返回日志中每个token最后一次转入的地址
+func latestOwners(logs []*nftchainservice.TransferLog) map[string]string {
+	owners := make(map[string]string)
+	for _, log := range logs {
+		owners[log.TokenID] = strings.ToLower(log.To)
+	}
+	return owners
+}
+
+// mintRecipients 返回日志中mint的token的接收者，作为item的creator
+func mintRecipients(logs []*nftchainservice.TransferLog) map[string]string {
+	creators := make(map[string]string)
+	for _, log := range logs {
+		if log.From == ZeroAddress {
+			if _, ok := creators[log.TokenID]; !ok {
+				creators[log.TokenID] = strings.ToLower(log.To)
+			}
+		}
+	}
+	return creators
+}
+
+// importItems 写入item的owner，新建的item以mint的接收者为creator，再并发获取metadata
+// 导入开始后Transfer同步已处理过转移的token跳过，其owner不早于导入读取的owner，未处理到的转移之后也会由Transfer同步处理
+func (s *Service) importItems(record *multi.CollectionImportRecord, owners map[string]string, creators map[string]string, opts Options) error {
+	if len(owners) == 0 {
+		return nil
+	}
+	collectionAddr := record.CollectionAddress
+	tokenIds := make([]string, 0, len(owners))
+	for tokenId := range owners {
+		tokenIds = append(tokenIds, tokenId)
+	}
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定已存在的item，Transfer同步更新同一item的事务在写入之后提交，其回滚日志记录的是导入写入的owner
+		var locked []string
+		if err := tx.Table(multi.ItemTableName(s.chain)).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("collection_address = ? and token_id in ?", collectionAddr, tokenIds).
+			Pluck("token_id", &locked).Error; err != nil {
+			return errors.Wrap(err, "failed on lock items")
+		}
+		touched, err := s.transferredTokens(tx, record, tokenIds)
+		if err != nil {
+			return err
+		}
+		items := make([]multi.Item, 0, len(owners))
+		for tokenId, owner := range owners {
+			if _, ok := touched[tokenId]; ok {
+				continue
+			}
+			items = append(items, multi.Item{
+				ChainId:           int(s.chainId),
+				CollectionAddress: collectionAddr,
+				TokenId:           tokenId,
+				Owner:             owner,
+				Creator:           creators[tokenId],
+				Supply:            1,
+			})
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		if err := tx.Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"owner", "update_time"}),
+		}).Create(&items).Error; err != nil {
+			return errors.Wrap(err, "failed on upsert items")
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// 单个item获取metadata失败时记录在刷新状态表中，不影响导入
+	return forEach(len(tokenIds), opts.Concurrency, func(i int) error {
+		s.refresher.Refresh(collectionAddr, tokenIds[i])
+		return nil
+	})
+}
+
+// transferredTokens 返回导入开始后Transfer同步记录过Transfer或Mint活动的token
+// 活动与item owner在同一事务中写入且不会被清理，重组回滚时一并删除
+func (s *Service) transferredTokens(tx *gorm.DB, record *multi.CollectionImportRecord, tokenIds []string) (map[string]struct{}, error) {
+	var transferred []string
+	if err := tx.Table(multi.ActivityTableName(s.chain)).
+		Where("collection_address = ? and token_id in ? and activity_type in ? and create_time >= ?",
+			record.CollectionAddress, tokenIds, []int{multi.Transfer, multi.Mint}, record.CreateTime).
+		Distinct().Pluck("token_id", &transferred).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get transferred tokens")
+	}
+	touched := make(map[string]struct{}, len(transferred))
+	for _, tokenId := range transferred {
+		touched[tokenId] = struct{}{}
+	}
+	return touched, nil
+}
+
+// deleteItems 删除已销毁的item及其属性
+func (s *Service) deleteItems(collectionAddr string, tokenIds []string) error {
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.ItemTableName(s.chain)).
+			Where("collection_address = ? and token_id in ?", collectionAddr, tokenIds).
+			Delete(&multi.Item{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete burned items")
+		}
+		if err := tx.Table(multi.ItemTraitTableName(s.chain)).
+			Where("collection_address = ? and token_id in ?", collectionAddr, tokenIds).
+			Delete(&multi.ItemTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete burned item traits")
+		}
+		return nil
+	})
+}
+
+// finish 统计item、owner和属性数量，标记collection已导入并通知订单管理器
+// ERC-1155的发行量为持有数量之和，owner为不同的持有者
+func (s *Service) finish(record *multi.CollectionImportRecord, tokenStandard int64) error {
+	collectionAddr := record.CollectionAddress
+	var itemAmount int64
+	err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		ownerTable := multi.ItemTableName(s.chain)
+		if tokenStandard == multi.TokenStandardERC1155 {
+			if err := s.finishErc1155Items(tx, collectionAddr); err != nil {
+				return err
+			}
+			ownerTable = multi.ItemHolderTableName(s.chain)
+		}
+		var ownerAmount int64
+		if err := tx.Table(multi.ItemTableName(s.chain)).
+			Where("collection_address = ?", collectionAddr).
+			Count(&itemAmount).Error; err != nil {
+			return errors.Wrap(err, "failed on count items")
+		}
+		if err := tx.Table(ownerTable).
+			Where("collection_address = ?", collectionAddr).
+			Distinct("owner").Count(&ownerAmount).Error; err != nil {
+			return errors.Wrap(err, "failed on count owners")
+		}
+
+		var traits []multi.CollectionTrait
+		if err := tx.Table(multi.ItemTraitTableName(s.chain)).
+			Select("collection_address, trait, trait_value, count(*) as count").
+			Where("collection_address = ?", collectionAddr).
+			Group("collection_address, trait, trait_value").
+			Scan(&traits).Error; err != nil {
+			return errors.Wrap(err, "failed on count traits")
+		}
+		if err := tx.Table(multi.CollectionTraitTableName(s.chain)).
+			Where("collection_address = ?", collectionAddr).
+			Delete(&multi.CollectionTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete collection traits")
+		}
+		if len(traits) > 0 {
+			if err := tx.Table(multi.CollectionTraitTableName(s.chain)).
+				CreateInBatches(&traits, DefaultBatchSize).Error; err != nil {
+				return errors.Wrap(err, "failed on create collection traits")
+			}
+		}
+
+		if err := tx.Table(gdb.GetMultiProjectCollectionTableName(s.project, s.chain)).
+			Where("address = ?", collectionAddr).
+			Updates(map[string]interface{}{
+				"item_amount":        itemAmount,
+				"owner_amount":       ownerAmount,
+				"floor_price_status": comm.CollectionFloorPriceImported,
+				"update_time":        time.Now().UnixMilli(),
+			}).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
+		EventType:      ordermanager.ImportCollection,
+		CollectionAddr: collectionAddr,
+	}, s.chain); err != nil {
+		return errors.Wrap(err, "failed on add import collection event")
+	}
+	// Transfer回放时同一token可能在多个区块窗口中导入，完成后以实际的item数量为准
+	record.FinishedStage = multi.ImportStageDone
+	record.ImportedCount = itemAmount
+	if err := s.updateRecord(record.Id, map[string]interface{}{
+		"finished_stage": record.FinishedStage,
+		"imported_count": record.ImportedCount,
+		"msg":            "",
+	}); err != nil {
+		return err
+	}
+	xzap.WithContext(s.ctx).Info("collection import finished",
+		zap.String("collection_address", collectionAddr), zap.Int64("record_id", record.Id),
+		zap.Int64("imported_count", record.ImportedCount))
+	return nil
+}
+
+// finishErc1155Items 删除已全部销毁的ERC-1155 item，并按持有数量之和更新发行量
+func (s *Service) finishErc1155Items(tx *gorm.DB, collectionAddr string) error {
+	held := tx.Table(multi.ItemHolderTableName(s.chain)).
+		Select("token_id").Where("collection_address = ?", collectionAddr)
+	var burned []string
+	if err := tx.Table(multi.ItemTableName(s.chain)).
+		Where("collection_address = ? and token_id not in (?)", collectionAddr, held).
+		Pluck("token_id", &burned).Error; err != nil {
+		return errors.Wrap(err, "failed on get burned items")
+	}
+	if len(burned) > 0 {
+		if err := tx.Table(multi.ItemTableName(s.chain)).
+			Where("collection_address = ? and token_id in ?", collectionAddr, burned).
+			Delete(&multi.Item{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete burned items")
+		}
+		if err := tx.Table(multi.ItemTraitTableName(s.chain)).
+			Where("collection_address = ? and token_id in ?", collectionAddr, burned).
+			Delete(&multi.ItemTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete burned item traits")
+		}
+	}
+	itemTable, holderTable := multi.ItemTableName(s.chain), multi.ItemHolderTableName(s.chain)
+	if err := tx.Exec("update "+itemTable+" set supply = (select coalesce(sum(h.balance), 0) from "+holderTable+
+		" h where h.collection_address = "+itemTable+".collection_address and h.token_id = "+itemTable+".token_id)"+
+		" where collection_address = ?", collectionAddr).Error; err != nil {
+		return errors.Wrap(err, "failed on update item supply")
+	}
+	return nil
+}
+
+// forEach 以最多concurrency个协程并发执行fn，返回第一个错误
+func forEach(n, concurrency int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(i); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,406 @@
+package collectionimporter
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+const (
+	testChain      = "sepolia"
+	testChainId    = 11155111
+	testCollection = "0xc011ec7000000000000000000000000000000010"
+	testAlice      = "0xa11ce00000000000000000000000000000000001"
+	testBob        = "0xb0b0000000000000000000000000000000000002"
+)
+
+// fakeNode 按内存中的token和Transfer日志返回链上数据，failIndex对应的token获取失败
+type fakeNode struct {
+	standard   int64
+	balances   map[string]map[string]int64 // token_id -> owner -> 持有数量
+	enumerable bool
+	tokens     []string
+	owners     map[string]string
+	logs       []*nftchainservice.TransferLog
+	head       uint64
+	failIndex  int
+}
+
+func (n *fakeNode) FetchCollectionName(collectionAddr string) (string, string) {
+	return "Test Collection", "TEST"
+}
+
+func (n *fakeNode) SupportsEnumerable(collectionAddr string) bool {
+	return n.enumerable
+}
+
+func (n *fakeNode) FetchTotalSupply(collectionAddr string) (uint64, error) {
+	return uint64(len(n.tokens)), nil
+}
+
+func (n *fakeNode) FetchTokenByIndex(collectionAddr string, index uint64) (string, error) {
+	if int(index) == n.failIndex {
+		return "", errors.New("execution reverted")
+	}
+	return n.tokens[index], nil
+}
+
+func (n *fakeNode) FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error) {
+	return common.HexToAddress(n.owners[tokenID]), nil
+}
+
+func (n *fakeNode) TokenStandard(collectionAddr string) int64 {
+	if n.standard == 0 {
+		return multi.TokenStandardERC721
+	}
+	return n.standard
+}
+
+func (n *fakeNode) FetchNftBalance(collectionAddr, tokenID, owner string) (*big.Int, error) {
+	return big.NewInt(n.balances[tokenID][strings.ToLower(owner)]), nil
+}
+
+func (n *fakeNode) GetCollectionTransferLogs(collectionAddr string, fromBlock, toBlock uint64) ([]*nftchainservice.TransferLog, error) {
+	var logs []*nftchainservice.TransferLog
+	for _, log := range n.logs {
+		if log.BlockNumber >= fromBlock && log.BlockNumber <= toBlock {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (n *fakeNode) LatestBlockNumber() (uint64, error) {
+	return n.head, nil
+}
+
+// fakeRefresher 为每个token写入一个属性，值为token_id的奇偶
+type fakeRefresher struct {
+	db *gorm.DB
+	mu sync.Mutex
+}
+
+func (r *fakeRefresher) Refresh(collectionAddr, tokenId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value := "odd"
+	if tokenId[len(tokenId)-1]%2 == 0 {
+		value = "even"
+	}
+	r.db.Table(multi.ItemTraitTableName(testChain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).Delete(&multi.ItemTrait{})
+	r.db.Table(multi.ItemTraitTableName(testChain)).Create(&multi.ItemTrait{
+		CollectionAddress: collectionAddr, TokenId: tokenId, Trait: "parity", TraitValue: value,
+	})
+}
+
+type importerFixture struct {
+	t       *testing.T
+	db      *gorm.DB
+	mr      *miniredis.Miniredis
+	filter  *collectionfilter.Filter
+	service *Service
+}
+
+func newImporterFixture(t *testing.T, node *fakeNode) *importerFixture {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "import.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed on open sqlite: %v", err)
+	}
+	schema, err := os.ReadFile(filepath.Join("testdata", "schema.sql"))
+	if err != nil {
+		t.Fatalf("failed on read schema: %v", err)
+	}
+	if err := db.Exec(string(schema)).Error; err != nil {
+		t.Fatalf("failed on create schema: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore([]cache.NodeConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: "node"}, Weight: 100}})
+
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	filter := collectionfilter.New(ctx, db, testChain, gdb.OrderBookDexProject)
+	s := New(ctx, db, kv, node, &fakeRefresher{db: db}, filter, testChainId, testChain, gdb.OrderBookDexProject)
+	return &importerFixture{t: t, db: db, mr: mr, filter: filter, service: s}
+}
+
+func (f *importerFixture) record() multi.CollectionImportRecord {
+	f.t.Helper()
+	var record multi.CollectionImportRecord
+	if err := f.db.Table(multi.CollectionImportRecordTableName(testChain)).
+		Order("id desc").First(&record).Error; err != nil {
+		f.t.Fatalf("failed on get import record: %v", err)
+	}
+	return record
+}
+
+func (f *importerFixture) owners() map[string]string {
+	f.t.Helper()
+	var items []multi.Item
+	if err := f.db.Table(multi.ItemTableName(testChain)).Find(&items).Error; err != nil {
+		f.t.Fatalf("failed on get items: %v", err)
+	}
+	owners := make(map[string]string)
+	for _, item := range items {
+		owners[item.TokenId] = strings.ToLower(item.Owner)
+	}
+	return owners
+}
+
+func (f *importerFixture) assertImported(itemAmount, ownerAmount int64, traitCounts map[string]int64) {
+	f.t.Helper()
+	var collection multi.Collection
+	if err := f.db.Table(multi.CollectionTableName(testChain)).
+		Select("address", "name", "symbol", "item_amount", "owner_amount", "floor_price_status").
+		Where("address = ?", testCollection).First(&collection).Error; err != nil {
+		f.t.Fatalf("failed on get collection: %v", err)
+	}
+	if collection.Name != "Test Collection" || collection.Symbol != "TEST" {
+		f.t.Errorf("unexpected collection name: %s, symbol: %s", collection.Name, collection.Symbol)
+	}
+	if collection.ItemAmount != itemAmount || collection.OwnerAmount != ownerAmount {
+		f.t.Errorf("item_amount %d, owner_amount %d, want %d, %d",
+			collection.ItemAmount, collection.OwnerAmount, itemAmount, ownerAmount)
+	}
+	if collection.FloorPriceStatus != comm.CollectionFloorPriceImported {
+		f.t.Errorf("unexpected floor_price_status: %d", collection.FloorPriceStatus)
+	}
+
+	var traits []multi.CollectionTrait
+	if err := f.db.Table(multi.CollectionTraitTableName(testChain)).Find(&traits).Error; err != nil {
+		f.t.Fatalf("failed on get collection traits: %v", err)
+	}
+	if len(traits) != len(traitCounts) {
+		f.t.Errorf("unexpected collection trait count: %d, want %d", len(traits), len(traitCounts))
+	}
+	for _, trait := range traits {
+		if want := traitCounts[trait.TraitValue]; trait.Count != want {
+			f.t.Errorf("trait %s/%s count %d, want %d", trait.Trait, trait.TraitValue, trait.Count, want)
+		}
+	}
+
+	record := f.record()
+	if record.FinishedStage != multi.ImportStageDone || record.Msg != "" || record.ImportedCount != itemAmount {
+		f.t.Errorf("unexpected import record: %+v", record)
+	}
+	if !f.filter.Contains(testCollection) {
+		f.t.Errorf("expected filter to contain %s", testCollection)
+	}
+	events, err := f.mr.List(fmt.Sprintf(ordermanager.CacheTradeEventsQueuePre, testChain))
+	if err != nil || len(events) != 1 || !strings.Contains(events[0], testCollection) {
+		f.t.Errorf("unexpected trade events: %v, err: %v", events, err)
+	}
+}
+
+// TestImportEnumerable 导入中途失败后再次导入，从失败的批次继续
+func TestImportEnumerable(t *testing.T) {
+	node := &fakeNode{
+		enumerable: true,
+		tokens:     []string{"1", "2", "3", "4", "5"},
+		owners:     map[string]string{"1": testAlice, "2": testAlice, "3": testBob, "4": testBob, "5": testBob},
+		failIndex:  3,
+	}
+	f := newImporterFixture(t, node)
+	opts := Options{BatchSize: 2, Concurrency: 2}
+
+	if err := f.service.Import(testCollection, opts); err == nil {
+		t.Fatal("expected import to fail")
+	}
+	record := f.record()
+	if record.FinishedStage != multi.ImportStageCollection || record.NextCursor != 2 || record.TotalCount != 5 ||
+		record.TokenSource != multi.ImportTokenSourceEnumerable || !strings.Contains(record.Msg, "execution reverted") {
+		t.Fatalf("unexpected import record after failure: %+v", record)
+	}
+	// 导入期间collection已在过滤器中，重新加载时同样包含导入中的collection
+	if !f.filter.Contains(testCollection) {
+		t.Fatal("expected filter to contain collection during import")
+	}
+	reloaded := collectionfilter.New(f.service.ctx, f.db, testChain, gdb.OrderBookDexProject)
+	if err := reloaded.PreloadCollections(); err != nil {
+		t.Fatalf("failed on preload collections: %v", err)
+	}
+	if !reloaded.Contains(testCollection) {
+		t.Fatal("expected preloaded filter to contain collection being imported")
+	}
+
+	// 导入中断期间Transfer同步处理了token 4转给alice，导入读取的owner仍是bob，不覆盖同步写入的owner
+	if err := f.db.Table(multi.ItemTableName(testChain)).Create(&multi.Item{
+		ChainId: testChainId, CollectionAddress: testCollection, TokenId: "4", Owner: testAlice, Supply: 1,
+	}).Error; err != nil {
+		t.Fatalf("failed on create item: %v", err)
+	}
+	if err := f.db.Table(multi.ActivityTableName(testChain)).Create(&multi.Activity{
+		ActivityType: multi.Transfer, Maker: testBob, Taker: testAlice, CollectionAddress: testCollection,
+		TokenId: "4", BlockNumber: 200, TxHash: "0x01",
+	}).Error; err != nil {
+		t.Fatalf("failed on create activity: %v", err)
+	}
+
+	node.failIndex = -1
+	if err := f.service.Import(testCollection, opts); err != nil {
+		t.Fatalf("failed on resume import: %v", err)
+	}
+	if got := f.record().Id; got != record.Id {
+		t.Errorf("expected import to resume record %d, got %d", record.Id, got)
+	}
+	owners := f.owners()
+	if owners["4"] != testAlice || owners["5"] != testBob {
+		t.Errorf("unexpected owners: %v", owners)
+	}
+	f.assertImported(5, 2, map[string]int64{"odd": 3, "even": 2})
+}
+
+func transfer(block uint64, index uint, from, to, tokenId string) *nftchainservice.TransferLog {
+	return &nftchainservice.TransferLog{BlockNumber: block, Index: index, From: from, To: to, TokenID: tokenId}
+}
+
+// TestImportTransfer 不支持Enumerable时回放Transfer日志，已销毁的token不导入，creator为mint的接收者
+func TestImportTransfer(t *testing.T) {
+	node := &fakeNode{
+		head:      130,
+		failIndex: -1,
+		logs: []*nftchainservice.TransferLog{
+			transfer(100, 0, ZeroAddress, testAlice, "1"),
+			transfer(100, 1, ZeroAddress, testBob, "2"),
+			transfer(105, 0, ZeroAddress, testAlice, "3"),
+			transfer(112, 0, testAlice, testBob, "1"),
+			transfer(118, 0, testAlice, ZeroAddress, "3"),
+			transfer(125, 0, testBob, testAlice, "1"),
+			transfer(126, 0, testBob, testAlice, "2"),
+			transfer(131, 0, testAlice, testBob, "2"),
+		},
+	}
+	f := newImporterFixture(t, node)
+
+	if err := f.service.Import(testCollection, Options{FromBlock: 100, BlockWindow: 10}); err != nil {
+		t.Fatalf("failed on import: %v", err)
+	}
+	// 131区块在截止区块之后，不影响导入结果
+	owners := f.owners()
+	if len(owners) != 2 || owners["1"] != testAlice || owners["2"] != testAlice {
+		t.Errorf("unexpected owners: %v", owners)
+	}
+	var items []multi.Item
+	if err := f.db.Table(multi.ItemTableName(testChain)).Order("token_id").Find(&items).Error; err != nil {
+		t.Fatalf("failed on get items: %v", err)
+	}
+	if len(items) != 2 || items[0].Creator != testAlice || items[1].Creator != testBob {
+		t.Errorf("expected creators to be mint recipients, got %+v", items)
+	}
+	record := f.record()
+	if record.TokenSource != multi.ImportTokenSourceTransfer || record.ToBlock != 130 || record.NextCursor != 131 {
+		t.Errorf("unexpected import record: %+v", record)
+	}
+	f.assertImported(2, 1, map[string]int64{"odd": 1, "even": 1})
+}
+
+// TestImportTransferCatchUp Transfer同步已处理到截止区块之后时，继续回放到同步进度
+func TestImportTransferCatchUp(t *testing.T) {
+	node := &fakeNode{
+		head:      130,
+		failIndex: -1,
+		logs: []*nftchainservice.TransferLog{
+			transfer(100, 0, ZeroAddress, testAlice, "1"),
+			transfer(100, 1, ZeroAddress, testAlice, "2"),
+			transfer(131, 0, testAlice, testBob, "2"),
+			transfer(135, 0, testAlice, testBob, "1"),
+		},
+	}
+	f := newImporterFixture(t, node)
+	// Transfer同步的下一个待同步区块为133，131区块在collection加入过滤器之前已被跳过
+	if err := f.db.Table(base.IndexedStatusTableName()).Create(&base.IndexedStatus{
+		ChainId: testChainId, LastIndexedBlock: 133, IndexType: base.TypeNftTransferIndex,
+	}).Error; err != nil {
+		t.Fatalf("failed on create index status: %v", err)
+	}
+
+	if err := f.service.Import(testCollection, Options{FromBlock: 100, BlockWindow: 10}); err != nil {
+		t.Fatalf("failed on import: %v", err)
+	}
+	// 135区块在同步进度之后，由Transfer同步处理
+	owners := f.owners()
+	if len(owners) != 2 || owners["1"] != testAlice || owners["2"] != testBob {
+		t.Errorf("unexpected owners: %v", owners)
+	}
+	record := f.record()
+	if record.ToBlock != 132 || record.NextCursor != 133 || record.TotalCount != 33 {
+		t.Errorf("unexpected import record: %+v", record)
+	}
+	f.assertImported(2, 2, map[string]int64{"odd": 1, "even": 1})
+}
+
+// TestImportErc1155 ERC-1155回放转移日志，按链上持有数量写入持有者，全部销毁的token不导入
+func TestImportErc1155(t *testing.T) {
+	transfer := func(block uint64, index uint, from, to, tokenId string, amount int64) *nftchainservice.TransferLog {
+		return &nftchainservice.TransferLog{BlockNumber: block, Index: index, Operator: testAlice, From: from, To: to,
+			TokenID: tokenId, Amount: big.NewInt(amount), TokenStandard: multi.TokenStandardERC1155}
+	}
+	node := &fakeNode{
+		standard:   multi.TokenStandardERC1155,
+		enumerable: true,
+		head:       130,
+		failIndex:  -1,
+		balances: map[string]map[string]int64{
+			"1": {testAlice: 6, testBob: 4},
+		},
+		logs: []*nftchainservice.TransferLog{
+			transfer(100, 0, ZeroAddress, testAlice, "1", 10),
+			transfer(100, 1, ZeroAddress, testAlice, "2", 5),
+			transfer(110, 0, testAlice, testBob, "1", 4),
+			transfer(120, 0, testAlice, ZeroAddress, "2", 5),
+		},
+	}
+	f := newImporterFixture(t, node)
+
+	if err := f.service.Import(testCollection, Options{FromBlock: 100, BlockWindow: 10}); err != nil {
+		t.Fatalf("failed on import: %v", err)
+	}
+	record := f.record()
+	if record.TokenSource != multi.ImportTokenSourceTransfer {
+		t.Errorf("expected erc1155 collection to import from transfer logs: %+v", record)
+	}
+
+	var holders []multi.ItemHolder
+	if err := f.db.Table(multi.ItemHolderTableName(testChain)).Order("owner").Find(&holders).Error; err != nil {
+		t.Fatalf("failed on get holders: %v", err)
+	}
+	if len(holders) != 2 || holders[0].Owner != testAlice || holders[0].Balance.IntPart() != 6 ||
+		holders[1].Owner != testBob || holders[1].Balance.IntPart() != 4 {
+		t.Errorf("unexpected holders: %+v", holders)
+	}
+	var items []multi.Item
+	if err := f.db.Table(multi.ItemTableName(testChain)).Find(&items).Error; err != nil {
+		t.Fatalf("failed on get items: %v", err)
+	}
+	if len(items) != 1 || items[0].TokenId != "1" || items[0].Supply != 10 || items[0].Owner != "" || items[0].Creator != testAlice {
+		t.Errorf("unexpected items: %+v", items)
+	}
+	f.assertImported(1, 2, map[string]int64{"odd": 1})
+}
@@ -0,0 +1,122 @@
+-- db/migrations中导入collection用到的表的SQLite版本
+-- 文本列使用NOCASE，与MySQL的utf8mb4_general_ci一样不区分大小写比较地址
+
+create table ob_indexed_status
+(
+    id                 integer primary key autoincrement,
+    chain_id           bigint      default 1  not null,
+    last_indexed_block bigint      default 0  null,
+    last_indexed_time  bigint                 null,
+    index_type         tinyint     default 0  not null,
+    contract_address   varchar(42) default '' not null collate nocase,
+    leader_token       bigint      default 0  not null,
+    create_time        bigint                 null,
+    update_time        bigint                 null
+);
+
+create table ob_collection_sepolia
+(
+    id                 integer primary key autoincrement,
+    symbol             varchar(128)         not null,
+    chain_id           bigint     default 1 not null,
+    auth               tinyint    default 0 not null,
+    token_standard     bigint               not null,
+    name               varchar(128)         not null,
+    creator            varchar(42)          not null collate nocase,
+    address            varchar(42)          not null collate nocase,
+    owner_amount       bigint     default 0 not null,
+    item_amount        bigint     default 0 not null,
+    floor_price_status int        default 0 not null,
+    create_time        bigint               null,
+    update_time        bigint               null,
+    unique (address)
+);
+
+create table ob_item_sepolia
+(
+    id                 integer primary key autoincrement,
+    chain_id           bigint       default 1 not null,
+    token_id           varchar(128)           not null,
+    name               varchar(128)           not null,
+    owner              varchar(42)            null collate nocase,
+    collection_address varchar(42)            null collate nocase,
+    creator            varchar(42)            not null collate nocase,
+    supply             bigint                 not null,
+    list_price         decimal(30)            null,
+    list_time          bigint                 null,
+    sale_price         decimal(30)            null,
+    views              bigint                 null,
+    create_time        bigint                 null,
+    update_time        bigint                 null,
+    unique (collection_address, token_id)
+);
+
+create table ob_item_holder_sepolia
+(
+    id                 integer primary key autoincrement,
+    collection_address varchar(42)           not null collate nocase,
+    token_id           varchar(128)          not null,
+    owner              varchar(42)           not null collate nocase,
+    balance            decimal(65) default 0 not null,
+    create_time        bigint                null,
+    update_time        bigint                null,
+    unique (collection_address, token_id, owner)
+);
+
+create table ob_item_trait_sepolia
+(
+    id                 integer primary key autoincrement,
+    collection_address varchar(42)  not null collate nocase,
+    token_id           varchar(128) not null,
+    trait              varchar(128) not null,
+    trait_value        varchar(512) not null,
+    create_time        bigint       null,
+    update_time        bigint       null
+);
+
+create table ob_collection_import_record_sepolia
+(
+    id                 integer primary key autoincrement,
+    collection_address varchar(42)               not null collate nocase,
+    msg                varchar(1600) default ''  not null,
+    finished_stage     tinyint(1)    default 0   not null,
+    token_source       tinyint(1)    default 0   not null,
+    total_count        bigint        default 0   not null,
+    imported_count     bigint        default 0   not null,
+    next_cursor        bigint        default 0   not null,
+    to_block           bigint        default 0   not null,
+    create_time        bigint                    not null,
+    update_time        bigint                    not null
+);
+
+create table ob_collection_trait_sepolia
+(
+    id                 integer primary key autoincrement,
+    collection_address varchar(42)      not null collate nocase,
+    trait              varchar(128)     not null,
+    trait_value        varchar(512)     not null,
+    count              bigint default 0 not null,
+    create_time        bigint           null,
+    update_time        bigint           null
+);
+
+create table ob_activity_sepolia
+(
+    id                 integer primary key autoincrement,
+    activity_type      tinyint                 not null,
+    maker              varchar(42)             null collate nocase,
+    taker              varchar(42)             null collate nocase,
+    marketplace_id     tinyint     default 0   not null,
+    collection_address varchar(42)             null collate nocase,
+    token_id           varchar(128)            null,
+    currency_address   varchar(42) default '1' not null collate nocase,
+    price              decimal(30) default 0   not null,
+    sell_price         decimal(30) default 0   not null,
+    buy_price          decimal(30) default 0   not null,
+    block_number       bigint      default 0   not null,
+    tx_hash            varchar(66)             null collate nocase,
+    event_time         bigint                  null,
+    create_time        bigint                  null,
+    update_time        bigint                  null,
+    unique (tx_hash, collection_address, token_id, activity_type)
+);
@@ -0,0 +1,29 @@
+package comm
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrFenced 同步进度已被token更大的leader写入，当前实例已失去leader身份
+var ErrFenced = errors.New("fenced by newer leader")
+
+// CheckLeaderToken 在事务中锁定同步进度并检查leader的fencing token，
+// 进度已被更新的leader写入时返回ErrFenced，token为0时表示未启用选举，不做检查
+func CheckLeaderToken(tx *gorm.DB, token int64) error {
+	if token == 0 {
+		return nil
+	}
+	var current struct {
+		LeaderToken int64
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("leader_token").
+		Limit(1).Scan(&current).Error; err != nil {
+		return errors.Wrap(err, "failed on get leader token")
+	}
+	if current.LeaderToken > token {
+		return errors.Wrapf(ErrFenced, "current token: %d, own token: %d", current.LeaderToken, token)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package comm
+
+import (
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HolderBalance 查询ERC-1155持有者的持有数量，没有记录时返回0
+func HolderBalance(tx *gorm.DB, chain, collection, tokenId, owner string) (decimal.Decimal, error) {
+	var holders []multi.ItemHolder
+	if err := tx.Table(multi.ItemHolderTableName(chain)).
+		Where("collection_address = ? and token_id = ? and owner = ?",
+			strings.ToLower(collection), tokenId, strings.ToLower(owner)).
+		Limit(1).Find(&holders).Error; err != nil {
+		return decimal.Zero, errors.Wrap(err, "failed on get item holder")
+	}
+	if len(holders) == 0 {
+		return decimal.Zero, nil
+	}
+	return holders[0].Balance, nil
+}
+
+// SetHolderBalance 设置ERC-1155持有者的持有数量，数量不大于0时删除记录
+func SetHolderBalance(tx *gorm.DB, chain, collection, tokenId, owner string, balance decimal.Decimal) error {
+	collection, owner = strings.ToLower(collection), strings.ToLower(owner)
+	if !balance.IsPositive() {
+		if err := tx.Table(multi.ItemHolderTableName(chain)).
+			Where("collection_address = ? and token_id = ? and owner = ?", collection, tokenId, owner).
+			Delete(&multi.ItemHolder{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete item holder")
+		}
+		return nil
+	}
+	if err := tx.Table(multi.ItemHolderTableName(chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}, {Name: "owner"}},
+		DoUpdates: clause.AssignmentColumns([]string{"balance", "update_time"}),
+	}).Create(&multi.ItemHolder{
+		CollectionAddress: collection,
+		TokenId:           tokenId,
+		Owner:             owner,
+		Balance:           balance,
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on upsert item holder")
+	}
+	return nil
+}
+
+// AdjustHolderBalance 按delta调整ERC-1155持有者的持有数量，返回调整前后的数量
+func AdjustHolderBalance(tx *gorm.DB, chain, collection, tokenId, owner string, delta decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	prev, err := HolderBalance(tx, chain, collection, tokenId, owner)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	balance := prev.Add(delta)
+	if balance.IsNegative() {
+		balance = decimal.Zero
+	}
+	if err := SetHolderBalance(tx, chain, collection, tokenId, owner, balance); err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return prev, balance, nil
+}
@@ -0,0 +1,502 @@
+package comm
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MaxReorgDepth       = 1000 // 保留区块hash和回滚日志的区块深度
+	MaxForkSearchBlocks = 200  // 查找分叉点时最多比较的已索引区块数量
+	HeaderBatchSize     = 100  // 每次批量请求的区块头数量
+)
+
+// ErrBlockHashChanged 查询区间期间区块hash发生变化，稍后重试
+var ErrBlockHashChanged = errors.New("block hash changed while syncing")
+
+// Journal 记录索引器已索引区块的hash和变更前的数据，链重组时查找分叉点并按倒序恢复
+// 区块hash和回滚日志以key区分：订单簿同步使用合约地址，Transfer同步使用固定的key，各自独立回滚
+type Journal struct {
+	ctx         context.Context
+	db          *gorm.DB
+	chainClient chainclient.ChainClient
+	chain       string
+	key         string
+}
+
+func NewJournal(ctx context.Context, db *gorm.DB, chainClient chainclient.ChainClient, chain, key string) *Journal {
+	return &Journal{
+		ctx:         ctx,
+		db:          db,
+		chainClient: chainClient,
+		chain:       chain,
+		key:         strings.ToLower(key),
+	}
+}
+
+// DetectReorg 检测链重组
+// 比较不晚于startBlock的最近一个已记录区块的hash与链上的hash，不一致时向前查找分叉点
+// 区间中途失败后从最后处理的日志所在区块继续时，上一个区块没有记录，使用该区块或更早的记录，只有没有任何记录时才视为首次同步
+// 返回值:
+// - uint64: 分叉点区块高度，该高度及之前的数据仍然有效
+// - bool: 是否发生了重组
+func (j *Journal) DetectReorg(startBlock uint64) (uint64, bool, error) {
+	if startBlock == 0 {
+		return 0, false, nil
+	}
+	// 查询不晚于startBlock的最近一个已索引区块的hash
+	var lastBlock multi.IndexedBlock
+	err := j.db.WithContext(j.ctx).Table(multi.IndexedBlockTableName(j.chain)).
+		Where("contract_address = ? and block_number <= ?", j.key, startBlock).
+		Order("block_number desc").
+		First(&lastBlock).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrap(err, "failed on get indexed block")
+	}
+	// 最近的记录是上一个区块时比较startBlock的父区块hash，否则比较记录区块本身的hash
+	adjacent := uint64(lastBlock.BlockNumber) == startBlock-1
+	number := uint64(lastBlock.BlockNumber)
+	if adjacent {
+		number = startBlock
+	}
+	header, err := j.chainClient.BlockHeaderByNumber(j.ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get block header")
+	}
+	chainHash := header.Hash
+	if adjacent {
+		chainHash = header.ParentHash
+	}
+	if strings.EqualFold(chainHash, lastBlock.BlockHash) {
+		return 0, false, nil
+	}
+
+	xzap.WithContext(j.ctx).Warn("chain reorg detected",
+		zap.String("key", j.key),
+		zap.Uint64("block_number", startBlock),
+		zap.Int64("indexed_block", lastBlock.BlockNumber),
+		zap.String("chain_hash", chainHash),
+		zap.String("indexed_hash", lastBlock.BlockHash))
+
+	forkBlock, err := j.findForkBlock(startBlock)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on find fork block")
+	}
+	return forkBlock, true, nil
+}
+
+// findForkBlock 从新到旧比较已记录的区块hash与链上区块hash，第一个一致的区块即为分叉点
+func (j *Journal) findForkBlock(startBlock uint64) (uint64, error) {
+	var blocks []multi.IndexedBlock
+	if err := j.db.WithContext(j.ctx).Table(multi.IndexedBlockTableName(j.chain)).
+		Where("contract_address = ? and block_number < ?", j.key, startBlock).
+		Order("block_number desc").Limit(MaxForkSearchBlocks).
+		Find(&blocks).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get indexed blocks")
+	}
+	if len(blocks) == 0 {
+		return 0, errors.New("no indexed block recorded")
+	}
+
+	for _, block := range blocks {
+		header, err := j.chainClient.BlockHeaderByNumber(j.ctx, big.NewInt(block.BlockNumber))
+		if err != nil {
+			return 0, errors.Wrap(err, "failed on get block header")
+		}
+		if strings.EqualFold(header.Hash, block.BlockHash) {
+			return uint64(block.BlockNumber), nil
+		}
+	}
+
+	// 所有记录的区块都已被重组，只能回滚到最早的记录之前
+	oldest := blocks[len(blocks)-1]
+	xzap.WithContext(j.ctx).Error("reorg deeper than indexed blocks",
+		zap.String("key", j.key),
+		zap.Int64("oldest_block", oldest.BlockNumber))
+	return uint64(oldest.BlockNumber - 1), nil
+}
+
+// VerifyHeaders 批量获取有日志的区块的区块头，与日志的区块hash比较
+// blockHashes为区块高度到日志中区块hash的映射，endHeader为已获取的结束区块头
+// 区块头在结束区块头之后获取，不一致说明查询期间发生了重组，区间内的区块被替换而结束区块不变时也能发现
+// 返回有日志的区块和结束区块的区块头，用于记录区块hash
+func (j *Journal) VerifyHeaders(blockHashes map[uint64]string, endHeader *types.BlockHeader) ([]*types.BlockHeader, error) {
+	var numbers []uint64
+	for number := range blockHashes {
+		if number != endHeader.Number {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Slice(numbers, func(i, k int) bool { return numbers[i] < numbers[k] })
+
+	headers := make([]*types.BlockHeader, 0, len(numbers)+1)
+	for i := 0; i < len(numbers); i += HeaderBatchSize {
+		end := i + HeaderBatchSize
+		if end > len(numbers) {
+			end = len(numbers)
+		}
+		batch, err := j.chainClient.BlockHeadersByNumbers(j.ctx, numbers[i:end])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on get block headers")
+		}
+		headers = append(headers, batch...)
+	}
+	headers = append(headers, endHeader)
+
+	for _, header := range headers {
+		if hash, ok := blockHashes[header.Number]; ok && !strings.EqualFold(hash, header.Hash) {
+			return nil, errors.Wrapf(ErrBlockHashChanged, "block: %d, header: %s, log: %s", header.Number, header.Hash, hash)
+		}
+	}
+	return headers, nil
+}
+
+// RecordBlocks 记录已索引区块的hash，并清理超过重组深度的区块hash和回滚日志
+func (j *Journal) RecordBlocks(tx *gorm.DB, headers []*types.BlockHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	var tip uint64
+	blocks := make([]*multi.IndexedBlock, 0, len(headers))
+	for _, header := range headers {
+		blocks = append(blocks, &multi.IndexedBlock{
+			ContractAddress: j.key,
+			BlockNumber:     int64(header.Number),
+			BlockHash:       header.Hash,
+			ParentHash:      header.ParentHash,
+		})
+		if header.Number > tip {
+			tip = header.Number
+		}
+	}
+	if err := tx.Table(multi.IndexedBlockTableName(j.chain)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "contract_address"}, {Name: "block_number"}},
+			DoUpdates: clause.AssignmentColumns([]string{"block_hash", "parent_hash", "update_time"}),
+		}).
+		Create(&blocks).Error; err != nil {
+		return errors.Wrap(err, "failed on create indexed block")
+	}
+
+	if tip <= MaxReorgDepth {
+		return nil
+	}
+	expired := tip - MaxReorgDepth
+	if err := tx.Table(multi.IndexedBlockTableName(j.chain)).
+		Where("contract_address = ? and block_number < ?", j.key, expired).
+		Delete(&multi.IndexedBlock{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expired indexed blocks")
+	}
+	if err := tx.Table(multi.IndexerJournalTableName(j.chain)).
+		Where("contract_address = ? and block_number < ?", j.key, expired).
+		Delete(&multi.IndexerJournal{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expired journals")
+	}
+	return nil
+}
+
+// Add 写入一条回滚日志
+func (j *Journal) Add(tx *gorm.DB, journal *multi.IndexerJournal) error {
+	journal.ContractAddress = j.key
+	if err := tx.Table(multi.IndexerJournalTableName(j.chain)).
+		Create(journal).Error; err != nil {
+		return errors.Wrap(err, "failed on create journal")
+	}
+	return nil
+}
+
+// OrderUpdated 查询订单当前状态并写入回滚日志，订单不存在时无需记录
+func (j *Journal) OrderUpdated(tx *gorm.DB, blockNumber uint64, txHash, orderId string) error {
+	var order multi.Order
+	if err := tx.Table(multi.OrderTableName(j.chain)).
+		Where("order_id = ?", orderId).
+		First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return errors.Wrap(err, "failed on get order")
+	}
+	return j.Add(tx, OrderJournal(blockNumber, txHash, &order))
+}
+
+// ItemOwner 查询item当前owner并写入回滚日志，item不存在时无需记录
+func (j *Journal) ItemOwner(tx *gorm.DB, blockNumber uint64, txHash, collection, tokenId string) error {
+	return j.item(tx, blockNumber, txHash, collection, tokenId, false)
+}
+
+// ItemUpsert 在创建或更新item前写入回滚日志，item不存在时记录创建，回滚时删除
+func (j *Journal) ItemUpsert(tx *gorm.DB, blockNumber uint64, txHash, collection, tokenId string) error {
+	return j.item(tx, blockNumber, txHash, collection, tokenId, true)
+}
+
+func (j *Journal) item(tx *gorm.DB, blockNumber uint64, txHash, collection, tokenId string, upsert bool) error {
+	var items []multi.Item
+	if err := tx.Table(multi.ItemTableName(j.chain)).
+		Where("collection_address = ? and token_id = ?", strings.ToLower(collection), tokenId).
+		Limit(1).Find(&items).Error; err != nil {
+		return errors.Wrap(err, "failed on get item")
+	}
+	journal := &multi.IndexerJournal{
+		BlockNumber:       int64(blockNumber),
+		TxHash:            txHash,
+		JournalType:       multi.JournalItemOwner,
+		CollectionAddress: strings.ToLower(collection),
+		TokenId:           tokenId,
+	}
+	if len(items) > 0 {
+		journal.PrevOwner = items[0].Owner
+	} else if upsert {
+		journal.JournalType = multi.JournalItemCreated
+	} else {
+		return nil
+	}
+	return j.Add(tx, journal)
+}
+
+// ItemSupply 在创建或更新ERC-1155 item前写入回滚日志，item不存在时记录创建，存在时记录当前发行量
+func (j *Journal) ItemSupply(tx *gorm.DB, blockNumber uint64, txHash, collection, tokenId string) error {
+	var items []multi.Item
+	if err := tx.Table(multi.ItemTableName(j.chain)).
+		Where("collection_address = ? and token_id = ?", strings.ToLower(collection), tokenId).
+		Limit(1).Find(&items).Error; err != nil {
+		return errors.Wrap(err, "failed on get item")
+	}
+	journal := &multi.IndexerJournal{
+		BlockNumber:       int64(blockNumber),
+		TxHash:            txHash,
+		JournalType:       multi.JournalItemCreated,
+		CollectionAddress: strings.ToLower(collection),
+		TokenId:           tokenId,
+	}
+	if len(items) > 0 {
+		journal.JournalType = multi.JournalItemSupply
+		journal.PrevBalance = decimal.NewFromInt(items[0].Supply)
+	}
+	return j.Add(tx, journal)
+}
+
+// OrdersInactivated 为已置为失效的挂单写入回滚日志，回滚时恢复为有效并加回订单簿
+func (j *Journal) OrdersInactivated(tx *gorm.DB, blockNumber uint64, txHash string, orderIds []string) error {
+	if len(orderIds) == 0 {
+		return nil
+	}
+	var orders []multi.Order
+	if err := tx.Table(multi.OrderTableName(j.chain)).
+		Where("order_id in ?", orderIds).
+		Find(&orders).Error; err != nil {
+		return errors.Wrap(err, "failed on get orders")
+	}
+	for i := range orders {
+		journal := OrderJournal(blockNumber, txHash, &orders[i])
+		journal.PrevOrderStatus = multi.OrderStatusActive
+		if err := j.Add(tx, journal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HolderBalance 查询ERC-1155持有者当前的持有数量并写入回滚日志
+func (j *Journal) HolderBalance(tx *gorm.DB, blockNumber uint64, txHash, collection, tokenId, owner string) error {
+	balance, err := HolderBalance(tx, j.chain, collection, tokenId, owner)
+	if err != nil {
+		return err
+	}
+	return j.Add(tx, &multi.IndexerJournal{
+		BlockNumber:       int64(blockNumber),
+		TxHash:            txHash,
+		JournalType:       multi.JournalHolderBalance,
+		CollectionAddress: strings.ToLower(collection),
+		TokenId:           tokenId,
+		PrevOwner:         strings.ToLower(owner),
+		PrevBalance:       balance,
+	})
+}
+
+// Rollback 倒序恢复分叉点之后的回滚日志，删除分叉点之后的回滚日志和区块hash
+// 返回需要发送给ordermanager的补偿事件
+func (j *Journal) Rollback(tx *gorm.DB, forkBlock uint64) ([]*ordermanager.TradeEvent, error) {
+	var journals []multi.IndexerJournal
+	if err := tx.Table(multi.IndexerJournalTableName(j.chain)).
+		Where("contract_address = ? and block_number > ?", j.key, forkBlock).
+		Order("id desc").
+		Find(&journals).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get journals")
+	}
+
+	var events []*ordermanager.TradeEvent
+	for i := range journals {
+		event, err := j.UndoJournal(tx, &journals[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on undo journal")
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+
+	if err := tx.Table(multi.IndexerJournalTableName(j.chain)).
+		Where("contract_address = ? and block_number > ?", j.key, forkBlock).
+		Delete(&multi.IndexerJournal{}).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on delete journals")
+	}
+	if err := tx.Table(multi.IndexedBlockTableName(j.chain)).
+		Where("contract_address = ? and block_number > ?", j.key, forkBlock).
+		Delete(&multi.IndexedBlock{}).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on delete indexed blocks")
+	}
+	return events, nil
+}
+
+// UndoJournal 恢复单条回滚日志，返回需要发送给ordermanager的补偿事件
+func (j *Journal) UndoJournal(tx *gorm.DB, journal *multi.IndexerJournal) (*ordermanager.TradeEvent, error) {
+	switch journal.JournalType {
+	case multi.JournalOrderCreated:
+		// 删除分叉后创建的订单，挂单和集合出价需要从订单簿中移除
+		var order multi.Order
+		if err := tx.Table(multi.OrderTableName(j.chain)).
+			Where("order_id = ?", journal.OrderID).
+			First(&order).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, errors.Wrap(err, "failed on get order")
+		}
+		if err := tx.Table(multi.OrderTableName(j.chain)).
+			Where("order_id = ?", journal.OrderID).
+			Delete(&multi.Order{}).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on delete order")
+		}
+		if !inOrderBook(order.OrderType) || order.OrderStatus != multi.OrderStatusActive {
+			return nil, nil
+		}
+		return &ordermanager.TradeEvent{
+			EventType:      ordermanager.Cancel,
+			CollectionAddr: order.CollectionAddress,
+			TokenID:        order.TokenId,
+			OrderId:        order.OrderID,
+			OrderType:      order.OrderType,
+		}, nil
+
+	case multi.JournalOrderUpdated:
+		// 恢复订单状态，重新生效的挂单和集合出价需要加回订单簿
+		if err := tx.Table(multi.OrderTableName(j.chain)).
+			Where("order_id = ?", journal.OrderID).
+			Updates(map[string]interface{}{
+				"order_status":       journal.PrevOrderStatus,
+				"quantity_remaining": journal.PrevQuantityRemaining,
+				"taker":              journal.PrevTaker,
+			}).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on restore order")
+		}
+		if journal.PrevOrderStatus != multi.OrderStatusActive {
+			return nil, nil
+		}
+		var order multi.Order
+		if err := tx.Table(multi.OrderTableName(j.chain)).
+			Where("order_id = ?", journal.OrderID).
+			First(&order).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on get order")
+		}
+		if !inOrderBook(order.OrderType) {
+			return nil, nil
+		}
+		return &ordermanager.TradeEvent{
+			EventType:      ordermanager.Listing,
+			CollectionAddr: order.CollectionAddress,
+			TokenID:        order.TokenId,
+			OrderId:        order.OrderID,
+			OrderType:      order.OrderType,
+			Price:          order.Price,
+			From:           order.Maker,
+		}, nil
+
+	case multi.JournalItemOwner:
+		// 恢复item owner，通过Transfer事件让ordermanager切换有效挂单
+		var item multi.Item
+		if err := tx.Table(multi.ItemTableName(j.chain)).
+			Where("collection_address = ? and token_id = ?", journal.CollectionAddress, journal.TokenId).
+			First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, errors.Wrap(err, "failed on get item")
+		}
+		if err := tx.Table(multi.ItemTableName(j.chain)).
+			Where("collection_address = ? and token_id = ?", journal.CollectionAddress, journal.TokenId).
+			Update("owner", journal.PrevOwner).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on restore item owner")
+		}
+		return &ordermanager.TradeEvent{
+			EventType:      ordermanager.Transfer,
+			CollectionAddr: journal.CollectionAddress,
+			TokenID:        journal.TokenId,
+			From:           item.Owner,
+			To:             journal.PrevOwner,
+		}, nil
+
+	case multi.JournalItemCreated:
+		// 删除分叉后mint的item
+		if err := tx.Table(multi.ItemTableName(j.chain)).
+			Where("collection_address = ? and token_id = ?", journal.CollectionAddress, journal.TokenId).
+			Delete(&multi.Item{}).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on delete item")
+		}
+		return nil, nil
+
+	case multi.JournalItemSupply:
+		// 恢复ERC-1155 item的发行量
+		if err := tx.Table(multi.ItemTableName(j.chain)).
+			Where("collection_address = ? and token_id = ?", journal.CollectionAddress, journal.TokenId).
+			Update("supply", journal.PrevBalance.IntPart()).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on restore item supply")
+		}
+		return nil, nil
+
+	case multi.JournalHolderBalance:
+		// 恢复ERC-1155持有数量，订单簿合约不支持ERC-1155挂单，无需通知ordermanager
+		if err := SetHolderBalance(tx, j.chain, journal.CollectionAddress, journal.TokenId,
+			journal.PrevOwner, journal.PrevBalance); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return nil, nil
+}
+
+// OrderJournal 根据订单变更前的数据生成回滚日志
+func OrderJournal(blockNumber uint64, txHash string, order *multi.Order) *multi.IndexerJournal {
+	return &multi.IndexerJournal{
+		BlockNumber:           int64(blockNumber),
+		TxHash:                txHash,
+		JournalType:           multi.JournalOrderUpdated,
+		OrderID:               order.OrderID,
+		CollectionAddress:     order.CollectionAddress,
+		TokenId:               order.TokenId,
+		PrevOrderStatus:       order.OrderStatus,
+		PrevQuantityRemaining: order.QuantityRemaining,
+		PrevTaker:             order.Taker,
+	}
+}
+
+// inOrderBook ordermanager订单簿中维护的订单类型
+func inOrderBook(orderType int64) bool {
+	return orderType == multi.ListingOrder || orderType == multi.CollectionBidOrder
+}
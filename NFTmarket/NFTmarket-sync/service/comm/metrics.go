@@ -0,0 +1,68 @@
+package comm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	headBlock = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "sync",
+		Name:      "head_block",
+		Help:      "Latest block number reported by the chain node.",
+	}, []string{"chain", "indexer"})
+	syncedBlock = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "sync",
+		Name:      "synced_block",
+		Help:      "Last block fully processed by the indexer.",
+	}, []string{"chain", "indexer"})
+	blocksBehind = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "easyswap",
+		Subsystem: "sync",
+		Name:      "blocks_behind",
+		Help:      "Blocks between the chain head and the last block processed by the indexer.",
+	}, []string{"chain", "indexer"})
+	eventsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyswap",
+		Subsystem: "sync",
+		Name:      "events_total",
+		Help:      "Chain events handled by the indexer, replayed logs included.",
+	}, []string{"chain", "indexer", "type"})
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyswap",
+		Subsystem: "sync",
+		Name:      "handler_errors_total",
+		Help:      "Chain events whose handler returned an error.",
+	}, []string{"chain", "indexer", "type"})
+)
+
+func init() {
+	prometheus.MustRegister(headBlock, syncedBlock, blocksBehind, eventsProcessed, handlerErrors)
+}
+
+// BlocksBehind 链上最新区块与已同步区块的差值，尚未同步时为head
+func BlocksBehind(head, synced uint64) uint64 {
+	if synced >= head {
+		return 0
+	}
+	return head - synced
+}
+
+// ObserveSync 上报同步进度，head为0时表示尚未获取到最新区块
+func ObserveSync(chain, indexer string, head, synced uint64) {
+	if head > 0 {
+		headBlock.WithLabelValues(chain, indexer).Set(float64(head))
+		blocksBehind.WithLabelValues(chain, indexer).Set(float64(BlocksBehind(head, synced)))
+	}
+	syncedBlock.WithLabelValues(chain, indexer).Set(float64(synced))
+}
+
+// ObserveEvent 按事件类型统计处理的事件数和处理失败数
+func ObserveEvent(chain, indexer, eventType string, err error) {
+	if err != nil {
+		handlerErrors.WithLabelValues(chain, indexer, eventType).Inc()
+		return
+	}
+	eventsProcessed.WithLabelValues(chain, indexer, eventType).Inc()
+}
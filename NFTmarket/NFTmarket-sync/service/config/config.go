@@ -2,13 +2,23 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
 	logging "github.com/ProjectsTask/EasySwapBase/logger"
+	"github.com/ProjectsTask/EasySwapBase/media"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 )
 
+const (
+	DefaultLeaseTTL        = 15 // in seconds
+	DefaultShutdownTimeout = 30 // in seconds
+	DefaultMaxBlocksBehind = 100
+)
+
 type Config struct {
 	Monitor     *Monitor         `toml:"monitor" mapstructure:"monitor" json:"monitor"`
 	Log         *logging.LogConf `toml:"log" mapstructure:"log" json:"log"`
@@ -18,6 +28,56 @@ type Config struct {
 	ChainCfg    ChainCfg         `toml:"chain_cfg" mapstructure:"chain_cfg" json:"chain_cfg"`
 	ContractCfg ContractCfg      `toml:"contract_cfg" mapstructure:"contract_cfg" json:"contract_cfg"`
 	ProjectCfg  ProjectCfg       `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
+	// 多链、多合约部署，为空时使用上面的单链配置
+	Deployments []Deployment `toml:"deployments" mapstructure:"deployments" json:"deployments"`
+	EventSink   EventSinkCfg `toml:"event_sink" mapstructure:"event_sink" json:"event_sink"`
+	// 多副本部署时的leader选举
+	LeaderElection LeaderElectionCfg `toml:"leader_election" mapstructure:"leader_election" json:"leader_election"`
+	// 退出时等待后台协程的最长时间(秒)，0时使用默认值
+	ShutdownTimeout int64 `toml:"shutdown_timeout" mapstructure:"shutdown_timeout" json:"shutdown_timeout"`
+	// 解析NFT metadata的字段名，为空时使用默认值
+	MetadataParse *MetadataParse `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
+	// 消费后端的metadata刷新队列
+	MetadataRefresh MetadataRefreshCfg `toml:"metadata_refresh" mapstructure:"metadata_refresh" json:"metadata_refresh"`
+	// tokenURI的网关、大小限制和缓存，未配置时使用默认值
+	Resolver *nftchainservice.ResolverConfig `toml:"resolver" mapstructure:"resolver" json:"resolver"`
+	// item图片的存储，未配置时不上传
+	Media *media.Config `toml:"media" mapstructure:"media" json:"media"`
+}
+
+// GetShutdownTimeout 返回退出时等待后台协程的最长时间
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return DefaultShutdownTimeout * time.Second
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// LeaderElectionCfg leader选举配置，启用后只有leader运行同步和订单管理器
+type LeaderElectionCfg struct {
+	Enable   bool  `toml:"enable" mapstructure:"enable" json:"enable"`
+	LeaseTTL int64 `toml:"lease_ttl" mapstructure:"lease_ttl" json:"lease_ttl"` // 租约时长(秒)，0时使用默认值
+}
+
+// GetLeaseTTL 返回租约时长
+func (c LeaderElectionCfg) GetLeaseTTL() time.Duration {
+	if c.LeaseTTL <= 0 {
+		return DefaultLeaseTTL * time.Second
+	}
+	return time.Duration(c.LeaseTTL) * time.Second
+}
+
+// EventSinkCfg 市场事件发布配置
+type EventSinkCfg struct {
+	Type   string `toml:"type" mapstructure:"type" json:"type"`          // redis或memory，为空时不发布
+	MaxLen int64  `toml:"max_len" mapstructure:"max_len" json:"max_len"` // 每条链的事件流保留的最大消息数，0表示不限制
+}
+
+// Deployment 一个订单簿合约部署
+type Deployment struct {
+	AnkrCfg     AnkrCfg     `toml:"ankr_cfg" mapstructure:"ankr_cfg" json:"ankr_cfg"`
+	ChainCfg    ChainCfg    `toml:"chain_cfg" mapstructure:"chain_cfg" json:"chain_cfg"`
+	ContractCfg ContractCfg `toml:"contract_cfg" mapstructure:"contract_cfg" json:"contract_cfg"`
 }
 
 type ChainCfg struct {
@@ -29,11 +89,71 @@ type ContractCfg struct {
 	EthAddress  string `toml:"eth_address" mapstructure:"eth_address" json:"eth_address"`
 	WethAddress string `toml:"weth_address" mapstructure:"weth_address" json:"weth_address"`
 	DexAddress  string `toml:"dex_address" mapstructure:"dex_address" json:"dex_address"`
+	// 订单簿金库地址，挂单时NFT存入金库，对应的Transfer由订单簿事件处理
+	VaultAddress string `toml:"vault_address" mapstructure:"vault_address" json:"vault_address"`
+	// 同步进度不存在时的起始区块
+	StartBlock uint64 `toml:"start_block" mapstructure:"start_block" json:"start_block"`
 }
 
 type Monitor struct {
 	PprofEnable bool  `toml:"pprof_enable" mapstructure:"pprof_enable" json:"pprof_enable"`
 	PprofPort   int64 `toml:"pprof_port" mapstructure:"pprof_port" json:"pprof_port"`
+	// 健康检查和Prometheus指标端口，0时不开启
+	HealthPort int64 `toml:"health_port" mapstructure:"health_port" json:"health_port"`
+	// 落后链上最新区块超过该数量时readiness检查失败，0时使用默认值
+	MaxBlocksBehind uint64 `toml:"max_blocks_behind" mapstructure:"max_blocks_behind" json:"max_blocks_behind"`
+}
+
+// GetMaxBlocksBehind 返回readiness检查允许落后的最大区块数
+func (m *Monitor) GetMaxBlocksBehind() uint64 {
+	if m == nil || m.MaxBlocksBehind == 0 {
+		return DefaultMaxBlocksBehind
+	}
+	return m.MaxBlocksBehind
+}
+
+// MetadataParse 与后端的metadata_parse配置相同
+type MetadataParse struct {
+	NameTags       []string `toml:"name_tags" mapstructure:"name_tags" json:"name_tags"`
+	ImageTags      []string `toml:"image_tags" mapstructure:"image_tags" json:"image_tags"`
+	AttributesTags []string `toml:"attributes_tags" mapstructure:"attributes_tags" json:"attributes_tags"`
+	TraitNameTags  []string `toml:"trait_name_tags" mapstructure:"trait_name_tags" json:"trait_name_tags"`
+	TraitValueTags []string `toml:"trait_value_tags" mapstructure:"trait_value_tags" json:"trait_value_tags"`
+}
+
+// GetMetadataParse 返回解析metadata的字段名，未配置的字段使用OpenSea标准的字段名
+func (c *Config) GetMetadataParse() MetadataParse {
+	parse := MetadataParse{
+		NameTags:       []string{"name"},
+		ImageTags:      []string{"image", "image_url"},
+		AttributesTags: []string{"attributes", "traits"},
+		TraitNameTags:  []string{"trait_type"},
+		TraitValueTags: []string{"value"},
+	}
+	if c.MetadataParse == nil {
+		return parse
+	}
+	if len(c.MetadataParse.NameTags) > 0 {
+		parse.NameTags = c.MetadataParse.NameTags
+	}
+	if len(c.MetadataParse.ImageTags) > 0 {
+		parse.ImageTags = c.MetadataParse.ImageTags
+	}
+	if len(c.MetadataParse.AttributesTags) > 0 {
+		parse.AttributesTags = c.MetadataParse.AttributesTags
+	}
+	if len(c.MetadataParse.TraitNameTags) > 0 {
+		parse.TraitNameTags = c.MetadataParse.TraitNameTags
+	}
+	if len(c.MetadataParse.TraitValueTags) > 0 {
+		parse.TraitValueTags = c.MetadataParse.TraitValueTags
+	}
+	return parse
+}
+
+// MetadataRefreshCfg metadata刷新配置，默认开启
+type MetadataRefreshCfg struct {
+	Disable bool `toml:"disable" mapstructure:"disable" json:"disable"`
 }
 
 type AnkrCfg struct {
@@ -41,6 +161,20 @@ type AnkrCfg struct {
 	HttpsUrl     string `toml:"https_url" mapstructure:"https_url" json:"https_url"`
 	WebsocketUrl string `toml:"websocket_url" mapstructure:"websocket_url" json:"websocket_url"`
 	EnableWss    bool   `toml:"enable_wss" mapstructure:"enable_wss" json:"enable_wss"`
+	// 多个节点，配置后忽略https_url和api_key，按健康分故障切换
+	Endpoints []chainclient.Endpoint `toml:"endpoints" mapstructure:"endpoints" json:"endpoints"`
+}
+
+// GetEndpoints 返回节点列表，未配置endpoints时使用https_url、websocket_url和api_key
+func (c AnkrCfg) GetEndpoints() []chainclient.Endpoint {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	endpoint := chainclient.Endpoint{Url: c.HttpsUrl + c.ApiKey}
+	if c.WebsocketUrl != "" {
+		endpoint.WsUrl = c.WebsocketUrl + c.ApiKey
+	}
+	return []chainclient.Endpoint{endpoint}
 }
 
 type ProjectCfg struct {
@@ -100,3 +234,24 @@ func UnmarshalCmdConfig() (*Config, error) {
 
 	return &c, nil
 }
+
+// GetDeployments 返回需要同步的所有合约部署
+func (c *Config) GetDeployments() []Deployment {
+	if len(c.Deployments) > 0 {
+		return c.Deployments
+	}
+	return []Deployment{{
+		AnkrCfg:     c.AnkrCfg,
+		ChainCfg:    c.ChainCfg,
+		ContractCfg: c.ContractCfg,
+	}}
+}
+
+// WithDeployment 返回使用指定部署的链和合约配置的副本
+func (c *Config) WithDeployment(d Deployment) *Config {
+	cfg := *c
+	cfg.AnkrCfg = d.AnkrCfg
+	cfg.ChainCfg = d.ChainCfg
+	cfg.ContractCfg = d.ContractCfg
+	return &cfg
+}
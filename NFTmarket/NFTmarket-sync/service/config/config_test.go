@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDeployments(t *testing.T) {
+	c := &Config{
+		ChainCfg:    ChainCfg{Name: "sepolia", ID: 11155111},
+		ContractCfg: ContractCfg{DexAddress: "0xdex"},
+	}
+	deployments := c.GetDeployments()
+	if len(deployments) != 1 || deployments[0].ContractCfg.DexAddress != "0xdex" {
+		t.Fatalf("expected top-level deployment, got %+v", deployments)
+	}
+
+	c.Deployments = []Deployment{
+		{ChainCfg: ChainCfg{Name: "eth", ID: 1}, ContractCfg: ContractCfg{DexAddress: "0xa"}},
+		{ChainCfg: ChainCfg{Name: "eth", ID: 1}, ContractCfg: ContractCfg{DexAddress: "0xb"}},
+	}
+	if got := c.GetDeployments(); len(got) != 2 {
+		t.Fatalf("expected 2 deployments, got %d", len(got))
+	}
+}
+
+func TestWithDeployment(t *testing.T) {
+	c := &Config{
+		ChainCfg:   ChainCfg{Name: "sepolia", ID: 11155111},
+		ProjectCfg: ProjectCfg{Name: "easyswap"},
+	}
+	d := Deployment{ChainCfg: ChainCfg{Name: "eth", ID: 1}, ContractCfg: ContractCfg{DexAddress: "0xa"}}
+	got := c.WithDeployment(d)
+	if got.ChainCfg.ID != 1 || got.ContractCfg.DexAddress != "0xa" || got.ProjectCfg.Name != "easyswap" {
+		t.Fatalf("unexpected config: %+v", got)
+	}
+	if c.ChainCfg.ID != 11155111 {
+		t.Fatalf("original config modified")
+	}
+}
+
+func TestGetEndpoints(t *testing.T) {
+	c := AnkrCfg{
+		ApiKey:       "key",
+		HttpsUrl:     "https://rpc.ankr.com/eth/",
+		WebsocketUrl: "wss://rpc.ankr.com/eth/ws/",
+	}
+	endpoints := c.GetEndpoints()
+	if len(endpoints) != 1 || endpoints[0].Url != "https://rpc.ankr.com/eth/key" ||
+		endpoints[0].WsUrl != "wss://rpc.ankr.com/eth/ws/key" {
+		t.Fatalf("unexpected endpoints: %+v", endpoints)
+	}
+}
+
+func TestGetLeaseTTL(t *testing.T) {
+	var c LeaderElectionCfg
+	if got := c.GetLeaseTTL(); got != DefaultLeaseTTL*time.Second {
+		t.Fatalf("expected default lease ttl, got %s", got)
+	}
+	c.LeaseTTL = 30
+	if got := c.GetLeaseTTL(); got != 30*time.Second {
+		t.Fatalf("expected 30s lease ttl, got %s", got)
+	}
+}
+
+func TestGetShutdownTimeout(t *testing.T) {
+	c := &Config{}
+	if got := c.GetShutdownTimeout(); got != DefaultShutdownTimeout*time.Second {
+		t.Fatalf("expected default shutdown timeout, got %s", got)
+	}
+	c.ShutdownTimeout = 5
+	if got := c.GetShutdownTimeout(); got != 5*time.Second {
+		t.Fatalf("expected 5s shutdown timeout, got %s", got)
+	}
+}
+
+func TestGetMaxBlocksBehind(t *testing.T) {
+	var m *Monitor
+	if got := m.GetMaxBlocksBehind(); got != DefaultMaxBlocksBehind {
+		t.Fatalf("expected default max blocks behind, got %d", got)
+	}
+	m = &Monitor{MaxBlocksBehind: 20}
+	if got := m.GetMaxBlocksBehind(); got != 20 {
+		t.Fatalf("expected 20 max blocks behind, got %d", got)
+	}
+}
+
+func TestGetMetadataParse(t *testing.T) {
+	c := &Config{}
+	if got := c.GetMetadataParse(); len(got.NameTags) != 1 || got.NameTags[0] != "name" {
+		t.Fatalf("expected default name tags, got %+v", got.NameTags)
+	}
+	c.MetadataParse = &MetadataParse{NameTags: []string{"title"}}
+	got := c.GetMetadataParse()
+	if len(got.NameTags) != 1 || got.NameTags[0] != "title" {
+		t.Fatalf("expected configured name tags, got %+v", got.NameTags)
+	}
+	if len(got.TraitValueTags) != 1 || got.TraitValueTags[0] != "value" {
+		t.Fatalf("expected default trait value tags, got %+v", got.TraitValueTags)
+	}
+}
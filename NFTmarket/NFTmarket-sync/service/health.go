@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/transferindexer"
+)
+
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// SyncLag 单个同步服务的进度
+type SyncLag struct {
+	Chain        string `json:"chain"`
+	Indexer      string `json:"indexer"`
+	HeadBlock    uint64 `json:"head_block"` // 0表示尚未获取到最新区块
+	SyncedBlock  uint64 `json:"synced_block"`
+	BlocksBehind uint64 `json:"blocks_behind"`
+}
+
+// Readiness readiness检查结果
+type Readiness struct {
+	Ready   bool      `json:"ready"`
+	Role    string    `json:"role"`
+	Reasons []string  `json:"reasons,omitempty"`
+	Lags    []SyncLag `json:"lags"`
+}
+
+// SyncLags 返回所有订单簿和Transfer同步服务的进度
+func (s *Service) SyncLags() []SyncLag {
+	var lags []SyncLag
+	for _, cs := range s.chains {
+		for _, indexer := range cs.orderbookIndexers {
+			health := indexer.Health()
+			lags = append(lags, SyncLag{
+				Chain:        cs.chain,
+				Indexer:      "orderbook:" + health.DexAddress,
+				HeadBlock:    health.HeadBlock,
+				SyncedBlock:  health.LastSyncBlock,
+				BlocksBehind: health.BlocksBehind(),
+			})
+		}
+		head, synced := cs.transferIndexer.SyncProgress()
+		lags = append(lags, SyncLag{
+			Chain:        cs.chain,
+			Indexer:      transferindexer.IndexerLabel,
+			HeadBlock:    head,
+			SyncedBlock:  synced,
+			BlocksBehind: comm.BlocksBehind(head, synced),
+		})
+	}
+	return lags
+}
+
+// Readiness 检查是否可以对外提供服务
+// follower不运行同步，始终就绪；leader或未启用选举时，任一同步服务尚未获取到最新区块或落后超过阈值时未就绪
+func (s *Service) Readiness() Readiness {
+	lags := s.SyncLags()
+	if !s.leader.IsLeader() {
+		return Readiness{Ready: true, Role: RoleFollower, Lags: lags}
+	}
+	reasons := checkLags(lags, s.config.Monitor.GetMaxBlocksBehind())
+	return Readiness{Ready: len(reasons) == 0, Role: RoleLeader, Reasons: reasons, Lags: lags}
+}
+
+// checkLags 返回未就绪的原因
+func checkLags(lags []SyncLag, maxBlocksBehind uint64) []string {
+	var reasons []string
+	for _, lag := range lags {
+		if lag.HeadBlock == 0 {
+			reasons = append(reasons, fmt.Sprintf("%s/%s: head block unknown", lag.Chain, lag.Indexer))
+			continue
+		}
+		if lag.BlocksBehind > maxBlocksBehind {
+			reasons = append(reasons, fmt.Sprintf("%s/%s: %d blocks behind, max %d",
+				lag.Chain, lag.Indexer, lag.BlocksBehind, maxBlocksBehind))
+		}
+	}
+	return reasons
+}
+
+// HealthHandler 健康检查和监控指标
+// /healthz 进程存活即返回200，附带后台协程状态
+// /readyz 未就绪时返回503
+// /metrics Prometheus指标
+func (s *Service) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "ok",
+			"loops":  s.LoopStatus(),
+		})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness := s.Readiness()
+		code := http.StatusOK
+		if !readiness.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, readiness)
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func TestCheckLags(t *testing.T) {
+	lags := []SyncLag{
+		{Chain: "eth", Indexer: "orderbook:0xa", HeadBlock: 1000, SyncedBlock: 999, BlocksBehind: 1},
+		{Chain: "eth", Indexer: "transfer", HeadBlock: 1000, SyncedBlock: 800, BlocksBehind: 200},
+		{Chain: "sepolia", Indexer: "orderbook:0xb"},
+	}
+	reasons := checkLags(lags, 100)
+	if len(reasons) != 2 {
+		t.Fatalf("expected 2 reasons, got %v", reasons)
+	}
+	if !strings.Contains(reasons[0], "eth/transfer: 200 blocks behind") {
+		t.Fatalf("unexpected lag reason: %s", reasons[0])
+	}
+	if !strings.Contains(reasons[1], "sepolia/orderbook:0xb: head block unknown") {
+		t.Fatalf("unexpected head reason: %s", reasons[1])
+	}
+	if reasons := checkLags(lags[:1], 100); len(reasons) != 0 {
+		t.Fatalf("expected ready, got %v", reasons)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	s := &Service{
+		config: &config.Config{Monitor: &config.Monitor{}},
+		loops:  lifecycle.NewGroup(),
+	}
+	handler := s.HealthHandler()
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var readiness Readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("failed on decode readiness: %v", err)
+	}
+	if !readiness.Ready || readiness.Role != RoleLeader {
+		t.Fatalf("unexpected readiness: %+v", readiness)
+	}
+}
@@ -0,0 +1,313 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/retry"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	BackfillWindow     = 2000 // 每个任务的初始区块数
+	MinBackfillWindow  = 1
+	BackfillWorkers    = 4
+	BackfillRetryLimit = 5
+)
+
+// 节点对查询结果数量或区块范围的限制错误
+var tooManyResultsErrors = []string{
+	"too many",
+	"query returned more than",
+	"limit exceeded",
+	"response size",
+	"block range",
+}
+
+type BackfillOptions struct {
+	From    uint64 // 起始区块，为0时从同步进度开始
+	To      uint64 // 结束区块，为0时同步到当前安全区块
+	Workers int    // 并发拉取日志的任务数
+	Window  uint64 // 每个任务的初始区块数
+}
+
+type backfillChunk struct {
+	index int
+	from  uint64
+	to    uint64
+}
+
+type backfillResult struct {
+	chunk backfillChunk
+	logs  []interface{}
+	err   error
+}
+
+// Backfill 并发拉取区间内的订单簿日志，按区块顺序处理，完成后将同步进度推进到结束区块之后
+// 起始区块不能早于同步进度之前MaxReorgDepth个区块，启用leader选举时需要先持有租约
+func (s *Service) Backfill(opts BackfillOptions) error {
+	if !s.leader.IsLeader() {
+		return errors.New("backfill requires the sync leader lease")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = BackfillWorkers
+	}
+	if opts.Window == 0 {
+		opts.Window = BackfillWindow
+	}
+	checkpoint, err := s.ensureCheckpoint(opts.From)
+	if err != nil {
+		return err
+	}
+	if opts.From == 0 {
+		opts.From = checkpoint
+	}
+	if opts.To == 0 {
+		currentBlockNum, err := s.chainClient.BlockNumber()
+		if err != nil {
+			return errors.Wrap(err, "failed on get current block number")
+		}
+		opts.To = currentBlockNum - MultiChainMaxBlockDifference[s.chain]
+	}
+	if opts.From > opts.To {
+		return errors.Errorf("invalid backfill range, from: %d, to: %d", opts.From, opts.To)
+	}
+	if opts.From > checkpoint {
+		return errors.Errorf("backfill from %d leaves a gap after checkpoint %d", opts.From, checkpoint)
+	}
+	// 超过重组深度的已处理日志已被清理，无法去重，重新处理会重复扣减订单数量并重复发送事件
+	if checkpoint > MaxReorgDepth && opts.From < checkpoint-MaxReorgDepth {
+		return errors.Errorf("backfill from %d is more than %d blocks behind checkpoint %d, processed logs are no longer kept",
+			opts.From, MaxReorgDepth, checkpoint)
+	}
+
+	xzap.WithContext(s.ctx).Info("backfill orderbook event start",
+		zap.Uint64("from", opts.From), zap.Uint64("to", opts.To),
+		zap.Int("workers", opts.Workers), zap.Uint64("window", opts.Window))
+
+	// 切分任务
+	var chunks []backfillChunk
+	for start := opts.From; start <= opts.To; start += opts.Window {
+		end := start + opts.Window - 1
+		if end > opts.To {
+			end = opts.To
+		}
+		chunks = append(chunks, backfillChunk{index: len(chunks), from: start, to: end})
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	// 限制已拉取但未处理的任务数量
+	inflight := make(chan struct{}, opts.Workers*2)
+	tasks := make(chan backfillChunk)
+	results := make(chan backfillResult, opts.Workers)
+	go func() {
+		defer close(tasks)
+		for _, chunk := range chunks {
+			select {
+			case inflight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case tasks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range tasks {
+				logs, err := s.fetchLogsAdaptive(ctx, chunk.from, chunk.to)
+				select {
+				case results <- backfillResult{chunk: chunk, logs: logs, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 按区块顺序合并处理
+	pending := make(map[int]backfillResult)
+	next := 0
+	for result := range results {
+		if result.err != nil {
+			return errors.Wrapf(result.err, "failed on fetch logs, from: %d, to: %d", result.chunk.from, result.chunk.to)
+		}
+		pending[result.chunk.index] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if err := s.backfillChunk(ready); err != nil {
+				return errors.Wrapf(err, "failed on handle logs, from: %d, to: %d", ready.chunk.from, ready.chunk.to)
+			}
+			<-inflight
+			next++
+			xzap.WithContext(s.ctx).Info("backfill orderbook event ...",
+				zap.Uint64("start_block", ready.chunk.from),
+				zap.Uint64("end_block", ready.chunk.to),
+				zap.Int("logs", len(ready.logs)))
+		}
+	}
+	if next != len(chunks) {
+		return errors.Wrap(ctx.Err(), "backfill interrupted")
+	}
+
+	// 推进同步进度，交给实时同步继续
+	nextBlock := opts.To + 1
+	if checkpoint > nextBlock {
+		nextBlock = checkpoint
+	}
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		return s.updateCheckpoint(tx, nextBlock)
+	}); err != nil {
+		return errors.Wrap(err, "failed on update orderbook event sync block number")
+	}
+
+	xzap.WithContext(s.ctx).Info("backfill orderbook event done",
+		zap.Uint64("from", opts.From), zap.Uint64("to", opts.To),
+		zap.Uint64("next_block", nextBlock))
+	return nil
+}
+
+// ensureCheckpoint 读取当前合约的同步进度
+// 不存在时接管旧版本按链记录的进度，否则以from或配置的起始区块创建
+func (s *Service) ensureCheckpoint(from uint64) (uint64, error) {
+	var indexedStatus base.IndexedStatus
+	err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ? and contract_address = ?", s.chainId, EventIndexType, s.contractAddress()).
+		First(&indexedStatus).Error
+	if err == nil {
+		return uint64(indexedStatus.LastIndexedBlock), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.Wrap(err, "failed on get orderbook index status")
+	}
+
+	// 接管未记录合约地址的旧进度
+	result := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ? and contract_address = ''", s.chainId, EventIndexType).
+		Limit(1).
+		Update("contract_address", s.contractAddress())
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "failed on claim orderbook index status")
+	}
+	if result.RowsAffected > 0 {
+		return s.ensureCheckpoint(from)
+	}
+
+	if from == 0 {
+		from = s.cfg.ContractCfg.StartBlock
+	}
+	if from == 0 {
+		return 0, errors.New("orderbook index status not found, start block is required")
+	}
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).Create(&base.IndexedStatus{
+		ChainId:          int(s.chainId),
+		LastIndexedBlock: int64(from),
+		IndexType:        EventIndexType,
+		ContractAddress:  s.contractAddress(),
+	}).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on create orderbook index status")
+	}
+	return from, nil
+}
+
+// backfillChunk 与同步区间一样校验日志与区块头属于同一条链，处理日志后记录有日志的区块和结束区块的hash
+func (s *Service) backfillChunk(result backfillResult) error {
+	endHeader, err := s.chainClient.BlockHeaderByNumber(s.ctx, new(big.Int).SetUint64(result.chunk.to))
+	if err != nil {
+		return errors.Wrap(err, "failed on get block header")
+	}
+	headers, err := s.windowHeaders(result.logs, endHeader)
+	if err != nil {
+		return err
+	}
+	if err := s.handleLogs(result.logs); err != nil {
+		return err
+	}
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		return s.recordIndexedBlocks(tx, headers)
+	})
+}
+
+// fetchLogsAdaptive 拉取区间内的日志，节点返回结果过多时缩小窗口，成功后逐步恢复
+func (s *Service) fetchLogsAdaptive(ctx context.Context, from, to uint64) ([]interface{}, error) {
+	var all []interface{}
+	window := to - from + 1
+	maxWindow := window
+	for start := from; start <= to; {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		end := start + window - 1
+		if end > to {
+			end = to
+		}
+		query := types.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []string{s.cfg.ContractCfg.DexAddress},
+		}
+		var logs []interface{}
+		var tooMany bool
+		err := retry.Retry(func(attempt uint) error {
+			var err error
+			logs, err = s.chainClient.FilterLogs(ctx, query)
+			if err != nil && isTooManyResults(err) {
+				tooMany = true
+				return nil
+			}
+			return err
+		}, retry.Limit(BackfillRetryLimit), retry.Wait(time.Second, 2*time.Second, 4*time.Second, 8*time.Second))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on get log")
+		}
+		if tooMany {
+			if window <= MinBackfillWindow {
+				return nil, errors.Errorf("too many results in single block %d", start)
+			}
+			window /= 2
+			continue
+		}
+		all = append(all, logs...)
+		start = end + 1
+		if window < maxWindow {
+			window *= 2
+			if window > maxWindow {
+				window = maxWindow
+			}
+		}
+	}
+	return all, nil
+}
+
+func isTooManyResults(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range tooManyResultsErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
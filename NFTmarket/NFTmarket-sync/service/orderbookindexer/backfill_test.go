@@ -0,0 +1,147 @@
+package orderbookindexer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+// limitedChainClient 区间超过limit个区块时返回结果过多错误，每个区块返回一条日志
+type limitedChainClient struct {
+	chainclient.ChainClient
+	limit uint64
+}
+
+func (c *limitedChainClient) FilterLogs(ctx context.Context, q types.FilterQuery) ([]interface{}, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if to-from+1 > c.limit {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var logs []interface{}
+	for block := from; block <= to; block++ {
+		logs = append(logs, ethereumTypes.Log{BlockNumber: block})
+	}
+	return logs, nil
+}
+
+func TestFetchLogsAdaptive(t *testing.T) {
+	s := &Service{
+		ctx:         context.Background(),
+		cfg:         &config.Config{},
+		chainClient: &limitedChainClient{limit: 3},
+	}
+	logs, err := s.fetchLogsAdaptive(context.Background(), 100, 119)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logs) != 20 {
+		t.Fatalf("expected 20 logs, got %d", len(logs))
+	}
+	for i, log := range logs {
+		if log.(ethereumTypes.Log).BlockNumber != uint64(100+i) {
+			t.Fatalf("logs out of order at %d", i)
+		}
+	}
+}
+
+func TestIsTooManyResults(t *testing.T) {
+	if !isTooManyResults(errors.New("Log response size exceeded")) {
+		t.Errorf("expected response size error to be too many results")
+	}
+	if isTooManyResults(errors.New("connection refused")) {
+		t.Errorf("expected network error not to be too many results")
+	}
+}
+
+// TestBackfillRecordsBlockHashes 回补记录每个有日志的区块hash，重复回补同一区间不会重复处理日志
+func TestBackfillRecordsBlockHashes(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.chain.setHead(107)
+	opts := BackfillOptions{To: 105, Workers: 2, Window: 2}
+	if err := h.service.Backfill(opts); err != nil {
+		t.Fatalf("failed on backfill: %v", err)
+	}
+	activities := len(h.activities())
+
+	opts.From = replayStartBlock
+	if err := h.service.Backfill(opts); err != nil {
+		t.Fatalf("failed on backfill again: %v", err)
+	}
+	if got := len(h.activities()); got != activities {
+		t.Errorf("expected backfill to skip processed logs, activities: %d, want %d", got, activities)
+	}
+
+	// 分叉区块在回补的区间内，重组时定位到区间内的分叉点
+	h.chain.apply(loadReplayFixture(t, "lifecycle_reorg.json"))
+	forkBlock, reorged, err := h.service.detectReorg(106)
+	if err != nil || !reorged || forkBlock != 103 {
+		t.Errorf("expected reorg at fork block 103, got %d, %v, %v", forkBlock, reorged, err)
+	}
+}
+
+// TestBackfillCheckpoint 回补不会使同步进度倒退，起始区块早于保留的已处理日志时拒绝回补
+func TestBackfillCheckpoint(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.chain.setHead(107)
+	checkpoint := func() int64 {
+		var status base.IndexedStatus
+		if err := h.db.Table(base.IndexedStatusTableName()).First(&status).Error; err != nil {
+			t.Fatalf("failed on get index status: %v", err)
+		}
+		return status.LastIndexedBlock
+	}
+	if _, err := h.service.ensureCheckpoint(replayStartBlock); err != nil {
+		t.Fatalf("failed on create checkpoint: %v", err)
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return h.service.updateCheckpoint(tx, 1050)
+	}); err != nil {
+		t.Fatalf("failed on update checkpoint: %v", err)
+	}
+
+	if err := h.service.Backfill(BackfillOptions{From: replayStartBlock, To: 105, Workers: 2, Window: 2}); err != nil {
+		t.Fatalf("failed on backfill: %v", err)
+	}
+	if got := checkpoint(); got != 1050 {
+		t.Errorf("expected checkpoint to stay at 1050, got %d", got)
+	}
+	// 回补中处理的日志不会使同步进度倒退
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return h.service.updateCheckpoint(tx, 103)
+	}); err != nil {
+		t.Fatalf("failed on update checkpoint: %v", err)
+	}
+	if got := checkpoint(); got != 1050 {
+		t.Errorf("expected checkpoint to only move forward, got %d", got)
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return h.service.updateCheckpoint(tx, 1200)
+	}); err != nil {
+		t.Fatalf("failed on update checkpoint: %v", err)
+	}
+	err := h.service.Backfill(BackfillOptions{From: replayStartBlock, To: 105})
+	if err == nil || !strings.Contains(err.Error(), "processed logs are no longer kept") {
+		t.Errorf("expected backfill behind processed logs to be refused, got %v", err)
+	}
+
+	// 重组回滚时重置同步进度
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return h.service.resetCheckpoint(tx, 104)
+	}); err != nil {
+		t.Fatalf("failed on reset checkpoint: %v", err)
+	}
+	if got := checkpoint(); got != 104 {
+		t.Errorf("expected checkpoint reset to 104, got %d", got)
+	}
+}
@@ -0,0 +1,43 @@
+package orderbookindexer
+
+import (
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// newMarketEvent 根据日志位置生成市场事件
+func (s *Service) newMarketEvent(log ethereumTypes.Log, eventType eventsink.EventType, blockTime int64) *eventsink.Event {
+	return &eventsink.Event{
+		Version:         eventsink.Version,
+		Type:            eventType,
+		ChainId:         s.chainId,
+		Chain:           s.chain,
+		ContractAddress: s.contractAddress(),
+		BlockNumber:     log.BlockNumber,
+		BlockTime:       blockTime,
+		TxHash:          log.TxHash.String(),
+		LogIndex:        log.Index,
+	}
+}
+
+// addMarketEvents 通过发件箱发布市场事件，未配置事件发布时忽略
+func (s *Service) addMarketEvents(tx *gorm.DB, events ...*eventsink.Event) error {
+	if s.eventSink == nil {
+		return nil
+	}
+	for _, event := range events {
+		event.CollectionAddress = strings.ToLower(event.CollectionAddress)
+		event.Maker = strings.ToLower(event.Maker)
+		event.Taker = strings.ToLower(event.Taker)
+		event.From = strings.ToLower(event.From)
+		event.To = strings.ToLower(event.To)
+		if err := s.addOutbox(tx, multi.OutboxMarketEvent, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package orderbookindexer
+
+import (
+	"container/list"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	HeaderCacheSize = 4096 // 缓存的区块头数量
+	HeaderBatchSize = 100  // 每次批量请求的区块头数量
+)
+
+// headerCache 按区块高度索引的区块头LRU缓存，所有事件处理共用
+type headerCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[uint64]*list.Element
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[uint64]*list.Element),
+	}
+}
+
+func (c *headerCache) get(blockNumber uint64) (*types.BlockHeader, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[blockNumber]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*types.BlockHeader), true
+}
+
+func (c *headerCache) add(header *types.BlockHeader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[header.Number]; ok {
+		elem.Value = header
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[header.Number] = c.ll.PushFront(header)
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*types.BlockHeader).Number)
+	}
+}
+
+func (c *headerCache) remove(blockNumber uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[blockNumber]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, blockNumber)
+	}
+}
+
+// removeFrom 删除不低于该高度的区块头，链重组回滚后调用
+func (c *headerCache) removeFrom(blockNumber uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for number, elem := range c.items {
+		if number >= blockNumber {
+			c.ll.Remove(elem)
+			delete(c.items, number)
+		}
+	}
+}
+
+// prefetchHeaders 批量获取日志所在区块的区块头，任一区块头获取失败或与日志的区块hash不一致时
+// 返回错误，整个区间在处理任何日志之前失败并重试
+func (s *Service) prefetchHeaders(logs []interface{}) error {
+	var missing []uint64
+	seen := make(map[uint64]bool)
+	for _, l := range logs {
+		ethLog := l.(ethereumTypes.Log)
+		if seen[ethLog.BlockNumber] {
+			continue
+		}
+		seen[ethLog.BlockNumber] = true
+		if _, ok := s.headers.get(ethLog.BlockNumber); !ok {
+			missing = append(missing, ethLog.BlockNumber)
+		}
+	}
+
+	for i := 0; i < len(missing); i += HeaderBatchSize {
+		end := i + HeaderBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		headers, err := s.chainClient.BlockHeadersByNumbers(s.ctx, missing[i:end])
+		if err != nil {
+			return errors.Wrap(err, "failed on get block headers")
+		}
+		for _, header := range headers {
+			s.headers.add(header)
+		}
+	}
+
+	// 缓存的区块头可能已被重组替换，hash不一致时丢弃并重试区间
+	for _, l := range logs {
+		ethLog := l.(ethereumTypes.Log)
+		header, ok := s.headers.get(ethLog.BlockNumber)
+		if !ok {
+			return errors.Errorf("block header %d not fetched", ethLog.BlockNumber)
+		}
+		if !strings.EqualFold(header.Hash, ethLog.BlockHash.String()) {
+			s.headers.remove(ethLog.BlockNumber)
+			return errors.Wrapf(errBlockHashChanged, "block: %d, header: %s, log: %s",
+				ethLog.BlockNumber, header.Hash, ethLog.BlockHash.String())
+		}
+	}
+	return nil
+}
+
+// blockTime 获取区块时间，优先使用缓存的区块头
+func (s *Service) blockTime(blockNumber uint64) (uint64, error) {
+	if header, ok := s.headers.get(blockNumber); ok {
+		return header.Time, nil
+	}
+	header, err := s.chainClient.BlockHeaderByNumber(s.ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get block header")
+	}
+	s.headers.add(header)
+	return header.Time, nil
+}
@@ -0,0 +1,105 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// headerChainClient 按区块高度生成区块头，记录批量请求，fail中的区块返回错误
+type headerChainClient struct {
+	chainclient.ChainClient
+	fail    map[uint64]bool
+	batches [][]uint64
+}
+
+func (c *headerChainClient) BlockHeadersByNumbers(ctx context.Context, blockNums []uint64) ([]*types.BlockHeader, error) {
+	c.batches = append(c.batches, blockNums)
+	var headers []*types.BlockHeader
+	for _, blockNum := range blockNums {
+		if c.fail[blockNum] {
+			return nil, errors.Errorf("block %d unavailable", blockNum)
+		}
+		headers = append(headers, &types.BlockHeader{
+			Number: blockNum,
+			Hash:   common.BigToHash(common.Big1).String(),
+			Time:   blockNum * 10,
+		})
+	}
+	return headers, nil
+}
+
+func TestHeaderCacheEvict(t *testing.T) {
+	c := newHeaderCache(2)
+	c.add(&types.BlockHeader{Number: 1})
+	c.add(&types.BlockHeader{Number: 2})
+	c.get(1)
+	c.add(&types.BlockHeader{Number: 3})
+	if _, ok := c.get(2); ok {
+		t.Errorf("expected least recently used header to be evicted")
+	}
+	if _, ok := c.get(1); !ok {
+		t.Errorf("expected recently used header to be kept")
+	}
+
+	c.removeFrom(3)
+	if _, ok := c.get(3); ok {
+		t.Errorf("expected header above fork block to be removed")
+	}
+}
+
+func TestPrefetchHeaders(t *testing.T) {
+	client := &headerChainClient{}
+	s := &Service{
+		ctx:         context.Background(),
+		chainClient: client,
+		headers:     newHeaderCache(HeaderCacheSize),
+	}
+	hash := common.BigToHash(common.Big1)
+	logs := []interface{}{
+		ethereumTypes.Log{BlockNumber: 100, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 100, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 101, BlockHash: hash},
+	}
+	if err := s.prefetchHeaders(logs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.batches) != 1 || len(client.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 distinct blocks, got %v", client.batches)
+	}
+	blockTime, err := s.blockTime(101)
+	if err != nil || blockTime != 1010 {
+		t.Errorf("expected cached block time 1010, got %d, %v", blockTime, err)
+	}
+
+	// 已缓存的区块不再请求
+	if err := s.prefetchHeaders(logs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.batches) != 1 {
+		t.Errorf("expected cached headers to be reused")
+	}
+
+	// 任一区块头失败时整个区间失败
+	client.fail = map[uint64]bool{103: true}
+	logs = append(logs,
+		ethereumTypes.Log{BlockNumber: 102, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 103, BlockHash: hash})
+	if err := s.prefetchHeaders(logs); err == nil {
+		t.Errorf("expected header failure to fail the window")
+	}
+
+	// 区块hash与日志不一致时失败并丢弃缓存
+	logs = []interface{}{ethereumTypes.Log{BlockNumber: 100, BlockHash: common.BigToHash(common.Big2)}}
+	if err := s.prefetchHeaders(logs); err == nil {
+		t.Errorf("expected hash mismatch to fail the window")
+	}
+	if _, ok := s.headers.get(100); ok {
+		t.Errorf("expected mismatched header to be removed from cache")
+	}
+}
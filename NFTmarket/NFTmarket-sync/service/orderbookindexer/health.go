@@ -0,0 +1,87 @@
+package orderbookindexer
+
+import (
+	"time"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+// Health 单个订单簿合约部署的同步状态
+type Health struct {
+	Chain             string    `json:"chain"`
+	ChainId           int64     `json:"chain_id"`
+	DexAddress        string    `json:"dex_address"`
+	HeadBlock         uint64    `json:"head_block"` // 节点返回的最新区块，0表示尚未获取到
+	LastSyncBlock     uint64    `json:"last_sync_block"`
+	LastSyncTime      time.Time `json:"last_sync_time"`
+	LastError         string    `json:"last_error"`
+	LastErrorTime     time.Time `json:"last_error_time"`
+	ConsecutiveErrors int       `json:"consecutive_errors"`
+	Live              bool      `json:"live"` // websocket订阅是否连接，断开时按轮询同步
+}
+
+// recordSyncError 记录同步失败，连续失败次数加一
+func (s *Service) recordSyncError(err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.LastError = err.Error()
+	s.health.LastErrorTime = time.Now()
+	s.health.ConsecutiveErrors++
+}
+
+// recordSyncSuccess 记录同步成功的区块，清零连续失败次数
+func (s *Service) recordSyncSuccess(block uint64) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.LastSyncBlock = block
+	s.health.LastSyncTime = time.Now()
+	s.health.ConsecutiveErrors = 0
+	comm.ObserveSync(s.chain, s.indexerLabel(), s.health.HeadBlock, block)
+}
+
+// recordCheckpoint 记录启动时加载的同步进度，checkpoint为下一个待同步的区块
+func (s *Service) recordCheckpoint(checkpoint uint64) {
+	if checkpoint == 0 {
+		return
+	}
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.LastSyncBlock = checkpoint - 1
+	comm.ObserveSync(s.chain, s.indexerLabel(), s.health.HeadBlock, s.health.LastSyncBlock)
+}
+
+// recordHead 记录节点返回的最新区块
+func (s *Service) recordHead(head uint64) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.HeadBlock = head
+	comm.ObserveSync(s.chain, s.indexerLabel(), head, s.health.LastSyncBlock)
+}
+
+// setLive 记录websocket订阅的连接状态
+func (s *Service) setLive(live bool) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.Live = live
+}
+
+// indexerLabel 监控指标中区分同一条链上的合约部署
+func (s *Service) indexerLabel() string {
+	return "orderbook:" + s.contractAddress()
+}
+
+// BlocksBehind 落后链上最新区块的数量
+func (h Health) BlocksBehind() uint64 {
+	return comm.BlocksBehind(h.HeadBlock, h.LastSyncBlock)
+}
+
+// Health 返回当前合约部署的同步状态
+func (s *Service) Health() Health {
+	s.healthMu.RLock()
+	defer s.healthMu.RUnlock()
+	health := s.health
+	health.Chain = s.chain
+	health.ChainId = s.chainId
+	health.DexAddress = s.contractAddress()
+	return health
+}
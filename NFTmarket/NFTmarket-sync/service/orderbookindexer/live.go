@@ -0,0 +1,105 @@
+package orderbookindexer
+
+import (
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum"
+	"go.uber.org/zap"
+)
+
+const (
+	LiveReconnectInterval = 5   // in seconds
+	LiveBufferSize        = 128 // 订阅通道的缓冲大小
+)
+
+// LiveTailLoop 订阅新区块头和订单簿合约日志，收到通知时立即唤醒同步循环。
+// 同步循环始终从检查点开始处理，订阅断开期间按SleepInterval轮询，
+// 重连后遗漏的区块会在下一轮同步中补齐
+func (s *Service) LiveTailLoop() {
+	var lastHead uint64
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.setLive(false)
+			return
+		default:
+		}
+
+		heads := make(chan *types.BlockHeader, LiveBufferSize)
+		logs := make(chan interface{}, LiveBufferSize)
+		sub, err := s.chainClient.Subscribe(s.ctx, types.FilterQuery{
+			Addresses: []string{s.cfg.ContractCfg.DexAddress},
+		}, heads, logs)
+		if err != nil {
+			xzap.WithContext(s.ctx).Warn("failed on subscribe orderbook, fallback to polling",
+				zap.String("chain", s.chain), zap.Error(err))
+			select {
+			case <-s.ctx.Done():
+			case <-time.After(LiveReconnectInterval * time.Second):
+			}
+			continue
+		}
+
+		s.setLive(true)
+		xzap.WithContext(s.ctx).Info("orderbook live tailing started", zap.String("chain", s.chain))
+		lastHead = s.tail(sub, heads, logs, lastHead)
+		s.setLive(false)
+	}
+}
+
+// tail 处理订阅通知直到订阅断开，返回最后收到的区块高度
+func (s *Service) tail(sub ethereum.Subscription, heads <-chan *types.BlockHeader, logs <-chan interface{}, lastHead uint64) uint64 {
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return lastHead
+		case err := <-sub.Err():
+			xzap.WithContext(s.ctx).Warn("orderbook subscription dropped, fallback to polling",
+				zap.String("chain", s.chain), zap.Error(err))
+			return lastHead
+		case header := <-heads:
+			// 重连期间遗漏的区块由同步循环从检查点补齐
+			if lastHead > 0 && header.Number > lastHead+1 {
+				xzap.WithContext(s.ctx).Info("gap in new heads, backfill missed blocks",
+					zap.String("chain", s.chain),
+					zap.Uint64("from_block", lastHead+1),
+					zap.Uint64("to_block", header.Number-1))
+			}
+			if header.Number > lastHead {
+				lastHead = header.Number
+			}
+			s.notify()
+		case <-logs:
+			// 被重组移除的日志同样唤醒同步循环，由重组检测回滚
+			s.notify()
+		}
+	}
+}
+
+// notify 唤醒同步循环，已有未处理的唤醒时忽略
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// waitNextBlock 等待下一次轮询，实时模式下收到新区块通知时提前返回
+func (s *Service) waitNextBlock() {
+	select {
+	case <-s.ctx.Done():
+	case <-s.wake:
+	case <-time.After(SleepInterval * time.Second):
+	}
+}
+
+// sleep 等待d，ctx取消时提前返回
+func (s *Service) sleep(d time.Duration) {
+	select {
+	case <-s.ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,66 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+// subscribeChainClient 每次订阅推送一个区块头后断开
+type subscribeChainClient struct {
+	chainclient.ChainClient
+	subscribed chan uint64
+	next       uint64
+}
+
+func (c *subscribeChainClient) Subscribe(ctx context.Context, q types.FilterQuery, heads chan<- *types.BlockHeader, logs chan<- interface{}) (ethereum.Subscription, error) {
+	c.next++
+	number := c.next * 10
+	c.subscribed <- number
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		heads <- &types.BlockHeader{Number: number}
+		select {
+		case <-quit:
+			return nil
+		case <-time.After(10 * time.Millisecond):
+			return errors.New("connection reset")
+		}
+	}), nil
+}
+
+func TestLiveTailReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(xzap.ToContext(context.Background(), zap.NewNop()))
+	defer cancel()
+	client := &subscribeChainClient{subscribed: make(chan uint64, 10)}
+	s := &Service{
+		ctx:         ctx,
+		cfg:         &config.Config{},
+		chainClient: client,
+		wake:        make(chan struct{}, 1),
+	}
+	go s.LiveTailLoop()
+
+	// 订阅断开后立即重新订阅
+	for i := 0; i < 2; i++ {
+		select {
+		case <-client.subscribed:
+		case <-time.After(time.Second):
+			t.Fatalf("expected subscription %d", i+1)
+		}
+	}
+	select {
+	case <-s.wake:
+	case <-time.After(time.Second):
+		t.Fatalf("expected new head to wake the sync loop")
+	}
+}
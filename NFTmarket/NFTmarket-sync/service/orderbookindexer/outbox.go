@@ -0,0 +1,135 @@
+package orderbookindexer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxBatchSize     = 100
+	OutboxRelayInterval = 1 // in seconds
+	// 投递失败后按指数退避重试的最大间隔，消息在投递成功之前一直保留在发件箱中
+	MaxOutboxBackoff = 60 // in seconds
+)
+
+// addOutbox 在事务中写入一条待投递的redis消息或市场事件
+func (s *Service) addOutbox(tx *gorm.DB, messageType int, message interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal outbox message")
+	}
+	if err := tx.Table(multi.OutboxTableName(s.chain)).Create(&multi.Outbox{
+		MessageType: messageType,
+		Payload:     string(payload),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on create outbox message")
+	}
+	return nil
+}
+
+// 投递发件箱消息到redis和事件流
+// 投递失败时按指数退避重试，不丢弃消息；redis恢复后按原顺序继续投递
+func (s *Service) OutboxRelayLoop() {
+	failures := 0 // 队首消息连续投递失败的次数
+	for {
+		if s.ctx.Err() != nil {
+			xzap.WithContext(s.ctx).Info("OutboxRelayLoop stopped due to context cancellation")
+			return
+		}
+
+		relayed, err := s.relayOutboxBatch()
+		if err != nil {
+			if relayed > 0 {
+				failures = 0
+			}
+			failures++
+			backoff := outboxBackoff(failures)
+			xzap.WithContext(s.ctx).Error("failed on relay outbox message, retry later",
+				zap.Int("attempts", failures), zap.Duration("backoff", backoff), zap.Error(err))
+			s.sleep(backoff)
+			continue
+		}
+		failures = 0
+		if relayed == 0 {
+			s.sleep(OutboxRelayInterval * time.Second)
+		}
+	}
+}
+
+// relayOutboxBatch 按id顺序投递一批消息，投递成功的消息从发件箱删除
+// 某条消息投递失败时停止本轮投递以保证消息顺序，返回已投递的数量和错误
+func (s *Service) relayOutboxBatch() (int, error) {
+	var messages []multi.Outbox
+	if err := s.db.WithContext(s.ctx).Table(multi.OutboxTableName(s.chain)).
+		Order("id asc").
+		Limit(OutboxBatchSize).
+		Find(&messages).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get outbox messages")
+	}
+
+	for i, message := range messages {
+		// 每条消息投递前确认仍是leader，租约过期后不再向redis和事件流写入
+		if err := s.leader.Check(s.ctx); err != nil {
+			return i, errors.Wrap(err, "refuse to relay outbox message")
+		}
+		if err := s.relayOutbox(&message); err != nil {
+			return i, errors.Wrapf(err, "failed on relay outbox message, id: %d", message.Id)
+		}
+		// 删除失败时消息会被再次投递，下游需要容忍重复
+		if err := s.db.WithContext(s.ctx).Table(multi.OutboxTableName(s.chain)).
+			Where("id = ?", message.Id).
+			Delete(&multi.Outbox{}).Error; err != nil {
+			return i, errors.Wrapf(err, "failed on delete outbox message, id: %d", message.Id)
+		}
+	}
+	return len(messages), nil
+}
+
+// outboxBackoff 第failures次投递失败后的重试间隔，从OutboxRelayInterval开始翻倍，不超过MaxOutboxBackoff
+func outboxBackoff(failures int) time.Duration {
+	backoff := OutboxRelayInterval * time.Second
+	for i := 1; i < failures && backoff < MaxOutboxBackoff*time.Second; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxOutboxBackoff*time.Second {
+		backoff = MaxOutboxBackoff * time.Second
+	}
+	return backoff
+}
+
+// relayOutbox 将单条消息推送到对应的redis队列或事件流
+func (s *Service) relayOutbox(message *multi.Outbox) error {
+	switch message.MessageType {
+	case multi.OutboxOrder:
+		var order multi.Order
+		if err := json.Unmarshal([]byte(message.Payload), &order); err != nil {
+			return errors.Wrap(err, "failed on unmarshal order")
+		}
+		return s.orderManager.AddToOrderManagerQueue(&order)
+	case multi.OutboxTradeEvent:
+		var event ordermanager.TradeEvent
+		if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+			return errors.Wrap(err, "failed on unmarshal trade event")
+		}
+		return ordermanager.AddUpdatePriceEvent(s.kv, &event, s.chain)
+	case multi.OutboxMarketEvent:
+		if s.eventSink == nil {
+			return nil
+		}
+		var event eventsink.Event
+		if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+			return errors.Wrap(err, "failed on unmarshal market event")
+		}
+		return s.eventSink.Publish(s.ctx, &event)
+	default:
+		return errors.Errorf("unknown outbox message type: %d", message.MessageType)
+	}
+}
@@ -0,0 +1,112 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// failingSink 前fail次发布返回错误，之后记录发布的事件
+type failingSink struct {
+	fail      int
+	published []*eventsink.Event
+}
+
+func (s *failingSink) Publish(ctx context.Context, events ...*eventsink.Event) error {
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("redis unavailable")
+	}
+	s.published = append(s.published, events...)
+	return nil
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, backoff := range want {
+		if got := outboxBackoff(i + 1); got != backoff {
+			t.Errorf("backoff after %d failures: %s, want %s", i+1, got, backoff)
+		}
+	}
+	if got := outboxBackoff(100); got != MaxOutboxBackoff*time.Second {
+		t.Errorf("expected backoff to be capped, got %s", got)
+	}
+}
+
+// TestRelayOutboxKeepsFailedMessage 投递失败的消息保留在发件箱中，恢复后按顺序投递
+func TestRelayOutboxKeepsFailedMessage(t *testing.T) {
+	h := newReplayHarness(t)
+	sink := &failingSink{fail: 20}
+	h.service.eventSink = sink
+	for _, eventType := range []eventsink.EventType{eventsink.OrderCreated, eventsink.OrderCancelled} {
+		if err := h.service.addOutbox(h.db, multi.OutboxMarketEvent, &eventsink.Event{Type: eventType}); err != nil {
+			t.Fatalf("failed on add outbox: %v", err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		if relayed, err := h.service.relayOutboxBatch(); err == nil || relayed != 0 {
+			t.Fatalf("expected relay to fail, relayed: %d, err: %v", relayed, err)
+		}
+	}
+	var count int64
+	if err := h.db.Table(multi.OutboxTableName(replayChain)).Count(&count).Error; err != nil {
+		t.Fatalf("failed on count outbox: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected failed messages to stay in outbox, got %d", count)
+	}
+
+	relayed, err := h.service.relayOutboxBatch()
+	if err != nil || relayed != 2 {
+		t.Fatalf("expected 2 messages relayed, got %d, %v", relayed, err)
+	}
+	if len(sink.published) != 2 || sink.published[0].Type != eventsink.OrderCreated || sink.published[1].Type != eventsink.OrderCancelled {
+		t.Errorf("unexpected published events: %+v", sink.published)
+	}
+}
+
+// TestRelayOutboxFenced 租约过期并有新leader当选后，旧leader不再投递发件箱消息
+func TestRelayOutboxFenced(t *testing.T) {
+	h := newReplayHarness(t)
+	sink := &failingSink{}
+	h.service.eventSink = sink
+	if err := h.service.addOutbox(h.db, multi.OutboxMarketEvent, &eventsink.Event{Type: eventsink.OrderCreated}); err != nil {
+		t.Fatalf("failed on add outbox: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	kv := xkv.NewStore([]cache.NodeConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: "node"}, Weight: 100}})
+	old := xkv.NewLeader(kv, "sync", "old", time.Second)
+	if _, ok, err := old.TryAcquire(context.Background()); err != nil || !ok {
+		t.Fatalf("failed on acquire leader: %v, %v", ok, err)
+	}
+	h.service.leader = old
+	mr.FastForward(2 * time.Second)
+	if _, ok, err := xkv.NewLeader(kv, "sync", "new", time.Second).TryAcquire(context.Background()); err != nil || !ok {
+		t.Fatalf("failed on acquire new leader: %v, %v", ok, err)
+	}
+
+	relayed, err := h.service.relayOutboxBatch()
+	if !errors.Is(err, xkv.ErrLeaseLost) || relayed != 0 {
+		t.Fatalf("expected relay to be fenced, relayed: %d, err: %v", relayed, err)
+	}
+	if len(sink.published) != 0 {
+		t.Errorf("expected no events published by old leader, got %d", len(sink.published))
+	}
+	var count int64
+	if err := h.db.Table(multi.OutboxTableName(replayChain)).Count(&count).Error; err != nil {
+		t.Fatalf("failed on count outbox: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected message to stay in outbox for new leader, got %d", count)
+	}
+}
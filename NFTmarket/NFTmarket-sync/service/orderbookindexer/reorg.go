@@ -0,0 +1,158 @@
+package orderbookindexer
+
+import (
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+const (
+	MaxReorgDepth       = comm.MaxReorgDepth       // 保留区块hash和回滚日志的区块深度
+	MaxForkSearchBlocks = comm.MaxForkSearchBlocks // 查找分叉点时最多比较的已索引区块数量
+)
+
+// errBlockHashChanged 查询区间期间区块hash发生变化，稍后重试
+var errBlockHashChanged = comm.ErrBlockHashChanged
+
+// detectReorg 检测链重组，返回分叉点区块高度和是否发生了重组
+func (s *Service) detectReorg(startBlock uint64) (uint64, bool, error) {
+	return s.journal.DetectReorg(startBlock)
+}
+
+// rollbackTo 将订单、活动和item owner回滚到分叉点，并向ordermanager发送补偿的地板价事件
+func (s *Service) rollbackTo(forkBlock uint64) error {
+	var events []*ordermanager.TradeEvent
+	err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		// 倒序恢复分叉点之后的回滚日志，删除回滚日志和区块hash
+		var err error
+		events, err = s.journal.Rollback(tx, forkBlock)
+		if err != nil {
+			return err
+		}
+		// 同一条链的多个合约部署共用活动和事件表，只删除本合约分叉点之后交易产生的记录
+		forkTxs := tx.Table(multi.ProcessedLogTableName(s.chain)).
+			Select("tx_hash").
+			Where("contract_address = ? and block_number > ?", s.contractAddress(), forkBlock)
+		// 删除分叉点之后的活动
+		if err := tx.Table(multi.ActivityTableName(s.chain)).
+			Where("block_number > ? and tx_hash in (?)", forkBlock, forkTxs).
+			Delete(&multi.Activity{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete activities")
+		}
+		// 删除分叉点之后的事件记录
+		for table, model := range map[string]interface{}{
+			multi.OrderEditTableName(s.chain):       &multi.OrderEdit{},
+			multi.OrderSkipTableName(s.chain):       &multi.OrderSkip{},
+			multi.BatchMatchErrorTableName(s.chain): &multi.BatchMatchError{},
+			multi.ProtocolShareTableName(s.chain):   &multi.ProtocolShare{},
+		} {
+			if err := tx.Table(table).
+				Where("block_number > ? and tx_hash in (?)", forkBlock, forkTxs).
+				Delete(model).Error; err != nil {
+				return errors.Wrapf(err, "failed on delete %s", table)
+			}
+		}
+		// 删除分叉点之后的已处理日志，使其在新链上可以重新处理
+		if err := tx.Table(multi.ProcessedLogTableName(s.chain)).
+			Where("contract_address = ? and block_number > ?", s.contractAddress(), forkBlock).
+			Delete(&multi.ProcessedLog{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete processed logs")
+		}
+		// 发送补偿事件，使ordermanager中的地板价与回滚后的数据一致
+		for _, event := range events {
+			if err := s.addOutbox(tx, multi.OutboxTradeEvent, event); err != nil {
+				return err
+			}
+		}
+		// 重置同步进度
+		return s.resetCheckpoint(tx, forkBlock+1)
+	})
+	if err != nil {
+		return err
+	}
+	// 分叉点之后缓存的区块头已失效
+	s.headers.removeFrom(forkBlock + 1)
+
+	xzap.WithContext(s.ctx).Info("rollback orderbook to fork block",
+		zap.Uint64("fork_block", forkBlock),
+		zap.Int("compensating_events", len(events)))
+	return nil
+}
+
+// recordIndexedBlocks 记录已索引区块的hash，并清理超过重组深度的旧记录
+func (s *Service) recordIndexedBlocks(tx *gorm.DB, headers []*types.BlockHeader) error {
+	if err := s.journal.RecordBlocks(tx, headers); err != nil {
+		return err
+	}
+	var tip uint64
+	for _, header := range headers {
+		if header.Number > tip {
+			tip = header.Number
+		}
+	}
+	if tip <= MaxReorgDepth {
+		return nil
+	}
+	if err := tx.Table(multi.ProcessedLogTableName(s.chain)).
+		Where("contract_address = ? and block_number < ?", s.contractAddress(), tip-MaxReorgDepth).
+		Delete(&multi.ProcessedLog{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expired processed logs")
+	}
+	return nil
+}
+
+// addJournal 写入一条回滚日志
+func (s *Service) addJournal(tx *gorm.DB, journal *multi.IndexerJournal) error {
+	return s.journal.Add(tx, journal)
+}
+
+// journalOrderUpdate 查询订单当前状态并写入回滚日志，订单不存在时无需记录
+func (s *Service) journalOrderUpdate(tx *gorm.DB, log ethereumTypes.Log, orderId string) error {
+	return s.journal.OrderUpdated(tx, log.BlockNumber, log.TxHash.String(), orderId)
+}
+
+// journalItemOwner 查询item当前owner并写入回滚日志，item不存在时无需记录
+func (s *Service) journalItemOwner(tx *gorm.DB, log ethereumTypes.Log, collection, tokenId string) error {
+	return s.journal.ItemOwner(tx, log.BlockNumber, log.TxHash.String(), collection, tokenId)
+}
+
+// orderJournal 根据订单变更前的数据生成回滚日志
+func orderJournal(log ethereumTypes.Log, order *multi.Order) *multi.IndexerJournal {
+	return comm.OrderJournal(log.BlockNumber, log.TxHash.String(), order)
+}
+
+// windowHeaders 获取区间内有日志的区块和结束区块的区块头，用于记录区块hash
+// 有日志的区块头在结束区块头之后重新批量获取，与日志的区块hash不一致说明查询期间发生了重组，
+// 区间内的区块被替换而结束区块不变时也能发现
+func (s *Service) windowHeaders(logs []interface{}, endHeader *types.BlockHeader) ([]*types.BlockHeader, error) {
+	logHashes := make(map[uint64]string)
+	for _, l := range logs {
+		ethLog := l.(ethereumTypes.Log)
+		if hash, ok := logHashes[ethLog.BlockNumber]; ok && !strings.EqualFold(hash, ethLog.BlockHash.String()) {
+			return nil, errors.Wrapf(errBlockHashChanged, "block: %d", ethLog.BlockNumber)
+		}
+		logHashes[ethLog.BlockNumber] = ethLog.BlockHash.String()
+	}
+
+	headers, err := s.journal.VerifyHeaders(logHashes, endHeader)
+	if err != nil {
+		// 缓存的区块头可能已被重组替换
+		for number := range logHashes {
+			s.headers.remove(number)
+		}
+		return nil, err
+	}
+	for _, header := range headers {
+		s.headers.add(header)
+	}
+	return headers, nil
+}
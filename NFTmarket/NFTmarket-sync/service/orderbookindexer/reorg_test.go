@@ -0,0 +1,54 @@
+package orderbookindexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+func TestWindowHeaders(t *testing.T) {
+	client := &headerChainClient{}
+	s := &Service{
+		ctx:         context.Background(),
+		chainClient: client,
+		headers:     newHeaderCache(HeaderCacheSize),
+		journal:     comm.NewJournal(context.Background(), nil, client, replayChain, replayDexAddress),
+	}
+	hash := common.BigToHash(common.Big1)
+	endHeader := &types.BlockHeader{Number: 105, Hash: common.HexToHash("0x05").String()}
+	logs := []interface{}{
+		ethereumTypes.Log{BlockNumber: 101, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 101, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 103, BlockHash: hash},
+		ethereumTypes.Log{BlockNumber: 105, BlockHash: common.HexToHash("0x05")},
+	}
+	headers, err := s.windowHeaders(logs, endHeader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 有日志的区块和结束区块都需要记录
+	if len(headers) != 3 || headers[0].Number != 101 || headers[1].Number != 103 || headers[2] != endHeader {
+		t.Errorf("unexpected headers: %+v", headers)
+	}
+	if len(client.batches) != 1 || len(client.batches[0]) != 2 {
+		t.Errorf("expected one batch of 2 blocks, got %v", client.batches)
+	}
+
+	// 区间内的区块被重组，结束区块不变
+	logs = append(logs, ethereumTypes.Log{BlockNumber: 102, BlockHash: common.BigToHash(common.Big2)})
+	if _, err := s.windowHeaders(logs, endHeader); !errors.Is(err, errBlockHashChanged) {
+		t.Errorf("expected reorg inside window to be detected, got %v", err)
+	}
+
+	// 结束区块的日志来自另一条分叉
+	logs = []interface{}{ethereumTypes.Log{BlockNumber: 105, BlockHash: common.HexToHash("0x06")}}
+	if _, err := s.windowHeaders(logs, endHeader); !errors.Is(err, errBlockHashChanged) {
+		t.Errorf("expected logs from another fork to mismatch end header, got %v", err)
+	}
+}
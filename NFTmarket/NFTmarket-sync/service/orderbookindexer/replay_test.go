@@ -0,0 +1,227 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	replayCollection = "0xc011ec7000000000000000000000000000000010"
+	replayAlice      = "0xa11ce00000000000000000000000000000000001"
+	replayBob        = "0xb0b0000000000000000000000000000000000002"
+	replayCarol      = "0xca20100000000000000000000000000000000003"
+)
+
+type replayOrderState struct {
+	name              string
+	status            int
+	quantityRemaining int64
+}
+
+type replayActivity struct {
+	activityType int
+	tokenId      string
+}
+
+func (h *replayHarness) assertOrders(want []replayOrderState) {
+	h.t.Helper()
+	if count := h.orderCount(); count != int64(len(want)) {
+		h.t.Errorf("unexpected order count: %d, want %d", count, len(want))
+	}
+	for _, w := range want {
+		order := h.order(w.name)
+		if order.OrderStatus != w.status || order.QuantityRemaining != w.quantityRemaining {
+			h.t.Errorf("order %s: status %d, quantity_remaining %d, want status %d, quantity_remaining %d",
+				w.name, order.OrderStatus, order.QuantityRemaining, w.status, w.quantityRemaining)
+		}
+	}
+}
+
+func (h *replayHarness) assertActivities(want []replayActivity) {
+	h.t.Helper()
+	activities := h.activities()
+	if len(activities) != len(want) {
+		h.t.Fatalf("unexpected activity count: %d, want %d", len(activities), len(want))
+	}
+	for i, w := range want {
+		if activities[i].ActivityType != w.activityType || activities[i].TokenId != w.tokenId {
+			h.t.Errorf("activity %d: type %d, token %s, want type %d, token %s",
+				i, activities[i].ActivityType, activities[i].TokenId, w.activityType, w.tokenId)
+		}
+	}
+}
+
+func (h *replayHarness) assertOwners(want map[string]string) {
+	h.t.Helper()
+	for tokenId, owner := range want {
+		if got := h.owner(replayCollection, tokenId); got != owner {
+			h.t.Errorf("token %s owner: %s, want %s", tokenId, got, owner)
+		}
+	}
+}
+
+func (h *replayHarness) assertFloorPrice(want string) {
+	h.t.Helper()
+	floorPrices, err := h.service.QueryCollectionsFloorPrice()
+	if err != nil {
+		h.t.Fatalf("failed on query floor price: %v", err)
+	}
+	if len(floorPrices) != 1 {
+		h.t.Fatalf("unexpected floor price count: %d", len(floorPrices))
+	}
+	if !floorPrices[0].Price.Equal(decimal.RequireFromString(want)) {
+		h.t.Errorf("floor price: %s, want %s", floorPrices[0].Price, want)
+	}
+}
+
+// TestReplayOrderLifecycle 回放挂单、改价、部分成交、取消，再重组掉后两个区块
+func TestReplayOrderLifecycle(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.syncTo(105)
+
+	// 101: L1挂单token1，B1集合出价2个
+	// 102: L1改价为L2
+	// 103: L3挂单token2
+	// 104: alice把token2卖给B1，B1部分成交
+	// 105: bob取消B1
+	h.assertOrders([]replayOrderState{
+		{"L1", multi.OrderStatusCancelled, 1},
+		{"B1", multi.OrderStatusCancelled, 1},
+		{"L2", multi.OrderStatusActive, 1},
+		{"L3", multi.OrderStatusActive, 1},
+	})
+	h.assertActivities([]replayActivity{
+		{multi.Listing, "1"},
+		{multi.CollectionBid, "0"},
+		{multi.Listing, "1"},
+		{multi.Listing, "2"},
+		{multi.Sale, "2"},
+		{multi.CancelCollectionBid, "0"},
+	})
+	h.assertOwners(map[string]string{"1": replayAlice, "2": replayBob})
+	// L3的maker已不是token2的owner，不计入地板价
+	h.assertFloorPrice("800000000000000000")
+
+	var edits []multi.OrderEdit
+	if err := h.db.Table(multi.OrderEditTableName(replayChain)).Find(&edits).Error; err != nil {
+		t.Fatalf("failed on get order edits: %v", err)
+	}
+	if len(edits) != 1 || edits[0].OldOrderID != replayOrderId("L1") || edits[0].NewOrderID != replayOrderId("L2") {
+		t.Errorf("unexpected order edits: %+v", edits)
+	}
+
+	// 104之后的区块被重组: 104'中carol买下L2，106中carol挂单L4
+	h.reorg("lifecycle_reorg.json", 107)
+
+	h.assertOrders([]replayOrderState{
+		{"L1", multi.OrderStatusCancelled, 1},
+		{"B1", multi.OrderStatusActive, 2},
+		{"L2", multi.OrderStatusFilled, 0},
+		{"L3", multi.OrderStatusActive, 1},
+		{"L4", multi.OrderStatusActive, 1},
+	})
+	h.assertActivities([]replayActivity{
+		{multi.Listing, "1"},
+		{multi.CollectionBid, "0"},
+		{multi.Listing, "1"},
+		{multi.Listing, "2"},
+		{multi.Sale, "1"},
+		{multi.Listing, "1"},
+	})
+	h.assertOwners(map[string]string{"1": replayCarol, "2": replayAlice})
+	h.assertFloorPrice("900000000000000000")
+}
+
+// TestReplayReorgInsideWindow 一个区间同步多个区块后，重组替换了区间内的区块，回滚到区间内有日志的分叉点
+func TestReplayReorgInsideWindow(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.syncWindow(105)
+
+	// 104之后的区块被重组，分叉点103是上一个区间内有日志的区块
+	h.chain.apply(loadReplayFixture(t, "lifecycle_reorg.json"))
+	h.chain.setHead(107)
+	forkBlock, reorged, err := h.service.detectReorg(h.next)
+	if err != nil {
+		t.Fatalf("failed on detect reorg: %v", err)
+	}
+	if !reorged || forkBlock != 103 {
+		t.Errorf("fork block: %d, reorged: %v, want 103", forkBlock, reorged)
+	}
+
+	h.syncWindow(107)
+	h.assertOrders([]replayOrderState{
+		{"L1", multi.OrderStatusCancelled, 1},
+		{"B1", multi.OrderStatusActive, 2},
+		{"L2", multi.OrderStatusFilled, 0},
+		{"L3", multi.OrderStatusActive, 1},
+		{"L4", multi.OrderStatusActive, 1},
+	})
+	h.assertOwners(map[string]string{"1": replayCarol, "2": replayAlice})
+	h.assertFloorPrice("900000000000000000")
+}
+
+// TestReplayAfterProcessedLogsPruned 已处理日志被清理后重放同一段区块，订单和事件记录不会重复变更
+func TestReplayAfterProcessedLogsPruned(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.syncTo(105)
+
+	if err := h.db.Exec("delete from " + multi.ProcessedLogTableName(replayChain)).Error; err != nil {
+		t.Fatalf("failed on delete processed logs: %v", err)
+	}
+	h.next = replayStartBlock
+	h.syncWindow(105)
+
+	// B1在104只成交了1个，重放不会再次扣减剩余数量
+	h.assertOrders([]replayOrderState{
+		{"L1", multi.OrderStatusCancelled, 1},
+		{"B1", multi.OrderStatusCancelled, 1},
+		{"L2", multi.OrderStatusActive, 1},
+		{"L3", multi.OrderStatusActive, 1},
+	})
+	var edits int64
+	if err := h.db.Table(multi.OrderEditTableName(replayChain)).Count(&edits).Error; err != nil {
+		t.Fatalf("failed on count order edits: %v", err)
+	}
+	if edits != 1 {
+		t.Errorf("unexpected order edit count: %d, want 1", edits)
+	}
+}
+
+// TestReplayReorgAfterPartialWindow 区间中途失败时同步进度停在日志所在区块，该区块被重组后仍能检测到
+func TestReplayReorgAfterPartialWindow(t *testing.T) {
+	h := newReplayHarness(t)
+	h.load("lifecycle.json")
+	h.syncTo(103)
+
+	// 只处理了104的日志，区间结束前失败，没有记录结束区块的hash
+	h.chain.setHead(105)
+	logs, err := h.chain.FilterLogs(context.Background(), types.FilterQuery{
+		FromBlock: big.NewInt(104),
+		ToBlock:   big.NewInt(104),
+	})
+	if err != nil {
+		t.Fatalf("failed on filter logs: %v", err)
+	}
+	if err := h.service.handleLogs(logs); err != nil {
+		t.Fatalf("failed on handle logs: %v", err)
+	}
+
+	// 104被重组，103不变
+	h.chain.apply(loadReplayFixture(t, "lifecycle_reorg.json"))
+	h.chain.setHead(107)
+	forkBlock, reorged, err := h.service.detectReorg(104)
+	if err != nil {
+		t.Fatalf("failed on detect reorg: %v", err)
+	}
+	if !reorged || forkBlock != 103 {
+		t.Errorf("fork block: %d, reorged: %v, want 103", forkBlock, reorged)
+	}
+}
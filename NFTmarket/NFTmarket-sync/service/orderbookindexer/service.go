@@ -1,15 +1,19 @@
 package orderbookindexer
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
 	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
@@ -21,7 +25,6 @@ import (
 	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/threading"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -31,17 +34,20 @@ import (
 )
 
 const (
-	EventIndexType   = 6
-	SleepInterval    = 10 // in seconds
-	SyncBlockPeriod  = 10
-	LogMakeTopic     = "0xfc37f2ff950f95913eb7182357ba3c14df60ef354bc7d6ab1ba2815f249fffe6"
-	LogCancelTopic   = "0x0ac8bb53fac566d7afc05d8b4df11d7690a7b27bdc40b54e4060f9b21fb849bd"
-	LogMatchTopic    = "0xf629aecab94607bc43ce4aebd564bf6e61c7327226a797b002de724b9944b20e"
-	contractAbi      = `[{"inputs":[],"name":"CannotFindNextEmptyKey","type":"error"},{"inputs":[],"name":"CannotFindPrevEmptyKey","type":"error"},{"inputs":[{"internalType":"OrderKey","name":"orderKey","type":"bytes32"}],"name":"CannotInsertDuplicateOrder","type":"error"},{"inputs":[],"name":"CannotInsertEmptyKey","type":"error"},{"inputs":[],"name":"CannotInsertExistingKey","type":"error"},{"inputs":[],"name":"CannotRemoveEmptyKey","type":"error"},{"inputs":[],"name":"CannotRemoveMissingKey","type":"error"},{"inputs":[],"name":"EnforcedPause","type":"error"},{"inputs":[],"name":"ExpectedPause","type":"error"},{"inputs":[],"name":"InvalidInitialization","type":"error"},{"inputs":[],"name":"NotInitializing","type":"error"},{"inputs":[{"internalType":"address","name":"owner","type":"address"}],"name":"OwnableInvalidOwner","type":"error"},{"inputs":[{"internalType":"address","name":"account","type":"address"}],"name":"OwnableUnauthorizedAccount","type":"error"},{"inputs":[],"name":"ReentrancyGuardReentrantCall","type":"error"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint256","name":"offset","type":"uint256"},{"indexed":false,"internalType":"bytes","name":"msg","type":"bytes"}],"name":"BatchMatchInnerError","type":"event"},{"anonymous":false,"inputs":[],"name":"EIP712DomainChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint64","name":"version","type":"uint64"}],"name":"Initialized","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":true,"internalType":"address","name":"maker","type":"address"}],"name":"LogCancel","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":true,"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"indexed":true,"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"indexed":true,"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"indexed":false,"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"indexed":false,"internalType":"Price","name":"price","type":"uint128"},{"indexed":false,"internalType":"uint64","name":"expiry","type":"uint64"},{"indexed":false,"internalType":"uint64","name":"salt","type":"uint64"}],"name":"LogMake","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"OrderKey","name":"makeOrderKey","type":"bytes32"},{"indexed":true,"internalType":"OrderKey","name":"takeOrderKey","type":"bytes32"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"indexed":false,"internalType":"structLibOrder.Order","name":"makeOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"indexed":false,"internalType":"structLibOrder.Order","name":"takeOrder","type":"tuple"},{"indexed":false,"internalType":"uint128","name":"fillPrice","type":"uint128"}],"name":"LogMatch","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":false,"internalType":"uint64","name":"salt","type":"uint64"}],"name":"LogSkipOrder","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"uint128","name":"newProtocolShare","type":"uint128"}],"name":"LogUpdatedProtocolShare","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"recipient","type":"address"},{"indexed":false,"internalType":"uint256","name":"amount","type":"uint256"}],"name":"LogWithdrawETH","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"previousOwner","type":"address"},{"indexed":true,"internalType":"address","name":"newOwner","type":"address"}],"name":"OwnershipTransferred","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"account","type":"address"}],"name":"Paused","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"account","type":"address"}],"name":"Unpaused","type":"event"},{"inputs":[{"internalType":"OrderKey[]","name":"orderKeys","type":"bytes32[]"}],"name":"cancelOrders","outputs":[{"internalType":"bool[]","name":"successes","type":"bool[]"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"components":[{"internalType":"OrderKey","name":"oldOrderKey","type":"bytes32"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"newOrder","type":"tuple"}],"internalType":"structLibOrder.EditDetail[]","name":"editDetails","type":"tuple[]"}],"name":"editOrders","outputs":[{"internalType":"OrderKey[]","name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},{"inputs":[],"name":"eip712Domain","outputs":[{"internalType":"bytes1","name":"fields","type":"bytes1"},{"internalType":"string","name":"name","type":"string"},{"internalType":"string","name":"version","type":"string"},{"internalType":"uint256","name":"chainId","type":"uint256"},{"internalType":"address","name":"verifyingContract","type":"address"},{"internalType":"bytes32","name":"salt","type":"bytes32"},{"internalType":"uint256[]","name":"extensions","type":"uint256[]"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"OrderKey","name":"","type":"bytes32"}],"name":"filledAmount","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"}],"name":"getBestOrder","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"orderResult","type":"tuple"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"}],"name":"getBestPrice","outputs":[{"internalType":"Price","name":"price","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"Price","name":"price","type":"uint128"}],"name":"getNextBestPrice","outputs":[{"internalType":"Price","name":"nextBestPrice","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"uint256","name":"count","type":"uint256"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"OrderKey","name":"firstOrderKey","type":"bytes32"}],"name":"getOrders","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order[]","name":"resultOrders","type":"tuple[]"},{"internalType":"OrderKey","name":"nextOrderKey","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"uint128","name":"newProtocolShare","type":"uint128"},{"internalType":"address","name":"newVault","type":"address"},{"internalType":"string","name":"EIP712Name","type":"string"},{"internalType":"string","name":"EIP712Version","type":"string"}],"name":"initialize","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order[]","name":"newOrders","type":"tuple[]"}],"name":"makeOrders","outputs":[{"internalType":"OrderKey[]","name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"}],"name":"matchOrder","outputs":[],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"},{"internalType":"uint256","name":"msgValue","type":"uint256"}],"name":"matchOrderWithoutPayback","outputs":[{"internalType":"uint128","name":"costValue","type":"uint128"}],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"}],"internalType":"structLibOrder.MatchDetail[]","name":"matchDetails","type":"tuple[]"}],"name":"matchOrders","outputs":[{"internalType":"bool[]","name":"successes","type":"bool[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"enumLibOrder.Side","name":"","type":"uint8"},{"internalType":"Price","name":"","type":"uint128"}],"name":"orderQueues","outputs":[{"internalType":"OrderKey","name":"head","type":"bytes32"},{"internalType":"OrderKey","name":"tail","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"OrderKey","name":"","type":"bytes32"}],"name":"orders","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"order","type":"tuple"},{"internalType":"OrderKey","name":"next","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"owner","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"pause","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[],"name":"paused","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"enumLibOrder.Side","name":"","type":"uint8"}],"name":"priceTrees","outputs":[{"internalType":"Price","name":"root","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"protocolShare","outputs":[{"internalType":"uint128","name":"","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"renounceOwnership","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"uint128","name":"newProtocolShare","type":"uint128"}],"name":"setProtocolShare","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"newVault","type":"address"}],"name":"setVault","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"newOwner","type":"address"}],"name":"transferOwnership","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[],"name":"unpause","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"recipient","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"withdrawETH","outputs":[],"stateMutability":"nonpayable","type":"function"},{"stateMutability":"payable","type":"receive"}]`
-	FixForCollection = 0
-	FixForItem       = 1
-	List             = 0
-	Bid              = 1
+	EventIndexType               = 6
+	SleepInterval                = 10 // in seconds
+	SyncBlockPeriod              = 10
+	LogMakeTopic                 = "0xfc37f2ff950f95913eb7182357ba3c14df60ef354bc7d6ab1ba2815f249fffe6"
+	LogCancelTopic               = "0x0ac8bb53fac566d7afc05d8b4df11d7690a7b27bdc40b54e4060f9b21fb849bd"
+	LogMatchTopic                = "0xf629aecab94607bc43ce4aebd564bf6e61c7327226a797b002de724b9944b20e"
+	LogSkipOrderTopic            = "0x43d1f368251ebe03c021962d50212d072e7ccee5c8ad3f541d93d0dc43bbd420"
+	BatchMatchInnerErrorTopic    = "0x050f709fb65709f10a27682788a9d67fe74de81b310b5c34e3d32f0e2c3ac557"
+	LogUpdatedProtocolShareTopic = "0x0b52884d4590055c8791518c34458834f75feed662340ef0b5af2898e7a9be9f"
+	contractAbi                  = `[{"inputs":[],"name":"CannotFindNextEmptyKey","type":"error"},{"inputs":[],"name":"CannotFindPrevEmptyKey","type":"error"},{"inputs":[{"internalType":"OrderKey","name":"orderKey","type":"bytes32"}],"name":"CannotInsertDuplicateOrder","type":"error"},{"inputs":[],"name":"CannotInsertEmptyKey","type":"error"},{"inputs":[],"name":"CannotInsertExistingKey","type":"error"},{"inputs":[],"name":"CannotRemoveEmptyKey","type":"error"},{"inputs":[],"name":"CannotRemoveMissingKey","type":"error"},{"inputs":[],"name":"EnforcedPause","type":"error"},{"inputs":[],"name":"ExpectedPause","type":"error"},{"inputs":[],"name":"InvalidInitialization","type":"error"},{"inputs":[],"name":"NotInitializing","type":"error"},{"inputs":[{"internalType":"address","name":"owner","type":"address"}],"name":"OwnableInvalidOwner","type":"error"},{"inputs":[{"internalType":"address","name":"account","type":"address"}],"name":"OwnableUnauthorizedAccount","type":"error"},{"inputs":[],"name":"ReentrancyGuardReentrantCall","type":"error"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint256","name":"offset","type":"uint256"},{"indexed":false,"internalType":"bytes","name":"msg","type":"bytes"}],"name":"BatchMatchInnerError","type":"event"},{"anonymous":false,"inputs":[],"name":"EIP712DomainChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint64","name":"version","type":"uint64"}],"name":"Initialized","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":true,"internalType":"address","name":"maker","type":"address"}],"name":"LogCancel","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":true,"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"indexed":true,"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"indexed":true,"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"indexed":false,"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"indexed":false,"internalType":"Price","name":"price","type":"uint128"},{"indexed":false,"internalType":"uint64","name":"expiry","type":"uint64"},{"indexed":false,"internalType":"uint64","name":"salt","type":"uint64"}],"name":"LogMake","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"OrderKey","name":"makeOrderKey","type":"bytes32"},{"indexed":true,"internalType":"OrderKey","name":"takeOrderKey","type":"bytes32"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"indexed":false,"internalType":"structLibOrder.Order","name":"makeOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"indexed":false,"internalType":"structLibOrder.Order","name":"takeOrder","type":"tuple"},{"indexed":false,"internalType":"uint128","name":"fillPrice","type":"uint128"}],"name":"LogMatch","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"OrderKey","name":"orderKey","type":"bytes32"},{"indexed":false,"internalType":"uint64","name":"salt","type":"uint64"}],"name":"LogSkipOrder","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"uint128","name":"newProtocolShare","type":"uint128"}],"name":"LogUpdatedProtocolShare","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"recipient","type":"address"},{"indexed":false,"internalType":"uint256","name":"amount","type":"uint256"}],"name":"LogWithdrawETH","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"previousOwner","type":"address"},{"indexed":true,"internalType":"address","name":"newOwner","type":"address"}],"name":"OwnershipTransferred","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"account","type":"address"}],"name":"Paused","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"account","type":"address"}],"name":"Unpaused","type":"event"},{"inputs":[{"internalType":"OrderKey[]","name":"orderKeys","type":"bytes32[]"}],"name":"cancelOrders","outputs":[{"internalType":"bool[]","name":"successes","type":"bool[]"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"components":[{"internalType":"OrderKey","name":"oldOrderKey","type":"bytes32"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"newOrder","type":"tuple"}],"internalType":"structLibOrder.EditDetail[]","name":"editDetails","type":"tuple[]"}],"name":"editOrders","outputs":[{"internalType":"OrderKey[]","name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},{"inputs":[],"name":"eip712Domain","outputs":[{"internalType":"bytes1","name":"fields","type":"bytes1"},{"internalType":"string","name":"name","type":"string"},{"internalType":"string","name":"version","type":"string"},{"internalType":"uint256","name":"chainId","type":"uint256"},{"internalType":"address","name":"verifyingContract","type":"address"},{"internalType":"bytes32","name":"salt","type":"bytes32"},{"internalType":"uint256[]","name":"extensions","type":"uint256[]"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"OrderKey","name":"","type":"bytes32"}],"name":"filledAmount","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"}],"name":"getBestOrder","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"orderResult","type":"tuple"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"}],"name":"getBestPrice","outputs":[{"internalType":"Price","name":"price","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"Price","name":"price","type":"uint128"}],"name":"getNextBestPrice","outputs":[{"internalType":"Price","name":"nextBestPrice","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"uint256","name":"count","type":"uint256"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"OrderKey","name":"firstOrderKey","type":"bytes32"}],"name":"getOrders","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order[]","name":"resultOrders","type":"tuple[]"},{"internalType":"OrderKey","name":"nextOrderKey","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"uint128","name":"newProtocolShare","type":"uint128"},{"internalType":"address","name":"newVault","type":"address"},{"internalType":"string","name":"EIP712Name","type":"string"},{"internalType":"string","name":"EIP712Version","type":"string"}],"name":"initialize","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order[]","name":"newOrders","type":"tuple[]"}],"name":"makeOrders","outputs":[{"internalType":"OrderKey[]","name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"}],"name":"matchOrder","outputs":[],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"},{"internalType":"uint256","name":"msgValue","type":"uint256"}],"name":"matchOrderWithoutPayback","outputs":[{"internalType":"uint128","name":"costValue","type":"uint128"}],"stateMutability":"payable","type":"function"},{"inputs":[{"components":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"sellOrder","type":"tuple"},{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"buyOrder","type":"tuple"}],"internalType":"structLibOrder.MatchDetail[]","name":"matchDetails","type":"tuple[]"}],"name":"matchOrders","outputs":[{"internalType":"bool[]","name":"successes","type":"bool[]"}],"stateMutability":"payable","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"enumLibOrder.Side","name":"","type":"uint8"},{"internalType":"Price","name":"","type":"uint128"}],"name":"orderQueues","outputs":[{"internalType":"OrderKey","name":"head","type":"bytes32"},{"internalType":"OrderKey","name":"tail","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"OrderKey","name":"","type":"bytes32"}],"name":"orders","outputs":[{"components":[{"internalType":"enumLibOrder.Side","name":"side","type":"uint8"},{"internalType":"enumLibOrder.SaleKind","name":"saleKind","type":"uint8"},{"internalType":"address","name":"maker","type":"address"},{"components":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"address","name":"collection","type":"address"},{"internalType":"uint96","name":"amount","type":"uint96"}],"internalType":"structLibOrder.Asset","name":"nft","type":"tuple"},{"internalType":"Price","name":"price","type":"uint128"},{"internalType":"uint64","name":"expiry","type":"uint64"},{"internalType":"uint64","name":"salt","type":"uint64"}],"internalType":"structLibOrder.Order","name":"order","type":"tuple"},{"internalType":"OrderKey","name":"next","type":"bytes32"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"owner","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"pause","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[],"name":"paused","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"enumLibOrder.Side","name":"","type":"uint8"}],"name":"priceTrees","outputs":[{"internalType":"Price","name":"root","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"protocolShare","outputs":[{"internalType":"uint128","name":"","type":"uint128"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"renounceOwnership","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"uint128","name":"newProtocolShare","type":"uint128"}],"name":"setProtocolShare","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"newVault","type":"address"}],"name":"setVault","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"newOwner","type":"address"}],"name":"transferOwnership","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[],"name":"unpause","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"recipient","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"withdrawETH","outputs":[],"stateMutability":"nonpayable","type":"function"},{"stateMutability":"payable","type":"receive"}]`
+	FixForCollection             = 0
+	FixForItem                   = 1
+	List                         = 0
+	Bid                          = 1
 
 	HexPrefix   = "0x"
 	ZeroAddress = "0x0000000000000000000000000000000000000000"
@@ -68,9 +74,18 @@ type Service struct {
 	kv           *xkv.Store
 	orderManager *ordermanager.OrderManager
 	chainClient  chainclient.ChainClient
+	eventSink    eventsink.Sink
+	leader       *xkv.Leader      // leader选举，为nil时未启用
+	loops        *lifecycle.Group // 后台协程及其运行状态
+	headers      *headerCache     // 区块头缓存
+	journal      *comm.Journal    // 区块hash和回滚日志，以合约地址为key
+	wake         chan struct{}    // 实时模式下收到新区块时唤醒同步循环
 	chainId      int64
 	chain        string
 	parsedAbi    abi.ABI
+
+	healthMu sync.RWMutex
+	health   Health
 }
 
 var MultiChainMaxBlockDifference = map[string]uint64{
@@ -82,8 +97,12 @@ var MultiChainMaxBlockDifference = map[string]uint64{
 	"zksync-era": 2,
 }
 
-func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, chainClient chainclient.ChainClient, chainId int64, chain string, orderManager *ordermanager.OrderManager) *Service {
+func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, chainClient chainclient.ChainClient, chainId int64, chain string, orderManager *ordermanager.OrderManager, eventSink eventsink.Sink, leader *xkv.Leader) *Service {
 	parsedAbi, _ := abi.JSON(strings.NewReader(contractAbi)) // 通过ABI实例化
+	var dexAddress string
+	if cfg != nil {
+		dexAddress = cfg.ContractCfg.DexAddress
+	}
 	return &Service{
 		ctx:          ctx,
 		cfg:          cfg,
@@ -91,6 +110,12 @@ func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, c
 		kv:           xkv,
 		chainClient:  chainClient,
 		orderManager: orderManager,
+		eventSink:    eventSink,
+		leader:       leader,
+		loops:        lifecycle.NewGroup(),
+		headers:      newHeaderCache(HeaderCacheSize),
+		journal:      comm.NewJournal(ctx, db, chainClient, chain, dexAddress),
+		wake:         make(chan struct{}, 1),
 		chain:        chain,
 		chainId:      chainId,
 		parsedAbi:    parsedAbi,
@@ -99,23 +124,56 @@ func New(ctx context.Context, cfg *config.Config, db *gorm.DB, xkv *xkv.Store, c
 
 func (s *Service) Start() {
 	// 同步订单薄事件
-	threading.GoSafe(s.SyncOrderBookEventLoop)
+	s.loops.Go("sync", s.SyncOrderBookEventLoop)
+	// 实时模式订阅新区块和合约日志
+	if s.cfg.AnkrCfg.EnableWss {
+		s.loops.Go("live_tail", s.LiveTailLoop)
+	}
+}
+
+// StartChainLoops 启动按链运行的任务，同一条链的多个合约部署只需启动一次
+func (s *Service) StartChainLoops() {
+	// 投递发件箱消息
+	s.loops.Go("outbox_relay", s.OutboxRelayLoop)
 	// 处理地板价
-	threading.GoSafe(s.UpKeepingCollectionFloorChangeLoop)
+	s.loops.Go("floor_change", s.UpKeepingCollectionFloorChangeLoop)
+}
+
+// Wait 等待后台协程在ctx取消后退出，正在处理的区间或日志事务随ctx取消回滚，同步进度不变
+func (s *Service) Wait(ctx context.Context) error {
+	return s.loops.Wait(ctx)
+}
+
+// Status 返回每个后台协程的运行状态
+func (s *Service) Status() map[string]lifecycle.State {
+	return s.loops.Status()
+}
+
+// contractAddress 当前同步的订单簿合约地址
+func (s *Service) contractAddress() string {
+	return strings.ToLower(s.cfg.ContractCfg.DexAddress)
 }
 
 // 同步订单薄事件
 func (s *Service) SyncOrderBookEventLoop() {
-	// 查询数据库记录最后区块
-	var indexedStatus base.IndexedStatus
-	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
-		Where("chain_id = ? and index_type = ?", s.chainId, EventIndexType).
-		First(&indexedStatus).Error; err != nil {
+	// 查询数据库记录最后区块，失败时重试，不影响其它链
+	var lastSyncBlock uint64
+	for {
+		checkpoint, err := s.ensureCheckpoint(0)
+		if err == nil {
+			lastSyncBlock = checkpoint
+			s.recordCheckpoint(checkpoint)
+			break
+		}
 		xzap.WithContext(s.ctx).Error("failed on get listing index status",
-			zap.Error(err))
-		return
+			zap.String("dex_address", s.contractAddress()), zap.Error(err))
+		s.recordSyncError(err)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(SleepInterval * time.Second):
+		}
 	}
-	lastSyncBlock := uint64(indexedStatus.LastIndexedBlock)
 	// 监听链
 	for {
 		// 监听停止通道
@@ -125,70 +183,224 @@ func (s *Service) SyncOrderBookEventLoop() {
 			return
 		default:
 		}
-		// 获取当前区块高度
-		currentBlockNum, err := s.chainClient.BlockNumber()
+		next, idle, err := s.syncOnce(lastSyncBlock)
+		if errors.Is(err, errBlockHashChanged) {
+			xzap.WithContext(s.ctx).Warn("block hash changed while syncing, retry",
+				zap.Uint64("start_block", lastSyncBlock), zap.Error(err))
+			s.sleep(SleepInterval * time.Second)
+			continue
+		}
 		if err != nil {
-			xzap.WithContext(s.ctx).Error("failed on get current block number", zap.Error(err))
-			time.Sleep(SleepInterval * time.Second)
+			xzap.WithContext(s.ctx).Error("failed on sync orderbook event",
+				zap.Uint64("start_block", lastSyncBlock), zap.Error(err))
+			s.recordSyncError(err)
+			s.sleep(SleepInterval * time.Second)
 			continue
 		}
-		// 如果上次同步的区块高度大于当前区块高度，等待一段时间后再次轮询
-		if lastSyncBlock > currentBlockNum-MultiChainMaxBlockDifference[s.chain] {
-			time.Sleep(SleepInterval * time.Second)
+		if idle {
+			// 已同步到最新区块，等待新区块后再次轮询
+			s.waitNextBlock()
 			continue
 		}
-		// 如果结束区块高度大于当前区块高度，将结束区块高度设置为当前区块高度
-		startBlock := lastSyncBlock
-		endBlock := startBlock + SyncBlockPeriod
-		if endBlock > currentBlockNum-MultiChainMaxBlockDifference[s.chain] {
-			endBlock = currentBlockNum - MultiChainMaxBlockDifference[s.chain]
+		lastSyncBlock = next
+	}
+}
+
+// syncOnce 从lastSyncBlock开始同步一个区间，返回下一个待同步的区块
+// 已同步到最新区块时返回idle为true；检测到链重组时回滚并返回分叉点的下一个区块
+func (s *Service) syncOnce(lastSyncBlock uint64) (uint64, bool, error) {
+	// 获取当前区块高度
+	currentBlockNum, err := s.chainClient.BlockNumber()
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get current block number")
+	}
+	s.recordHead(currentBlockNum)
+	// 如果上次同步的区块高度大于当前区块高度，等待新区块后再次轮询
+	if lastSyncBlock > currentBlockNum-MultiChainMaxBlockDifference[s.chain] {
+		return lastSyncBlock, true, nil
+	}
+	// 如果结束区块高度大于当前区块高度，将结束区块高度设置为当前区块高度
+	startBlock := lastSyncBlock
+	endBlock := startBlock + SyncBlockPeriod
+	if endBlock > currentBlockNum-MultiChainMaxBlockDifference[s.chain] {
+		endBlock = currentBlockNum - MultiChainMaxBlockDifference[s.chain]
+	}
+	// 检测链重组，发生重组时回滚到分叉点后重新同步
+	forkBlock, reorged, err := s.detectReorg(startBlock)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on detect chain reorg")
+	}
+	if reorged {
+		if err := s.rollbackTo(forkBlock); err != nil {
+			return 0, false, errors.Wrapf(err, "failed on rollback chain reorg, fork_block: %d", forkBlock)
 		}
-		// 查询区块事件
-		query := types.FilterQuery{
-			FromBlock: new(big.Int).SetUint64(startBlock),
-			ToBlock:   new(big.Int).SetUint64(endBlock),
-			Addresses: []string{s.cfg.ContractCfg.DexAddress},
+		return forkBlock + 1, false, nil
+	}
+	// 查询区块事件
+	query := types.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(startBlock),
+		ToBlock:   new(big.Int).SetUint64(endBlock),
+		Addresses: []string{s.cfg.ContractCfg.DexAddress},
+	}
+	logs, err := s.chainClient.FilterLogs(s.ctx, query)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get log")
+	}
+	// 获取结束区块头和有日志的区块头，校验日志与区块头属于同一条链
+	endHeader, err := s.chainClient.BlockHeaderByNumber(s.ctx, new(big.Int).SetUint64(endBlock))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get block header")
+	}
+	headers, err := s.windowHeaders(logs, endHeader)
+	if err != nil {
+		return 0, false, err
+	}
+	// 遍历日志，根据不同的topic处理不同的事件
+	// 每条日志在独立事务中处理，失败时重试整个区间，已处理的日志会被跳过
+	if err := s.handleLogs(logs); err != nil {
+		return 0, false, errors.Wrapf(err, "failed on handle orderbook event, start_block: %d, end_block: %d", startBlock, endBlock)
+	}
+	// 记录有日志的区块和结束区块的hash并更新最后同步的区块高度
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.recordIndexedBlocks(tx, headers); err != nil {
+			return err
+		}
+		return s.updateCheckpoint(tx, endBlock+1)
+	}); err != nil {
+		return 0, false, errors.Wrap(err, "failed on update orderbook event sync block number")
+	}
+	s.recordSyncSuccess(endBlock)
+	// 记录日志
+	xzap.WithContext(s.ctx).Info("sync orderbook event ...",
+		zap.Uint64("start_block", startBlock),
+		zap.Uint64("end_block", endBlock))
+	return endBlock + 1, false, nil
+}
+
+// 按topic分发日志
+func (s *Service) handleLogs(logs []interface{}) error {
+	// 先获取全部区块头，失败时不处理任何日志
+	if err := s.prefetchHeaders(logs); err != nil {
+		return err
+	}
+	for i := 0; i < len(logs); i++ {
+		ethLog := logs[i].(ethereumTypes.Log)
+		var eventType string
+		var err error
+		switch ethLog.Topics[0].String() {
+		case LogMakeTopic:
+			// LogMake-创建订单
+			eventType = "make"
+			err = s.handleMakeEvent(ethLog)
+		case LogCancelTopic:
+			// LogCancel-取消订单，editOrders会在同一交易中紧接着发出LogMake
+			if i+1 < len(logs) && isEditPair(ethLog, logs[i+1].(ethereumTypes.Log)) {
+				eventType = "edit"
+				err = s.handleEditEvent(ethLog, logs[i+1].(ethereumTypes.Log))
+				i++
+			} else {
+				eventType = "cancel"
+				err = s.handleCancelEvent(ethLog)
+			}
+		case LogMatchTopic:
+			// LogMatch-匹配订单
+			eventType = "match"
+			err = s.handleMatchEvent(ethLog)
+		case LogSkipOrderTopic:
+			// LogSkipOrder-订单被合约跳过
+			eventType = "skip_order"
+			err = s.handleSkipOrderEvent(ethLog)
+		case BatchMatchInnerErrorTopic:
+			// BatchMatchInnerError-批量撮合中的单笔失败
+			eventType = "batch_match_inner_error"
+			err = s.handleBatchMatchInnerErrorEvent(ethLog)
+		case LogUpdatedProtocolShareTopic:
+			// LogUpdatedProtocolShare-协议手续费比例变更
+			eventType = "protocol_share"
+			err = s.handleProtocolShareEvent(ethLog)
+		default:
+		}
+		if eventType != "" {
+			comm.ObserveEvent(s.chain, s.indexerLabel(), eventType, err)
 		}
-		logs, err := s.chainClient.FilterLogs(s.ctx, query)
 		if err != nil {
-			xzap.WithContext(s.ctx).Error("failed on get log", zap.Error(err))
-			time.Sleep(SleepInterval * time.Second)
-			continue
+			return errors.Wrapf(err, "failed on handle log, tx_hash: %s, log_index: %d", ethLog.TxHash.String(), ethLog.Index)
 		}
-		// 遍历日志，根据不同的topic处理不同的事件
-		for _, log := range logs {
-			ethLog := log.(ethereumTypes.Log)
-			switch ethLog.Topics[0].String() {
-			case LogMakeTopic:
-				// LogMake-创建订单
-				s.handleMakeEvent(ethLog)
-			case LogCancelTopic:
-				// LogCancel-取消订单
-				s.handleCancelEvent(ethLog)
-			case LogMatchTopic:
-				// LogMatch-匹配订单
-				s.handleMatchEvent(ethLog)
-			default:
-			}
+	}
+	return nil
+}
+
+// applyLog 在同一个事务中处理单条日志的数据库变更，并推进同步进度
+// 以(tx_hash, log_index)去重，重放已处理的日志不会产生任何变更
+// 同时记录日志所在区块的hash，区间中途失败后从该区块继续时仍能检测到重组
+func (s *Service) applyLog(log ethereumTypes.Log, fn func(tx *gorm.DB) error) error {
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(multi.ProcessedLogTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&multi.ProcessedLog{
+			ContractAddress: s.contractAddress(),
+			TxHash:          log.TxHash.String(),
+			LogIndex:        int64(log.Index),
+			BlockNumber:     int64(log.BlockNumber),
+		})
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create processed log")
 		}
-		// 更新最后同步的区块高度
-		lastSyncBlock = endBlock + 1
-		if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
-			Where("chain_id = ? and index_type = ?", s.chainId, EventIndexType).
-			Update("last_indexed_block", lastSyncBlock).Error; err != nil {
-			xzap.WithContext(s.ctx).Error("failed on update orderbook event sync block number",
-				zap.Error(err))
-			return
+		if result.RowsAffected == 0 {
+			// 已处理过的日志
+			return nil
+		}
+		if err := fn(tx); err != nil {
+			return err
 		}
-		// 记录日志
-		xzap.WithContext(s.ctx).Info("sync orderbook event ...",
-			zap.Uint64("start_block", startBlock),
-			zap.Uint64("end_block", endBlock))
+		// 同步进度停在日志所在区块时，记录该区块的hash用于之后的重组检测
+		if err := s.journal.RecordBlocks(tx, []*types.BlockHeader{{
+			Number: log.BlockNumber,
+			Hash:   log.BlockHash.String(),
+		}}); err != nil {
+			return err
+		}
+		return s.updateCheckpoint(tx, log.BlockNumber)
+	})
+}
+
+// updateCheckpoint 推进最后同步的区块高度，只向前移动，回补历史区块时不会使实时同步的进度倒退
+// 启用leader选举时先检查fencing token，已失去leader身份时整个事务回滚
+func (s *Service) updateCheckpoint(tx *gorm.DB, blockNumber uint64) error {
+	return s.setCheckpoint(tx, gorm.Expr("case when last_indexed_block < ? then ? else last_indexed_block end", blockNumber, blockNumber))
+}
+
+// resetCheckpoint 链重组回滚时将同步进度重置到分叉点之后
+func (s *Service) resetCheckpoint(tx *gorm.DB, blockNumber uint64) error {
+	return s.setCheckpoint(tx, blockNumber)
+}
+
+func (s *Service) setCheckpoint(tx *gorm.DB, lastIndexedBlock interface{}) error {
+	status := func() *gorm.DB {
+		return tx.Table(base.IndexedStatusTableName()).
+			Where("chain_id = ? and index_type = ? and contract_address = ?", s.chainId, EventIndexType, s.contractAddress())
 	}
+	token := s.leader.Token()
+	if err := comm.CheckLeaderToken(status(), token); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"last_indexed_block": lastIndexedBlock}
+	if token > 0 {
+		updates["leader_token"] = token
+	}
+	if err := status().Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update orderbook event sync block number")
+	}
+	return nil
 }
 
 // 处理创建订单事件
-func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
+func (s *Service) handleMakeEvent(log ethereumTypes.Log) error {
+	return s.handleMake(log, "")
+}
+
+// handleMake 创建订单，editedFrom不为空时表示订单由editOrders编辑生成，记录新旧订单的关联
+func (s *Service) handleMake(log ethereumTypes.Log, editedFrom string) error {
 	var event struct {
 		OrderKey [32]byte
 		Nft      struct {
@@ -204,7 +416,7 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 	err := s.parsedAbi.UnpackIntoInterface(&event, "LogMake", log.Data)
 	if err != nil {
 		xzap.WithContext(s.ctx).Error("Error unpacking LogMake event:", zap.Error(err))
-		return
+		return nil
 	}
 	// 解析指定数据
 	side := uint8(new(big.Int).SetBytes(log.Topics[1].Bytes()).Uint64())
@@ -225,35 +437,10 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 		// 卖单
 		orderType = multi.ListingOrder
 	}
-	// 将订单信息存入数据库
-	newOrder := multi.Order{
-		CollectionAddress: event.Nft.CollectionAddr.String(),
-		MarketplaceId:     multi.MarketOrderBook,
-		TokenId:           event.Nft.TokenId.String(),
-		OrderID:           HexPrefix + hex.EncodeToString(event.OrderKey[:]),
-		OrderStatus:       multi.OrderStatusActive,
-		EventTime:         time.Now().Unix(),
-		ExpireTime:        int64(event.Expiry),
-		CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
-		Price:             decimal.NewFromBigInt(event.Price, 0),
-		Maker:             maker.String(),
-		Taker:             ZeroAddress,
-		QuantityRemaining: event.Nft.Amount.Int64(),
-		Size:              event.Nft.Amount.Int64(),
-		OrderType:         orderType,
-		Salt:              int64(event.Salt),
-	}
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newOrder).Error; err != nil {
-		xzap.WithContext(s.ctx).Error("failed on create order",
-			zap.Error(err))
-	}
-	// 获取指定区块事件
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	// 获取指定区块时间
+	blockTime, err := s.blockTime(log.BlockNumber)
 	if err != nil {
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return errors.Wrap(err, "failed to get block time")
 	}
 	// 设置行为类型
 	var activityType int
@@ -270,7 +457,23 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 		// 卖单
 		activityType = multi.Listing
 	}
-	// 将订单信息存入活动表
+	newOrder := multi.Order{
+		CollectionAddress: event.Nft.CollectionAddr.String(),
+		MarketplaceId:     multi.MarketOrderBook,
+		TokenId:           event.Nft.TokenId.String(),
+		OrderID:           HexPrefix + hex.EncodeToString(event.OrderKey[:]),
+		OrderStatus:       multi.OrderStatusActive,
+		EventTime:         int64(blockTime),
+		ExpireTime:        int64(event.Expiry),
+		CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
+		Price:             decimal.NewFromBigInt(event.Price, 0),
+		Maker:             maker.String(),
+		Taker:             ZeroAddress,
+		QuantityRemaining: event.Nft.Amount.Int64(),
+		Size:              event.Nft.Amount.Int64(),
+		OrderType:         orderType,
+		Salt:              int64(event.Salt),
+	}
 	newActivity := multi.Activity{
 		ActivityType:      activityType,
 		Maker:             maker.String(),
@@ -284,29 +487,77 @@ func (s *Service) handleMakeEvent(log ethereumTypes.Log) {
 		TxHash:            log.TxHash.String(),
 		EventTime:         int64(blockTime),
 	}
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
-	}
-	// 将订单信息存入订单管理队列
-	if err := s.orderManager.AddToOrderManagerQueue(&multi.Order{
-		ExpireTime:        newOrder.ExpireTime,
-		OrderID:           newOrder.OrderID,
-		CollectionAddress: newOrder.CollectionAddress,
-		TokenId:           newOrder.TokenId,
-		Price:             newOrder.Price,
-		Maker:             newOrder.Maker,
-	}); err != nil {
-		xzap.WithContext(s.ctx).Error("failed on add order to manager queue",
-			zap.Error(err),
-			zap.String("order_id", newOrder.OrderID))
-	}
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		// 将订单信息存入数据库
+		result := tx.Table(multi.OrderTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&newOrder)
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create order")
+		}
+		if result.RowsAffected > 0 {
+			// 记录回滚日志
+			if err := s.addJournal(tx, &multi.IndexerJournal{
+				BlockNumber:       int64(log.BlockNumber),
+				TxHash:            log.TxHash.String(),
+				JournalType:       multi.JournalOrderCreated,
+				OrderID:           newOrder.OrderID,
+				CollectionAddress: newOrder.CollectionAddress,
+				TokenId:           newOrder.TokenId,
+			}); err != nil {
+				return err
+			}
+		}
+		// 记录编辑关联
+		if editedFrom != "" {
+			if err := tx.Table(multi.OrderEditTableName(s.chain)).Clauses(clause.OnConflict{
+				DoNothing: true,
+			}).Create(&multi.OrderEdit{
+				OldOrderID:  editedFrom,
+				NewOrderID:  newOrder.OrderID,
+				Maker:       newOrder.Maker,
+				BlockNumber: int64(log.BlockNumber),
+				TxHash:      log.TxHash.String(),
+				LogIndex:    int64(log.Index),
+				EventTime:   int64(blockTime),
+			}).Error; err != nil {
+				return errors.Wrap(err, "failed on create order edit")
+			}
+		}
+		// 将订单信息存入活动表
+		if err := tx.Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&newActivity).Error; err != nil {
+			return errors.Wrap(err, "failed on create activity")
+		}
+		// 发布市场事件
+		created := s.newMarketEvent(log, eventsink.OrderCreated, int64(blockTime))
+		created.OrderId = newOrder.OrderID
+		created.OrderType = newOrder.OrderType
+		created.CollectionAddress = newOrder.CollectionAddress
+		created.TokenId = newOrder.TokenId
+		created.Maker = newOrder.Maker
+		created.Price = newOrder.Price
+		created.Quantity = newOrder.Size
+		created.ExpireTime = newOrder.ExpireTime
+		if err := s.addMarketEvents(tx, created); err != nil {
+			return err
+		}
+		// 将订单信息存入订单管理队列
+		return s.addOutbox(tx, multi.OutboxOrder, &multi.Order{
+			ExpireTime:        newOrder.ExpireTime,
+			OrderID:           newOrder.OrderID,
+			CollectionAddress: newOrder.CollectionAddress,
+			TokenId:           newOrder.TokenId,
+			Price:             newOrder.Price,
+			Maker:             newOrder.Maker,
+			OrderType:         newOrder.OrderType,
+		})
+	})
 }
 
 // 处理匹配订单事件
-func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
+func (s *Service) handleMatchEvent(log ethereumTypes.Log) error {
 	// 解析时间数据
 	var event struct {
 		MakeOrder Order
@@ -316,7 +567,7 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 	err := s.parsedAbi.UnpackIntoInterface(&event, "LogMatch", log.Data)
 	if err != nil {
 		xzap.WithContext(s.ctx).Error("Error unpacking LogMatch event:", zap.Error(err))
-		return
+		return nil
 	}
 	// 解析指定参数
 	makeOrderId := HexPrefix + hex.EncodeToString(log.Topics[1].Bytes())
@@ -328,7 +579,7 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 	var from string
 	var to string
 	var sellOrderId string
-	var buyOrder multi.Order
+	var buyOrderId string
 	if event.MakeOrder.Side == Bid {
 		// 买单， 由卖方发起交易撮合
 		owner = strings.ToLower(event.MakeOrder.Maker.String())
@@ -337,47 +588,7 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		from = event.TakeOrder.Maker.String()
 		to = event.MakeOrder.Maker.String()
 		sellOrderId = takeOrderId
-		// 更新卖方订单状态
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", takeOrderId).
-			Updates(map[string]interface{}{
-				"order_status":       multi.OrderStatusFilled,
-				"quantity_remaining": 0,
-				"taker":              to,
-			}).Error; err != nil {
-			xzap.WithContext(s.ctx).Error("failed on update order status",
-				zap.String("order_id", takeOrderId))
-			return
-		}
-		// 查询买方订单信息，不存在则无需更新，说明不是从平台前端发起的交易
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", makeOrderId).
-			First(&buyOrder).Error; err != nil {
-			xzap.WithContext(s.ctx).Error("failed on get buy order",
-				zap.Error(err))
-			return
-		}
-		// 更新买方订单的剩余数量
-		if buyOrder.QuantityRemaining > 1 {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", makeOrderId).
-				Update("quantity_remaining", buyOrder.QuantityRemaining-1).Error; err != nil {
-				xzap.WithContext(s.ctx).Error("failed on update order quantity_remaining",
-					zap.String("order_id", makeOrderId))
-				return
-			}
-		} else {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", makeOrderId).
-				Updates(map[string]interface{}{
-					"order_status":       multi.OrderStatusFilled,
-					"quantity_remaining": 0,
-				}).Error; err != nil {
-				xzap.WithContext(s.ctx).Error("failed on update order status",
-					zap.String("order_id", makeOrderId))
-				return
-			}
-		}
+		buyOrderId = makeOrderId
 	} else {
 		// 卖单， 由买方发起交易撮合， 同理
 		owner = strings.ToLower(event.TakeOrder.Maker.String())
@@ -386,55 +597,13 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		from = event.MakeOrder.Maker.String()
 		to = event.TakeOrder.Maker.String()
 		sellOrderId = makeOrderId
-		// 更新卖方订单状态
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", makeOrderId).
-			Updates(map[string]interface{}{
-				"order_status":       multi.OrderStatusFilled,
-				"quantity_remaining": 0,
-				"taker":              to,
-			}).Error; err != nil {
-			xzap.WithContext(s.ctx).Error("failed on update order status",
-				zap.String("order_id", makeOrderId))
-			return
-		}
-		// 查询买方订单信息
-		if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-			Where("order_id = ?", takeOrderId).
-			First(&buyOrder).Error; err != nil {
-			xzap.WithContext(s.ctx).Error("failed on get buy order",
-				zap.Error(err))
-			return
-		}
-		// 更新买方订单的剩余数量
-		if buyOrder.QuantityRemaining > 1 {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", takeOrderId).
-				Update("quantity_remaining", buyOrder.QuantityRemaining-1).Error; err != nil {
-				xzap.WithContext(s.ctx).Error("failed on update order quantity_remaining",
-					zap.String("order_id", takeOrderId))
-				return
-			}
-		} else {
-			if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-				Where("order_id = ?", takeOrderId).
-				Updates(map[string]interface{}{
-					"order_status":       multi.OrderStatusFilled,
-					"quantity_remaining": 0,
-				}).Error; err != nil {
-				xzap.WithContext(s.ctx).Error("failed on update order status",
-					zap.String("order_id", takeOrderId))
-				return
-			}
-		}
+		buyOrderId = takeOrderId
 	}
 	// 获取指定区块时间
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	blockTime, err := s.blockTime(log.BlockNumber)
 	if err != nil {
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return errors.Wrap(err, "failed to get block time")
 	}
-	// 保存行为信息-mysql
 	newActivity := multi.Activity{
 		ActivityType:      multi.Sale,
 		Maker:             event.MakeOrder.Maker.String(),
@@ -448,104 +617,368 @@ func (s *Service) handleMatchEvent(log ethereumTypes.Log) {
 		TxHash:            log.TxHash.String(),
 		EventTime:         int64(blockTime),
 	}
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
+	// 市场事件
+	sellFilled := s.newMarketEvent(log, eventsink.OrderFilled, int64(blockTime))
+	sellFilled.OrderId = sellOrderId
+	sellFilled.OrderType = multi.ListingOrder
+	sellFilled.CollectionAddress = collection
+	sellFilled.TokenId = tokenId
+	sellFilled.Maker = from
+	sellFilled.Taker = to
+	sellFilled.Price = newActivity.Price
+	sellFilled.Quantity = 1
+	ownershipChanged := s.newMarketEvent(log, eventsink.OwnershipChanged, int64(blockTime))
+	ownershipChanged.CollectionAddress = collection
+	ownershipChanged.TokenId = tokenId
+	ownershipChanged.From = from
+	ownershipChanged.To = to
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		// 保存行为信息-mysql，成交记录已存在说明已处理日志被清理后重放了这次成交，
+		// 跳过后续更新，避免重复扣减买单的剩余数量
+		result := tx.Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&newActivity)
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create activity")
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		events := []*eventsink.Event{sellFilled}
+		// 记录卖方订单回滚日志
+		if err := s.journalOrderUpdate(tx, log, sellOrderId); err != nil {
+			return err
+		}
+		// 更新卖方订单状态
+		if err := tx.Table(multi.OrderTableName(s.chain)).
+			Where("order_id = ?", sellOrderId).
+			Updates(map[string]interface{}{
+				"order_status":       multi.OrderStatusFilled,
+				"quantity_remaining": 0,
+				"taker":              to,
+			}).Error; err != nil {
+			return errors.Wrapf(err, "failed on update order status, order_id: %s", sellOrderId)
+		}
+		// 查询买方订单信息，不存在则无需更新，说明不是从平台前端发起的交易
+		var buyOrder multi.Order
+		err := tx.Table(multi.OrderTableName(s.chain)).
+			Where("order_id = ?", buyOrderId).
+			First(&buyOrder).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, "failed on get buy order")
+		}
+		if err == nil {
+			// 记录买方订单回滚日志
+			if err := s.addJournal(tx, orderJournal(log, &buyOrder)); err != nil {
+				return err
+			}
+			buyFilled := s.newMarketEvent(log, eventsink.OrderFilled, int64(blockTime))
+			buyFilled.OrderId = buyOrderId
+			buyFilled.OrderType = buyOrder.OrderType
+			buyFilled.CollectionAddress = collection
+			buyFilled.TokenId = tokenId
+			buyFilled.Maker = buyOrder.Maker
+			buyFilled.Taker = from
+			buyFilled.Price = newActivity.Price
+			buyFilled.Quantity = 1
+			events = append(events, buyFilled)
+			// 更新买方订单的剩余数量
+			if buyOrder.QuantityRemaining > 1 {
+				if err := tx.Table(multi.OrderTableName(s.chain)).
+					Where("order_id = ?", buyOrderId).
+					Update("quantity_remaining", buyOrder.QuantityRemaining-1).Error; err != nil {
+					return errors.Wrapf(err, "failed on update order quantity_remaining, order_id: %s", buyOrderId)
+				}
+			} else {
+				if err := tx.Table(multi.OrderTableName(s.chain)).
+					Where("order_id = ?", buyOrderId).
+					Updates(map[string]interface{}{
+						"order_status":       multi.OrderStatusFilled,
+						"quantity_remaining": 0,
+					}).Error; err != nil {
+					return errors.Wrapf(err, "failed on update order status, order_id: %s", buyOrderId)
+				}
+				// 完全成交的集合出价从订单簿中删除
+				if err := s.addOutbox(tx, multi.OutboxTradeEvent, &ordermanager.TradeEvent{
+					EventType:      ordermanager.Filled,
+					CollectionAddr: buyOrder.CollectionAddress,
+					TokenID:        buyOrder.TokenId,
+					OrderId:        buyOrderId,
+					OrderType:      buyOrder.OrderType,
+					BlockTime:      int64(blockTime),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		// 记录NFT所有者回滚日志
+		if err := s.journalItemOwner(tx, log, collection, tokenId); err != nil {
+			return err
+		}
+		// 更新NFT的所有者，订单簿合约只支持ERC-721，每次成交数量为1
+		if err := tx.Table(multi.ItemTableName(s.chain)).
+			Where("collection_address = ? and token_id = ?", strings.ToLower(collection), tokenId).
+			Update("owner", owner).Error; err != nil {
+			return errors.Wrap(err, "failed to update item owner")
+		}
+		// 发布市场事件
+		if err := s.addMarketEvents(tx, append(events, ownershipChanged)...); err != nil {
+			return err
+		}
+		// 保存行为信息-redis
+		return s.addOutbox(tx, multi.OutboxTradeEvent, &ordermanager.TradeEvent{
+			OrderId:        sellOrderId,
+			CollectionAddr: collection,
+			EventType:      ordermanager.Buy,
+			TokenID:        tokenId,
+			Price:          newActivity.Price,
+			From:           from,
+			To:             to,
+			BlockTime:      int64(blockTime),
+		})
+	})
+}
+
+// 处理取消订单事件
+func (s *Service) handleCancelEvent(log ethereumTypes.Log) error {
+	return s.handleCancel(log, false)
+}
+
+// handleCancel 取消订单，edited为true时表示订单被编辑替换，不记录取消活动
+func (s *Service) handleCancel(log ethereumTypes.Log, edited bool) error {
+	orderId := HexPrefix + hex.EncodeToString(log.Topics[1].Bytes())
+	// 获取指定区块时间
+	blockTime, err := s.blockTime(log.BlockNumber)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block time")
 	}
-	// 更新NFT的所有者
-	if err := s.db.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).
-		Where("collection_address = ? and token_id = ?", strings.ToLower(collection), tokenId).
-		Update("owner", owner).Error; err != nil {
-		xzap.WithContext(s.ctx).Error("failed to update item owner",
-			zap.Error(err))
-		return
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		// 查询订单信息，不存在则无需更新
+		var cancelOrder multi.Order
+		if err := tx.Table(multi.OrderTableName(s.chain)).
+			Where("order_id = ?", orderId).
+			First(&cancelOrder).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				xzap.WithContext(s.ctx).Warn("cancel order not found", zap.String("order_id", orderId))
+				return nil
+			}
+			return errors.Wrap(err, "failed on get cancel order")
+		}
+		// 记录回滚日志
+		if err := s.addJournal(tx, orderJournal(log, &cancelOrder)); err != nil {
+			return err
+		}
+		// 更新订单为取消状态
+		if err := tx.Table(multi.OrderTableName(s.chain)).
+			Where("order_id = ?", orderId).
+			Update("order_status", multi.OrderStatusCancelled).Error; err != nil {
+			return errors.Wrapf(err, "failed on update order status, order_id: %s", orderId)
+		}
+		// 保存行为记录-redis
+		if err := s.addOutbox(tx, multi.OutboxTradeEvent, &ordermanager.TradeEvent{
+			OrderId:        cancelOrder.OrderID,
+			CollectionAddr: cancelOrder.CollectionAddress,
+			TokenID:        cancelOrder.TokenId,
+			EventType:      ordermanager.Cancel,
+			BlockTime:      int64(blockTime),
+		}); err != nil {
+			return err
+		}
+		// 发布市场事件
+		cancelled := s.newMarketEvent(log, eventsink.OrderCancelled, int64(blockTime))
+		cancelled.OrderId = cancelOrder.OrderID
+		cancelled.OrderType = cancelOrder.OrderType
+		cancelled.CollectionAddress = cancelOrder.CollectionAddress
+		cancelled.TokenId = cancelOrder.TokenId
+		cancelled.Maker = cancelOrder.Maker
+		cancelled.Price = cancelOrder.Price
+		cancelled.Quantity = cancelOrder.QuantityRemaining
+		if err := s.addMarketEvents(tx, cancelled); err != nil {
+			return err
+		}
+		if edited {
+			return nil
+		}
+		// 设置行为类型
+		var activityType int
+		switch cancelOrder.OrderType {
+		case multi.ListingOrder:
+			activityType = multi.CancelListing
+		case multi.CollectionBidOrder:
+			activityType = multi.CancelCollectionBid
+		default:
+			activityType = multi.CancelItemBid
+		}
+		// 保存行为记录-mysql
+		newActivity := multi.Activity{
+			ActivityType:      activityType,
+			Maker:             cancelOrder.Maker,
+			Taker:             ZeroAddress,
+			MarketplaceID:     multi.MarketOrderBook,
+			CollectionAddress: cancelOrder.CollectionAddress,
+			TokenId:           cancelOrder.TokenId,
+			CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
+			Price:             cancelOrder.Price,
+			BlockNumber:       int64(log.BlockNumber),
+			TxHash:            log.TxHash.String(),
+			EventTime:         int64(blockTime),
+		}
+		if err := tx.Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&newActivity).Error; err != nil {
+			return errors.Wrap(err, "failed on create activity")
+		}
+		return nil
+	})
+}
+
+// 处理编辑订单事件，editOrders在同一交易中依次发出旧订单的LogCancel和新订单的LogMake
+func (s *Service) handleEditEvent(cancelLog, makeLog ethereumTypes.Log) error {
+	oldOrderId := HexPrefix + hex.EncodeToString(cancelLog.Topics[1].Bytes())
+	if err := s.handleCancel(cancelLog, true); err != nil {
+		return err
 	}
-	// 保存行为信息-redis
-	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
-		OrderId:        sellOrderId,
-		CollectionAddr: collection,
-		EventType:      ordermanager.Buy,
-		TokenID:        tokenId,
-		From:           from,
-		To:             to,
-	}, s.chain); err != nil {
-		xzap.WithContext(s.ctx).Error("failed on add update price event",
-			zap.Error(err),
-			zap.String("type", "sale"),
-			zap.String("order_id", sellOrderId))
+	return s.handleMake(makeLog, oldOrderId)
+}
+
+// isEditPair 判断LogCancel与紧随其后的LogMake是否由同一次editOrders产生
+func isEditPair(cancelLog, makeLog ethereumTypes.Log) bool {
+	if len(makeLog.Topics) < 4 || len(cancelLog.Topics) < 3 {
+		return false
 	}
+	return makeLog.Topics[0].String() == LogMakeTopic &&
+		makeLog.TxHash == cancelLog.TxHash &&
+		makeLog.Index > cancelLog.Index &&
+		makeLog.Topics[3] == cancelLog.Topics[2]
 }
 
-// 处理取消订单事件
-func (s *Service) handleCancelEvent(log ethereumTypes.Log) {
-	// 更新订单为取消状态
-	orderId := HexPrefix + hex.EncodeToString(log.Topics[1].Bytes())
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-		Where("order_id = ?", orderId).
-		Update("order_status", multi.OrderStatusCancelled).Error; err != nil {
-		xzap.WithContext(s.ctx).Error("failed on update order status",
-			zap.String("order_id", orderId))
-		return
+// 处理订单被跳过事件
+func (s *Service) handleSkipOrderEvent(log ethereumTypes.Log) error {
+	var event struct {
+		OrderKey [32]byte
+		Salt     uint64
 	}
-	// 查询订单信息
-	var cancelOrder multi.Order
-	if err := s.db.WithContext(s.ctx).Table(multi.OrderTableName(s.chain)).
-		Where("order_id = ?", orderId).
-		First(&cancelOrder).Error; err != nil {
-		xzap.WithContext(s.ctx).Error("failed on get cancel order",
-			zap.Error(err))
-		return
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "LogSkipOrder", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking LogSkipOrder event:", zap.Error(err))
+		return nil
 	}
+	orderId := HexPrefix + hex.EncodeToString(event.OrderKey[:])
 	// 获取指定区块时间
-	blockTime, err := s.chainClient.BlockTimeByNumber(s.ctx, big.NewInt(int64(log.BlockNumber)))
+	blockTime, err := s.blockTime(log.BlockNumber)
 	if err != nil {
-		xzap.WithContext(s.ctx).Error("failed to get block time", zap.Error(err))
-		return
+		return errors.Wrap(err, "failed to get block time")
 	}
-	// 设置行为类型
-	var activityType int
-	switch cancelOrder.OrderType {
-	case multi.ListingOrder:
-		activityType = multi.CancelListing
-	case multi.CollectionBidOrder:
-		activityType = multi.CancelCollectionBid
-	default:
-		activityType = multi.CancelItemBid
-	}
-	// 保存行为记录-mysql
-	newActivity := multi.Activity{
-		ActivityType:      activityType,
-		Maker:             cancelOrder.Maker,
-		Taker:             ZeroAddress,
-		MarketplaceID:     multi.MarketOrderBook,
-		CollectionAddress: cancelOrder.CollectionAddress,
-		TokenId:           cancelOrder.TokenId,
-		CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
-		Price:             cancelOrder.Price,
-		BlockNumber:       int64(log.BlockNumber),
-		TxHash:            log.TxHash.String(),
-		EventTime:         int64(blockTime),
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		// 根据订单当前状态推断跳过原因
+		var order multi.Order
+		err := tx.Table(multi.OrderTableName(s.chain)).
+			Where("order_id = ?", orderId).
+			First(&order).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, "failed on get skip order")
+		}
+		var reason string
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			reason = multi.SkipReasonInvalidMake
+		case order.OrderStatus == multi.OrderStatusFilled:
+			reason = multi.SkipReasonOrderFilled
+		case order.OrderStatus == multi.OrderStatusCancelled:
+			reason = multi.SkipReasonOrderCancelled
+		case order.Salt != int64(event.Salt):
+			// 编辑时新订单无效，事件中携带的是新订单的salt
+			reason = multi.SkipReasonInvalidEditOrder
+		default:
+			reason = multi.SkipReasonRejected
+		}
+		if err := tx.Table(multi.OrderSkipTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&multi.OrderSkip{
+			OrderID:     orderId,
+			Salt:        int64(event.Salt),
+			Reason:      reason,
+			BlockNumber: int64(log.BlockNumber),
+			TxHash:      log.TxHash.String(),
+			LogIndex:    int64(log.Index),
+			EventTime:   int64(blockTime),
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on create order skip")
+		}
+		return nil
+	})
+}
+
+// 处理批量撮合单笔失败事件
+func (s *Service) handleBatchMatchInnerErrorEvent(log ethereumTypes.Log) error {
+	var event struct {
+		Offset *big.Int
+		Msg    []byte
 	}
-	if err := s.db.WithContext(s.ctx).Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
-		DoNothing: true,
-	}).Create(&newActivity).Error; err != nil {
-		xzap.WithContext(s.ctx).Warn("failed on create activity",
-			zap.Error(err))
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "BatchMatchInnerError", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking BatchMatchInnerError event:", zap.Error(err))
+		return nil
 	}
-	// 保存行为记录-redis
-	if err := ordermanager.AddUpdatePriceEvent(s.kv, &ordermanager.TradeEvent{
-		OrderId:        cancelOrder.OrderID,
-		CollectionAddr: cancelOrder.CollectionAddress,
-		TokenID:        cancelOrder.TokenId,
-		EventType:      ordermanager.Cancel,
-	}, s.chain); err != nil {
-		xzap.WithContext(s.ctx).Error("failed on add update price event",
-			zap.Error(err),
-			zap.String("type", "cancel"),
-			zap.String("order_id", cancelOrder.OrderID))
+	// 获取指定区块时间
+	blockTime, err := s.blockTime(log.BlockNumber)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block time")
 	}
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		if err := tx.Table(multi.BatchMatchErrorTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&multi.BatchMatchError{
+			TxHash:      log.TxHash.String(),
+			LogIndex:    int64(log.Index),
+			BlockNumber: int64(log.BlockNumber),
+			MatchOffset: event.Offset.Int64(),
+			RevertData:  HexPrefix + hex.EncodeToString(event.Msg),
+			Reason:      s.decodeRevertReason(event.Msg),
+			EventTime:   int64(blockTime),
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on create batch match error")
+		}
+		return nil
+	})
+}
+
+// decodeRevertReason 解析revert数据，支持Error(string)和合约ABI中声明的自定义错误
+func (s *Service) decodeRevertReason(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	for name, abiErr := range s.parsedAbi.Errors {
+		if bytes.Equal(abiErr.ID[:4], data[:4]) {
+			return name
+		}
+	}
+	return HexPrefix + hex.EncodeToString(data[:4])
+}
+
+// 处理协议手续费比例变更事件
+func (s *Service) handleProtocolShareEvent(log ethereumTypes.Log) error {
+	share := new(big.Int).SetBytes(log.Topics[1].Bytes())
+	// 获取指定区块时间
+	blockTime, err := s.blockTime(log.BlockNumber)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block time")
+	}
+	return s.applyLog(log, func(tx *gorm.DB) error {
+		if err := tx.Table(multi.ProtocolShareTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&multi.ProtocolShare{
+			ProtocolShare: decimal.NewFromBigInt(share, 0),
+			BlockNumber:   int64(log.BlockNumber),
+			TxHash:        log.TxHash.String(),
+			LogIndex:      int64(log.Index),
+			EventTime:     int64(blockTime),
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on create protocol share")
+		}
+		return nil
+	})
 }
 
 // 处理地板价
@@ -598,7 +1031,7 @@ func (s *Service) UpKeepingCollectionFloorChangeLoop() {
 	}
 }
 
-// 删除过期地板价格
+// 删除过期地板价格、出价记录和5分钟K线
 func (s *Service) deleteExpireCollectionFloorChangeFromDatabase() error {
 	stmt := fmt.Sprintf(`DELETE FROM %s where event_time < UNIX_TIMESTAMP() - %d`, gdb.GetMultiProjectCollectionFloorPriceTableName(s.cfg.ProjectCfg.Name, s.chain), comm.CollectionFloorTimeRange)
 
@@ -606,6 +1039,19 @@ func (s *Service) deleteExpireCollectionFloorChangeFromDatabase() error {
 		return errors.Wrap(err, "failed on delete expire collection floor price")
 	}
 
+	stmt = fmt.Sprintf(`DELETE FROM %s where event_time < UNIX_TIMESTAMP() - %d`, gdb.GetMultiProjectCollectionBidPriceTableName(s.cfg.ProjectCfg.Name, s.chain), comm.CollectionFloorTimeRange)
+
+	if err := s.db.Exec(stmt).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expire collection bid price")
+	}
+
+	// 只清理5分钟K线，小时和日K线长期保留
+	stmt = fmt.Sprintf(`DELETE FROM %s where period = '5m' and open_time < UNIX_TIMESTAMP() - %d`, gdb.GetMultiProjectCollectionFloorCandleTableName(s.cfg.ProjectCfg.Name, s.chain), comm.CollectionFloorTimeRange)
+
+	if err := s.db.Exec(stmt).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expire collection floor candle")
+	}
+
 	return nil
 }
 
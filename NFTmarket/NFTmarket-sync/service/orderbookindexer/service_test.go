@@ -28,7 +28,7 @@ func TestSyncEvent(t *testing.T) {
 	})
 
 	chainClient, _ := chainclient.New(10, "https://rpc.ankr.com/optimism/9c6c678ebcb56da1cb80f7632c7c02264831232c3d53453c7726a611e7ca36d7")
-	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil)
+	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil, nil, nil)
 
 	query := types.FilterQuery{
 		FromBlock: new(big.Int).SetUint64(111819366),
@@ -65,7 +65,7 @@ func TestHandleMakeEvent(t *testing.T) {
 		MaxOpenConns: 1500,
 	})
 	chainClient, _ := chainclient.New(10, "https://rpc.ankr.com/optimism/9c6c678ebcb56da1cb80f7632c7c02264831232c3d53453c7726a611e7ca36d7")
-	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil)
+	orderbookSyncer := New(ctx, nil, db, nil, chainClient, 10, "optimism", nil, nil, nil)
 	data, _ := hex.DecodeString("c773ae81bc9a186dc6c5d70a486730a6f734578ae1a0116acd0aaaf69250d2650000000000000000000000000000000000000000000000000000000000000000000000000000000000000000e7f1725e7734ce288f8367e1bb143e90bb3f05120000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000002386f26fc10000000000000000000000000000000000000000000000000000000000006558875d0000000000000000000000000000000000000000000000000000000000000001")
 	log := ethereumTypes.Log{
 		Address: common.HexToAddress("0x123"),
@@ -81,3 +81,45 @@ func TestHandleMakeEvent(t *testing.T) {
 	}
 	orderbookSyncer.handleMakeEvent(log)
 }
+
+func TestIsEditPair(t *testing.T) {
+	maker := common.BytesToHash(common.HexToAddress("0x1234").Bytes())
+	txHash := common.HexToHash("0xaa")
+	cancelLog := ethereumTypes.Log{
+		TxHash: txHash,
+		Index:  1,
+		Topics: []common.Hash{common.HexToHash(LogCancelTopic), common.HexToHash("0x01"), maker},
+	}
+	makeLog := ethereumTypes.Log{
+		TxHash: txHash,
+		Index:  3,
+		Topics: []common.Hash{common.HexToHash(LogMakeTopic), {}, {}, maker},
+	}
+	if !isEditPair(cancelLog, makeLog) {
+		t.Errorf("expected cancel and make in the same tx to be an edit")
+	}
+
+	makeLog.TxHash = common.HexToHash("0xbb")
+	if isEditPair(cancelLog, makeLog) {
+		t.Errorf("expected cancel and make in different txs not to be an edit")
+	}
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	orderbookSyncer := New(context.Background(), nil, nil, nil, nil, 10, "optimism", nil, nil, nil)
+
+	// Error(string)
+	data, _ := hex.DecodeString("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000000b" +
+		"48454c4c4f20574f524c44000000000000000000000000000000000000000000")
+	if reason := orderbookSyncer.decodeRevertReason(data); reason != "HELLO WORLD" {
+		t.Errorf("unexpected revert reason: %s", reason)
+	}
+
+	// 合约自定义错误
+	abiErr := orderbookSyncer.parsedAbi.Errors["EnforcedPause"]
+	if reason := orderbookSyncer.decodeRevertReason(abiErr.ID[:4]); reason != "EnforcedPause" {
+		t.Errorf("unexpected revert reason: %s", reason)
+	}
+}
@@ -0,0 +1,218 @@
+-- db/migrations中订单簿同步用到的表的SQLite版本，用于回放测试
+-- 文本列使用NOCASE，与MySQL的utf8mb4_general_ci一样不区分大小写比较地址
+
+create table ob_indexed_status
+(
+    id                 integer primary key autoincrement,
+    chain_id           bigint      default 1  not null,
+    last_indexed_block bigint      default 0  null,
+    last_indexed_time  bigint                 null,
+    index_type         tinyint     default 0  not null,
+    contract_address   varchar(42) default '' not null collate nocase,
+    leader_token       bigint      default 0  not null,
+    create_time        bigint                 null,
+    update_time        bigint                 null
+);
+
+create table ob_activity_sepolia
+(
+    id                 integer primary key autoincrement,
+    activity_type      tinyint                 not null,
+    maker              varchar(42)             null collate nocase,
+    taker              varchar(42)             null collate nocase,
+    marketplace_id     tinyint     default 0   not null,
+    collection_address varchar(42)             null collate nocase,
+    token_id           varchar(128)            null,
+    currency_address   varchar(42) default '1' not null collate nocase,
+    price              decimal(30) default 0   not null,
+    sell_price         decimal(30) default 0   not null,
+    buy_price          decimal(30) default 0   not null,
+    block_number       bigint      default 0   not null,
+    tx_hash            varchar(66)             null collate nocase,
+    event_time         bigint                  null,
+    create_time        bigint                  null,
+    update_time        bigint                  null,
+    unique (tx_hash, collection_address, token_id, activity_type)
+);
+
+create table ob_item_sepolia
+(
+    id                 integer primary key autoincrement,
+    chain_id           bigint       default 1 not null,
+    token_id           varchar(128)           not null,
+    name               varchar(128)           not null,
+    owner              varchar(42)            null collate nocase,
+    collection_address varchar(42)            null collate nocase,
+    creator            varchar(42)            not null collate nocase,
+    supply             bigint                 not null,
+    list_price         decimal(30)            null,
+    list_time          bigint                 null,
+    sale_price         decimal(30)            null,
+    views              bigint                 null,
+    create_time        bigint                 null,
+    update_time        bigint                 null,
+    unique (collection_address, token_id)
+);
+
+create table ob_item_holder_sepolia
+(
+    id                 integer primary key autoincrement,
+    collection_address varchar(42)           not null collate nocase,
+    token_id           varchar(128)          not null,
+    owner              varchar(42)           not null collate nocase,
+    balance            decimal(65) default 0 not null,
+    create_time        bigint                null,
+    update_time        bigint                null,
+    unique (collection_address, token_id, owner)
+);
+
+create table ob_collection_sepolia
+(
+    id                 integer primary key autoincrement,
+    symbol             varchar(128)         not null,
+    chain_id           bigint     default 1 not null,
+    auth               tinyint    default 0 not null,
+    token_standard     bigint               not null,
+    name               varchar(128)         not null,
+    creator            varchar(42)          not null collate nocase,
+    address            varchar(42)          not null collate nocase,
+    owner_amount       bigint     default 0 not null,
+    item_amount        bigint     default 0 not null,
+    floor_price_status int        default 0 not null,
+    create_time        bigint               null,
+    update_time        bigint               null,
+    unique (address)
+);
+
+create table ob_order_sepolia
+(
+    id                 integer primary key autoincrement,
+    marketplace_id     tinyint     default 0   not null,
+    collection_address varchar(42)             null collate nocase,
+    token_id           varchar(128)            null,
+    order_id           varchar(66)             not null collate nocase,
+    order_status       tinyint     default 0   not null,
+    event_time         bigint                  null,
+    expire_time        bigint                  null,
+    price              decimal(30) default 0   not null,
+    maker              varchar(42)             null collate nocase,
+    taker              varchar(42)             null collate nocase,
+    quantity_remaining bigint      default 0   not null,
+    size               bigint      default 1   not null,
+    currency_address   varchar(42) default '1' not null collate nocase,
+    order_type         tinyint                 not null,
+    salt               bigint      default 0   null,
+    create_time        bigint                  null,
+    update_time        bigint                  null,
+    unique (order_id)
+);
+
+create table ob_indexed_block_sepolia
+(
+    id               integer primary key autoincrement,
+    contract_address varchar(42) default '' not null collate nocase,
+    block_number     bigint                 not null,
+    block_hash       varchar(66)            not null collate nocase,
+    parent_hash      varchar(66)            not null collate nocase,
+    create_time      bigint                 null,
+    update_time      bigint                 null,
+    unique (contract_address, block_number)
+);
+
+create table ob_indexer_journal_sepolia
+(
+    id                      integer primary key autoincrement,
+    contract_address        varchar(42)  default '' not null collate nocase,
+    block_number            bigint                  not null,
+    tx_hash                 varchar(66)             not null collate nocase,
+    journal_type            tinyint                 not null,
+    order_id                varchar(66)             null collate nocase,
+    collection_address      varchar(42)             null collate nocase,
+    token_id                varchar(128)            null,
+    prev_order_status       tinyint      default 0  not null,
+    prev_quantity_remaining bigint       default 0  not null,
+    prev_taker              varchar(42)  default '' not null collate nocase,
+    prev_owner              varchar(42)  default '' not null collate nocase,
+    prev_balance            decimal(65)  default 0  not null,
+    create_time             bigint                  null,
+    update_time             bigint                  null
+);
+
+create table ob_processed_log_sepolia
+(
+    id               integer primary key autoincrement,
+    contract_address varchar(42) default '' not null collate nocase,
+    tx_hash          varchar(66)            not null collate nocase,
+    log_index        bigint                 not null,
+    block_number     bigint                 not null,
+    create_time      bigint                 null,
+    update_time      bigint                 null,
+    unique (tx_hash, log_index)
+);
+
+create table ob_outbox_sepolia
+(
+    id           integer primary key autoincrement,
+    message_type tinyint not null,
+    payload      text    not null,
+    create_time  bigint  null,
+    update_time  bigint  null
+);
+
+create table ob_order_edit_sepolia
+(
+    id           integer primary key autoincrement,
+    old_order_id varchar(66)      not null collate nocase,
+    new_order_id varchar(66)      not null collate nocase,
+    maker        varchar(42)      not null collate nocase,
+    block_number bigint           not null,
+    tx_hash      varchar(66)      not null collate nocase,
+    log_index    bigint default 0 not null,
+    event_time   bigint default 0 null,
+    create_time  bigint           null,
+    update_time  bigint           null,
+    unique (tx_hash, log_index)
+);
+
+create table ob_order_skip_sepolia
+(
+    id           integer primary key autoincrement,
+    order_id     varchar(66)      not null collate nocase,
+    salt         bigint           not null,
+    reason       varchar(32)      not null,
+    block_number bigint           not null,
+    tx_hash      varchar(66)      not null collate nocase,
+    log_index    bigint           not null,
+    event_time   bigint default 0 null,
+    create_time  bigint           null,
+    update_time  bigint           null,
+    unique (tx_hash, log_index)
+);
+
+create table ob_batch_match_error_sepolia
+(
+    id           integer primary key autoincrement,
+    tx_hash      varchar(66)      not null collate nocase,
+    log_index    bigint           not null,
+    block_number bigint           not null,
+    match_offset bigint           not null,
+    revert_data  text             null,
+    reason       varchar(512)     null,
+    event_time   bigint default 0 null,
+    create_time  bigint           null,
+    update_time  bigint           null,
+    unique (tx_hash, log_index)
+);
+
+create table ob_protocol_share_sepolia
+(
+    id             integer primary key autoincrement,
+    protocol_share decimal(30)      not null,
+    block_number   bigint           not null,
+    tx_hash        varchar(66)      not null collate nocase,
+    log_index      bigint           not null,
+    event_time     bigint default 0 null,
+    create_time    bigint           null,
+    update_time    bigint           null,
+    unique (tx_hash, log_index)
+);
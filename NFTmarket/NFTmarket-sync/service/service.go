@@ -3,38 +3,130 @@ package service
 import (
 	"context"
 	"fmt"
-	"sync"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/chain"
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/media"
+	"github.com/ProjectsTask/EasySwapBase/metadatarefresh"
 	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/core/stores/kv"
 	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	"github.com/ProjectsTask/EasySwapSync/service/orderbookindexer"
+	"github.com/ProjectsTask/EasySwapSync/service/transferindexer"
 
 	"github.com/ProjectsTask/EasySwapSync/model"
 	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/collectionimporter"
 	"github.com/ProjectsTask/EasySwapSync/service/config"
 )
 
+const (
+	ChainStartRetryInterval = 10 // in seconds
+	FilterReloadInterval    = 60 // 重新加载已导入collection的间隔(秒)
+	LeaderCampaignDivisor   = 3  // 每隔租约时长的1/3竞选一次
+)
+
 type Service struct {
-	ctx              context.Context            // 上下文
-	config           *config.Config             // 配置信息
-	kvStore          *xkv.Store                 // Redis
-	db               *gorm.DB                   // Mysql
-	wg               *sync.WaitGroup            // 等待
-	collectionFilter *collectionfilter.Filter   // 过滤器
-	orderbookIndexer *orderbookindexer.Service  // 订单簿服务
-	orderManager     *ordermanager.OrderManager // 订单管理器
+	ctx       context.Context    // 上下文
+	cancel    context.CancelFunc // 失去leader时停止所有链的同步
+	config    *config.Config     // 配置信息
+	kvStore   *xkv.Store         // Redis
+	db        *gorm.DB           // Mysql
+	loops     *lifecycle.Group   // 竞选和启动各链的后台协程
+	chains    []*chainService    // 每条链的同步服务
+	eventSink eventsink.Sink     // 市场事件发布
+	leader    *xkv.Leader        // leader选举，为nil时未启用
+	exit      chan error         // 失去leader等需要进程退出的错误
+}
+
+// chainService 一条链上的同步服务，同一条链的多个订单簿合约部署共用过滤器、订单管理器和Transfer同步
+type chainService struct {
+	chainId           int64
+	chain             string
+	collectionFilter  *collectionfilter.Filter    // 过滤器
+	orderbookIndexers []*orderbookindexer.Service // 每个合约部署的订单簿服务
+	transferIndexer   *transferindexer.Service    // Transfer同步服务
+	orderManager      *ordermanager.OrderManager  // 订单管理器
+	metadataRefresher *metadatarefresh.Service    // metadata刷新，未启用时为nil
+	importer          *collectionimporter.Service // collection导入
+	mediaUploader     *media.Uploader             // item图片上传，未配置存储时为nil
+	chainClient       *chainclient.FailoverClient // 多节点链客户端
 }
 
 func New(ctx context.Context, cfg *config.Config) (*Service, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	// 初始化Redis
+	kvStore := NewKvStore(cfg)
+	// 初始化mysql
+	db := model.NewDB(cfg.DB)
+	// 初始化市场事件发布
+	eventSink, err := NewEventSink(cfg.EventSink, kvStore)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 初始化leader选举
+	var leader *xkv.Leader
+	if cfg.LeaderElection.Enable {
+		leader = xkv.NewLeader(kvStore, leaderElectionName(cfg), leaderID(), cfg.LeaderElection.GetLeaseTTL())
+	}
+
+	// 按链分组合约部署，保持配置中的顺序
+	var chainIds []int64
+	deployments := make(map[int64][]config.Deployment)
+	for _, d := range cfg.GetDeployments() {
+		if _, ok := deployments[d.ChainCfg.ID]; !ok {
+			chainIds = append(chainIds, d.ChainCfg.ID)
+		}
+		deployments[d.ChainCfg.ID] = append(deployments[d.ChainCfg.ID], d)
+	}
+	// 单条链初始化失败时跳过，不影响其它链
+	var chains []*chainService
+	for _, chainId := range chainIds {
+		cs, err := newChainService(ctx, cfg, db, kvStore, eventSink, leader, deployments[chainId])
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on create chain service, skip it",
+				zap.Int64("chain_id", chainId), zap.Error(err))
+			continue
+		}
+		chains = append(chains, cs)
+	}
+	if len(chains) == 0 {
+		cancel()
+		return nil, errors.New("no chain service available")
+	}
+	// 设置结构体
+	manager := Service{
+		ctx:       ctx,
+		cancel:    cancel,
+		config:    cfg,
+		db:        db,
+		kvStore:   kvStore,
+		chains:    chains,
+		eventSink: eventSink,
+		leader:    leader,
+		exit:      make(chan error, 1),
+		loops:     lifecycle.NewGroup(),
+	}
+	// 返回
+	return &manager, nil
+}
+
+// NewKvStore 根据配置初始化Redis
+func NewKvStore(cfg *config.Config) *xkv.Store {
 	var kvConf kv.KvConf
 	for _, con := range cfg.Kv.Redis {
 		kvConf = append(kvConf, cache.NodeConf{
@@ -46,50 +138,355 @@ func New(ctx context.Context, cfg *config.Config) (*Service, error) {
 			Weight: 2,
 		})
 	}
-	kvStore := xkv.NewStore(kvConf)
-	// 初始化mysql
-	var err error
-	db := model.NewDB(cfg.DB)
+	return xkv.NewStore(kvConf)
+}
+
+// newChainService 初始化一条链的同步服务
+func newChainService(ctx context.Context, cfg *config.Config, db *gorm.DB, kvStore *xkv.Store, eventSink eventsink.Sink, leader *xkv.Leader, deployments []config.Deployment) (*chainService, error) {
+	chainCfg := cfg.WithDeployment(deployments[0])
+	switch chainCfg.ChainCfg.ID {
+	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID:
+	default:
+		return nil, errors.Errorf("unsupported chain id: %d", chainCfg.ChainCfg.ID)
+	}
 	// 初始化过滤器
-	collectionFilter := collectionfilter.New(ctx, db, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
+	collectionFilter := collectionfilter.New(ctx, db, chainCfg.ChainCfg.Name, chainCfg.ProjectCfg.Name)
 	// 初始化管理器
-	orderManager := ordermanager.New(ctx, db, kvStore, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
-	// 初始化链客户端
-	var orderbookSyncer *orderbookindexer.Service
-	var chainClient chainclient.ChainClient
-	fmt.Println("chainClient url:" + cfg.AnkrCfg.HttpsUrl + cfg.AnkrCfg.ApiKey)
-	switch cfg.ChainCfg.ID {
-	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID:
-		// 以太坊客户端
-		chainClient, err = chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on create evm client")
+	orderManager := ordermanager.New(ctx, db, kvStore, chainCfg.ChainCfg.Name, chainCfg.ProjectCfg.Name)
+	orderManager.SetLeader(leader)
+	// 以太坊客户端，同一条链的订单簿同步和NFT链上服务共用节点的健康状态和限流
+	chainClient, err := chainclient.NewFailover(int(chainCfg.ChainCfg.ID), chainCfg.ChainCfg.Name, chainCfg.AnkrCfg.GetEndpoints())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create evm client")
+	}
+	// NFT链上服务
+	parse := cfg.GetMetadataParse()
+	nodeSrv, err := nftchainservice.NewWithClient(ctx, chainClient, chainCfg.ChainCfg.Name,
+		parse.NameTags, parse.ImageTags, parse.AttributesTags, parse.TraitNameTags, parse.TraitValueTags)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create nft chain service")
+	}
+	if cfg.Resolver != nil {
+		if err := nodeSrv.SetResolverConfig(cfg.Resolver); err != nil {
+			return nil, err
 		}
-		orderbookSyncer = orderbookindexer.New(ctx, cfg, db, kvStore, chainClient, cfg.ChainCfg.ID, cfg.ChainCfg.Name, orderManager)
 	}
-	// 设置结构体
-	manager := Service{
-		ctx:              ctx,
-		config:           cfg,
-		db:               db,
-		kvStore:          kvStore,
+
+	cs := &chainService{
+		chainId:          chainCfg.ChainCfg.ID,
+		chain:            chainCfg.ChainCfg.Name,
 		collectionFilter: collectionFilter,
-		orderbookIndexer: orderbookSyncer,
 		orderManager:     orderManager,
-		wg:               &sync.WaitGroup{},
+		chainClient:      chainClient,
+		transferIndexer: transferindexer.New(ctx, chainCfg, db, nodeSrv, collectionFilter,
+			chainCfg.ChainCfg.ID, chainCfg.ChainCfg.Name, orderManager, eventSink, leader),
 	}
-	// 返回
-	return &manager, nil
+	// 导入collection时直接调用刷新获取metadata，不依赖刷新队列是否启用
+	refresher := metadatarefresh.New(ctx, db, kvStore, nodeSrv,
+		chainCfg.ChainCfg.Name, chainCfg.ChainCfg.ID, chainCfg.ProjectCfg.Name)
+	if !cfg.MetadataRefresh.Disable {
+		cs.metadataRefresher = refresher
+	}
+	if cfg.Media != nil && cfg.Media.Type != "" {
+		mediaMgr, err := media.NewManager(cfg.Media)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on create media manager")
+		}
+		cs.mediaUploader = media.NewUploader(ctx, db, mediaMgr, chainCfg.ChainCfg.Name)
+	}
+	cs.importer = collectionimporter.New(ctx, db, kvStore, nodeSrv, refresher, collectionFilter,
+		chainCfg.ChainCfg.ID, chainCfg.ChainCfg.Name, chainCfg.ProjectCfg.Name)
+	for _, d := range deployments {
+		deploymentCfg := cfg.WithDeployment(d)
+		cs.orderbookIndexers = append(cs.orderbookIndexers, orderbookindexer.New(ctx, deploymentCfg, db, kvStore,
+			chainClient, d.ChainCfg.ID, d.ChainCfg.Name, orderManager, eventSink, leader))
+	}
+	return cs, nil
 }
 
+// Start 启动服务，启用leader选举时在后台竞选，当选后才启动同步
+// 回补时已持有租约则直接启动同步
 func (s *Service) Start() error {
+	if s.leader == nil || s.leader.IsLeader() {
+		s.startChains()
+		return nil
+	}
+	s.loops.Go("leader", s.leaderLoop)
+	return nil
+}
+
+// Stop 停止所有链的同步并等待后台协程退出，ctx结束时返回仍在运行的协程
+// 1. 通知所有后台协程退出，订单簿和Transfer同步正在处理的事务随之回滚，同步进度不变
+// 2. 订单管理器处理完当前事件后写入最后的快照和K线
+// 3. 释放leader租约，follower立即接管
+func (s *Service) Stop(ctx context.Context) error {
+	s.cancel()
+
+	var errs []string
+	wait := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	wait("service", s.loops.Wait(ctx))
+	for _, cs := range s.chains {
+		for _, indexer := range cs.orderbookIndexers {
+			wait(cs.chain+"/orderbook", indexer.Wait(ctx))
+		}
+		wait(cs.chain+"/transfer", cs.transferIndexer.Wait(ctx))
+		if cs.metadataRefresher != nil {
+			wait(cs.chain+"/metadata", cs.metadataRefresher.Wait(ctx))
+		}
+		if cs.mediaUploader != nil {
+			wait(cs.chain+"/media", cs.mediaUploader.Wait(ctx))
+		}
+	}
+	for _, cs := range s.chains {
+		wait(cs.chain+"/ordermanager", cs.orderManager.Stop(ctx))
+	}
+
+	if s.leader != nil && s.leader.IsLeader() {
+		if err := s.leader.Resign(context.WithoutCancel(ctx)); err != nil {
+			xzap.WithContext(ctx).Error("failed on resign sync leader", zap.Error(err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("failed on stop sync service, %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// LoopStatus 返回所有后台协程的运行状态，key为"<chain>/<组件>/<协程>"
+func (s *Service) LoopStatus() map[string]lifecycle.State {
+	status := s.loops.Status()
+	for _, cs := range s.chains {
+		for _, indexer := range cs.orderbookIndexers {
+			for name, state := range indexer.Status() {
+				status[fmt.Sprintf("%s/orderbook:%s/%s", cs.chain, strings.ToLower(indexer.Health().DexAddress), name)] = state
+			}
+		}
+		for name, state := range cs.transferIndexer.Status() {
+			status[fmt.Sprintf("%s/transfer/%s", cs.chain, name)] = state
+		}
+		for name, state := range cs.orderManager.Status() {
+			status[fmt.Sprintf("%s/ordermanager/%s", cs.chain, name)] = state
+		}
+		if cs.metadataRefresher != nil {
+			for name, state := range cs.metadataRefresher.Status() {
+				status[fmt.Sprintf("%s/metadata/%s", cs.chain, name)] = state
+			}
+		}
+		if cs.mediaUploader != nil {
+			for name, state := range cs.mediaUploader.Status() {
+				status[fmt.Sprintf("%s/media/%s", cs.chain, name)] = state
+			}
+		}
+	}
+	return status
+}
+
+// Exit 返回需要进程退出的错误，例如失去leader身份
+func (s *Service) Exit() <-chan error {
+	return s.exit
+}
+
+func (s *Service) startChains() {
+	for _, cs := range s.chains {
+		cs := cs
+		s.loops.Go(cs.chain+"/start", func() {
+			s.startChain(cs)
+		})
+	}
+}
+
+// leaderLoop 竞选leader，当选后启动所有链的同步并续期租约
+// 失去租约时停止同步并通知进程退出，由进程管理器重启为follower；正常退出时由Stop释放租约
+func (s *Service) leaderLoop() {
+	ttl := s.config.LeaderElection.GetLeaseTTL()
+	xzap.WithContext(s.ctx).Info("campaign for sync leader", zap.String("id", s.leader.ID()))
+	token, err := s.leader.Campaign(s.ctx, ttl/LeaderCampaignDivisor)
+	if err != nil {
+		return
+	}
+	xzap.WithContext(s.ctx).Info("elected as sync leader",
+		zap.String("id", s.leader.ID()), zap.Int64("token", token))
+	s.startChains()
+	s.keepLeader()
+}
+
+// keepLeader 续期租约，失去租约时停止同步并通知进程退出
+func (s *Service) keepLeader() {
+	err := s.leader.Keep(s.ctx)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	xzap.WithContext(s.ctx).Error("sync leader lease lost, stop syncing",
+		zap.String("id", s.leader.ID()), zap.Int64("token", s.leader.Token()), zap.Error(err))
+	s.cancel()
+	s.exit <- err
+}
+
+// acquireLeader 启用leader选举时获取租约并在后台续期，租约被其它实例持有时返回错误
+func (s *Service) acquireLeader() error {
+	if s.leader == nil || s.leader.IsLeader() {
+		return nil
+	}
+	token, ok, err := s.leader.TryAcquire(s.ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("sync leader lease is held by another instance, stop it first")
+	}
+	xzap.WithContext(s.ctx).Info("acquired sync leader lease",
+		zap.String("id", s.leader.ID()), zap.Int64("token", token))
+	s.loops.Go("leader", s.keepLeader)
+	return nil
+}
+
+// leaderElectionName 同一项目的所有副本参与同一个选举
+func leaderElectionName(cfg *config.Config) string {
+	return "sync:" + strings.ToLower(cfg.ProjectCfg.Name)
+}
+
+// leaderID 当前进程在选举中的标识
+func leaderID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// startChain 启动一条链的同步服务，加载collection失败时重试
+func (s *Service) startChain(cs *chainService) {
 	// 不要移动位置
-	if err := s.collectionFilter.PreloadCollections(); err != nil {
-		return errors.Wrap(err, "failed on preload collection to filter")
+	for {
+		err := cs.collectionFilter.PreloadCollections()
+		if err == nil {
+			break
+		}
+		xzap.WithContext(s.ctx).Error("failed on preload collection to filter",
+			zap.String("chain", cs.chain), zap.Error(err))
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(ChainStartRetryInterval * time.Second):
+		}
+	}
+	// 停止后不再启动
+	if s.ctx.Err() != nil {
+		return
+	}
+	// 启动订单簿同步
+	for _, indexer := range cs.orderbookIndexers {
+		indexer.Start()
 	}
-	// 启动链客户端
-	s.orderbookIndexer.Start()
+	cs.orderbookIndexers[0].StartChainLoops()
+	// 启动Transfer同步
+	cs.transferIndexer.Start()
 	// 启动订单管理器
-	s.orderManager.Start()
-	return nil
+	cs.orderManager.Start()
+	// 启动metadata刷新
+	if cs.metadataRefresher != nil {
+		cs.metadataRefresher.Start()
+	}
+	// 启动图片上传
+	if cs.mediaUploader != nil {
+		cs.mediaUploader.Start()
+	}
+	// 定时加载通过import命令导入的collection
+	s.loops.Go(cs.chain+"/filter", func() { s.reloadCollectionsLoop(cs) })
+}
+
+// reloadCollectionsLoop 定时从数据库加载已导入的collection到过滤器
+func (s *Service) reloadCollectionsLoop(cs *chainService) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(FilterReloadInterval * time.Second):
+		}
+		if err := cs.collectionFilter.PreloadCollections(); err != nil {
+			xzap.WithContext(s.ctx).Error("failed on reload collections to filter",
+				zap.String("chain", cs.chain), zap.Error(err))
+		}
+	}
+}
+
+// NewEventSink 根据配置创建市场事件总线，未配置时返回nil
+func NewEventSink(cfg config.EventSinkCfg, kvStore *xkv.Store) (eventsink.Bus, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "redis":
+		return eventsink.NewRedisBus(kvStore.Redis, cfg.MaxLen), nil
+	case "memory":
+		return eventsink.NewMemoryBus(), nil
+	default:
+		return nil, errors.Errorf("unsupported event sink type: %s", cfg.Type)
+	}
+}
+
+// Health 返回所有订单簿合约部署的同步状态
+func (s *Service) Health() []orderbookindexer.Health {
+	var healths []orderbookindexer.Health
+	for _, cs := range s.chains {
+		for _, indexer := range cs.orderbookIndexers {
+			healths = append(healths, indexer.Health())
+		}
+	}
+	return healths
+}
+
+// EndpointStats 返回每条链的节点健康状态和请求统计
+func (s *Service) EndpointStats() map[string][]chainclient.EndpointStats {
+	stats := make(map[string][]chainclient.EndpointStats)
+	for _, cs := range s.chains {
+		stats[cs.chain] = cs.chainClient.Stats()
+	}
+	return stats
+}
+
+// Backfill 并发回补订单簿事件，完成后可调用Start进入实时同步
+// chainName和dexAddress为空时要求只配置了一个合约部署
+func (s *Service) Backfill(chainName, dexAddress string, opts orderbookindexer.BackfillOptions) error {
+	var matched []*orderbookindexer.Service
+	for _, cs := range s.chains {
+		if chainName != "" && cs.chain != chainName {
+			continue
+		}
+		for _, indexer := range cs.orderbookIndexers {
+			if dexAddress != "" && !strings.EqualFold(indexer.Health().DexAddress, dexAddress) {
+				continue
+			}
+			matched = append(matched, indexer)
+		}
+	}
+	if len(matched) == 0 {
+		return errors.Errorf("no deployment matched, chain: %s, dex: %s", chainName, dexAddress)
+	}
+	if len(matched) > 1 {
+		return errors.Errorf("multiple deployments matched, chain: %s, dex: %s, use --chain and --dex to select one", chainName, dexAddress)
+	}
+	// 回补与实时同步写入同样的数据，持有租约期间其它实例不会同步
+	if err := s.acquireLeader(); err != nil {
+		return err
+	}
+	return matched[0].Backfill(opts)
+}
+
+// ImportCollection 导入collection，chainName为空时要求只配置了一条链
+func (s *Service) ImportCollection(chainName, collectionAddr string, opts collectionimporter.Options) error {
+	var matched []*chainService
+	for _, cs := range s.chains {
+		if chainName != "" && cs.chain != chainName {
+			continue
+		}
+		matched = append(matched, cs)
+	}
+	if len(matched) == 0 {
+		return errors.Errorf("no chain matched, chain: %s", chainName)
+	}
+	if len(matched) > 1 {
+		return errors.Errorf("multiple chains matched, use --chain to select one")
+	}
+	return matched[0].importer.Import(collectionAddr, opts)
 }
@@ -0,0 +1,84 @@
+package transferindexer
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+// windowHeaders 获取区间内有日志的区块和结束区块的区块头，与日志的区块hash比较，用于记录区块hash
+func (s *Service) windowHeaders(transferLogs []*nftchainservice.TransferLog, endBlock uint64) ([]*types.BlockHeader, error) {
+	logHashes := make(map[uint64]string)
+	for _, transferLog := range transferLogs {
+		if transferLog.Removed {
+			continue
+		}
+		if hash, ok := logHashes[transferLog.BlockNumber]; ok && !strings.EqualFold(hash, transferLog.BlockHash) {
+			return nil, errors.Wrapf(comm.ErrBlockHashChanged, "block: %d", transferLog.BlockNumber)
+		}
+		logHashes[transferLog.BlockNumber] = transferLog.BlockHash
+	}
+	endHeader, err := s.nodeSrv.NodeClient.BlockHeaderByNumber(s.ctx, new(big.Int).SetUint64(endBlock))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+	return s.journal.VerifyHeaders(logHashes, endHeader)
+}
+
+// rollbackTo 将item owner、持有数量和失效的挂单回滚到分叉点，删除分叉点之后的Transfer和Mint活动，
+// 并向ordermanager发送补偿事件
+func (s *Service) rollbackTo(forkBlock uint64) error {
+	var events []*ordermanager.TradeEvent
+	err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		// 倒序恢复分叉点之后的回滚日志，删除回滚日志和区块hash
+		var err error
+		events, err = s.journal.Rollback(tx, forkBlock)
+		if err != nil {
+			return err
+		}
+		// Transfer的已处理记录以collection地址为key
+		collections := tx.Table(multi.CollectionTableName(s.chain)).Select("address")
+		forkTxs := tx.Table(multi.ProcessedLogTableName(s.chain)).
+			Select("tx_hash").
+			Where("block_number > ? and contract_address in (?)", forkBlock, collections)
+		// 删除分叉点之后的Transfer和Mint活动
+		if err := tx.Table(multi.ActivityTableName(s.chain)).
+			Where("activity_type in ? and block_number > ? and tx_hash in (?)",
+				[]int{multi.Transfer, multi.Mint}, forkBlock, forkTxs).
+			Delete(&multi.Activity{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete activities")
+		}
+		// 删除分叉点之后的已处理日志，使其在新链上可以重新处理
+		if err := tx.Table(multi.ProcessedLogTableName(s.chain)).
+			Where("block_number > ? and contract_address in (?)", forkBlock, collections).
+			Delete(&multi.ProcessedLog{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete processed logs")
+		}
+		// 发送补偿事件，使ordermanager中的订单簿与回滚后的数据一致
+		for _, event := range events {
+			if err := s.addTradeEvent(tx, event); err != nil {
+				return err
+			}
+		}
+		// 重置同步进度
+		return s.updateCheckpoint(tx, forkBlock+1)
+	})
+	if err != nil {
+		return err
+	}
+
+	xzap.WithContext(s.ctx).Info("rollback transfer to fork block",
+		zap.Uint64("fork_block", forkBlock),
+		zap.Int("compensating_events", len(events)))
+	return nil
+}
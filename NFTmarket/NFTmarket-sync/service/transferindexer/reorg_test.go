@@ -0,0 +1,208 @@
+package transferindexer
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+const (
+	testChain      = "sepolia"
+	testCollection = "0xc011000000000000000000000000000000000001"
+	testAlice      = "0xa11ce00000000000000000000000000000000001"
+	testBob        = "0xb0b0000000000000000000000000000000000002"
+)
+
+// newTestService 使用订单簿回放测试的SQLite表结构创建Transfer同步服务
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "transfer.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed on open sqlite: %v", err)
+	}
+	schema, err := os.ReadFile(filepath.Join("..", "orderbookindexer", "testdata", "replay", "schema.sql"))
+	if err != nil {
+		t.Fatalf("failed on read schema: %v", err)
+	}
+	if err := db.Exec(string(schema)).Error; err != nil {
+		t.Fatalf("failed on create schema: %v", err)
+	}
+	for _, record := range []struct {
+		table string
+		value interface{}
+	}{
+		{base.IndexedStatusTableName(), &base.IndexedStatus{ChainId: 1, LastIndexedBlock: 106, IndexType: TransferIndexType}},
+		{multi.CollectionTableName(testChain), map[string]interface{}{
+			"address": testCollection, "token_standard": multi.TokenStandardERC721, "symbol": "", "name": "", "creator": "",
+		}},
+		{multi.ItemTableName(testChain), &multi.Item{CollectionAddress: testCollection, TokenId: "1", Owner: testAlice, Supply: 1}},
+		{multi.OrderTableName(testChain), &multi.Order{
+			OrderID: "0x01", CollectionAddress: testCollection, TokenId: "1", Maker: testAlice,
+			OrderType: multi.ListingOrder, OrderStatus: multi.OrderStatusActive, QuantityRemaining: 1,
+			Price: decimal.NewFromInt(100),
+		}},
+	} {
+		if err := db.Table(record.table).Create(record.value).Error; err != nil {
+			t.Fatalf("failed on create %s: %v", record.table, err)
+		}
+	}
+
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	return &Service{
+		ctx:          ctx,
+		cfg:          &config.Config{},
+		db:           db,
+		orderManager: ordermanager.New(ctx, db, nil, testChain, gdb.OrderBookDexProject),
+		journal:      comm.NewJournal(ctx, db, nil, testChain, JournalKey),
+		chainId:      1,
+		chain:        testChain,
+	}
+}
+
+// TestRollbackTransfer 分叉后的转移和mint在重组时回滚，挂单恢复有效
+func TestRollbackTransfer(t *testing.T) {
+	s := newTestService(t)
+	transfers := [][]*nftchainservice.TransferLog{
+		{{Address: testCollection, TransactionHash: "0xt1", BlockNumber: 105, From: testAlice, To: testBob, TokenID: "1"}},
+		{{Address: testCollection, TransactionHash: "0xt2", BlockNumber: 106, From: ZeroAddress, To: testBob, TokenID: "2"}},
+	}
+	for _, transfer := range transfers {
+		if err := s.handleTransfer(transfer); err != nil {
+			t.Fatalf("failed on handle transfer: %v", err)
+		}
+	}
+	var order multi.Order
+	if err := s.db.Table(multi.OrderTableName(testChain)).Where("order_id = ?", "0x01").First(&order).Error; err != nil {
+		t.Fatalf("failed on get order: %v", err)
+	}
+	if order.OrderStatus != multi.OrderStatusInactive {
+		t.Fatalf("expected listing to be inactivated by transfer, got %d", order.OrderStatus)
+	}
+
+	if err := s.rollbackTo(104); err != nil {
+		t.Fatalf("failed on rollback: %v", err)
+	}
+
+	var items []multi.Item
+	if err := s.db.Table(multi.ItemTableName(testChain)).Order("token_id").Find(&items).Error; err != nil {
+		t.Fatalf("failed on get items: %v", err)
+	}
+	if len(items) != 1 || items[0].Owner != testAlice {
+		t.Errorf("expected minted item removed and owner restored, got %+v", items)
+	}
+	if err := s.db.Table(multi.OrderTableName(testChain)).Where("order_id = ?", "0x01").First(&order).Error; err != nil {
+		t.Fatalf("failed on get order: %v", err)
+	}
+	if order.OrderStatus != multi.OrderStatusActive {
+		t.Errorf("expected listing to be active again, got %d", order.OrderStatus)
+	}
+	for table, model := range map[string]interface{}{
+		multi.ActivityTableName(testChain):       &multi.Activity{},
+		multi.ProcessedLogTableName(testChain):   &multi.ProcessedLog{},
+		multi.IndexerJournalTableName(testChain): &multi.IndexerJournal{},
+	} {
+		var count int64
+		if err := s.db.Table(table).Model(model).Count(&count).Error; err != nil {
+			t.Fatalf("failed on count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("expected %s to be cleared after rollback, got %d", table, count)
+		}
+	}
+	var status base.IndexedStatus
+	if err := s.indexStatus(s.db).First(&status).Error; err != nil {
+		t.Fatalf("failed on get index status: %v", err)
+	}
+	if status.LastIndexedBlock != 105 {
+		t.Errorf("expected checkpoint reset to 105, got %d", status.LastIndexedBlock)
+	}
+}
+
+// TestRollbackErc1155Transfer 分叉后的ERC-1155转移和mint在重组时回滚，持有数量和发行量恢复
+func TestRollbackErc1155Transfer(t *testing.T) {
+	s := newTestService(t)
+	const erc1155 = "0xc011000000000000000000000000000000000002"
+	for _, record := range []struct {
+		table string
+		value interface{}
+	}{
+		{multi.CollectionTableName(testChain), map[string]interface{}{
+			"address": erc1155, "token_standard": multi.TokenStandardERC1155, "symbol": "", "name": "", "creator": "",
+		}},
+		{multi.ItemTableName(testChain), &multi.Item{CollectionAddress: erc1155, TokenId: "7", Supply: 5}},
+		{multi.ItemHolderTableName(testChain), &multi.ItemHolder{
+			CollectionAddress: erc1155, TokenId: "7", Owner: testAlice, Balance: decimal.NewFromInt(5),
+		}},
+	} {
+		if err := s.db.Table(record.table).Create(record.value).Error; err != nil {
+			t.Fatalf("failed on create %s: %v", record.table, err)
+		}
+	}
+	transfer := func(txHash string, block uint64, from, to, tokenId string, amount int64) []*nftchainservice.TransferLog {
+		return []*nftchainservice.TransferLog{{
+			Address: erc1155, TransactionHash: txHash, BlockNumber: block, From: from, To: to, Operator: to,
+			TokenID: tokenId, Amount: big.NewInt(amount), TokenStandard: multi.TokenStandardERC1155,
+		}}
+	}
+	for _, transferLogs := range [][]*nftchainservice.TransferLog{
+		transfer("0xt1", 105, testAlice, testBob, "7", 4),
+		transfer("0xt2", 106, ZeroAddress, testBob, "7", 2),
+		transfer("0xt3", 106, ZeroAddress, testBob, "8", 1),
+	} {
+		if err := s.handleTransfer(transferLogs); err != nil {
+			t.Fatalf("failed on handle transfer: %v", err)
+		}
+	}
+
+	if err := s.rollbackTo(104); err != nil {
+		t.Fatalf("failed on rollback: %v", err)
+	}
+
+	var items []multi.Item
+	if err := s.db.Table(multi.ItemTableName(testChain)).
+		Where("collection_address = ?", erc1155).Find(&items).Error; err != nil {
+		t.Fatalf("failed on get items: %v", err)
+	}
+	if len(items) != 1 || items[0].TokenId != "7" || items[0].Supply != 5 {
+		t.Errorf("expected minted item removed and supply restored, got %+v", items)
+	}
+	var holders []multi.ItemHolder
+	if err := s.db.Table(multi.ItemHolderTableName(testChain)).Find(&holders).Error; err != nil {
+		t.Fatalf("failed on get holders: %v", err)
+	}
+	if len(holders) != 1 || holders[0].Owner != testAlice || !holders[0].Balance.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("expected holder balances restored, got %+v", holders)
+	}
+}
+
+// TestWindowHeadersMismatch 同一区块的日志hash不一致时重试区间
+func TestWindowHeadersMismatch(t *testing.T) {
+	s := &Service{}
+	logs := []*nftchainservice.TransferLog{
+		{BlockNumber: 105, BlockHash: "0x01", Amount: big.NewInt(1)},
+		{BlockNumber: 105, BlockHash: "0x02", Amount: big.NewInt(1)},
+	}
+	if _, err := s.windowHeaders(logs, 105); !errors.Is(err, comm.ErrBlockHashChanged) {
+		t.Errorf("expected block hash change, got %v", err)
+	}
+}
@@ -0,0 +1,544 @@
+package transferindexer
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/eventsink"
+	"github.com/ProjectsTask/EasySwapBase/kit/lifecycle"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/orderbookindexer"
+)
+
+const (
+	TransferIndexType = base.TypeNftTransferIndex
+	SleepInterval     = 10 // in seconds
+	SyncBlockPeriod   = 10
+	ZeroAddress       = "0x0000000000000000000000000000000000000000"
+	IndexerLabel      = "transfer" // 监控指标中的indexer标签
+	JournalKey        = "transfer" // 区块hash和回滚日志的key，与订单簿合约的记录区分
+)
+
+// Service 同步ERC-721 Transfer和ERC-1155 TransferSingle、TransferBatch事件，维护item owner和持有数量并使无法成交的挂单失效
+type Service struct {
+	ctx              context.Context
+	cfg              *config.Config
+	db               *gorm.DB
+	nodeSrv          *nftchainservice.Service
+	collectionFilter *collectionfilter.Filter
+	orderManager     *ordermanager.OrderManager
+	eventSink        eventsink.Sink
+	leader           *xkv.Leader      // leader选举，为nil时未启用
+	loops            *lifecycle.Group // 后台协程及其运行状态
+	journal          *comm.Journal    // 区块hash和回滚日志，以JournalKey为key
+	chainId          int64
+	chain            string
+
+	headBlock   atomic.Uint64 // 节点返回的最新区块
+	syncedBlock atomic.Uint64 // 最后同步完成的区块
+}
+
+func New(ctx context.Context, cfg *config.Config, db *gorm.DB, nodeSrv *nftchainservice.Service, collectionFilter *collectionfilter.Filter, chainId int64, chain string, orderManager *ordermanager.OrderManager, eventSink eventsink.Sink, leader *xkv.Leader) *Service {
+	return &Service{
+		ctx:              ctx,
+		cfg:              cfg,
+		db:               db,
+		nodeSrv:          nodeSrv,
+		collectionFilter: collectionFilter,
+		orderManager:     orderManager,
+		eventSink:        eventSink,
+		leader:           leader,
+		loops:            lifecycle.NewGroup(),
+		journal:          comm.NewJournal(ctx, db, nodeSrv.NodeClient, chain, JournalKey),
+		chainId:          chainId,
+		chain:            chain,
+	}
+}
+
+func (s *Service) Start() {
+	// 同步Transfer事件
+	s.loops.Go("sync", s.SyncTransferEventLoop)
+}
+
+// Wait 等待后台协程在ctx取消后退出
+func (s *Service) Wait(ctx context.Context) error {
+	return s.loops.Wait(ctx)
+}
+
+// Status 返回每个后台协程的运行状态
+func (s *Service) Status() map[string]lifecycle.State {
+	return s.loops.Status()
+}
+
+// SyncProgress 返回节点最新区块和最后同步完成的区块，head为0表示尚未获取到最新区块
+func (s *Service) SyncProgress() (head, synced uint64) {
+	return s.headBlock.Load(), s.syncedBlock.Load()
+}
+
+// recordProgress 记录同步进度并上报监控指标
+func (s *Service) recordProgress(head, synced uint64) {
+	s.headBlock.Store(head)
+	s.syncedBlock.Store(synced)
+	comm.ObserveSync(s.chain, IndexerLabel, head, synced)
+}
+
+// 同步Transfer事件
+func (s *Service) SyncTransferEventLoop() {
+	// 读取同步进度，失败时重试
+	var lastSyncBlock uint64
+	for {
+		checkpoint, err := s.loadLastSyncBlock()
+		if err == nil {
+			lastSyncBlock = checkpoint
+			break
+		}
+		xzap.WithContext(s.ctx).Error("failed on get transfer index status", zap.Error(err))
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(SleepInterval * time.Second):
+		}
+	}
+	if lastSyncBlock > 0 {
+		s.recordProgress(0, lastSyncBlock-1)
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			xzap.WithContext(s.ctx).Info("SyncTransferEventLoop stopped due to context cancellation")
+			return
+		default:
+		}
+		next, idle, err := s.syncOnce(lastSyncBlock)
+		if errors.Is(err, comm.ErrBlockHashChanged) {
+			xzap.WithContext(s.ctx).Warn("block hash changed while syncing, retry",
+				zap.Uint64("start_block", lastSyncBlock), zap.Error(err))
+			s.sleep(SleepInterval * time.Second)
+			continue
+		}
+		if err != nil {
+			xzap.WithContext(s.ctx).Error("failed on sync transfer event",
+				zap.Uint64("start_block", lastSyncBlock), zap.Error(err))
+			s.sleep(SleepInterval * time.Second)
+			continue
+		}
+		if idle {
+			s.sleep(SleepInterval * time.Second)
+			continue
+		}
+		lastSyncBlock = next
+	}
+}
+
+// syncOnce 从lastSyncBlock开始同步一个区间，返回下一个待同步的区块
+// 已同步到最新区块时返回idle为true；检测到链重组时回滚并返回分叉点的下一个区块
+func (s *Service) syncOnce(lastSyncBlock uint64) (uint64, bool, error) {
+	// 获取当前区块高度
+	currentBlockNum, err := s.nodeSrv.NodeClient.BlockNumber()
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get current block number")
+	}
+	s.recordProgress(currentBlockNum, s.syncedBlock.Load())
+	safeBlockNum := currentBlockNum - orderbookindexer.MultiChainMaxBlockDifference[s.chain]
+	if lastSyncBlock > safeBlockNum {
+		return lastSyncBlock, true, nil
+	}
+	startBlock := lastSyncBlock
+	endBlock := startBlock + SyncBlockPeriod
+	if endBlock > safeBlockNum {
+		endBlock = safeBlockNum
+	}
+	// 检测链重组，发生重组时回滚到分叉点后重新同步
+	forkBlock, reorged, err := s.journal.DetectReorg(startBlock)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on detect chain reorg")
+	}
+	if reorged {
+		if err := s.rollbackTo(forkBlock); err != nil {
+			return 0, false, errors.Wrapf(err, "failed on rollback chain reorg, fork_block: %d", forkBlock)
+		}
+		return forkBlock + 1, false, nil
+	}
+	// 查询Transfer事件
+	transferLogs, err := s.nodeSrv.GetNFTTransferEvent(startBlock, endBlock)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get transfer event")
+	}
+	// 获取结束区块头和有日志的区块头，校验日志与区块头属于同一条链
+	headers, err := s.windowHeaders(transferLogs, endBlock)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := s.handleTransferLogs(transferLogs); err != nil {
+		return 0, false, errors.Wrapf(err, "failed on handle transfer event, start_block: %d, end_block: %d", startBlock, endBlock)
+	}
+	// 记录区块hash并更新最后同步的区块高度
+	if err := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.journal.RecordBlocks(tx, headers); err != nil {
+			return err
+		}
+		return s.updateCheckpoint(tx, endBlock+1)
+	}); err != nil {
+		return 0, false, errors.Wrap(err, "failed on update transfer event sync block number")
+	}
+	s.recordProgress(currentBlockNum, endBlock)
+	xzap.WithContext(s.ctx).Info("sync transfer event ...",
+		zap.Uint64("start_block", startBlock),
+		zap.Uint64("end_block", endBlock))
+	return endBlock + 1, false, nil
+}
+
+// sleep 等待指定时间，ctx取消时立即返回
+func (s *Service) sleep(d time.Duration) {
+	select {
+	case <-s.ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// loadLastSyncBlock 读取同步进度，首次启动时从当前区块开始同步
+func (s *Service) loadLastSyncBlock() (uint64, error) {
+	var indexedStatus base.IndexedStatus
+	err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, TransferIndexType).
+		First(&indexedStatus).Error
+	if err == nil {
+		return uint64(indexedStatus.LastIndexedBlock), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.Wrap(err, "failed on get transfer index status")
+	}
+
+	currentBlockNum, err := s.nodeSrv.NodeClient.BlockNumber()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get current block number")
+	}
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).Create(&base.IndexedStatus{
+		ChainId:          int(s.chainId),
+		LastIndexedBlock: int64(currentBlockNum),
+		IndexType:        TransferIndexType,
+	}).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on create transfer index status")
+	}
+	return currentBlockNum, nil
+}
+
+// indexStatus Transfer事件同步进度的查询
+func (s *Service) indexStatus(tx *gorm.DB) *gorm.DB {
+	return tx.Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, TransferIndexType)
+}
+
+// updateCheckpoint 更新Transfer事件同步进度，启用leader选举时先检查fencing token
+func (s *Service) updateCheckpoint(tx *gorm.DB, blockNumber uint64) error {
+	token := s.leader.Token()
+	if err := comm.CheckLeaderToken(s.indexStatus(tx), token); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"last_indexed_block": blockNumber}
+	if token > 0 {
+		updates["leader_token"] = token
+	}
+	if err := s.indexStatus(tx).Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update transfer event sync block number")
+	}
+	if blockNumber <= comm.MaxReorgDepth {
+		return nil
+	}
+	// 清理超过重组深度的Transfer已处理记录，订单簿合约的记录由订单簿索引器清理
+	if err := tx.Table(multi.ProcessedLogTableName(s.chain)).
+		Where("block_number < ? and contract_address in (?)", blockNumber-comm.MaxReorgDepth,
+			tx.Table(multi.CollectionTableName(s.chain)).Select("address")).
+		Delete(&multi.ProcessedLog{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete expired processed logs")
+	}
+	return nil
+}
+
+// handleTransferLogs 按顺序处理已追踪collection的Transfer事件
+// 同一条TransferBatch日志拆分出的事件(tx_hash, log_index)相同，在同一个事务中处理
+func (s *Service) handleTransferLogs(transferLogs []*nftchainservice.TransferLog) error {
+	for _, group := range groupTransferLogs(transferLogs) {
+		transferLog := group[0]
+		if transferLog.Removed || !s.collectionFilter.Contains(transferLog.Address) {
+			continue
+		}
+		// 挂单存入和取回金库的转移由订单簿事件处理
+		if s.isVault(transferLog.From) || s.isVault(transferLog.To) {
+			continue
+		}
+		err := s.handleTransfer(group)
+		comm.ObserveEvent(s.chain, IndexerLabel, "transfer", err)
+		if err != nil {
+			return errors.Wrapf(err, "failed on handle transfer, tx_hash: %s, log_index: %d",
+				transferLog.TransactionHash, transferLog.Index)
+		}
+	}
+	return nil
+}
+
+// groupTransferLogs 将相邻且(tx_hash, log_index)相同的事件分为一组
+func groupTransferLogs(transferLogs []*nftchainservice.TransferLog) [][]*nftchainservice.TransferLog {
+	var groups [][]*nftchainservice.TransferLog
+	for _, transferLog := range transferLogs {
+		if n := len(groups); n > 0 {
+			last := groups[n-1][0]
+			if last.TransactionHash == transferLog.TransactionHash && last.Index == transferLog.Index {
+				groups[n-1] = append(groups[n-1], transferLog)
+				continue
+			}
+		}
+		groups = append(groups, []*nftchainservice.TransferLog{transferLog})
+	}
+	return groups
+}
+
+// handleTransfer 处理同一条日志中的转移事件，更新item owner或ERC-1155持有数量、记录活动并使无法成交的挂单失效
+func (s *Service) handleTransfer(transferLogs []*nftchainservice.TransferLog) error {
+	return s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		// 已失去leader身份时不再写入
+		if err := comm.CheckLeaderToken(s.indexStatus(tx), s.leader.Token()); err != nil {
+			return err
+		}
+		// 以(tx_hash, log_index)去重
+		result := tx.Table(multi.ProcessedLogTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&multi.ProcessedLog{
+			ContractAddress: strings.ToLower(transferLogs[0].Address),
+			TxHash:          transferLogs[0].TransactionHash,
+			LogIndex:        int64(transferLogs[0].Index),
+			BlockNumber:     int64(transferLogs[0].BlockNumber),
+		})
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create processed log")
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		for _, transferLog := range transferLogs {
+			var err error
+			if transferLog.TokenStandard == multi.TokenStandardERC1155 {
+				err = s.applyErc1155Transfer(tx, transferLog)
+			} else {
+				err = s.applyErc721Transfer(tx, transferLog)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyErc721Transfer 更新item owner，mint时创建item，旧owner的挂单已无法成交
+func (s *Service) applyErc721Transfer(tx *gorm.DB, transferLog *nftchainservice.TransferLog) error {
+	collection := strings.ToLower(transferLog.Address)
+	isMint := transferLog.From == ZeroAddress
+	item := multi.Item{
+		ChainId:           int(s.chainId),
+		CollectionAddress: collection,
+		TokenId:           transferLog.TokenID,
+		Owner:             strings.ToLower(transferLog.To),
+		Supply:            1,
+	}
+	if isMint {
+		item.Creator = strings.ToLower(transferLog.To)
+	}
+	// 记录item owner回滚日志，mint创建的item回滚时删除
+	if err := s.journal.ItemUpsert(tx, transferLog.BlockNumber, transferLog.TransactionHash, collection, transferLog.TokenID); err != nil {
+		return err
+	}
+	if err := tx.Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "update_time"}),
+	}).Create(&item).Error; err != nil {
+		return errors.Wrap(err, "failed on update item owner")
+	}
+	if err := s.addTransferActivity(tx, transferLog); err != nil {
+		return err
+	}
+	if isMint {
+		return nil
+	}
+	// 旧owner的挂单已无法成交，记录回滚日志使重组时恢复
+	orderIds, err := s.orderManager.InactivateMakerListings(tx, collection, transferLog.TokenID, transferLog.From)
+	if err != nil {
+		return err
+	}
+	if err := s.journal.OrdersInactivated(tx, transferLog.BlockNumber, transferLog.TransactionHash, orderIds); err != nil {
+		return err
+	}
+	return s.addTransferTradeEvent(tx, transferLog)
+}
+
+// applyErc1155Transfer 调整转出方和转入方的持有数量，mint和burn时同步item的发行量
+// 订单簿合约只支持ERC-721挂单，ERC-1155的转移不影响订单和地板价
+func (s *Service) applyErc1155Transfer(tx *gorm.DB, transferLog *nftchainservice.TransferLog) error {
+	collection := strings.ToLower(transferLog.Address)
+	isMint := transferLog.From == ZeroAddress
+	isBurn := transferLog.To == ZeroAddress
+	amount := decimal.NewFromBigInt(transferLog.Amount, 0)
+
+	// 创建item，mint和burn时更新发行量
+	supply := decimal.Zero
+	if isMint {
+		supply = amount
+	} else if isBurn {
+		supply = amount.Neg()
+	}
+	item := multi.Item{
+		ChainId:           int(s.chainId),
+		CollectionAddress: collection,
+		TokenId:           transferLog.TokenID,
+		Supply:            decimal.Max(supply, decimal.Zero).IntPart(),
+	}
+	if isMint {
+		item.Creator = strings.ToLower(transferLog.Operator)
+	}
+	// 记录发行量回滚日志，mint创建的item回滚时删除
+	if err := s.journal.ItemSupply(tx, transferLog.BlockNumber, transferLog.TransactionHash, collection, transferLog.TokenID); err != nil {
+		return err
+	}
+	if err := tx.Table(multi.ItemTableName(s.chain)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"supply":      gorm.Expr("supply + ?", supply.IntPart()),
+			"update_time": time.Now().UnixMilli(),
+		}),
+	}).Create(&item).Error; err != nil {
+		return errors.Wrap(err, "failed on update item supply")
+	}
+
+	// 调整持有数量前记录回滚日志
+	if !isMint {
+		if err := s.journal.HolderBalance(tx, transferLog.BlockNumber, transferLog.TransactionHash, collection, transferLog.TokenID, transferLog.From); err != nil {
+			return err
+		}
+		if _, _, err := comm.AdjustHolderBalance(tx, s.chain, collection, transferLog.TokenID, transferLog.From, amount.Neg()); err != nil {
+			return err
+		}
+	}
+	if !isBurn {
+		if err := s.journal.HolderBalance(tx, transferLog.BlockNumber, transferLog.TransactionHash, collection, transferLog.TokenID, transferLog.To); err != nil {
+			return err
+		}
+		if _, _, err := comm.AdjustHolderBalance(tx, s.chain, collection, transferLog.TokenID, transferLog.To, amount); err != nil {
+			return err
+		}
+	}
+	return s.addTransferActivity(tx, transferLog)
+}
+
+// addTransferActivity 记录Transfer或Mint活动并发布所有权变更事件
+func (s *Service) addTransferActivity(tx *gorm.DB, transferLog *nftchainservice.TransferLog) error {
+	activityType := multi.Transfer
+	if transferLog.From == ZeroAddress {
+		activityType = multi.Mint
+	}
+	if err := tx.Table(multi.ActivityTableName(s.chain)).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(&multi.Activity{
+		ActivityType:      activityType,
+		Maker:             transferLog.From,
+		Taker:             transferLog.To,
+		MarketplaceID:     multi.MarketOrderBook,
+		CollectionAddress: strings.ToLower(transferLog.Address),
+		TokenId:           transferLog.TokenID,
+		CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
+		Price:             decimal.Zero,
+		BlockNumber:       int64(transferLog.BlockNumber),
+		TxHash:            transferLog.TransactionHash,
+		EventTime:         int64(transferLog.BlockTime),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on create activity")
+	}
+	// 发布市场事件
+	return s.addOwnershipChanged(tx, transferLog)
+}
+
+// addTransferTradeEvent 通过发件箱通知ordermanager移除旧owner的挂单并加入新owner的有效挂单
+func (s *Service) addTransferTradeEvent(tx *gorm.DB, transferLog *nftchainservice.TransferLog) error {
+	return s.addTradeEvent(tx, &ordermanager.TradeEvent{
+		EventType:      ordermanager.Transfer,
+		CollectionAddr: strings.ToLower(transferLog.Address),
+		TokenID:        transferLog.TokenID,
+		From:           transferLog.From,
+		To:             transferLog.To,
+		BlockTime:      int64(transferLog.BlockTime),
+	})
+}
+
+// addTradeEvent 通过发件箱向ordermanager发送事件
+func (s *Service) addTradeEvent(tx *gorm.DB, event *ordermanager.TradeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal trade event")
+	}
+	if err := tx.Table(multi.OutboxTableName(s.chain)).Create(&multi.Outbox{
+		MessageType: multi.OutboxTradeEvent,
+		Payload:     string(payload),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on create outbox message")
+	}
+	return nil
+}
+
+// addOwnershipChanged 通过发件箱发布所有权变更事件，未配置事件发布时忽略
+func (s *Service) addOwnershipChanged(tx *gorm.DB, transferLog *nftchainservice.TransferLog) error {
+	if s.eventSink == nil {
+		return nil
+	}
+	collection := strings.ToLower(transferLog.Address)
+	var quantity int64
+	if transferLog.TokenStandard == multi.TokenStandardERC1155 {
+		quantity = transferLog.Amount.Int64()
+	}
+	payload, err := json.Marshal(&eventsink.Event{
+		Version:           eventsink.Version,
+		Type:              eventsink.OwnershipChanged,
+		ChainId:           s.chainId,
+		Chain:             s.chain,
+		ContractAddress:   collection,
+		BlockNumber:       transferLog.BlockNumber,
+		BlockTime:         int64(transferLog.BlockTime),
+		TxHash:            transferLog.TransactionHash,
+		LogIndex:          transferLog.Index,
+		CollectionAddress: collection,
+		TokenId:           transferLog.TokenID,
+		From:              strings.ToLower(transferLog.From),
+		To:                strings.ToLower(transferLog.To),
+		Quantity:          quantity,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal market event")
+	}
+	if err := tx.Table(multi.OutboxTableName(s.chain)).Create(&multi.Outbox{
+		MessageType: multi.OutboxMarketEvent,
+		Payload:     string(payload),
+	}).Error; err != nil {
+		return errors.Wrap(err, "failed on create outbox message")
+	}
+	return nil
+}
+
+// isVault 判断地址是否为订单簿金库合约
+func (s *Service) isVault(address string) bool {
+	return s.cfg.ContractCfg.VaultAddress != "" && strings.EqualFold(address, s.cfg.ContractCfg.VaultAddress)
+}
@@ -0,0 +1,40 @@
+package transferindexer
+
+import (
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func TestIsVault(t *testing.T) {
+	s := &Service{cfg: &config.Config{}}
+	if s.isVault("0x0000000000000000000000000000000000000001") {
+		t.Errorf("expected no vault when vault address is not configured")
+	}
+
+	s.cfg.ContractCfg.VaultAddress = "0xAbCdEf0000000000000000000000000000000001"
+	if !s.isVault("0xabcdef0000000000000000000000000000000001") {
+		t.Errorf("expected vault address to match case-insensitively")
+	}
+}
+
+func TestGroupTransferLogs(t *testing.T) {
+	logs := []*nftchainservice.TransferLog{
+		{TransactionHash: "0x1", Index: 0, TokenID: "1"},
+		{TransactionHash: "0x1", Index: 1, TokenID: "2"},
+		{TransactionHash: "0x1", Index: 1, TokenID: "3"},
+		{TransactionHash: "0x2", Index: 1, TokenID: "4"},
+	}
+	groups := groupTransferLogs(logs)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	if len(groups[1]) != 2 || groups[1][0].TokenID != "2" || groups[1][1].TokenID != "3" {
+		t.Errorf("expected batch transfer logs to be grouped in order, got %+v", groups[1])
+	}
+	if len(groups[2]) != 1 || groups[2][0].TokenID != "4" {
+		t.Errorf("expected logs in different transactions not to be grouped")
+	}
+}